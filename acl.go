@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ACLActionはACLのルールに一致したパケットの扱いを表す。
+type ACLAction int
+
+const (
+	ACLAllow ACLAction = iota // 通す
+	ACLDeny                   // 破棄する
+)
+
+// ACLRuleはACLの1行分の条件と動作を表す。ゼロ値の条件は全てに一致する。
+type ACLRule struct {
+	Action   ACLAction  // 一致したときの動作
+	Src      *net.IPNet // 送信元IPの範囲（nilなら任意）
+	Dst      *net.IPNet // 宛先IPの範囲（nilなら任意）
+	Protocol Protocol   // プロトコル（空なら任意）
+	SrcPort  int        // 送信元ポート（0なら任意）
+	DstPort  int        // 宛先ポート（0なら任意）
+}
+
+// matchesはパケットがルールの条件を全て満たすかどうかを返す。
+func (r ACLRule) matches(p Packet) bool {
+	if r.Src != nil && !r.Src.Contains(net.ParseIP(p.SrcIP)) {
+		return false
+	}
+	if r.Dst != nil && !r.Dst.Contains(net.ParseIP(p.DstIP)) {
+		return false
+	}
+	if r.Protocol != "" && r.Protocol != p.Proto() {
+		return false
+	}
+	if r.SrcPort != 0 && r.SrcPort != p.SrcPort {
+		return false
+	}
+	return r.DstPort == 0 || r.DstPort == p.DstPort
+}
+
+// ACLは上から順に評価するルールの一覧を表す。最初に一致したルールの動作を使い、
+// どのルールにも一致しなければDefaultの動作を使う。ARPパケットは対象外。
+type ACL struct {
+	Rules   []ACLRule // 評価順のルール
+	Default ACLAction // どのルールにも一致しないときの動作
+}
+
+// AddRuleは送信元と宛先をCIDRまたはIPアドレス（空なら任意）で指定したルールを末尾に追加。
+func (acl *ACL) AddRule(action ACLAction, src, dst string, proto Protocol, srcPort, dstPort int) error {
+	srcNet, err := parseACLNet(src)
+	if err != nil {
+		return err
+	}
+	dstNet, err := parseACLNet(dst)
+	if err != nil {
+		return err
+	}
+	acl.Rules = append(acl.Rules, ACLRule{Action: action, Src: srcNet, Dst: dstNet, Protocol: proto, SrcPort: srcPort, DstPort: dstPort})
+	return nil
+}
+
+// parseACLNetはCIDRかIPアドレスを範囲に変換する（空ならnil）。
+func parseACLNet(s string) (*net.IPNet, error) {
+	if s == "" {
+		return nil, nil
+	}
+	if !strings.Contains(s, "/") {
+		if net.ParseIP(s) == nil {
+			return nil, fmt.Errorf("不正なACLのアドレス %q", s)
+		}
+		ipnet := hostNet(s)
+		return &ipnet, nil
+	}
+	_, ipnet, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, fmt.Errorf("不正なACLのアドレス %q: %w", s, err)
+	}
+	return ipnet, nil
+}
+
+// Evaluateはパケットに適用される動作と、一致したルールの番号（0始まり、既定の動作なら-1）を返す。
+func (acl *ACL) Evaluate(p Packet) (ACLAction, int) {
+	for i, r := range acl.Rules {
+		if r.matches(p) {
+			return r.Action, i
+		}
+	}
+	return acl.Default, -1
+}
+
+// permitsはACLがパケットを通すかどうかを返し、破棄する場合はログに記録する。aclがnilなら全て通す。
+// formatとargsはログに出す適用箇所の説明。
+func (acl *ACL) permits(n *Network, p Packet, format string, args ...any) bool {
+	if acl == nil || p.ARP != nil {
+		return true
+	}
+	action, rule := acl.Evaluate(p)
+	if action == ACLAllow {
+		return true
+	}
+	where := fmt.Sprintf(format, args...)
+	if rule < 0 {
+		n.log().Warnf("[ACL] %s: 既定のポリシーにより破棄: %s", where, p)
+	} else {
+		n.log().Warnf("[ACL] %s: ルール %d により破棄: %s", where, rule, p)
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestACLEvaluateFirstMatchWins(t *testing.T) {
+	acl := &ACL{Default: ACLDeny}
+	for _, r := range []struct {
+		action   ACLAction
+		src, dst string
+		proto    Protocol
+		dstPort  int
+	}{
+		{ACLDeny, "10.0.0.1", "", "", 23},
+		{ACLAllow, "10.0.0.0/24", "", ProtocolUDP, 0},
+		{ACLDeny, "", "", ProtocolUDP, 0}, // 前のルールに一致したパケットには適用しない
+	} {
+		if err := acl.AddRule(r.action, r.src, r.dst, r.proto, 0, r.dstPort); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name   string
+		p      Packet
+		action ACLAction
+		rule   int
+	}{
+		{"最初のルール", Packet{SrcIP: "10.0.0.1", DstIP: "10.0.1.1", Protocol: ProtocolUDP, DstPort: 23}, ACLDeny, 0},
+		{"2番目のルール", Packet{SrcIP: "10.0.0.1", DstIP: "10.0.1.1", Protocol: ProtocolUDP, DstPort: 53}, ACLAllow, 1},
+		{"3番目のルール", Packet{SrcIP: "10.0.9.1", DstIP: "10.0.1.1", Protocol: ProtocolUDP}, ACLDeny, 2},
+		{"既定の動作", Packet{SrcIP: "10.0.9.1", DstIP: "10.0.1.1", Protocol: ProtocolTCP}, ACLDeny, -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if action, rule := acl.Evaluate(tt.p); action != tt.action || rule != tt.rule {
+				t.Errorf("Evaluate = %v, %d, 期待値 %v, %d", action, rule, tt.action, tt.rule)
+			}
+		})
+	}
+	if err := acl.AddRule(ACLAllow, "10.0.0.300", "", "", 0, 0); err == nil {
+		t.Error("不正なアドレスでエラーにならない")
+	}
+}
+
+func TestSwitchPortACL(t *testing.T) {
+	n, a, b, c, s := newTestLAN3(t)
+	acl := &ACL{Default: ACLAllow}
+	if err := acl.AddRule(ACLDeny, "10.0.0.1", "10.0.0.2", "", 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	s.PortTo(a).InACL = acl
+	atB, atC := recordArrivals(n, b), recordArrivals(n, c)
+	a.SendPacket(lanPacket(a, b, "blocked"))
+	a.SendPacket(lanPacket(a, c, "allowed"))
+	n.Bus.Run()
+	if len(atB.packets) != 0 || len(atC.packets) != 1 {
+		t.Errorf("届いたパケット B = %d, C = %d, 期待値 0, 1", len(atB.packets), len(atC.packets))
+	}
+	if s.Stats.Dropped[DropACL] != 1 {
+		t.Errorf("ACLによる破棄 = %d, 期待値 1", s.Stats.Dropped[DropACL])
+	}
+}
+
+func TestRouterInterfaceACL(t *testing.T) {
+	n, a, b, r := newTestRoutedNet(t)
+	c := newTestHost("C", "AA:AA:AA:AA:AA:03", "198.51.100.1")
+	c.networkLayer().SubnetMask, c.networkLayer().Gateway = "255.255.255.0", "198.51.100.254"
+	n.AddDevice(c)
+	rc, _ := n.AddBidirectionalLink(r, c, time.Millisecond)
+	if _, err := r.AddInterface("198.51.100.254/24", "RR:RR:RR:RR:RR:03", rc); err != nil {
+		t.Fatal(err)
+	}
+	inACL := &ACL{Default: ACLAllow}
+	inACL.AddRule(ACLDeny, "10.0.0.1", "203.0.113.1", "", 0, 0)
+	r.Interfaces[0].InACL = inACL
+	outACL := &ACL{Default: ACLDeny} // Cへは既定で破棄し、UDPの53番だけ通す
+	outACL.AddRule(ACLAllow, "", "", ProtocolUDP, 0, 53)
+	r.Interfaces[2].OutACL = outACL
+	atB, atC := recordArrivals(n, b), recordArrivals(n, c)
+
+	a.Send("203.0.113.1", []byte("to b"))
+	a.SendPacket(Packet{DstIP: "198.51.100.1", Protocol: ProtocolUDP, DstPort: 53, Data: []byte("dns")})
+	a.SendPacket(Packet{DstIP: "198.51.100.1", Protocol: ProtocolUDP, DstPort: 80, Data: []byte("web")})
+	n.Bus.Run()
+	if len(atB.packets) != 0 {
+		t.Errorf("Bに届いたパケット = %d, 期待値 0", len(atB.packets))
+	}
+	if len(atC.packets) != 1 || string(atC.packets[0].Data) != "dns" {
+		t.Errorf("Cに届いたパケット = %v, 期待値はUDPの53番宛てだけ", atC.packets)
+	}
+	if r.Stats.Dropped[DropACL] != 2 {
+		t.Errorf("ACLによる破棄 = %d, 期待値 2", r.Stats.Dropped[DropACL])
+	}
+}
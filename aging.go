@@ -0,0 +1,38 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// StartAgingはinterval毎（0以下ならAgeTime毎）にMACテーブルを調べ、有効期間を過ぎたエントリを
+// 削除するようにする。lookupMACは参照したエントリしか削除しないため、長いシミュレーションで
+// 通信の途絶えたデバイスのエントリがテーブルに残り続けるのを防ぐ。AgeTimeが0なら何も削除せず、
+// intervalとAgeTimeがどちらも0なら掃除を追加しない。
+// 掃除は止めるまで続くため、RunUntilで進めるか、返したハンドルをCancelで止める。
+func (s *Switch) StartAging(interval time.Duration) EventHandle {
+	if interval <= 0 {
+		interval = s.AgeTime
+	}
+	return s.Network.Bus.AddPeriodic(interval, func() { s.sweepMACTable() })
+}
+
+// sweepMACTableは有効期間を過ぎたMACテーブルのエントリをMACアドレス順に削除し、削除した数を返す。
+func (s *Switch) sweepMACTable() int {
+	if s.AgeTime <= 0 {
+		return 0
+	}
+	now := s.Network.Bus.Now()
+	var expired []string
+	for mac, entry := range s.MACTable {
+		if now.Sub(entry.LearnedAt) > s.AgeTime {
+			expired = append(expired, mac)
+		}
+	}
+	sort.Strings(expired)
+	for _, mac := range expired {
+		s.Network.log().Infof("[Switch] %s: 有効期間を過ぎたMACテーブルのエントリを削除 %s (ポート %d)", s.Name, mac, s.MACTable[mac].Port.Number)
+		delete(s.MACTable, mac)
+	}
+	return len(expired)
+}
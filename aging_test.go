@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSwitchStartAging(t *testing.T) {
+	n, a, b, c, s := newTestLAN3(t)
+	skipAnnounce(a, b, c)
+	s.AgeTime = 10 * time.Second
+	macB := b.dataLinkLayer().MAC
+	b.SendPacket(lanPacket(b, a, "learn"))
+	h := s.StartAging(time.Second)
+	defer n.Bus.Cancel(h)
+
+	runFor(t, n, 5*time.Second)
+	if _, ok := s.MACTable[macB]; !ok {
+		t.Fatal("有効期間内にBのエントリが削除された")
+	}
+	// 参照されなくても掃除でエントリが消える
+	runFor(t, n, 7*time.Second)
+	if _, ok := s.MACTable[macB]; ok {
+		t.Fatal("有効期間を過ぎてもBのエントリが残っている")
+	}
+
+	gotB, received := record(b), c.Stats.Received
+	a.SendPacket(lanPacket(a, b, "hello"))
+	runFor(t, n, time.Second)
+	if got := c.Stats.Received - received; got != 1 {
+		t.Errorf("Cに届いたフレーム = %d, 期待値 1（フラッディング）", got)
+	}
+	if len(gotB.in) != 1 {
+		t.Errorf("Bが受信したパケット = %d, 期待値 1", len(gotB.in))
+	}
+}
+
+func TestSwitchStartAgingCancel(t *testing.T) {
+	n, a, b, c, s := newTestLAN3(t)
+	skipAnnounce(a, b, c)
+	s.AgeTime = 10 * time.Second
+	b.SendPacket(lanPacket(b, a, "learn"))
+	n.Bus.Cancel(s.StartAging(time.Second))
+	runFor(t, n, time.Minute)
+	if _, ok := s.MACTable[b.dataLinkLayer().MAC]; !ok {
+		t.Error("掃除を止めたのにエントリが削除された")
+	}
+}
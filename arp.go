@@ -0,0 +1,220 @@
+package main
+
+import (
+	"net"
+)
+
+// BroadcastMACは全デバイス宛てのブロードキャストMACアドレス。
+const BroadcastMAC = "FF:FF:FF:FF:FF:FF"
+
+// ARPOpはARPメッセージの種類を表す。
+type ARPOp int
+
+const (
+	ARPRequest ARPOp = iota + 1 // IPアドレスに対応するMACアドレスの問い合わせ
+	ARPReply                    // 問い合わせへの応答
+)
+
+// ARPMessageはARPの要求/応答の内容を表す。
+type ARPMessage struct {
+	Op        ARPOp  // 要求か応答か
+	SenderIP  string // 送信者のIPアドレス
+	SenderMAC string // 送信者のMACアドレス
+	TargetIP  string // 解決したいIPアドレス
+}
+
+// networkLayerはホストのレイヤースタックからネットワーク層を返す。
+func (h *Host) networkLayer() *NetworkLayer {
+	for _, layer := range h.Layers {
+		if nl, ok := layer.(*NetworkLayer); ok {
+			return nl
+		}
+	}
+	return nil
+}
+
+// dataLinkLayerはホストのレイヤースタックからデータリンク層を返す。
+func (h *Host) dataLinkLayer() *DataLinkLayer {
+	for _, layer := range h.Layers {
+		if dl, ok := layer.(*DataLinkLayer); ok {
+			return dl
+		}
+	}
+	return nil
+}
+
+// learnARPはIPアドレスとMACアドレスの対応をARPテーブルに登録。
+func (nl *NetworkLayer) learnARP(ip, mac string) {
+	if nl.ARPTable == nil {
+		nl.ARPTable = make(map[string]string)
+	}
+	nl.ARPTable[ip] = mac
+}
+
+// nextHopは宛先IPへ送るときにMACアドレスを解決すべきIPを返す。
+// 宛先が自分のサブネット内ならその宛先、サブネット外でゲートウェイがあればゲートウェイを返す。
+func (nl *NetworkLayer) nextHop(dst string) string {
+	if nl.Gateway == "" || nl.onLink(dst) {
+		return dst
+	}
+	return nl.Gateway
+}
+
+// resolveARPはパケットを次ホップのARP解決待ちにし、送信元IPのインターフェースからARP要求をブロードキャスト。
+// 解決待ちの間に追加のパケットが来た場合も、要求が失われた可能性があるため再度問い合わせる。
+func (h *Host) resolveARP(p Packet) {
+	nic := h.nicWithIP(p.SrcIP)
+	nl, dl := nic.Network, nic.DataLink
+	if nl == nil || dl == nil {
+		h.Network.log().Warnf("[ARP] %s: ネットワーク層またはデータリンク層がないためARP解決できません", h.Name)
+		return
+	}
+	if h.pendingARP == nil {
+		h.pendingARP = make(map[string][]Packet)
+	}
+	hop := nl.nextHop(p.DstIP)
+	waiting := len(h.pendingARP[hop]) > 0
+	h.pendingARP[hop] = append(h.pendingARP[hop], p.Clone()) // 解決を待つ間に送信元がデータやMetaを書き換えても影響しない
+	if waiting {
+		h.Network.log().Debugf("[ARP] %s: %s の解決待ちにパケットを追加し、再度問い合わせ", h.Name, hop)
+	} else {
+		h.Network.log().Debugf("[ARP] %s: %s のMACアドレスを問い合わせ", h.Name, hop)
+	}
+	h.transmit(Packet{
+		SrcIP:    nl.IP,
+		DstIP:    hop,
+		SrcMAC:   dl.MAC,
+		DstMAC:   BroadcastMAC,
+		TTL:      1,
+		Protocol: ProtocolARP,
+		ARP:      &ARPMessage{Op: ARPRequest, SenderIP: nl.IP, SenderMAC: dl.MAC, TargetIP: hop},
+	})
+}
+
+// handleARPは受信したARP要求に応答し、ARP応答の内容をキャッシュして待機中のパケットを送信。
+// 要求は問い合わせ対象のIPを持つインターフェースで、応答は宛先MACを持つインターフェースで処理する。
+func (h *Host) handleARP(p Packet) {
+	msg := p.ARP
+	nic := h.nicWithIP(msg.TargetIP)
+	if msg.Op == ARPReply {
+		nic = h.nicReceiving(Packet{DstMAC: p.DstMAC})
+	}
+	nl, dl := nic.Network, nic.DataLink
+	if nl == nil || dl == nil {
+		return
+	}
+	conflict := h.detectConflict(nl, dl, msg)
+	switch msg.Op {
+	case ARPRequest:
+		if !sameIP(msg.TargetIP, nl.IP) {
+			h.Network.log().Debugf("[ARP] %s: 他のホスト宛てのARP要求を無視 (%s)", h.Name, msg.TargetIP)
+			return
+		}
+		if !conflict {
+			nl.learnARP(msg.SenderIP, msg.SenderMAC)
+		}
+		h.Network.log().Debugf("[ARP] %s: %s からのARP要求に応答", h.Name, msg.SenderIP)
+		h.transmit(Packet{
+			SrcIP:    nl.IP,
+			DstIP:    msg.SenderIP,
+			SrcMAC:   dl.MAC,
+			DstMAC:   msg.SenderMAC,
+			TTL:      1,
+			Protocol: ProtocolARP,
+			ARP:      &ARPMessage{Op: ARPReply, SenderIP: nl.IP, SenderMAC: dl.MAC, TargetIP: msg.SenderIP},
+		})
+	case ARPReply:
+		if p.DstMAC != dl.MAC || conflict {
+			return
+		}
+		nl.learnARP(msg.SenderIP, msg.SenderMAC)
+		h.Network.log().Debugf("[ARP] %s: %s を解決 -> %s", h.Name, msg.SenderIP, msg.SenderMAC)
+		pending := h.pendingARP[msg.SenderIP]
+		delete(h.pendingARP, msg.SenderIP)
+		for _, q := range pending {
+			q.DstMAC = msg.SenderMAC
+			h.transmit(q)
+		}
+	}
+}
+
+// resolveARPはルータの転送パケットをARP解決待ちにし、インターフェースからARP要求をブロードキャスト。
+func (r *Router) resolveARP(iface *Interface, p Packet) {
+	if r.pendingARP == nil {
+		r.pendingARP = make(map[string][]Packet)
+	}
+	r.pendingARP[p.DstIP] = append(r.pendingARP[p.DstIP], p.Clone())
+	r.Network.log().Debugf("[ARP] %s: %s のMACアドレスを問い合わせ", r.Name, p.DstIP)
+	iface.Link.Transmit(Packet{
+		SrcIP:    iface.IP,
+		DstIP:    p.DstIP,
+		SrcMAC:   iface.MAC,
+		DstMAC:   BroadcastMAC,
+		TTL:      1,
+		Protocol: ProtocolARP,
+		ARP:      &ARPMessage{Op: ARPRequest, SenderIP: iface.IP, SenderMAC: iface.MAC, TargetIP: p.DstIP},
+	})
+}
+
+// handleARPはルータのインターフェース宛てのARP要求に応答し、ARP応答で解決待ちのパケットを送出。
+func (r *Router) handleARP(ingress *Interface, p Packet) {
+	msg := p.ARP
+	if ingress == nil {
+		ingress = r.connectedInterface(net.ParseIP(msg.SenderIP))
+	}
+	if ingress == nil || ingress.Link == nil {
+		return
+	}
+	switch msg.Op {
+	case ARPRequest:
+		if !r.ownsIP(msg.TargetIP) {
+			if !r.ProxyARP || !r.proxiesFor(ingress, msg.TargetIP) {
+				return
+			}
+			r.Network.log().Debugf("[ARP] %s: %s からの %s へのARP要求に代理で応答", r.Name, msg.SenderIP, msg.TargetIP)
+		} else {
+			r.Network.log().Debugf("[ARP] %s: %s からのARP要求に応答", r.Name, msg.SenderIP)
+		}
+		r.learnARP(msg.SenderIP, msg.SenderMAC)
+		ingress.Link.Transmit(Packet{
+			SrcIP:    msg.TargetIP,
+			DstIP:    msg.SenderIP,
+			SrcMAC:   ingress.MAC,
+			DstMAC:   msg.SenderMAC,
+			TTL:      1,
+			Protocol: ProtocolARP,
+			ARP:      &ARPMessage{Op: ARPReply, SenderIP: msg.TargetIP, SenderMAC: ingress.MAC, TargetIP: msg.SenderIP},
+		})
+	case ARPReply:
+		r.learnARP(msg.SenderIP, msg.SenderMAC)
+		r.Network.log().Debugf("[ARP] %s: %s を解決 -> %s", r.Name, msg.SenderIP, msg.SenderMAC)
+		pending := r.pendingARP[msg.SenderIP]
+		delete(r.pendingARP, msg.SenderIP)
+		for _, q := range pending {
+			r.deliverConnected(ingress, q)
+		}
+	}
+}
+
+// proxiesForは代理ARPでtargetへのARP要求に応答するかを返す。targetが受信したインターフェースの
+// サブネット外にあり、他のインターフェースの直結サブネットか、受信したインターフェース以外へ向かう経路で転送できれば応答する。
+// 受信したインターフェースにMACがなければ応答しない。
+func (r *Router) proxiesFor(ingress *Interface, target string) bool {
+	ip := net.ParseIP(target)
+	if ip == nil || ingress.MAC == "" || ingress.Subnet.Contains(ip) {
+		return false
+	}
+	if iface := r.connectedInterface(ip); iface != nil {
+		return true
+	}
+	route, ok := r.Table.Lookup(ip)
+	return ok && route.NextHop != nil && r.interfaceTo(route.NextHop) != ingress
+}
+
+// learnARPはIPアドレスとMACアドレスの対応をルータのARPテーブルに登録。
+func (r *Router) learnARP(ip, mac string) {
+	if r.arpTable == nil {
+		r.arpTable = make(map[string]string)
+	}
+	r.arpTable[ip] = mac
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestARPResolvesBeforeSending(t *testing.T) {
+	n, a, b, _ := newTestLAN(t)
+	got := &recordLayer{}
+	b.Layers = append(b.Layers, got)
+	a.SendPacket(Packet{DstIP: "10.0.0.2", Data: []byte("hello")})
+	n.Bus.Run()
+	if len(got.in) != 1 {
+		t.Fatalf("届いたパケット = %d, 期待値 1", len(got.in))
+	}
+	// ARP要求、ARP応答、データがそれぞれスイッチ経由の2ms
+	if at := elapsed(n); at != 6*time.Millisecond {
+		t.Errorf("到着時刻 = %v, 期待値 6ms", at)
+	}
+	if mac := a.networkLayer().ARPTable["10.0.0.2"]; mac != "AA:AA:AA:AA:AA:02" {
+		t.Errorf("AのARPテーブル = %q, 期待値 AA:AA:AA:AA:AA:02", mac)
+	}
+	if mac := b.networkLayer().ARPTable["10.0.0.1"]; mac != "AA:AA:AA:AA:AA:01" {
+		t.Errorf("BのARPテーブル = %q, 期待値 AA:AA:AA:AA:AA:01（要求から学習する）", mac)
+	}
+
+	// 解決済みなら問い合わせずにすぐ送る
+	start := elapsed(n)
+	a.SendPacket(Packet{DstIP: "10.0.0.2", Data: []byte("again")})
+	n.Bus.Run()
+	if len(got.in) != 2 {
+		t.Fatalf("届いたパケット = %d, 期待値 2", len(got.in))
+	}
+	if d := elapsed(n) - start; d != 2*time.Millisecond {
+		t.Errorf("解決済みの宛先への配送時間 = %v, 期待値 2ms", d)
+	}
+}
+
+func TestARPQueuesWhileResolving(t *testing.T) {
+	n, a, b, _ := newTestLAN(t)
+	got := &recordLayer{}
+	b.Layers = append(b.Layers, got)
+	for _, data := range []string{"one", "two", "three"} {
+		a.SendPacket(Packet{DstIP: "10.0.0.2", Data: []byte(data)})
+	}
+	n.Bus.Run()
+	if len(got.in) != 3 {
+		t.Fatalf("届いたパケット = %d, 期待値 3", len(got.in))
+	}
+	for i, want := range []string{"one", "two", "three"} {
+		if string(got.in[i].Data) != want {
+			t.Errorf("%d番目に届いたパケット = %q, 期待値 %q（送った順）", i, got.in[i].Data, want)
+		}
+	}
+	if len(a.pendingARP) != 0 {
+		t.Errorf("解決後も待機中のパケットが残っている: %v", a.pendingARP)
+	}
+}
+
+func TestARPResolvesGatewayOffSubnet(t *testing.T) {
+	n, a, b, _ := newTestRoutedNet(t)
+	got := record(b)
+	a.Send("203.0.113.1", []byte("hello"))
+	n.Bus.Run()
+	if len(got.in) != 1 {
+		t.Fatalf("届いたパケット = %d, 期待値 1", len(got.in))
+	}
+	table := a.networkLayer().ARPTable
+	if mac := table["10.0.0.254"]; mac != "RR:RR:RR:RR:RR:01" {
+		t.Errorf("ゲートウェイのMAC = %q, 期待値 RR:RR:RR:RR:RR:01", mac)
+	}
+	if _, ok := table["203.0.113.1"]; ok {
+		t.Error("サブネット外の宛先を直接ARPで解決した")
+	}
+}
+
+func TestNextHopBySubnet(t *testing.T) {
+	nl := &NetworkLayer{
+		IP:         "10.0.0.1",
+		SubnetMask: "255.255.255.0",
+		Gateway:    "10.0.0.254",
+		ARPTable:   map[string]string{"10.0.0.2": "AA:AA:AA:AA:AA:02", "10.0.0.254": "RR:RR:RR:RR:RR:01"},
+	}
+	tests := []struct {
+		dst, hop, mac string
+	}{
+		{"10.0.0.2", "10.0.0.2", "AA:AA:AA:AA:AA:02"},      // 同じサブネットの相手へは直接
+		{"10.0.0.3", "10.0.0.3", ""},                       // 未解決の相手はARPを待つ
+		{"203.0.113.1", "10.0.0.254", "RR:RR:RR:RR:RR:01"}, // サブネット外はゲートウェイ経由
+	}
+	for _, tt := range tests {
+		if hop := nl.nextHop(tt.dst); hop != tt.hop {
+			t.Errorf("nextHop(%s) = %s, 期待値 %s", tt.dst, hop, tt.hop)
+		}
+		if p := nl.HandleOutgoing(Packet{DstIP: tt.dst}); p.DstMAC != tt.mac {
+			t.Errorf("%s への宛先MAC = %q, 期待値 %q", tt.dst, p.DstMAC, tt.mac)
+		}
+	}
+	nl.Gateway = ""
+	if hop := nl.nextHop("203.0.113.1"); hop != "203.0.113.1" {
+		t.Errorf("ゲートウェイがない場合の nextHop = %s, 期待値 宛先そのもの", hop)
+	}
+}
+
+func TestHostUsesGatewayMACOffSubnet(t *testing.T) {
+	n, a, b, r := newTestRoutedNet(t)
+	got := record(b)
+	a.networkLayer().learnARP("10.0.0.3", "AA:AA:AA:AA:AA:03") // 同じサブネットの相手は解決済み
+	a.Send("10.0.0.3", []byte("on-subnet"))
+	a.Send("203.0.113.1", []byte("off-subnet"))
+	n.Bus.Run()
+	// 同じサブネットの相手へのフレームはルータのMAC宛てではないため、ルータが破棄する
+	if r.Stats.Dropped[DropMACMismatch] != 1 {
+		t.Errorf("ルータでのMACの不一致による破棄 = %d, 期待値 1", r.Stats.Dropped[DropMACMismatch])
+	}
+	if len(got.in) != 1 || string(got.in[0].Data) != "off-subnet" {
+		t.Errorf("Bに届いたパケット = %v, 期待値 off-subnet のみ", got.in)
+	}
+}
+
+func TestRouterProxyARP(t *testing.T) {
+	tests := []struct {
+		name  string
+		proxy bool
+		dst   string
+		reply bool // ルータが代理で応答するか
+	}{
+		{"他のインターフェースのサブネット", true, "203.0.113.1", true},
+		{"代理ARPが無効", false, "203.0.113.1", false},
+		{"受信したインターフェースと同じサブネット", true, "10.0.0.77", false},
+		{"経路のない宛先", true, "198.51.100.1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, a, b, r := newTestRoutedNet(t)
+			nl := a.networkLayer()
+			nl.SubnetMask, nl.Gateway = "", "" // 全ての宛先を直結とみなしてARPで解決する
+			r.ProxyARP = tt.proxy
+			got := record(b)
+			a.Send(tt.dst, []byte("hello"))
+			runBus(t, n)
+			mac, resolved := nl.ARPTable[tt.dst]
+			if resolved != tt.reply || (tt.reply && mac != "RR:RR:RR:RR:RR:01") {
+				t.Errorf("AのARPテーブルの %s = %q (%v), 期待値 代理応答 %v", tt.dst, mac, resolved, tt.reply)
+			}
+			if delivered := len(got.in) == 1; delivered != tt.reply {
+				t.Errorf("Bに届いたパケット = %d, 期待値 代理応答したときだけ1", len(got.in))
+			}
+			if !tt.reply && len(a.pendingARP[tt.dst]) != 1 {
+				t.Errorf("応答がないのに解決待ちのパケットが %d 個", len(a.pendingARP[tt.dst]))
+			}
+		})
+	}
+}
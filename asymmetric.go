@@ -0,0 +1,27 @@
+package main
+
+import "time"
+
+// LinkParamsはリンクの片方向の回線の特性を表す。
+type LinkParams struct {
+	Delay     time.Duration // 伝送遅延時間
+	Bandwidth int64         // 帯域幅（bps、0なら無制限）
+	LossRate  float64       // パケットロス率（0.0〜1.0）
+	Jitter    time.Duration // 遅延の揺らぎの幅
+}
+
+// applyはリンクに特性を設定する。
+func (lp LinkParams) apply(l *Link) {
+	l.Delay, l.Bandwidth, l.LossRate, l.Jitter = lp.Delay, lp.Bandwidth, lp.LossRate, lp.Jitter
+}
+
+// AddAsymmetricLinkはデバイス間に向きごとに特性の異なる双方向リンクを追加する。
+// ADSLやケーブル回線のように上りと下りで帯域幅が違う回線を表すのに使う。
+// AddBidirectionalLinkと同じくスイッチのリンク表やホストの接続先にも登録し、a->b、b->aの順にリンクを返す。
+func (n *Network) AddAsymmetricLink(a, b Device, aToB, bToA LinkParams) (*Link, *Link) {
+	ab, ba := n.AddBidirectionalLink(a, b, 0)
+	aToB.apply(ab)
+	bToA.apply(ba)
+	n.log().Debugf("[Network] %s -> %s は %d bps、%s -> %s は %d bps の非対称リンク", a.GetName(), b.GetName(), aToB.Bandwidth, b.GetName(), a.GetName(), bToA.Bandwidth)
+	return ab, ba
+}
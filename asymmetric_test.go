@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAddAsymmetricLink(t *testing.T) {
+	n := newTestNetwork(t)
+	a := newTestHost("A", "AA:AA:AA:AA:AA:01", "10.0.0.1")
+	b := newTestHost("B", "AA:AA:AA:AA:AA:02", "10.0.0.2")
+	n.AddDevice(a)
+	n.AddDevice(b)
+	up := LinkParams{Delay: time.Millisecond, Bandwidth: 8_000}
+	down := LinkParams{Delay: 5 * time.Millisecond, Bandwidth: 80_000}
+	ab, ba := n.AddAsymmetricLink(a, b, up, down)
+	if ab.Delay != up.Delay || ab.Bandwidth != up.Bandwidth || ba.Delay != down.Delay || ba.Bandwidth != down.Bandwidth {
+		t.Fatalf("リンクの特性 = A->B %v/%d bps, B->A %v/%d bps", ab.Delay, ab.Bandwidth, ba.Delay, ba.Bandwidth)
+	}
+	if n.GetLink(a, b) != ab || n.GetLink(b, a) != ba {
+		t.Fatal("非対称リンクがネットワークに登録されていない")
+	}
+	skipAnnounce(a, b)
+	var atA, atB time.Duration
+	a.OnReceive = func(Packet) { atA = elapsed(n) }
+	b.OnReceive = func(Packet) { atB = elapsed(n) }
+	data := string(make([]byte, 100))
+	a.SendPacket(lanPacket(a, b, data))
+	b.SendPacket(lanPacket(b, a, data))
+	runBus(t, n)
+	// 100バイトは8000bpsで100ms、80000bpsで10msかけて送出する
+	if atB != 101*time.Millisecond {
+		t.Errorf("A->Bの到着時刻 = %v, 期待値 101ms", atB)
+	}
+	if atA != 15*time.Millisecond {
+		t.Errorf("B->Aの到着時刻 = %v, 期待値 15ms", atA)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+// BandwidthDelayProductは帯域幅と伝送遅延の積（バイト）を返す。満杯の回線上に同時に載るデータ量で、
+// 片方向のリンクの値のため、往復の値が必要なら逆方向のリンクの値と足す。帯域幅が無制限なら0を返す。
+func (l *Link) BandwidthDelayProduct() int {
+	if l.Bandwidth <= 0 {
+		return 0
+	}
+	return int(float64(l.Bandwidth) / 8 * l.Delay.Seconds()) // 積をint64で計算すると高速なリンクで桁あふれする
+}
+
+// InFlightBytesは送出を始めてまだ宛先に届いていないパケットのデータの合計バイト数を返す。
+func (l *Link) InFlightBytes() int {
+	eb := l.Network.Bus
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	return l.inFlight
+}
+
+// checkOverloadは送出を始めたsentバイトのパケットを除いた伝送中のバイト数が帯域幅遅延積を超えたときに
+// 一度だけ警告する（帯域幅が無制限なら何もしない）。送信待ちキューで順に送出するリンクでは、帯域幅を使い切っても
+// 伝送中のデータは帯域幅遅延積と送出中のパケット1つ分までのため、これを超えるのは送信の負荷が帯域幅を上回り、
+// パケットが回線上に溜まり始めていることを表す。下回れば再び警告する。
+func (l *Link) checkOverload(sent int) {
+	bdp := l.BandwidthDelayProduct()
+	if bdp <= 0 {
+		return
+	}
+	inFlight := l.InFlightBytes() - sent
+	switch {
+	case inFlight > bdp && !l.overloaded:
+		l.overloaded = true
+		l.Network.log().Warnf("リンク: %s から %s への伝送中のデータ %d バイトが帯域幅遅延積 %d バイトを超えました（送信の負荷が帯域幅を上回っています）", l.From.GetName(), l.To.GetName(), inFlight, bdp)
+	case inFlight <= bdp:
+		l.overloaded = false
+	}
+}
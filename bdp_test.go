@@ -0,0 +1,90 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLinkBandwidthDelayProduct(t *testing.T) {
+	tests := []struct {
+		name      string
+		bandwidth int64
+		delay     time.Duration
+		want      int
+	}{
+		{"8Mbpsで10ms", 8_000_000, 10 * time.Millisecond, 10_000},
+		{"帯域幅が無制限", 0, 10 * time.Millisecond, 0},
+		{"遅延がない", 8_000_000, 0, 0},
+		{"高速なリンクでも桁あふれしない", 100_000_000_000, time.Second, 12_500_000_000},
+	}
+	for _, tt := range tests {
+		l := &Link{Bandwidth: tt.bandwidth, Delay: tt.delay}
+		if got := l.BandwidthDelayProduct(); got != tt.want {
+			t.Errorf("%s: BandwidthDelayProduct = %d, 期待値 %d", tt.name, got, tt.want)
+		}
+	}
+
+	// 往復の値は両方向のリンクの値の和で、帯域幅と往復の遅延の積になる
+	n, a, _, s := newTestLAN(t)
+	as, sa := n.GetLink(a, s), n.GetLink(s, a)
+	as.Bandwidth, as.Delay = 8_000_000, 10*time.Millisecond
+	sa.Bandwidth, sa.Delay = 8_000_000, 10*time.Millisecond
+	rtt := as.Delay + sa.Delay
+	if got, want := as.BandwidthDelayProduct()+sa.BandwidthDelayProduct(), int(8_000_000/8*rtt.Seconds()); got != want {
+		t.Errorf("往復の帯域幅遅延積 = %d, 期待値 %d", got, want)
+	}
+}
+
+// watchInFlightはリンクの伝送中のバイト数の最大値と、過負荷と判定したかをintervalごとに記録する。
+func watchInFlight(n *Network, l *Link, interval time.Duration) (maxInFlight *int, overloaded *bool) {
+	maxInFlight, overloaded = new(int), new(bool)
+	n.Bus.AddPeriodic(interval, func() {
+		*maxInFlight = max(*maxInFlight, l.InFlightBytes())
+		*overloaded = *overloaded || l.overloaded
+	})
+	return maxInFlight, overloaded
+}
+
+func TestLinkInFlightCappedByBDP(t *testing.T) {
+	n, ab, got := newTestQueuedLink(t, 80_000, 100) // 10バイトの送出に1ms
+	ab.Delay = 10 * time.Millisecond                // 帯域幅遅延積は100バイト
+	for seq := 0; seq < 50; seq++ {
+		if err := ab.Transmit(queuedPacket(10, seq)); err != nil {
+			t.Fatalf("Transmit %d: %v", seq, err)
+		}
+	}
+	maxInFlight, overloaded := watchInFlight(n, ab, 100*time.Microsecond)
+	runFor(t, n, 100*time.Millisecond)
+	if len(got.packets) != 50 {
+		t.Fatalf("届いたパケット = %d, 期待値 50", len(got.packets))
+	}
+	// 順に送出するため、伝送中のデータは帯域幅遅延積と送出中のパケット1つ分を超えない
+	bdp := ab.BandwidthDelayProduct()
+	if *maxInFlight < bdp || *maxInFlight > bdp+10 {
+		t.Errorf("伝送中のバイト数の最大値 = %d, 期待値 %d〜%d", *maxInFlight, bdp, bdp+10)
+	}
+	if *overloaded {
+		t.Error("帯域幅を使い切っているだけのリンクを過負荷と判定した")
+	}
+	if ab.InFlightBytes() != 0 {
+		t.Errorf("全て届いた後の伝送中のバイト数 = %d, 期待値 0", ab.InFlightBytes())
+	}
+}
+
+func TestLinkOverloadBeyondBDP(t *testing.T) {
+	n, ab, got := newTestQueuedLink(t, 80_000, 0) // 送信待ちキューがなければ送出が重なる
+	ab.Delay = 10 * time.Millisecond
+	for seq := 0; seq < 50; seq++ {
+		ab.Transmit(queuedPacket(10, seq))
+	}
+	if got := ab.InFlightBytes(); got != 500 {
+		t.Errorf("伝送中のバイト数 = %d, 期待値 500", got)
+	}
+	if !ab.overloaded {
+		t.Error("帯域幅遅延積を超えて送出したリンクを過負荷と判定しない")
+	}
+	runBus(t, n)
+	if len(got.packets) != 50 || ab.InFlightBytes() != 0 {
+		t.Errorf("届いたパケット = %d, 伝送中のバイト数 = %d", len(got.packets), ab.InFlightBytes())
+	}
+}
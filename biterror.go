@@ -0,0 +1,25 @@
+package main
+
+import (
+	"math"
+)
+
+// corruptionProbはデータの全ビットのうち少なくとも1ビットが誤る確率を返す。
+func (l *Link) corruptionProb(p Packet) float64 {
+	bits := float64(len(p.Data) * 8)
+	return 1 - math.Pow(1-min(l.BitErrorRate, 1), bits)
+}
+
+// corruptはデータを複製してランダムな1バイトの1ビットを反転し、Corruptedを設定したパケットを返す。
+// 元のデータは他のパケットと共有している可能性があるため変更しない。
+func (l *Link) corrupt(p Packet) Packet {
+	data := append([]byte(nil), p.Data...)
+	i := min(int(l.randFloat()*float64(len(data))), len(data)-1)
+	bit := min(int(l.randFloat()*8), 7)
+	data[i] ^= 1 << bit
+	p.Data = data
+	p.Corrupted = true
+	l.Corruptions++
+	l.Network.log().Warnf("リンク: %s から %s へのパケットの %d バイト目にビット誤り%s", l.From.GetName(), l.To.GetName(), i, p.traceTag())
+	return p
+}
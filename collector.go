@@ -0,0 +1,76 @@
+package main
+
+import (
+	"sync"
+)
+
+// Collectorはホストのアプリケーション層に届いたパケットを記録する。
+// テストでログを解析せずに配送結果を確かめるのに使う。
+type Collector struct {
+	mu      sync.Mutex // packetsを保護する
+	packets []Packet   // 届いた順のパケット
+	bus     *EventBus  // WaitForで進めるイベントバス（最後に接続したホストのもの）
+}
+
+// NewCollectorは空のCollectorを作成。
+func NewCollector() *Collector {
+	return &Collector{}
+}
+
+// Attachはホストに届いたパケットを記録するようにする。既存のOnReceiveは記録の後に呼ばれる。
+func (c *Collector) Attach(h *Host) {
+	prev := h.OnReceive
+	h.OnReceive = func(p Packet) {
+		c.mu.Lock()
+		c.packets = append(c.packets, p.Clone())
+		c.mu.Unlock()
+		if prev != nil {
+			prev(p)
+		}
+	}
+	if h.Network != nil {
+		c.bus = h.Network.Bus
+	}
+}
+
+// AttachNetworkはネットワーク内の全てのホストにAttachする。
+func (c *Collector) AttachNetwork(n *Network) {
+	for _, d := range n.Devices {
+		if h, ok := d.(*Host); ok {
+			c.Attach(h)
+		}
+	}
+	c.bus = n.Bus
+}
+
+// Receivedはこれまでに記録したパケットを届いた順に返す。
+func (c *Collector) Received() []Packet {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Packet(nil), c.packets...)
+}
+
+// Lenは記録したパケット数を返す。
+func (c *Collector) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.packets)
+}
+
+// Resetは記録したパケットを消去する。
+func (c *Collector) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.packets = nil
+}
+
+// WaitForはn個以上のパケットを記録するまでイベントバスを1イベントずつ進め、
+// 記録できたかどうかを返す。イベントがなくなってもn個に満たなければfalseを返す。
+func (c *Collector) WaitFor(n int) bool {
+	for c.Len() < n {
+		if c.bus == nil || !c.bus.Step() {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,64 @@
+package main
+
+import "testing"
+
+func TestCollectorReceived(t *testing.T) {
+	n, a, b, _ := newTestLAN(t)
+	skipAnnounce(a, b)
+	c := NewCollector()
+	c.AttachNetwork(n)
+	a.Send("10.0.0.2", []byte("hello"))
+	b.Send("10.0.0.1", []byte("world"))
+	runBus(t, n)
+
+	got := c.Received()
+	want := []struct {
+		data, srcIP, dstIP, srcMAC, dstMAC string
+	}{
+		{"hello", "10.0.0.1", "10.0.0.2", "AA:AA:AA:AA:AA:01", "AA:AA:AA:AA:AA:02"},
+		{"world", "10.0.0.2", "10.0.0.1", "AA:AA:AA:AA:AA:02", "AA:AA:AA:AA:AA:01"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("記録したパケット = %d, 期待値 %d", len(got), len(want))
+	}
+	for i, w := range want {
+		p := got[i]
+		if string(p.Data) != w.data || p.SrcIP != w.srcIP || p.DstIP != w.dstIP || p.SrcMAC != w.srcMAC || p.DstMAC != w.dstMAC {
+			t.Errorf("%d番目 = %q %s(%s) -> %s(%s), 期待値 %q %s(%s) -> %s(%s)", i,
+				p.Data, p.SrcIP, p.SrcMAC, p.DstIP, p.DstMAC, w.data, w.srcIP, w.srcMAC, w.dstIP, w.dstMAC)
+		}
+	}
+	c.Reset()
+	if c.Len() != 0 || len(c.Received()) != 0 {
+		t.Errorf("Reset後に記録したパケット = %d, 期待値 0", c.Len())
+	}
+}
+
+func TestCollectorWaitFor(t *testing.T) {
+	n, a, b, _ := newTestLAN(t)
+	skipAnnounce(a, b)
+	forwarded := 0
+	b.OnReceive = func(p Packet) { forwarded++ }
+	c := NewCollector()
+	c.Attach(b) // 既存のOnReceiveも記録の後に呼ばれる
+	for i := range 3 {
+		a.Send("10.0.0.2", []byte{byte(i)})
+	}
+
+	if !c.WaitFor(2) {
+		t.Fatal("WaitFor(2) = false, 期待値 true")
+	}
+	if c.Len() != 2 || forwarded != 2 {
+		t.Errorf("WaitFor(2)の後に記録したパケット = %d, OnReceive %d, 期待値 2", c.Len(), forwarded)
+	}
+	now := n.Bus.Now()
+	if !c.WaitFor(2) || !n.Bus.Now().Equal(now) {
+		t.Error("n個を記録済みのWaitFor(n)はイベントを進めずにtrueを返すはず")
+	}
+	if !c.WaitFor(3) || c.Len() != 3 {
+		t.Errorf("WaitFor(3)の後に記録したパケット = %d, 期待値 3", c.Len())
+	}
+	if c.WaitFor(4) {
+		t.Error("WaitFor(4) = true, イベントがなくなったらfalseを返すはず")
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+// AnnounceIPはホストの各インターフェースのIPアドレスをGratuitous ARPでブロードキャストする。
+// 同じIPアドレスを使っているホストは応答を返すため、双方で重複を検出できる。
+// ネットワークへの追加時と電源を入れたときには接続済みのインターフェースから、
+// それ以外のインターフェースからは最初に送信するときに自動で通知する。
+func (h *Host) AnnounceIP() {
+	for _, nic := range h.nics() {
+		h.announce(nic)
+	}
+}
+
+// announceLinkedは接続先へのリンクがあるインターフェースのうち、まだ通知していないもののIPアドレスを通知する。
+func (h *Host) announceLinked() {
+	if h.Network == nil || h.poweredOff {
+		return
+	}
+	for _, nic := range h.nics() {
+		if nic.Network != nil && !nic.Network.announced && nic.ConnectedDev != nil && h.Network.GetLink(h, nic.ConnectedDev) != nil {
+			h.announce(nic)
+		}
+	}
+}
+
+// announceはインターフェースのIPアドレスをGratuitous ARPでブロードキャストする（アドレスが未割り当てなら何もしない）。
+func (h *Host) announce(nic *NIC) {
+	nl, dl := nic.Network, nic.DataLink
+	if nl == nil || dl == nil || nl.IP == "" || nl.IP == "0.0.0.0" {
+		return
+	}
+	nl.announced = true
+	h.Network.log().Debugf("[ARP] %s: IPアドレス %s を通知", h.Name, nl.IP)
+	h.transmit(Packet{
+		SrcIP:    nl.IP,
+		DstIP:    nl.IP,
+		SrcMAC:   dl.MAC,
+		DstMAC:   BroadcastMAC,
+		TTL:      1,
+		Protocol: ProtocolARP,
+		ARP:      &ARPMessage{Op: ARPRequest, SenderIP: nl.IP, SenderMAC: dl.MAC, TargetIP: nl.IP},
+	})
+}
+
+// detectConflictは受信したARPメッセージの送信者が、別のMACで自分と同じIPアドレスを名乗っていないかを調べる。
+// 重複していればConflictMACに記録して警告し、trueを返す。
+func (h *Host) detectConflict(nl *NetworkLayer, dl *DataLinkLayer, msg *ARPMessage) bool {
+	if nl.IP == "" || nl.IP == "0.0.0.0" || msg.SenderIP != nl.IP || msg.SenderMAC == dl.MAC {
+		return false
+	}
+	if nl.ConflictMAC != msg.SenderMAC {
+		nl.ConflictMAC = msg.SenderMAC
+		h.Network.log().Warnf("[ARP] %s: IPアドレス %s が %s と重複しています", h.Name, nl.IP, msg.SenderMAC)
+	}
+	return true
+}
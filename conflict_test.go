@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// newTestConflictLANはnewTestLANのスイッチに、Aと同じIPアドレス10.0.0.1を持つホストCを加えたネットワークを作る。
+func newTestConflictLAN(t *testing.T) (*Network, *Host, *Host, *Host) {
+	n, a, b, s := newTestLAN(t)
+	c := newTestHost("C", "AA:AA:AA:AA:AA:03", "10.0.0.1")
+	n.AddDevice(c)
+	n.AddBidirectionalLink(c, s, time.Millisecond)
+	return n, a, b, c
+}
+
+func TestIPConflictDetectedOnFirstSend(t *testing.T) {
+	n, a, _, c := newTestConflictLAN(t)
+	a.networkLayer().RefuseOnConflict = true
+	a.Send("10.0.0.2", []byte("hello")) // 最初の送信の前のGratuitous ARPにCが応答する
+	runBus(t, n)
+	if mac := c.networkLayer().ConflictMAC; mac != "AA:AA:AA:AA:AA:01" {
+		t.Errorf("Cが検出した重複 = %q, 期待値 AA:AA:AA:AA:AA:01", mac)
+	}
+	if mac := a.networkLayer().ConflictMAC; mac != "AA:AA:AA:AA:AA:03" {
+		t.Errorf("Aが検出した重複 = %q, 期待値 AA:AA:AA:AA:AA:03", mac)
+	}
+	if err := a.Send("10.0.0.2", []byte("again")); !errors.Is(err, DropIPConflict) {
+		t.Errorf("重複を検出した後のSend = %v, 期待値 %s", err, DropIPConflict)
+	}
+}
+
+func TestIPConflictAnnouncedOnPowerOn(t *testing.T) {
+	n, a, _, c := newTestConflictLAN(t)
+	n.SetDeviceState(c, false)
+	n.SetDeviceState(c, true) // 電源を入れるとすぐにGratuitous ARPを送る
+	runBus(t, n)
+	if mac := a.networkLayer().ConflictMAC; mac != "AA:AA:AA:AA:AA:03" {
+		t.Errorf("Aが検出した重複 = %q, 期待値 AA:AA:AA:AA:AA:03", mac)
+	}
+	if mac := c.networkLayer().ConflictMAC; mac != "AA:AA:AA:AA:AA:01" {
+		t.Errorf("Cが検出した重複 = %q, 期待値 AA:AA:AA:AA:AA:01", mac)
+	}
+}
+
+func TestNoIPConflictWithUniqueAddresses(t *testing.T) {
+	n, a, b, _ := newTestLAN(t)
+	a.Send("10.0.0.2", []byte("hello"))
+	runBus(t, n)
+	for _, h := range []*Host{a, b} {
+		if mac := h.networkLayer().ConflictMAC; mac != "" {
+			t.Errorf("%s が重複を検出した: %s", h.Name, mac)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// runDeterminismScenarioはスイッチとルータ、揺らぎとロスのあるリンクを含むトポロジーで、
+// 同時刻に多数のパケットを送るシミュレーションを実行し、配送の順序、全てのトレース、詳細なログを返す。
+func runDeterminismScenario(t *testing.T) (deliveries, traces []string, log string) {
+	t.Helper()
+	var logBuf bytes.Buffer
+	n := NewNetwork()
+	n.SetLogger(NewWriterLogger(&logBuf, LevelDebug))
+	s, r := &Switch{Name: "S"}, &Router{Name: "R"}
+	n.AddDevice(s)
+	n.AddDevice(r)
+	var hosts []*Host
+	for i := 1; i <= 4; i++ {
+		h := newTestHost(fmt.Sprintf("H%d", i), fmt.Sprintf("AA:AA:AA:AA:AA:%02d", i), fmt.Sprintf("10.0.0.%d", i))
+		h.networkLayer().SubnetMask, h.networkLayer().Gateway = "255.255.255.0", "10.0.0.254"
+		n.AddDevice(h)
+		hs, _ := n.AddBidirectionalLink(h, s, time.Millisecond)
+		hs.Jitter, hs.Reorder, hs.Rand = 500*time.Microsecond, true, rand.New(rand.NewSource(int64(i)))
+		hosts = append(hosts, h)
+	}
+	d := newTestHost("D", "DD:DD:DD:DD:DD:01", "203.0.113.1")
+	d.networkLayer().SubnetMask, d.networkLayer().Gateway = "255.255.255.0", "203.0.113.254"
+	n.AddDevice(d)
+	rs, _ := n.AddBidirectionalLink(r, s, time.Millisecond)
+	rd, dr := n.AddBidirectionalLink(r, d, 2*time.Millisecond)
+	rd.Bandwidth, rd.QueueSize = 1_000_000, 4
+	dr.LossRate, dr.Rand = 0.2, rand.New(rand.NewSource(99))
+	if _, err := r.AddInterface("10.0.0.254/24", "RR:RR:RR:RR:RR:01", rs); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.AddInterface("203.0.113.254/24", "RR:RR:RR:RR:RR:02", rd); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, h := range append(hosts, d) {
+		h.OnReceive = func(p Packet) {
+			deliveries = append(deliveries, fmt.Sprintf("%v %s <- %s %q", elapsed(n), h.Name, p.SrcIP, p.Data))
+			if h == d && !strings.HasPrefix(string(p.Data), "echo") {
+				d.Send(p.SrcIP, append([]byte("echo "), p.Data...))
+			}
+		}
+	}
+	for round := 0; round < 3; round++ {
+		n.Bus.AddEvent(time.Duration(round)*5*time.Millisecond, func() {
+			for i, h := range hosts {
+				h.Send("203.0.113.1", []byte(fmt.Sprintf("%s-%d", h.Name, round)))
+				h.Send(hosts[(i+1)%len(hosts)].networkLayer().IP, []byte(fmt.Sprintf("peer %s-%d", h.Name, round)))
+				h.SendPacket(Packet{Data: []byte(fmt.Sprintf("broadcast %s-%d", h.Name, round))})
+			}
+		})
+	}
+	runBus(t, n)
+	for i := 1; i <= n.traceSeq; i++ {
+		id := fmt.Sprintf("t%d", i)
+		for _, e := range n.Trace(id) {
+			traces = append(traces, fmt.Sprintf("%s %v %s %s", id, e.Time.Sub(SimulationEpoch), e.Name, e.Action))
+		}
+	}
+	return deliveries, traces, logBuf.String()
+}
+
+func TestSimulationIsDeterministic(t *testing.T) {
+	deliveries, traces, log := runDeterminismScenario(t)
+	if len(deliveries) < 20 || len(traces) == 0 {
+		t.Fatalf("シナリオの配送 = %d、トレース = %d で、検証に十分でない", len(deliveries), len(traces))
+	}
+	for run := 2; run <= 5; run++ {
+		d2, t2, log2 := runDeterminismScenario(t)
+		if !slices.Equal(deliveries, d2) {
+			t.Fatalf("%d回目の配送の順序が異なる:\n%s\n期待値\n%s", run, strings.Join(d2, "\n"), strings.Join(deliveries, "\n"))
+		}
+		if !slices.Equal(traces, t2) {
+			t.Fatalf("%d回目のトレースが異なる", run)
+		}
+		if log != log2 {
+			t.Fatalf("%d回目のログが異なる", run)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+)
+
+const (
+	DHCPServerPort   = 67             // DHCPサーバが待ち受けるポート
+	DHCPClientPort   = 68             // DHCPクライアントが待ち受けるポート
+	DefaultLeaseTime = 24 * time.Hour // 既定のリース期間
+)
+
+// DHCPOpはDHCPメッセージの種類を表す。
+type DHCPOp int
+
+const (
+	DHCPDiscover DHCPOp = iota + 1 // クライアントからのアドレス要求（ブロードキャスト）
+	DHCPOffer                      // サーバからのアドレスの払い出し
+	DHCPNak                        // 払い出せるアドレスがないことの通知
+)
+
+// DHCPMessageはDHCPの要求/応答の内容を表す。
+type DHCPMessage struct {
+	Op        DHCPOp        // メッセージの種類
+	ClientMAC string        // 要求したクライアントのMACアドレス
+	YourIP    string        // クライアントに払い出したIPアドレス
+	Mask      string        // 払い出したアドレスのサブネットマスク
+	LeaseTime time.Duration // リース期間
+}
+
+// DHCPLeaseはサーバが払い出したアドレスの記録を表す。
+type DHCPLease struct {
+	IP     string    // 払い出したIPアドレス
+	MAC    string    // 借りているクライアントのMACアドレス
+	Expiry time.Time // リースが切れる仮想時刻
+}
+
+// DHCPServerはアドレスプールからホストへIPアドレスを払い出すデバイスを表す。
+type DHCPServer struct {
+	Name       string               // サーバの名前
+	IP         string               // サーバのIPアドレス
+	MAC        string               // サーバのMACアドレス
+	Pool       net.IPNet            // 払い出すアドレスのサブネット
+	LeaseTime  time.Duration        // リース期間（0なら既定値）
+	Leases     map[string]DHCPLease // クライアントのMACアドレスごとのリース
+	Network    *Network             // サーバが属するネットワーク
+	Stats      Stats                // サーバが処理したパケットの統計
+	poweredOff bool                 // 電源が切れていればtrue（ゼロ値は電源が入った状態。Network.SetDeviceStateで変更する）
+}
+
+// NewDHCPServerはpoolCIDRのサブネットからアドレスを払い出すDHCPサーバを作成。
+// サブネットのネットワークアドレス、ブロードキャストアドレス、サーバ自身のIPは払い出さない。
+func NewDHCPServer(name, ip, mac, poolCIDR string) (*DHCPServer, error) {
+	_, pool, err := net.ParseCIDR(poolCIDR)
+	if err != nil {
+		return nil, fmt.Errorf("不正なアドレスプール %q: %w", poolCIDR, err)
+	}
+	if pool.IP.To4() == nil {
+		return nil, fmt.Errorf("アドレスプール %q はIPv4ではありません", poolCIDR)
+	}
+	return &DHCPServer{Name: name, IP: ip, MAC: mac, Pool: *pool}, nil
+}
+
+func (srv *DHCPServer) setNetwork(n *Network) {
+	srv.Network = n
+}
+
+func (srv *DHCPServer) stats() *Stats { return &srv.Stats }
+
+// allocateはクライアントに払い出すアドレスを選ぶ。有効なリースがあれば同じアドレスを更新し、
+// なければ未使用か期限切れのアドレスを選ぶ。空きがなければfalseを返す。
+func (srv *DHCPServer) allocate(mac string) (string, bool) {
+	now := srv.Network.Bus.Now()
+	if lease, ok := srv.Leases[mac]; ok && now.Before(lease.Expiry) {
+		return lease.IP, true
+	}
+	inUse := make(map[string]bool)
+	for m, lease := range srv.Leases {
+		if now.Before(lease.Expiry) {
+			inUse[lease.IP] = true
+		} else {
+			delete(srv.Leases, m)
+		}
+	}
+	base := binary.BigEndian.Uint32(srv.Pool.IP.To4())
+	ones, bits := srv.Pool.Mask.Size()
+	size := uint32(1) << (bits - ones)
+	for off := uint32(1); off+1 < size; off++ { // ネットワークアドレスとブロードキャストアドレスを除く
+		b := make(net.IP, 4)
+		binary.BigEndian.PutUint32(b, base+off)
+		if ip := b.String(); ip != srv.IP && !inUse[ip] {
+			return ip, true
+		}
+	}
+	return "", false
+}
+
+// SendPacketはサーバから出るリンクへパケットを送出。
+func (srv *DHCPServer) SendPacket(p Packet) error {
+	if err := srv.Network.dropOffline(srv.poweredOff, srv.Name, &srv.Stats, p); err != nil {
+		return err
+	}
+	for _, l := range srv.Network.Links {
+		if l.From == srv {
+			srv.Stats.countSent(p)
+			return l.Transmit(p)
+		}
+	}
+	srv.Stats.countDrop(DropNoLink)
+	srv.Network.log().Warnf("[DHCP] %s: 送出先のリンクがありません", srv.Name)
+	return dropError(srv.Name, DropNoLink)
+}
+
+// ReceivePacketはアドレス要求に対してアドレスを払い出し、空きがなければNAKを返す。
+func (srv *DHCPServer) ReceivePacket(p Packet) {
+	if srv.Network.dropOffline(srv.poweredOff, srv.Name, &srv.Stats, p) != nil {
+		return
+	}
+	srv.Stats.countReceived(p)
+	srv.Network.recordTrace(p, srv.Name, TraceReceive)
+	if p.DHCP == nil || p.DHCP.Op != DHCPDiscover {
+		return
+	}
+	mac := p.DHCP.ClientMAC
+	reply := Packet{
+		SrcIP:    srv.IP,
+		DstIP:    "255.255.255.255",
+		SrcMAC:   srv.MAC,
+		DstMAC:   mac,
+		TTL:      DefaultTTL,
+		Protocol: ProtocolUDP,
+		SrcPort:  DHCPServerPort,
+		DstPort:  DHCPClientPort,
+	}
+	ip, ok := srv.allocate(mac)
+	if !ok {
+		srv.Network.log().Warnf("[DHCP] %s: アドレスプール %s が枯渇したため %s に払い出せません", srv.Name, &srv.Pool, mac)
+		reply.DHCP = &DHCPMessage{Op: DHCPNak, ClientMAC: mac}
+		srv.SendPacket(reply)
+		return
+	}
+	leaseTime := srv.LeaseTime
+	if leaseTime == 0 {
+		leaseTime = DefaultLeaseTime
+	}
+	if srv.Leases == nil {
+		srv.Leases = make(map[string]DHCPLease)
+	}
+	srv.Leases[mac] = DHCPLease{IP: ip, MAC: mac, Expiry: srv.Network.Bus.Now().Add(leaseTime)}
+	srv.Network.log().Infof("[DHCP] %s: %s に %s を払い出し (リース %v)", srv.Name, mac, ip, leaseTime)
+	reply.DHCP = &DHCPMessage{Op: DHCPOffer, ClientMAC: mac, YourIP: ip, Mask: net.IP(srv.Pool.Mask).String(), LeaseTime: leaseTime}
+	srv.SendPacket(reply)
+}
+
+func (srv *DHCPServer) GetName() string {
+	return srv.Name
+}
+
+// RequestDHCPはアドレス要求をブロードキャストし、払い出されたIPアドレスをネットワーク層に設定する。
+func (h *Host) RequestDHCP() {
+	nl, dl := h.networkLayer(), h.dataLinkLayer()
+	if nl == nil || dl == nil {
+		h.Network.log().Warnf("[DHCP] %s: ネットワーク層またはデータリンク層がないためアドレスを要求できません", h.Name)
+		return
+	}
+	h.Network.log().Debugf("[DHCP] %s: アドレスを要求", h.Name)
+	h.transmit(Packet{
+		SrcIP:    "0.0.0.0",
+		DstIP:    "255.255.255.255",
+		SrcMAC:   dl.MAC,
+		DstMAC:   BroadcastMAC,
+		TTL:      1,
+		Protocol: ProtocolUDP,
+		SrcPort:  DHCPClientPort,
+		DstPort:  DHCPServerPort,
+		DHCP:     &DHCPMessage{Op: DHCPDiscover, ClientMAC: dl.MAC},
+	})
+}
+
+// handleDHCPは自分宛のDHCP応答を処理し、払い出されたアドレスをネットワーク層に設定する。
+func (h *Host) handleDHCP(p Packet) {
+	nl, dl := h.networkLayer(), h.dataLinkLayer()
+	if nl == nil || dl == nil || p.DHCP.ClientMAC != dl.MAC {
+		return
+	}
+	switch p.DHCP.Op {
+	case DHCPOffer:
+		nl.IP = p.DHCP.YourIP
+		nl.SubnetMask = p.DHCP.Mask
+		h.Network.log().Infof("[DHCP] %s: %s からアドレス %s を取得", h.Name, p.SrcIP, nl.IP)
+		h.AnnounceIP()
+	case DHCPNak:
+		h.Network.log().Warnf("[DHCP] %s: %s がアドレスを払い出せませんでした", h.Name, p.SrcIP)
+	}
+}
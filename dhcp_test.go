@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// newTestDHCPLANはスイッチSにDHCPサーバ（10.0.0.1、プール10.0.0.0/29）と、
+// アドレスを持たないホストをcount台つないだネットワークを作る。
+func newTestDHCPLAN(t *testing.T, count int) (*Network, *DHCPServer, []*Host) {
+	n := newTestNetwork(t)
+	srv, err := NewDHCPServer("DHCP", "10.0.0.1", "DD:DD:DD:DD:DD:01", "10.0.0.0/29")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Switch{Name: "S"}
+	n.AddDevice(srv)
+	n.AddDevice(s)
+	n.AddBidirectionalLink(srv, s, time.Millisecond)
+	var hosts []*Host
+	for i := 1; i <= count; i++ {
+		h := newTestHost(fmt.Sprintf("H%d", i), fmt.Sprintf("AA:AA:AA:AA:AA:%02X", i), "")
+		n.AddDevice(h)
+		n.AddBidirectionalLink(h, s, time.Millisecond)
+		hosts = append(hosts, h)
+	}
+	return n, srv, hosts
+}
+
+func TestDHCPLeasesDistinctAddresses(t *testing.T) {
+	n, srv, hosts := newTestDHCPLAN(t, 3)
+	for _, h := range hosts {
+		h.RequestDHCP()
+	}
+	n.Bus.Run()
+	seen := make(map[string]bool)
+	for _, h := range hosts {
+		nl := h.networkLayer()
+		if nl.IP == "" || nl.IP == srv.IP || seen[nl.IP] {
+			t.Errorf("%s のアドレス = %q, 期待値はサーバ以外の重複しないアドレス", h.Name, nl.IP)
+		}
+		seen[nl.IP] = true
+		if nl.SubnetMask != "255.255.255.248" {
+			t.Errorf("%s のサブネットマスク = %q, 期待値 255.255.255.248", h.Name, nl.SubnetMask)
+		}
+		lease, ok := srv.Leases[h.dataLinkLayer().MAC]
+		if !ok || lease.IP != nl.IP {
+			t.Errorf("%s のリース = %+v, 期待値 %s", h.Name, lease, nl.IP)
+		}
+		// 要求とオファーがスイッチを経由する2msで払い出す
+		if want := SimulationEpoch.Add(2*time.Millisecond + DefaultLeaseTime); !lease.Expiry.Equal(want) {
+			t.Errorf("%s のリース期限 = %v, 期待値 %v", h.Name, lease.Expiry, want)
+		}
+	}
+}
+
+func TestDHCPPoolExhausted(t *testing.T) {
+	n, srv, hosts := newTestDHCPLAN(t, 6) // /29のうち払い出せるのはサーバを除く5個
+	for _, h := range hosts {
+		h.RequestDHCP()
+		n.Bus.Run()
+	}
+	for _, h := range hosts[:5] {
+		if h.networkLayer().IP == "" {
+			t.Errorf("%s にアドレスが払い出されていない", h.Name)
+		}
+	}
+	last := hosts[5]
+	if ip := last.networkLayer().IP; ip != "" {
+		t.Errorf("プールが枯渇しているのに %s に %s が払い出された", last.Name, ip)
+	}
+	if len(srv.Leases) != 5 {
+		t.Errorf("リース数 = %d, 期待値 5", len(srv.Leases))
+	}
+}
+
+func TestDHCPReusesExpiredLease(t *testing.T) {
+	n, srv, hosts := newTestDHCPLAN(t, 6)
+	srv.LeaseTime = time.Minute
+	for _, h := range hosts[:5] {
+		h.RequestDHCP()
+	}
+	n.Bus.Run()
+	first := hosts[0].networkLayer().IP
+	hosts[0].RequestDHCP() // 有効なリースの更新は同じアドレス
+	n.Bus.Run()
+	if ip := hosts[0].networkLayer().IP; ip != first {
+		t.Errorf("更新後のアドレス = %s, 期待値 %s", ip, first)
+	}
+
+	n.Bus.AddEvent(2*time.Minute, func() { hosts[5].RequestDHCP() })
+	n.Bus.Run()
+	if ip := hosts[5].networkLayer().IP; ip == "" {
+		t.Error("期限切れのリースのアドレスが再利用されない")
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ToDOTはトポロジーをGraphvizのDOT形式で返す。デバイスは種類ごとの形のノード、
+// リンクは遅延と帯域幅をラベルにした辺になる。遅延と帯域幅が等しい往復のリンクは向きのない1本の辺にまとめる。
+func (n *Network) ToDOT() string {
+	var b strings.Builder
+	b.WriteString("digraph network {\n")
+	for _, d := range n.Devices {
+		shape, label := "plaintext", d.GetName()
+		switch dev := d.(type) {
+		case *Host:
+			shape = "box"
+			if nl := dev.networkLayer(); nl != nil && nl.IP != "" {
+				label += "\n" + nl.IP
+			}
+		case *Switch:
+			shape = "diamond"
+		case *Router:
+			shape = "ellipse"
+			if ip := dev.sourceIP(); ip != "" {
+				label += "\n" + ip
+			}
+		case *Hub:
+			shape = "triangle"
+		case *DHCPServer:
+			shape = "component"
+			label += "\n" + dev.IP
+		}
+		fmt.Fprintf(&b, "\t%q [shape=%s, label=%q];\n", d.GetName(), shape, label)
+	}
+	drawn := make(map[*Link]bool)
+	for _, l := range n.Links {
+		if drawn[l] {
+			continue
+		}
+		drawn[l] = true
+		attrs := fmt.Sprintf("label=%q", linkLabel(l))
+		if back, ok := n.linkIndex[[2]Device{l.To, l.From}]; ok && back.Delay == l.Delay && back.Bandwidth == l.Bandwidth {
+			drawn[back] = true
+			attrs += ", dir=none"
+		}
+		fmt.Fprintf(&b, "\t%q -> %q [%s];\n", l.From.GetName(), l.To.GetName(), attrs)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// linkLabelはリンクの遅延と帯域幅（設定されていれば）を辺のラベルにする。
+func linkLabel(l *Link) string {
+	label := l.Delay.String()
+	if l.Bandwidth > 0 {
+		label += ", " + formatBandwidth(l.Bandwidth)
+	}
+	return label
+}
+
+// formatBandwidthは帯域幅を「10Mbps」のような単位付きの文字列にする。
+func formatBandwidth(bps int64) string {
+	for _, u := range []struct {
+		scale int64
+		unit  string
+	}{{1e9, "Gbps"}, {1e6, "Mbps"}, {1e3, "kbps"}} {
+		if bps >= u.scale && bps%u.scale == 0 {
+			return fmt.Sprintf("%d%s", bps/u.scale, u.unit)
+		}
+	}
+	return fmt.Sprintf("%dbps", bps)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNetworkToDOT(t *testing.T) {
+	n, _, b, r := newTestRoutedNet(t)
+	c := newTestHost("C", "AA:AA:AA:AA:AA:03", "10.0.0.3")
+	s, hub := &Switch{Name: "S"}, &Hub{Name: "H"}
+	for _, d := range []Device{c, s, hub} {
+		n.AddDevice(d)
+	}
+	n.AddBidirectionalLink(s, hub, 500*time.Microsecond)
+	cs, sc := n.AddBidirectionalLink(c, s, time.Millisecond)
+	cs.Bandwidth, sc.Bandwidth = 10_000_000, 1_500 // 帯域幅が異なる往復のリンクは2本の辺にする
+	n.GetLink(r, b).Bandwidth = 1_000_000_000
+	n.GetLink(b, r).Bandwidth = 1_000_000_000
+	want := `digraph network {
+	"A" [shape=box, label="A\n10.0.0.1"];
+	"B" [shape=box, label="B\n203.0.113.1"];
+	"R" [shape=ellipse, label="R\n10.0.0.254"];
+	"C" [shape=box, label="C\n10.0.0.3"];
+	"S" [shape=diamond, label="S"];
+	"H" [shape=triangle, label="H"];
+	"R" -> "A" [label="1ms", dir=none];
+	"R" -> "B" [label="1ms, 1Gbps", dir=none];
+	"S" -> "H" [label="500µs", dir=none];
+	"C" -> "S" [label="1ms, 10Mbps"];
+	"S" -> "C" [label="1ms, 1500bps"];
+}
+`
+	for run := 0; run < 3; run++ { // デバイスとリンクは追加した順に並び、実行のたびに同じ出力になる
+		if got := n.ToDOT(); got != want {
+			t.Fatalf("ToDOT =\n%s\n期待値\n%s", got, want)
+		}
+	}
+}
+
+func TestFormatBandwidth(t *testing.T) {
+	tests := []struct {
+		bps  int64
+		want string
+	}{
+		{2_000_000_000, "2Gbps"},
+		{100_000_000, "100Mbps"},
+		{1_500_000, "1500kbps"},
+		{64_000, "64kbps"},
+		{1_500, "1500bps"},
+		{999, "999bps"},
+	}
+	for _, tt := range tests {
+		if got := formatBandwidth(tt.bps); got != tt.want {
+			t.Errorf("formatBandwidth(%d) = %q, 期待値 %q", tt.bps, got, tt.want)
+		}
+	}
+}
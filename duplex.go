@@ -0,0 +1,113 @@
+package main
+
+import (
+	"time"
+)
+
+// Duplexはリンクの通信方式を表す。
+type Duplex int
+
+const (
+	FullDuplex Duplex = iota // 全二重（両方向に同時に送れる）
+	HalfDuplex               // 半二重（両方向で1フレームずつしか送れない）
+)
+
+const (
+	SlotTime          = 51200 * time.Nanosecond // バックオフの単位時間（10Mbpsでの512ビット時間）
+	MaxCollisionRetry = 16                      // 衝突による再送の最大回数
+	maxBackoffExp     = 10                      // バックオフの待ち時間を倍にする最大回数
+)
+
+// mediumは半二重のリンクとその逆方向のリンクが共有する回線を表す。
+type medium struct {
+	frames []*halfDuplexFrame // 回線上を伝送中のフレーム
+}
+
+// halfDuplexFrameは半二重の回線上を伝送中のフレームを表す。
+type halfDuplexFrame struct {
+	link     *Link       // フレームを送ったリンク
+	packet   Packet      // 伝送中のパケット
+	attempts int         // これまでの衝突の回数
+	start    time.Time   // 送出を始めた時刻
+	end      time.Time   // 回線を使い終える時刻
+	delivery EventHandle // 宛先へ届けるイベント
+}
+
+// sharedMediumは逆方向のリンクと共有する回線を返す。逆方向のリンクがなければこのリンクだけで使う。
+func (l *Link) sharedMedium() *medium {
+	if l.medium != nil {
+		return l.medium
+	}
+	if back := l.Network.linkIndex[[2]Device{l.To, l.From}]; back != nil && back.Duplex == HalfDuplex {
+		if back.medium == nil {
+			back.medium = &medium{}
+		}
+		l.medium = back.medium
+		return l.medium
+	}
+	l.medium = &medium{}
+	return l.medium
+}
+
+// transmitHalfDuplexは半二重の回線にフレームを送出する（CSMA/CD）。
+// 伝送中のフレームの信号が既に届いていれば回線が空くまで待ち、
+// まだ届いていない（伝搬遅延以内に同時に送り始めた）場合は衝突として両方を破棄し、バックオフ後に再送する。
+func (l *Link) transmitHalfDuplex(p Packet, attempts int) {
+	m := l.sharedMedium()
+	now := l.Network.Bus.Now()
+	active := m.frames[:0]
+	for _, f := range m.frames {
+		if f.end.After(now) {
+			active = append(active, f)
+		}
+	}
+	m.frames = active
+
+	var sensedUntil time.Time
+	for _, f := range m.frames {
+		if elapsed := now.Sub(f.start); elapsed > 0 && elapsed >= l.Delay && f.end.After(sensedUntil) {
+			sensedUntil = f.end
+		}
+	}
+	if !sensedUntil.IsZero() {
+		l.Network.Bus.AddEvent(sensedUntil.Sub(now), func() { l.transmitHalfDuplex(p, attempts) })
+		return
+	}
+
+	frame := &halfDuplexFrame{link: l, packet: p, attempts: attempts}
+	if len(m.frames) > 0 {
+		colliding := append(m.frames, frame)
+		m.frames = nil
+		for _, f := range colliding {
+			l.Network.Bus.Cancel(f.delivery)
+			f.link.Collisions++
+			f.link.backoff(f)
+		}
+		return
+	}
+	frame.start = now
+	frame.end = now.Add(l.SerializationDelay(p) + l.Delay)
+	frame.delivery = l.send(p)
+	m.frames = append(m.frames, frame)
+}
+
+// backoffは衝突したフレームを二進指数バックオフで待たせてから再送する。再送回数の上限を超えたら破棄する。
+func (l *Link) backoff(f *halfDuplexFrame) {
+	attempts := f.attempts + 1
+	if attempts > MaxCollisionRetry {
+		l.Stats.countDrop(DropCollision)
+		l.Network.recordTrace(f.packet, l.Name(), TraceDrop)
+		l.Network.log().Warnf("リンク: %s から %s へのフレームが %d 回衝突したため破棄: %s", l.From.GetName(), l.To.GetName(), f.attempts, f.packet)
+		return
+	}
+	slots := int(l.randFloat() * float64(int(1)<<min(attempts, maxBackoffExp)))
+	wait := time.Duration(slots) * SlotTime
+	l.Network.log().Debugf("リンク: %s から %s で衝突、%v 後に再送 (%d 回目)%s", l.From.GetName(), l.To.GetName(), wait, attempts, f.packet.traceTag())
+	l.Network.Bus.AddEvent(wait, func() {
+		if l.removed {
+			l.Stats.countDrop(DropLinkRemoved)
+			return
+		}
+		l.transmitHalfDuplex(f.packet, attempts)
+	})
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// newTestHalfDuplexはnewTestQueuedLinkの両方向のリンクを半二重にし、乱数の種を固定する。
+// Aに届いたパケットの記録も返す。
+func newTestHalfDuplex(t *testing.T, bandwidth int64) (*Network, *Link, *Link, *arrivals, *arrivals) {
+	n, ab, atB := newTestQueuedLink(t, bandwidth, 0)
+	ba := n.GetLink(ab.To, ab.From)
+	ab.Duplex, ba.Duplex = HalfDuplex, HalfDuplex
+	ab.Rand, ba.Rand = rand.New(rand.NewSource(1)), rand.New(rand.NewSource(2))
+	atA := recordArrivals(n, ab.From.(*Host))
+	return n, ab, ba, atA, atB
+}
+
+// replyPacketはAに届くdataバイトのパケットを作る。
+func replyPacket(data int, seq int) Packet {
+	return Packet{SrcIP: "10.0.0.2", DstIP: "10.0.0.1", SrcMAC: "AA:AA:AA:AA:AA:02", DstMAC: "AA:AA:AA:AA:AA:01", Data: make([]byte, data), Seq: seq}
+}
+
+func TestHalfDuplexCollisionBacksOff(t *testing.T) {
+	n, ab, _, _, atB := newTestHalfDuplex(t, 0)
+	ab.Transmit(queuedPacket(10, 1))
+	ab.Transmit(queuedPacket(10, 2)) // 同時に送り始めるので衝突する
+	n.Bus.Run()
+	if ab.Collisions < 2 {
+		t.Errorf("衝突したフレーム = %d, 期待値 2以上", ab.Collisions)
+	}
+	if ab.Stats.Dropped[DropCollision] != 0 {
+		t.Errorf("衝突による破棄 = %d, 期待値 0（再送で届く）", ab.Stats.Dropped[DropCollision])
+	}
+	at := atB.at
+	if len(at) != 2 || at[0] <= time.Millisecond || at[1]-at[0] < ab.Delay {
+		t.Errorf("到着時刻 = %v, 期待値はバックオフで1msより後に、回線が空いてから1つずつ", at)
+	}
+}
+
+func TestHalfDuplexCollisionBothDirections(t *testing.T) {
+	n, ab, ba, atA, atB := newTestHalfDuplex(t, 0)
+	ab.Transmit(queuedPacket(10, 1))
+	ba.Transmit(replyPacket(10, 1))
+	n.Bus.Run()
+	if ab.Collisions == 0 || ab.Collisions != ba.Collisions {
+		t.Errorf("衝突 A->B = %d, B->A = %d, 期待値は同じ回数（1以上）", ab.Collisions, ba.Collisions)
+	}
+	for name, at := range map[string][]time.Duration{"A": atA.at, "B": atB.at} {
+		if len(at) != 1 || at[0] <= time.Millisecond {
+			t.Errorf("%s への到着時刻 = %v, 期待値はバックオフで1msより後に1つ", name, at)
+		}
+	}
+}
+
+func TestHalfDuplexCarrierSense(t *testing.T) {
+	n, ab, _, _, atB := newTestHalfDuplex(t, 100_000) // 125バイトの送出に10ms
+	ab.Transmit(queuedPacket(125, 1))
+	n.Bus.AddEvent(2*time.Millisecond, func() { ab.Transmit(queuedPacket(125, 2)) }) // 既に信号が届いている
+	n.Bus.Run()
+	if ab.Collisions != 0 {
+		t.Errorf("衝突 = %d, 期待値 0", ab.Collisions)
+	}
+	if at := atB.at; len(at) != 2 || at[0] != 11*time.Millisecond || at[1] != 22*time.Millisecond {
+		t.Errorf("到着時刻 = %v, 期待値 [11ms 22ms]（回線が空く11msまで待つ）", at)
+	}
+}
+
+func TestFullDuplexNoCollision(t *testing.T) {
+	n, ab, atB := newTestQueuedLink(t, 0, 0)
+	ba := n.GetLink(ab.To, ab.From)
+	atA := recordArrivals(n, ab.From.(*Host))
+	ab.Transmit(queuedPacket(10, 1))
+	ba.Transmit(replyPacket(10, 1))
+	n.Bus.Run()
+	if ab.Collisions != 0 || ba.Collisions != 0 {
+		t.Errorf("全二重なのに衝突した: %d, %d", ab.Collisions, ba.Collisions)
+	}
+	for name, at := range map[string][]time.Duration{"A": atA.at, "B": atB.at} {
+		if len(at) != 1 || at[0] != time.Millisecond {
+			t.Errorf("%s への到着時刻 = %v, 期待値 [1ms]", name, at)
+		}
+	}
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEventBusVirtualOrder(t *testing.T) {
+	eb := NewEventBus()
+	var order []string
+	var times []time.Duration
+	record := func(name string) func() {
+		return func() {
+			order = append(order, name)
+			times = append(times, eb.Now().Sub(SimulationEpoch))
+		}
+	}
+	eb.AddEvent(3*time.Second, record("c"))
+	eb.AddEvent(time.Second, record("a"))
+	eb.AddEvent(2*time.Second, record("b1"))
+	eb.AddEvent(2*time.Second, record("b2")) // 同時刻なら追加した順
+	start := time.Now()
+	eb.Run()
+	if wall := time.Since(start); wall > time.Second {
+		t.Errorf("仮想時計なのに実時間で %v かかった", wall)
+	}
+	want := []string{"a", "b1", "b2", "c"}
+	wantTimes := []time.Duration{time.Second, 2 * time.Second, 2 * time.Second, 3 * time.Second}
+	for i := range want {
+		if i >= len(order) || order[i] != want[i] || times[i] != wantTimes[i] {
+			t.Fatalf("実行順 = %v (%v), 期待値 %v (%v)", order, times, want, wantTimes)
+		}
+	}
+	if got := eb.Now().Sub(SimulationEpoch); got != 3*time.Second {
+		t.Errorf("CurrentTime = %v, 期待値 3s", got)
+	}
+}
+
+func TestEventBusDelayFromCurrentTime(t *testing.T) {
+	eb := NewEventBus()
+	var at time.Duration
+	eb.AddEvent(10*time.Second, func() {
+		eb.AddEvent(5*time.Second, func() { at = eb.Now().Sub(SimulationEpoch) })
+	})
+	eb.Run()
+	if at != 15*time.Second {
+		t.Errorf("ハンドラから追加したイベントの時刻 = %v, 期待値 15s", at)
+	}
+}
+
+func TestEventBusRealTime(t *testing.T) {
+	eb := NewEventBus()
+	eb.RealTime = true
+	ran := false
+	eb.AddEvent(20*time.Millisecond, func() { ran = true })
+	start := time.Now()
+	eb.Run()
+	if !ran {
+		t.Fatal("イベントが実行されていない")
+	}
+	if wall := time.Since(start); wall < 20*time.Millisecond {
+		t.Errorf("RealTimeなのに %v しか待機していない", wall)
+	}
+}
+
+// go test -raceで実行すると、RunとAddEventの間のデータ競合を検出できる。
+func TestEventBusConcurrentAddEvent(t *testing.T) {
+	const workers, perWorker = 8, 200
+	eb := NewEventBus()
+	var ran atomic.Int64
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				eb.AddEvent(time.Duration(i%7)*time.Millisecond, func() {
+					ran.Add(1)
+					eb.AddEvent(time.Millisecond, func() { ran.Add(1) }) // ハンドラからの追加
+				})
+			}
+		}(w)
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	for finished := false; ; {
+		eb.Run()
+		if finished {
+			break
+		}
+		select {
+		case <-done:
+			finished = true // 全てのゴルーチンが追加し終えた後にもう一度Runで残りを実行する
+		default:
+		}
+	}
+	if got, want := ran.Load(), int64(2*workers*perWorker); got != want {
+		t.Errorf("実行したハンドラ = %d, 期待値 %d", got, want)
+	}
+	if _, ok := eb.Peek(); ok {
+		t.Error("Runの後にイベントが残っている")
+	}
+}
+
+func TestEventBusCancel(t *testing.T) {
+	eb := NewEventBus()
+	var fired []int
+	eb.AddEvent(time.Second, func() { fired = append(fired, 1) })
+	h := eb.AddEvent(2*time.Second, func() { fired = append(fired, 2) })
+	eb.AddEvent(3*time.Second, func() { fired = append(fired, 3) })
+	eb.Cancel(h)
+	eb.Run()
+	if len(fired) != 2 || fired[0] != 1 || fired[1] != 3 {
+		t.Errorf("実行したハンドラ = %v, 期待値 [1 3]", fired)
+	}
+	eb.Cancel(h)             // 実行済みやキャンセル済みのハンドルは何もしない
+	eb.Cancel(EventHandle{}) // ゼロ値のハンドルも何もしない
+}
+
+func TestEventBusCancelFromHandler(t *testing.T) {
+	eb := NewEventBus()
+	timedOut := false
+	timeout := eb.AddEvent(5*time.Second, func() { timedOut = true })
+	eb.AddEvent(time.Second, func() { eb.Cancel(timeout) }) // 応答が届いてタイムアウトを取り消す
+	eb.Run()
+	if timedOut {
+		t.Error("キャンセルしたタイムアウトが実行された")
+	}
+	if _, ok := eb.Peek(); ok {
+		t.Error("Peekがキャンセル済みのイベントを返した")
+	}
+	if now := eb.Now().Sub(SimulationEpoch); now != time.Second {
+		t.Errorf("CurrentTime = %v, 期待値 1s（キャンセルしたイベントの時刻まで進めない）", now)
+	}
+}
+
+func TestEventBusPeriodicBoundedWindow(t *testing.T) {
+	eb := NewEventBus()
+	var at []time.Duration
+	h := eb.AddPeriodic(time.Second, func() { at = append(at, eb.Now().Sub(SimulationEpoch)) })
+	eb.AddEvent(5500*time.Millisecond, func() { eb.Cancel(h) })
+	eb.Run()
+	if len(at) != 5 {
+		t.Fatalf("実行回数 = %d, 期待値 5 (%v)", len(at), at)
+	}
+	for i, d := range at {
+		if d != time.Duration(i+1)*time.Second {
+			t.Errorf("%d 回目の実行時刻 = %v, 期待値 %ds", i+1, d, i+1)
+		}
+	}
+	if now := eb.Now().Sub(SimulationEpoch); now != 5500*time.Millisecond {
+		t.Errorf("CurrentTime = %v, 期待値 5.5s（キャンセルした後は実行しない）", now)
+	}
+}
+
+func TestEventBusPeriodicN(t *testing.T) {
+	eb := NewEventBus()
+	runs := 0
+	eb.AddPeriodicN(time.Second, 3, func() { runs++ })
+	eb.Run()
+	if runs != 3 {
+		t.Errorf("実行回数 = %d, 期待値 3", runs)
+	}
+	if now := eb.Now().Sub(SimulationEpoch); now != 3*time.Second {
+		t.Errorf("CurrentTime = %v, 期待値 3s", now)
+	}
+}
+
+func TestEventBusPeriodicRejectsZeroInterval(t *testing.T) {
+	eb := NewEventBus()
+	eb.logger = NewWriterLogger(io.Discard, LevelWarn)
+	h := eb.AddPeriodic(0, func() { t.Error("間隔0の繰り返しイベントが実行された") })
+	if h != (EventHandle{}) {
+		t.Error("間隔0でゼロ値でないハンドルを返した")
+	}
+	eb.Run()
+}
+
+func TestEventBusPeriodicMaxSimTime(t *testing.T) {
+	eb := NewEventBus()
+	eb.logger = NewWriterLogger(io.Discard, LevelWarn)
+	eb.MaxSimTime = 10 * time.Second
+	runs := 0
+	eb.AddPeriodic(time.Second, func() { runs++ })
+	if err := eb.Run(); !errors.Is(err, ErrMaxSimTime) {
+		t.Fatalf("Runのエラー = %v, 期待値 %v", err, ErrMaxSimTime)
+	}
+	if runs != 10 {
+		t.Errorf("実行回数 = %d, 期待値 10", runs)
+	}
+}
+
+func TestEventBusStepThroughSwitch(t *testing.T) {
+	n, a, b, s := newTestLAN(t)
+	got := record(b)
+	a.SendPacket(lanPacket(a, b, "hi"))
+	if at, ok := n.Bus.Peek(); !ok || at.Sub(SimulationEpoch) != time.Millisecond {
+		t.Fatalf("次のイベント = %v %v, 期待値 1ms", at.Sub(SimulationEpoch), ok)
+	}
+
+	// 最初の送信の前にAはGratuitous ARPを送るため、スイッチはそれとフレームを続けて受信する
+	for range 2 {
+		if !n.Bus.Step() {
+			t.Fatal("イベントが実行されなかった")
+		}
+	}
+	if entry, ok := s.MACTable[a.dataLinkLayer().MAC]; !ok || entry.LearnedAt.Sub(SimulationEpoch) != time.Millisecond {
+		t.Errorf("2ステップ後のMACテーブル = %v, 期待値は1msに学習したA", s.MACTable)
+	}
+	if _, ok := s.MACTable[b.dataLinkLayer().MAC]; ok {
+		t.Error("まだ送信していないBが学習されている")
+	}
+	if len(got.in) != 0 {
+		t.Errorf("2ステップ後に届いたパケット = %d, 期待値 0", len(got.in))
+	}
+	if at, ok := n.Bus.Peek(); !ok || at.Sub(SimulationEpoch) != 2*time.Millisecond {
+		t.Fatalf("次のイベント = %v %v, 期待値 2ms", at.Sub(SimulationEpoch), ok)
+	}
+
+	n.Bus.Step() // BがフラッディングされたGratuitous ARPを受信する
+	n.Bus.Step() // Bが転送されたフレームを受信する
+	if len(got.in) != 1 || n.Bus.Now().Sub(SimulationEpoch) != 2*time.Millisecond {
+		t.Errorf("4ステップ後に届いたパケット = %d（%v）, 期待値 1（2ms）", len(got.in), n.Bus.Now().Sub(SimulationEpoch))
+	}
+	if n.Bus.Step() {
+		t.Error("イベントが残っていないのにStepがtrueを返した")
+	}
+}
+
+func TestEventBusSimultaneousEventsFIFO(t *testing.T) {
+	eb := NewEventBus()
+	var order []int
+	for i := 0; i < 20; i++ {
+		eb.AddEvent(0, func() { order = append(order, i) })
+	}
+	eb.Run()
+	for i, got := range order {
+		if got != i {
+			t.Fatalf("同時刻のイベントの実行順 = %v, 期待値は追加した順", order)
+		}
+	}
+	if len(order) != 20 || eb.Now() != SimulationEpoch {
+		t.Errorf("実行したイベント = %d（%v）, 期待値 20（0s）", len(order), eb.Now().Sub(SimulationEpoch))
+	}
+}
+
+func TestEventBusMiddleware(t *testing.T) {
+	eb := NewEventBus()
+	var order []string
+	invocations := 0
+	eb.Use(func(e *Event, next func()) { // 外側：全てのイベントを数える
+		invocations++
+		order = append(order, "outer")
+		next()
+	})
+	eb.Use(func(e *Event, next func()) { // 内側：2sのイベントだけスキップする
+		order = append(order, "inner")
+		if e.Time.Sub(SimulationEpoch) == 2*time.Second {
+			return
+		}
+		next()
+	})
+	var ran []time.Duration
+	for _, at := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second} {
+		eb.AddEvent(at, func() { ran = append(ran, eb.Now().Sub(SimulationEpoch)) })
+	}
+	eb.Run()
+	if invocations != 3 {
+		t.Errorf("ミドルウェアの呼び出し = %d, 期待値 3", invocations)
+	}
+	if len(ran) != 2 || ran[0] != time.Second || ran[1] != 3*time.Second {
+		t.Errorf("実行したハンドラ = %v, 期待値 [1s 3s]", ran)
+	}
+	if len(order) != 6 || order[0] != "outer" || order[1] != "inner" {
+		t.Errorf("ミドルウェアの実行順 = %v, 期待値は追加した順に外側から", order)
+	}
+	if eb.Now().Sub(SimulationEpoch) != 3*time.Second {
+		t.Errorf("CurrentTime = %v, 期待値 3s（スキップしても時刻は進む）", eb.Now().Sub(SimulationEpoch))
+	}
+}
+
+func TestEventBusWithoutMiddleware(t *testing.T) {
+	n, a, b, _ := newTestLAN(t)
+	if len(n.Bus.Middleware) != 0 {
+		t.Fatalf("既定のミドルウェア = %d, 期待値 0", len(n.Bus.Middleware))
+	}
+	got := record(b)
+	a.SendPacket(lanPacket(a, b, "hi"))
+	n.Bus.Run()
+	if len(got.in) != 1 {
+		t.Errorf("届いたパケット = %d, 期待値 1", len(got.in))
+	}
+}
+
+func TestEventBusRunUntilThenResume(t *testing.T) {
+	eb := NewEventBus()
+	var ran []time.Duration
+	for _, at := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 4 * time.Second} {
+		eb.AddEvent(at, func() { ran = append(ran, eb.Now().Sub(SimulationEpoch)) })
+	}
+	eb.RunUntil(SimulationEpoch.Add(3 * time.Second)) // 3sちょうどのイベントは含まない
+	if len(ran) != 2 || eb.Now().Sub(SimulationEpoch) != 3*time.Second {
+		t.Fatalf("打ち切りまでに実行 = %v（%v）, 期待値 [1s 2s]（3s）", ran, eb.Now().Sub(SimulationEpoch))
+	}
+	if next, ok := eb.Peek(); !ok || next.Sub(SimulationEpoch) != 3*time.Second {
+		t.Errorf("残っている次のイベント = %v %v, 期待値 3s", next.Sub(SimulationEpoch), ok)
+	}
+	eb.Run()
+	if len(ran) != 4 || ran[2] != 3*time.Second || ran[3] != 4*time.Second {
+		t.Errorf("再開後に実行 = %v, 期待値 [1s 2s 3s 4s]", ran)
+	}
+}
+
+func TestEventBusStop(t *testing.T) {
+	eb := NewEventBus()
+	var ran []int
+	eb.AddEvent(time.Second, func() { ran = append(ran, 1) })
+	eb.AddEvent(2*time.Second, func() {
+		ran = append(ran, 2)
+		eb.Stop() // このハンドラが終わったらRunを返す
+	})
+	eb.AddEvent(3*time.Second, func() { ran = append(ran, 3) })
+	eb.Run()
+	if len(ran) != 2 || eb.Now().Sub(SimulationEpoch) != 2*time.Second {
+		t.Fatalf("停止までに実行 = %v（%v）, 期待値 [1 2]（2s）", ran, eb.Now().Sub(SimulationEpoch))
+	}
+	eb.Run() // 停止の要求は消費済みなので最後まで進む
+	if len(ran) != 3 || ran[2] != 3 {
+		t.Errorf("再開後に実行 = %v, 期待値 [1 2 3]", ran)
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"time"
+)
+
+// fairShareDelayは現在送出中のフローの数で帯域幅を等分したときの、パケットを送出し終えるまでの時間を返す。
+// 同じフローのパケットは前のパケットを送出し終えてから送出を始め、
+// 送出時間は自分を含む送出中のフローの数だけ長くなる。serializationは帯域幅を独占した場合の送出時間。
+func (l *Link) fairShareDelay(p Packet, serialization time.Duration) time.Duration {
+	if serialization <= 0 {
+		return serialization
+	}
+	now := l.Network.Bus.Now()
+	if l.flows == nil {
+		l.flows = make(map[uint32]time.Time)
+	}
+	flow := flowHash(p)
+	active := 1
+	for f, finish := range l.flows {
+		switch {
+		case !finish.After(now):
+			delete(l.flows, f) // 送出を終えたフローは数えない
+		case f != flow:
+			active++
+		}
+	}
+	start := now
+	if finish, ok := l.flows[flow]; ok {
+		start = finish
+	}
+	finish := start.Add(serialization * time.Duration(active))
+	l.flows[flow] = finish
+	if active > 1 {
+		l.Network.log().Debugf("リンク: %s から %s の帯域幅を %d 個のフローで共有%s", l.From.GetName(), l.To.GetName(), active, p.traceTag())
+	}
+	return finish.Sub(now)
+}
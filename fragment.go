@@ -0,0 +1,110 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// DefaultReassemblyTimeoutは断片がそろうのを待つ既定の時間。
+const DefaultReassemblyTimeout = 30 * time.Second
+
+// IsFragmentはパケットが分割された断片かどうかを返す。
+func (p Packet) IsFragment() bool {
+	return p.FragOffset > 0 || p.MoreFragments
+}
+
+// fragmentはデータをMTU以下の断片に分割する。既に断片であれば元のパケット内のオフセットを引き継ぐ。
+func (l *Link) fragment(p Packet) []Packet {
+	if p.FragID == 0 {
+		l.Network.fragID++
+		p.FragID = l.Network.fragID
+	}
+	var frags []Packet
+	for off := 0; off < len(p.Data); off += l.MTU {
+		end := min(off+l.MTU, len(p.Data))
+		f := p
+		f.Data = p.Data[off:end]
+		f.FragOffset = p.FragOffset + off
+		f.MoreFragments = p.MoreFragments || end < len(p.Data)
+		frags = append(frags, f)
+	}
+	l.Network.log().Debugf("リンク: %s から %s へのパケットをMTU %d で %d 個に分割", l.From.GetName(), l.To.GetName(), l.MTU, len(frags))
+	return frags
+}
+
+// fragKeyは同じ元パケットに属する断片を識別する。
+type fragKey struct {
+	SrcIP string
+	ID    int
+}
+
+// reassemblyは再構築中のパケットの断片を保持する。
+type reassembly struct {
+	parts map[int][]byte // オフセットごとの断片データ
+	size  int            // 受信済みのバイト数
+	total int            // 元のデータ長（最後の断片を受信するまで-1）
+
+	timeout EventHandle // 再構築のタイムアウトイベント
+}
+
+// reassembleは断片をバッファに加え、全ての断片がそろえば再構築したパケットを返す。
+// 最初の断片からReassemblyTimeout（未設定なら既定値）以内にそろわなければ破棄する。
+func (nl *NetworkLayer) reassemble(p Packet) (Packet, bool) {
+	key := fragKey{SrcIP: p.SrcIP, ID: p.FragID}
+	if nl.fragments == nil {
+		nl.fragments = make(map[fragKey]*reassembly)
+	}
+	r, ok := nl.fragments[key]
+	if !ok {
+		r = &reassembly{parts: make(map[int][]byte), total: -1}
+		nl.fragments[key] = r
+		nl.scheduleReassemblyTimeout(key, r)
+	}
+	if _, dup := r.parts[p.FragOffset]; !dup {
+		r.parts[p.FragOffset] = p.Data
+		r.size += len(p.Data)
+	}
+	if !p.MoreFragments {
+		r.total = p.FragOffset + len(p.Data)
+	}
+	if r.total < 0 || r.size < r.total {
+		nl.log().Debugf("[IP] %s: 断片を受信 (ID %d, オフセット %d)、残り待機中", nl.IP, p.FragID, p.FragOffset)
+		return Packet{}, false
+	}
+
+	delete(nl.fragments, key)
+	if nl.host != nil && nl.host.Network != nil {
+		nl.host.Network.Bus.Cancel(r.timeout)
+	}
+	offsets := make([]int, 0, len(r.parts))
+	for off := range r.parts {
+		offsets = append(offsets, off)
+	}
+	sort.Ints(offsets)
+	data := make([]byte, 0, r.total)
+	for _, off := range offsets {
+		data = append(data, r.parts[off]...)
+	}
+	p.Data = data
+	p.FragOffset, p.MoreFragments = 0, false
+	nl.log().Debugf("[IP] %s: %d 個の断片からパケットを再構築 (ID %d, %d bytes)", nl.IP, len(offsets), p.FragID, len(data))
+	return p, true
+}
+
+// scheduleReassemblyTimeoutは再構築が時間内に終わらなければバッファを破棄するイベントを登録。
+func (nl *NetworkLayer) scheduleReassemblyTimeout(key fragKey, r *reassembly) {
+	if nl.host == nil || nl.host.Network == nil {
+		return
+	}
+	timeout := nl.ReassemblyTimeout
+	if timeout == 0 {
+		timeout = DefaultReassemblyTimeout
+	}
+	r.timeout = nl.host.Network.Bus.AddEvent(timeout, func() {
+		if nl.fragments[key] == r {
+			delete(nl.fragments, key)
+			nl.countDrop(DropReassembly)
+			nl.log().Warnf("[IP] %s: %s からの断片 (ID %d) がそろわないため破棄", nl.IP, key.SrcIP, key.ID)
+		}
+	})
+}
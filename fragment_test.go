@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// newTestFragmentLANはAからスイッチへのリンクのMTUを1500にしたnewTestLANを作る。
+func newTestFragmentLAN(t *testing.T) (*Network, *Host, *Host, *Link) {
+	n, a, b, s := newTestLAN(t)
+	as := n.GetLink(a, s)
+	as.MTU = 1500
+	return n, a, b, as
+}
+
+// fragmentPayloadは位置ごとに値の異なるsizeバイトのデータを返す。
+func fragmentPayload(size int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	return data
+}
+
+func TestFragmentationReassembles(t *testing.T) {
+	n, a, b, as := newTestFragmentLAN(t)
+	got := record(b)
+	data := fragmentPayload(4000)
+	a.SendPacket(Packet{DstIP: "10.0.0.2", Data: data})
+	n.Bus.Run()
+	if len(got.in) != 1 {
+		t.Fatalf("届いたパケット = %d, 期待値 1", len(got.in))
+	}
+	p := got.in[0]
+	if !bytes.Equal(p.Data, data) {
+		t.Error("再構築したデータが元のデータと一致しない")
+	}
+	if p.IsFragment() {
+		t.Errorf("届いたパケットが断片のまま: オフセット %d, MF %v", p.FragOffset, p.MoreFragments)
+	}
+	if as.Stats.Sent != 2+3 { // Gratuitous ARPとARP要求、1500+1500+1000バイトの断片
+		t.Errorf("MTUのリンクで送出したパケット = %d, 期待値 5", as.Stats.Sent)
+	}
+	if b.networkLayer().fragments[fragKey{SrcIP: "10.0.0.1", ID: p.FragID}] != nil {
+		t.Error("再構築を終えた断片のバッファが残っている")
+	}
+}
+
+func TestFragmentationDropsIncomplete(t *testing.T) {
+	n, _, b, as := newTestFragmentLAN(t)
+	b.networkLayer().ReassemblyTimeout = time.Second
+	got := record(b)
+	for _, f := range as.fragment(NewPacket("10.0.0.1", "10.0.0.2", string(fragmentPayload(4000)))) {
+		if f.FragOffset == 1500 {
+			continue // 2番目の断片を失う
+		}
+		f.DstMAC = "AA:AA:AA:AA:AA:02"
+		b.ReceivePacket(f)
+	}
+	if len(b.networkLayer().fragments) != 1 {
+		t.Fatal("断片のバッファが作られていない")
+	}
+	n.Bus.Run()
+	if len(got.in) != 0 {
+		t.Errorf("断片が欠けたのにパケットが届いた: %v", got.in)
+	}
+	if b.Stats.Dropped[DropReassembly] != 1 {
+		t.Errorf("再構築の失敗による破棄 = %d, 期待値 1", b.Stats.Dropped[DropReassembly])
+	}
+	if len(b.networkLayer().fragments) != 0 {
+		t.Error("タイムアウトした断片のバッファが残っている")
+	}
+	if at := elapsed(n); at != time.Second {
+		t.Errorf("バッファを破棄した時刻 = %v, 期待値 1s", at)
+	}
+}
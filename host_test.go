@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHostEchoApplication(t *testing.T) {
+	n, a, b, _ := newTestLAN(t)
+	b.OnReceive = func(p Packet) {
+		b.Send(p.SrcIP, append([]byte("echo: "), p.Data...))
+	}
+	var replies []Packet
+	var at time.Duration
+	a.OnReceive = func(p Packet) {
+		replies = append(replies, p)
+		at = elapsed(n)
+	}
+	a.Send("10.0.0.2", []byte("ping"))
+	n.Bus.Run()
+	if len(replies) != 1 {
+		t.Fatalf("Aに届いた応答 = %d, 期待値 1", len(replies))
+	}
+	r := replies[0]
+	if string(r.Data) != "echo: ping" || r.SrcIP != "10.0.0.2" || r.SrcMAC != "AA:AA:AA:AA:AA:02" {
+		t.Errorf("応答 = %v", r)
+	}
+	// ARPで2ms×2、要求で2ms、応答はBがARP要求から学習済みのため2ms
+	if at != 8*time.Millisecond {
+		t.Errorf("応答の到着時刻 = %v, 期待値 8ms", at)
+	}
+}
+
+func TestHostOnReceiveOnlyForOwnPackets(t *testing.T) {
+	n, a, b, _ := newTestLAN(t)
+	called := 0
+	b.OnReceive = func(Packet) { called++ }
+	p := lanPacket(a, b, "not mine")
+	p.DstIP = "10.0.0.9"
+	a.SendPacket(p)
+	a.SendPacket(lanPacket(a, b, "mine"))
+	n.Bus.Run()
+	if called != 1 {
+		t.Errorf("OnReceiveの呼び出し = %d, 期待値 1", called)
+	}
+}
+
+func TestHostSendPacketDropReasons(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(n *Network, a, b *Host, s *Switch) *Host // 送信するホストを返す
+		want  DropReason
+		where string
+	}{
+		{"ネットワークに未追加", func(n *Network, a, b *Host, s *Switch) *Host {
+			return newTestHost("X", "AA:AA:AA:AA:AA:09", "10.0.0.9")
+		}, DropNoLink, "X"},
+		{"電源が切れている", func(n *Network, a, b *Host, s *Switch) *Host {
+			n.SetDeviceState(a, false)
+			return a
+		}, DropDeviceOffline, "A"},
+		{"IPアドレスの重複", func(n *Network, a, b *Host, s *Switch) *Host {
+			nl := a.networkLayer()
+			nl.RefuseOnConflict, nl.ConflictMAC = true, "AA:AA:AA:AA:AA:09"
+			return a
+		}, DropIPConflict, "A"},
+		{"フレームが大きすぎる", func(n *Network, a, b *Host, s *Switch) *Host {
+			a.dataLinkLayer().MaxFrameSize = FrameOverhead
+			return a
+		}, DropFrameTooLarge, "A"},
+		{"接続先デバイスがない", func(n *Network, a, b *Host, s *Switch) *Host {
+			a.ConnectedDev = nil
+			return a
+		}, DropNoLink, "A"},
+		{"接続先へのリンクがない", func(n *Network, a, b *Host, s *Switch) *Host {
+			n.RemoveLink(a, s)
+			return a
+		}, DropNoLink, "A"},
+		{"リンクがダウン", func(n *Network, a, b *Host, s *Switch) *Host {
+			n.SetLinkState(a, s, false)
+			return a
+		}, DropLinkDown, "A->S"},
+		{"送信待ちキューが一杯", func(n *Network, a, b *Host, s *Switch) *Host {
+			as := n.GetLink(a, s)
+			as.Bandwidth, as.QueueSize = 8, 1
+			a.SendPacket(lanPacket(a, b, "busy")) // 送出中
+			a.SendPacket(lanPacket(a, b, "queued"))
+			return a
+		}, DropQueueFull, "A->S"},
+		{"送信レートの制限", func(n *Network, a, b *Host, s *Switch) *Host {
+			a.OutLimit = NewTokenBucket(8, 0, RateLimitDrop)
+			return a
+		}, DropRateLimit, "A"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetDefaultLogger(NewWriterLogger(testLogWriter{t}, LevelWarn))
+			defer SetDefaultLogger(defaultLogger)
+			n, a, b, s := newTestLAN(t)
+			skipAnnounce(a)
+			h := tt.setup(n, a, b, s)
+			err := h.SendPacket(lanPacket(h, b, "hello"))
+			var drop *DropError
+			if !errors.As(err, &drop) || drop.Reason != tt.want || drop.Where != tt.where {
+				t.Fatalf("SendPacket = %v, 期待値 %s での %s", err, tt.where, tt.want)
+			}
+			if !errors.Is(err, tt.want) {
+				t.Errorf("errors.Is(err, %s) = false", tt.want)
+			}
+			stats := &h.Stats
+			if strings.Contains(tt.where, "->") { // リンクでの破棄はリンクの統計に記録される
+				stats = &n.GetLink(a, s).Stats
+			}
+			if got := stats.Dropped[tt.want]; got != 1 {
+				t.Errorf("Stats.Dropped[%s] = %d, 期待値 1", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+// Hubは受信したパケットを受信リンク以外の全リンクへそのまま中継するL1のリピータを表す。
+// スイッチと違いMACアドレスを学習しないため、接続された全デバイスが1つの衝突ドメインになる。
+type Hub struct {
+	Name       string   // ハブの名前
+	Network    *Network // ハブが属するネットワーク
+	Stats      Stats    // ハブが処理したパケットの統計
+	poweredOff bool     // 電源が切れていればtrue（ゼロ値は電源が入った状態。Network.SetDeviceStateで変更する）
+}
+
+func (hub *Hub) setNetwork(n *Network) {
+	hub.Network = n
+}
+
+func (hub *Hub) stats() *Stats { return &hub.Stats }
+
+// SendPacketはハブから出る全リンクへパケットを中継。
+func (hub *Hub) SendPacket(p Packet) error {
+	if err := hub.Network.dropOffline(hub.poweredOff, hub.Name, &hub.Stats, p); err != nil {
+		return err
+	}
+	hub.repeat(p, nil)
+	return nil
+}
+
+// ReceivePacketは受信したパケットを全リンクへ中継。
+func (hub *Hub) ReceivePacket(p Packet) {
+	if hub.Network.dropOffline(hub.poweredOff, hub.Name, &hub.Stats, p) != nil {
+		return
+	}
+	hub.Stats.countReceived(p)
+	hub.Network.recordTrace(p, hub.Name, TraceReceive)
+	hub.repeat(p, nil)
+}
+
+// receiveFromはリンク経由で届いたパケットを、そのリンクの送信元以外へ中継。
+func (hub *Hub) receiveFrom(link *Link, p Packet) {
+	if hub.Network.dropOffline(hub.poweredOff, hub.Name, &hub.Stats, p) != nil {
+		return
+	}
+	hub.Stats.countReceived(p)
+	hub.Network.recordTrace(p, hub.Name, TraceReceive)
+	hub.repeat(p, link.From)
+}
+
+// repeatはingress以外へ向かうハブの全リンクへパケットの複製を送る。
+func (hub *Hub) repeat(p Packet, ingress Device) {
+	hub.Network.log().Debugf("[Hub] %s: パケットを全ポートへ中継%s", hub.Name, p.traceTag())
+	for _, l := range hub.Network.Links {
+		if l.From == hub && l.To != ingress {
+			hub.Stats.countSent(p)
+			l.Transmit(p.Clone())
+		}
+	}
+}
+
+func (hub *Hub) GetName() string {
+	return hub.Name
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHubRepeatsUnicastToAllPorts(t *testing.T) {
+	n := newTestNetwork(t)
+	a := newTestHost("A", "AA:AA:AA:AA:AA:01", "10.0.0.1")
+	b := newTestHost("B", "AA:AA:AA:AA:AA:02", "10.0.0.2")
+	c := newTestHost("C", "AA:AA:AA:AA:AA:03", "10.0.0.3")
+	hub := &Hub{Name: "Hub"}
+	for _, d := range []Device{a, b, c, hub} {
+		n.AddDevice(d)
+	}
+	for _, h := range []*Host{a, b, c} {
+		n.AddBidirectionalLink(h, hub, time.Millisecond)
+	}
+	got := 0
+	b.OnReceive = func(Packet) { got++ }
+	b.SendPacket(lanPacket(b, a, "learn")) // スイッチなら以降のAからBへのフレームはBだけに届く
+	n.Bus.Run()
+	a.SendPacket(lanPacket(a, b, "1"))
+	a.SendPacket(lanPacket(a, b, "2"))
+	n.Bus.Run()
+
+	if got != 2 {
+		t.Errorf("Bに届いたパケット = %d, 期待値 2", got)
+	}
+	// AとBが最初の送信の前に送るGratuitous ARPも、ハブは他の全てのポートへ送る
+	if c.Stats.Received != 2+3 || c.Stats.Dropped[DropMACMismatch] != 3 {
+		t.Errorf("Cが受信したフレーム = %d（MAC不一致で破棄 %d）, 期待値 5（3）", c.Stats.Received, c.Stats.Dropped[DropMACMismatch])
+	}
+	if a.Stats.Received != 1+1 {
+		t.Errorf("Aが受信したフレーム = %d, 期待値 2（自分が送ったフレームは戻らない）", a.Stats.Received)
+	}
+	if hub.Stats.Received != 2+3 || hub.Stats.Sent != 2*(2+3) {
+		t.Errorf("ハブの受信 %d, 送出 %d, 期待値 5, 10", hub.Stats.Received, hub.Stats.Sent)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+)
+
+// ICMPTypeはICMPメッセージの種類を表す（値はRFC 792に準拠）。
+type ICMPType int
+
+const (
+	ICMPEchoReply       ICMPType = 0  // エコー応答
+	ICMPDestUnreachable ICMPType = 3  // 宛先到達不能
+	ICMPEchoRequest     ICMPType = 8  // エコー要求
+	ICMPTimeExceeded    ICMPType = 11 // 時間超過
+)
+
+// ICMPMessageはICMPメッセージの内容を表す。
+type ICMPMessage struct {
+	Type      ICMPType // メッセージの種類
+	Code      int      // 種類ごとの詳細コード
+	OrigDstIP string   // エラーの原因となったパケットの宛先IP
+	ID        int      // エコー要求と応答を対応付ける識別子（エラー通知では原因となったエコー要求の値）
+	Seq       int      // エコー要求のシーケンス番号（エラー通知では原因となったエコー要求の値）
+}
+
+// IsErrorはメッセージがエラー通知（到達不能、時間超過）かどうかを返す。
+func (m *ICMPMessage) IsError() bool {
+	return m.Type == ICMPDestUnreachable || m.Type == ICMPTimeExceeded
+}
+
+// Stringはログ用にICMPメッセージの種類を返す。
+func (m *ICMPMessage) String() string {
+	switch m.Type {
+	case ICMPEchoReply:
+		return "エコー応答"
+	case ICMPDestUnreachable:
+		return "宛先到達不能"
+	case ICMPEchoRequest:
+		return "エコー要求"
+	case ICMPTimeExceeded:
+		return "時間超過"
+	}
+	return fmt.Sprintf("ICMP type %d", m.Type)
+}
+
+// sendUnreachableは届けられなかったパケットの送信元へ宛先到達不能メッセージを返送。
+func (r *Router) sendUnreachable(p Packet) {
+	r.sendICMPError(p, ICMPDestUnreachable, fmt.Sprintf("%s に到達できません", p.DstIP))
+}
+
+// sendTimeExceededはTTL切れで破棄したパケットの送信元へ時間超過メッセージを返送。
+// 送信元はメッセージの送信元IPから、どのルータで破棄されたかを知ることができる。
+func (r *Router) sendTimeExceeded(p Packet) {
+	r.sendICMPError(p, ICMPTimeExceeded, fmt.Sprintf("%s への転送中にTTLが切れました", p.DstIP))
+}
+
+// sendICMPErrorはパケットの送信元へICMPのエラー通知を返送する。原因がエコー要求なら識別子と
+// シーケンス番号を引き継ぐ。ICMPエラーへのエラーは生成せず、返送経路がない場合も送らない。
+func (r *Router) sendICMPError(p Packet, typ ICMPType, text string) {
+	if p.ICMP != nil && p.ICMP.IsError() {
+		return
+	}
+	if net.ParseIP(p.SrcIP) == nil {
+		return
+	}
+	msg := &ICMPMessage{Type: typ, OrigDstIP: p.DstIP}
+	if p.ICMP != nil && p.ICMP.Type == ICMPEchoRequest {
+		msg.ID, msg.Seq = p.ICMP.ID, p.ICMP.Seq
+	}
+	reply := Packet{
+		Data:     []byte(text),
+		SrcIP:    r.sourceIP(),
+		DstIP:    p.SrcIP,
+		DstMAC:   p.SrcMAC,
+		TTL:      DefaultTTL,
+		Protocol: ProtocolICMP,
+		ICMP:     msg,
+	}
+	if errors.Is(r.route(reply), DropNoRoute) {
+		r.Network.log().Warnf("[Router] %s: %s への返送経路がないため%sを送信しません", r.Name, p.SrcIP, msg)
+		return
+	}
+	r.Network.log().Debugf("[Router] %s: %s へ%sを送信", r.Name, p.SrcIP, msg)
+}
+
+// handleICMPは自分宛のICMPメッセージを処理する。
+// エコー要求には同じ識別子とシーケンス番号のエコー応答を返し、エコー応答は実行中のpingに渡す。
+func (nl *NetworkLayer) handleICMP(p Packet) {
+	if nl.host == nil {
+		return
+	}
+	switch p.ICMP.Type {
+	case ICMPEchoRequest:
+		nl.host.SendPacket(Packet{
+			Data:     append([]byte(nil), p.Data...),
+			DstIP:    p.SrcIP,
+			DstMAC:   p.SrcMAC,
+			Protocol: ProtocolICMP,
+			ICMP:     &ICMPMessage{Type: ICMPEchoReply, ID: p.ICMP.ID, Seq: p.ICMP.Seq},
+		})
+	case ICMPEchoReply, ICMPTimeExceeded:
+		if ps, ok := nl.host.pings[p.ICMP.ID]; ok {
+			ps.reply(p.ICMP.Seq, p.SrcIP)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import "testing"
+
+// newTestICMPRouterはIP 10.0.0.254のルータRと、10.0.0.0/24の経路の先にあるホストA（10.0.0.1）を作り、
+// Aが受け取ったパケットの記録を返す。
+func newTestICMPRouter(t *testing.T) (*Router, *Host, *recordLayer) {
+	n := newTestNetwork(t)
+	a := newTestHost("A", "AA:AA:AA:AA:AA:01", "10.0.0.1")
+	got := &recordLayer{}
+	a.Layers = append(a.Layers, got)
+	r := &Router{Name: "R", IP: "10.0.0.254"}
+	n.AddDevice(a)
+	n.AddDevice(r)
+	if err := r.AddRoute("10.0.0.0/24", a, 1); err != nil {
+		t.Fatal(err)
+	}
+	return r, a, got
+}
+
+func TestRouterSendsUnreachable(t *testing.T) {
+	r, _, got := newTestICMPRouter(t)
+	r.SendPacket(Packet{SrcIP: "10.0.0.1", DstIP: "198.51.100.1", SrcMAC: "AA:AA:AA:AA:AA:01", TTL: DefaultTTL, Data: []byte("hello")})
+	if len(got.in) != 1 {
+		t.Fatalf("Aに届いたパケット = %d, 期待値 1", len(got.in))
+	}
+	reply := got.in[0]
+	if reply.ICMP == nil || reply.ICMP.Type != ICMPDestUnreachable {
+		t.Fatalf("届いたパケット = %+v, 期待値 宛先到達不能", reply)
+	}
+	if reply.ICMP.OrigDstIP != "198.51.100.1" || reply.SrcIP != "10.0.0.254" || reply.DstIP != "10.0.0.1" {
+		t.Errorf("宛先到達不能メッセージ = %+v", reply)
+	}
+	if r.Stats.Dropped[DropNoRoute] != 1 {
+		t.Errorf("ルータの経路なしによる破棄 = %d, 期待値 1", r.Stats.Dropped[DropNoRoute])
+	}
+}
+
+func TestRouterNoUnreachableWithoutReturnPath(t *testing.T) {
+	r, _, got := newTestICMPRouter(t)
+	// 返送経路のない送信元を装ったパケット
+	r.SendPacket(Packet{SrcIP: "192.0.2.9", DstIP: "198.51.100.1", SrcMAC: "AA:AA:AA:AA:AA:01", TTL: DefaultTTL})
+	if len(got.in) != 0 {
+		t.Errorf("返送経路がないのにメッセージが届いた: %v", got.in)
+	}
+}
+
+func TestNoUnreachableForICMPError(t *testing.T) {
+	r, _, got := newTestICMPRouter(t)
+	r.SendPacket(Packet{SrcIP: "10.0.0.1", DstIP: "198.51.100.1", SrcMAC: "AA:AA:AA:AA:AA:01", TTL: DefaultTTL,
+		ICMP: &ICMPMessage{Type: ICMPDestUnreachable}})
+	if len(got.in) != 0 {
+		t.Errorf("ICMPエラーに対してエラーを返した: %v", got.in)
+	}
+}
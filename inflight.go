@@ -0,0 +1,72 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// PacketInfoはリンクで伝送中のパケット1つの配送予定を表す。
+type PacketInfo struct {
+	Source string    // パケットを送出したデバイスの名前
+	Dest   string    // パケットが届くデバイスの名前
+	Due    time.Time // 宛先に届く予定の仮想時刻
+	Packet Packet    // 伝送中のパケット
+
+	link    *Link // パケットを運んでいるリンク
+	settled bool  // 実行かキャンセルでリンクの伝送中のバイト数から差し引き済みならtrue
+}
+
+// settleはロックを取得済みの状態で、パケットをリンクの伝送中のバイト数から一度だけ差し引く。
+func (pi *PacketInfo) settle() {
+	if !pi.settled {
+		pi.settled = true
+		pi.link.inFlight -= len(pi.Packet.Data)
+	}
+}
+
+// addPacketEventはリンクの配送イベントをパケットの情報付きで追加する。InFlightはこの情報を返す。
+// パケットのデータ長はリンクの伝送中のバイト数に加え、実行かキャンセルの時点で差し引く。
+func (eb *EventBus) addPacketEvent(delay time.Duration, l *Link, p Packet, handler func()) EventHandle {
+	eb.mu.Lock()
+	at := eb.now().Add(delay)
+	info := &PacketInfo{Source: l.From.GetName(), Dest: l.To.GetName(), Due: at, Packet: p, link: l}
+	event := &Event{Time: at, Handler: handler, Packet: info}
+	eb.push(event)
+	l.inFlight += len(p.Data)
+	eb.mu.Unlock()
+	eb.log().Debugf("[EventBus] イベントを追加: 遅延 %v", delay)
+	return EventHandle{event: event}
+}
+
+// PendingCountはキャンセルされずに実行を待っているイベントの数を返す。
+func (eb *EventBus) PendingCount() int {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	count := 0
+	for _, event := range eb.Events {
+		if !event.Cancelled {
+			count++
+		}
+	}
+	return count
+}
+
+// InFlightはリンクで伝送中（配送イベントを待っている）のパケットを、届く予定の早い順に返す。
+// リンクの送信待ちキューで送出を待っているパケットは含まない。
+func (eb *EventBus) InFlight() []PacketInfo {
+	eb.mu.Lock()
+	var events []*Event
+	for _, event := range eb.Events {
+		if event.Packet != nil && !event.Cancelled {
+			events = append(events, event)
+		}
+	}
+	eb.mu.Unlock()
+	sort.Slice(events, func(i, j int) bool { return EventQueue(events).Less(i, j) })
+	infos := make([]PacketInfo, len(events))
+	for i, event := range events {
+		infos[i] = *event.Packet
+		infos[i].Packet = event.Packet.Packet.Clone()
+	}
+	return infos
+}
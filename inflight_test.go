@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEventBusPendingCountAndInFlight(t *testing.T) {
+	n, a, b, _ := newTestLAN(t)
+	skipAnnounce(a, b)
+	a.SendPacket(lanPacket(a, b, "hello"))
+	cancelled := n.Bus.AddEvent(time.Second, func() { t.Error("キャンセルしたイベントが実行された") })
+	n.Bus.Cancel(cancelled)
+
+	if got := n.Bus.PendingCount(); got != 1 {
+		t.Errorf("Run前のPendingCount = %d, 期待値 1", got)
+	}
+	before := n.Bus.InFlight()
+	if len(before) != 1 || before[0].Source != "A" || before[0].Dest != "S" ||
+		before[0].Due != SimulationEpoch.Add(time.Millisecond) || string(before[0].Packet.Data) != "hello" {
+		t.Fatalf("Run前のInFlight = %+v", before)
+	}
+	before[0].Packet.Data[0] = 'j' // 返したパケットは複製で、伝送中のパケットに影響しない
+
+	var pending int
+	var during []PacketInfo
+	n.Bus.AddEvent(1500*time.Microsecond, func() {
+		pending, during = n.Bus.PendingCount(), n.Bus.InFlight()
+	})
+	var got []Packet
+	b.OnReceive = func(p Packet) { got = append(got, p) }
+	runBus(t, n)
+
+	// 1.5msの時点ではスイッチがBへ転送したフレームだけが伝送中
+	if pending != 1 {
+		t.Errorf("Run中のPendingCount = %d, 期待値 1", pending)
+	}
+	if len(during) != 1 || during[0].Source != "S" || during[0].Dest != "B" || during[0].Due != SimulationEpoch.Add(2*time.Millisecond) {
+		t.Errorf("Run中のInFlight = %+v", during)
+	}
+	if got := n.Bus.PendingCount(); got != 0 {
+		t.Errorf("Run後のPendingCount = %d, 期待値 0", got)
+	}
+	if after := n.Bus.InFlight(); len(after) != 0 {
+		t.Errorf("Run後のInFlight = %+v", after)
+	}
+	if len(got) != 1 || string(got[0].Data) != "hello" {
+		t.Errorf("Bに届いたパケット = %v", got)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"net"
+)
+
+// Interfaceはルータがサブネットに直結するインターフェースを表す。
+type Interface struct {
+	Name   string    // インターフェースの名前（AddInterfaceで追加した順に「eth0」から付ける）
+	IP     string    // インターフェースのIPアドレス
+	MAC    string    // インターフェースのMACアドレス（空ならMACを検査しない）
+	Subnet net.IPNet // 直結するサブネット
+	Link   *Link     // サブネットへ送出するリンク
+	InACL  *ACL      // このインターフェースで受信するパケットに適用するACL（nilなら全て通す）
+	OutACL *ACL      // このインターフェースから送出するパケットに適用するACL（nilなら全て通す）
+
+	InLimit  *TokenBucket // このインターフェースで受信するパケットに適用するレートの制限（nilなら制限しない、RIPの広告には適用しない）
+	OutLimit *TokenBucket // このインターフェースから送出するパケットに適用するレートの制限（nilなら制限しない）
+}
+
+// AddInterfaceはCIDR表記のアドレス（例："192.168.1.254/24"）を持つインターフェースを追加。
+func (r *Router) AddInterface(cidr, mac string, link *Link) (*Interface, error) {
+	ip, subnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("不正なインターフェースのアドレス %q: %w", cidr, err)
+	}
+	iface := &Interface{Name: portName("", len(r.Interfaces)), IP: ip.String(), MAC: mac, Subnet: *subnet, Link: link}
+	r.Interfaces = append(r.Interfaces, iface)
+	r.Network.log().Infof("[Router] %s: インターフェース追加 %s (%s)", r.Name, cidr, subnet)
+	return iface, nil
+}
+
+// connectedInterfaceはipを含む直結サブネットのインターフェースを返す（なければnil）。
+func (r *Router) connectedInterface(ip net.IP) *Interface {
+	for _, iface := range r.Interfaces {
+		if iface.Subnet.Contains(ip) {
+			return iface
+		}
+	}
+	return nil
+}
+
+// interfaceToはdへのリンクを持つインターフェースを返す（なければnil）。
+func (r *Router) interfaceTo(d Device) *Interface {
+	for _, iface := range r.Interfaces {
+		if iface.Link != nil && iface.Link.To == d {
+			return iface
+		}
+	}
+	return nil
+}
+
+// ownsIPはipがルータ自身のアドレスかどうかを返す。
+func (r *Router) ownsIP(ip string) bool {
+	if ip == "" {
+		return false
+	}
+	if sameIP(ip, r.IP) {
+		return true
+	}
+	for _, iface := range r.Interfaces {
+		if sameIP(iface.IP, ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// sourceIPはルータが生成するパケットの送信元IPを返す。
+func (r *Router) sourceIP() string {
+	if r.IP == "" && len(r.Interfaces) > 0 {
+		return r.Interfaces[0].IP
+	}
+	return r.IP
+}
+
+// deliverConnectedは直結サブネット上の宛先へ、ARPで解決したMACアドレスでパケットを送る。
+func (r *Router) deliverConnected(iface *Interface, p Packet) error {
+	if iface.Link == nil {
+		r.Stats.countDrop(DropNoLink)
+		r.Network.log().Warnf("[Router] %s: インターフェース %s にリンクがないためパケットを破棄", r.Name, iface.IP)
+		return dropError(r.Name, DropNoLink)
+	}
+	if !iface.OutACL.permits(r.Network, p, "%s インターフェース %s 送信", r.Name, iface.IP) {
+		r.Stats.countDrop(DropACL)
+		return dropError(r.Name, DropACL)
+	}
+	mac, ok := r.arpTable[p.DstIP]
+	if !ok {
+		r.resolveARP(iface, p)
+		return nil
+	}
+	p.SrcMAC = iface.MAC
+	p.DstMAC = mac
+	r.Network.log().Debugf("[Router] %s: 直結サブネット %s の %s へ配送", r.Name, &iface.Subnet, p.DstIP)
+	r.Stats.countSent(p)
+	return iface.OutLimit.transmit(r.Network, &r.Stats, r.Name, iface.Link, p)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net"
+	"testing"
+)
+
+func TestRouterForwardsBetweenConnectedSubnets(t *testing.T) {
+	n, a, b, r := newTestRoutedNet(t)
+	var toA, toB []Packet
+	a.OnReceive = func(p Packet) { toA = append(toA, p) }
+	b.OnReceive = func(p Packet) { toB = append(toB, p) }
+	a.Send("203.0.113.1", []byte("a->b"))
+	b.Send("10.0.0.1", []byte("b->a"))
+	n.Bus.Run()
+	if len(r.Table.Routes) != 0 {
+		t.Fatalf("経路表が空でない: %v", r.Table.Routes)
+	}
+	for _, c := range []struct {
+		got    []Packet
+		data   string
+		srcMAC string // 宛先側のインターフェースのMAC
+	}{{toB, "a->b", "RR:RR:RR:RR:RR:02"}, {toA, "b->a", "RR:RR:RR:RR:RR:01"}} {
+		if len(c.got) != 1 {
+			t.Fatalf("%s: 届いたパケット = %d, 期待値 1", c.data, len(c.got))
+		}
+		p := c.got[0]
+		if string(p.Data) != c.data || p.SrcMAC != c.srcMAC || p.TTL != DefaultTTL-1 {
+			t.Errorf("%s: 届いたパケット = %v (TTL %d)", c.data, p, p.TTL)
+		}
+	}
+	if mac := r.arpTable["203.0.113.1"]; mac != "AA:AA:AA:AA:AA:02" {
+		t.Errorf("ルータのARPテーブル = %q, 期待値 AA:AA:AA:AA:AA:02", mac)
+	}
+}
+
+func TestRouterInterfaces(t *testing.T) {
+	_, _, _, r := newTestRoutedNet(t)
+	if _, err := r.AddInterface("10.0.0.300/24", "", nil); err == nil {
+		t.Error("不正なCIDRでエラーにならない")
+	}
+	if len(r.Interfaces) != 2 {
+		t.Fatalf("インターフェース = %v", r.Interfaces)
+	}
+	tests := []struct {
+		ip   string
+		want *Interface
+	}{
+		{"10.0.0.77", r.Interfaces[0]},
+		{"203.0.113.200", r.Interfaces[1]},
+		{"198.51.100.1", nil},
+	}
+	for _, tt := range tests {
+		if got := r.connectedInterface(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("connectedInterface(%s) = %v, 期待値 %v", tt.ip, got, tt.want)
+		}
+	}
+	if !r.ownsIP("203.0.113.254") || r.ownsIP("203.0.113.1") {
+		t.Error("ownsIPがインターフェースのアドレスを正しく判定しない")
+	}
+	if r.sourceIP() != "10.0.0.254" {
+		t.Errorf("sourceIP = %s, 期待値 10.0.0.254", r.sourceIP())
+	}
+}
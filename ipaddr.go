@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net"
+	"strconv"
+	"strings"
+)
+
+// sameIPは2つのアドレス文字列が同じIPアドレスを表すかを返す。
+// IPv6の省略表記や大文字小文字の違いを吸収し、どちらかがIPアドレスでなければ文字列として比べる。
+func sameIP(a, b string) bool {
+	ipA, ipB := net.ParseIP(a), net.ParseIP(b)
+	if ipA == nil || ipB == nil {
+		return a == b
+	}
+	return ipA.Equal(ipB)
+}
+
+// canonicalIPはIPアドレスを標準の表記（IPv6なら小文字の省略形）にする（IPアドレスでなければそのまま返す）。
+// ARPテーブルなど文字列をキーにする表で、同じアドレスが別の表記で引かれないようにする。
+func canonicalIP(s string) string {
+	if ip := net.ParseIP(s); ip != nil {
+		return ip.String()
+	}
+	return s
+}
+
+// ipBytesはアドレス文字列をIPv4なら4バイト、IPv6なら16バイトに変換（不正な場合は4バイトの0）。
+func ipBytes(s string) []byte {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return make([]byte, 4)
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return v4
+	}
+	return ip
+}
+
+// maskはSubnetMaskをIPアドレスに合わせたマスクに変換する（解釈できなければnil）。
+// SubnetMaskはIPv4の「255.255.255.0」のようなマスクか、IPv6で使う「64」「/64」のようなプレフィックス長で指定する。
+func (nl *NetworkLayer) mask() net.IPMask {
+	ip := net.ParseIP(nl.IP)
+	if ip == nil {
+		return nil
+	}
+	bits := 8 * net.IPv6len
+	if ip.To4() != nil {
+		bits = 8 * net.IPv4len
+	}
+	if m := net.ParseIP(nl.SubnetMask); m != nil {
+		m4 := m.To4()
+		if (m4 != nil) != (bits == 8*net.IPv4len) { // IPv4とIPv6のマスクを取り違えている
+			return nil
+		}
+		if m4 != nil {
+			return net.IPMask(m4)
+		}
+		return net.IPMask(m.To16())
+	}
+	ones, err := strconv.Atoi(strings.TrimPrefix(nl.SubnetMask, "/"))
+	if err != nil || ones < 0 || ones > bits {
+		return nil
+	}
+	return net.CIDRMask(ones, bits)
+}
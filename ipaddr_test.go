@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// newTestRoutedNet6はnewTestRoutedNetと同じ構成を、ホストA（2001:db8:1::1/64）と
+// B（2001:db8:2::1/64）、ルータRのインターフェース2001:db8:1::fe/64と2001:db8:2::fe/64で作る。
+func newTestRoutedNet6(t testing.TB) (*Network, *Host, *Host, *Router) {
+	t.Helper()
+	n := newTestNetwork(t)
+	a := newTestHost("A", "AA:AA:AA:AA:AA:01", "2001:db8:1::1")
+	b := newTestHost("B", "AA:AA:AA:AA:AA:02", "2001:db8:2::1")
+	a.networkLayer().SubnetMask, a.networkLayer().Gateway = "64", "2001:db8:1::fe"
+	b.networkLayer().SubnetMask, b.networkLayer().Gateway = "/64", "2001:DB8:2::FE" // 大文字の表記でも同じアドレス
+	r := &Router{Name: "R"}
+	n.AddDevice(a)
+	n.AddDevice(b)
+	n.AddDevice(r)
+	ra, _ := n.AddBidirectionalLink(r, a, time.Millisecond)
+	rb, _ := n.AddBidirectionalLink(r, b, time.Millisecond)
+	if _, err := r.AddInterface("2001:db8:1::fe/64", "RR:RR:RR:RR:RR:01", ra); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.AddInterface("2001:db8:2::fe/64", "RR:RR:RR:RR:RR:02", rb); err != nil {
+		t.Fatal(err)
+	}
+	return n, a, b, r
+}
+
+func TestRouterForwardsIPv6(t *testing.T) {
+	n, a, b, r := newTestRoutedNet6(t)
+	var toA, toB []Packet
+	a.OnReceive = func(p Packet) { toA = append(toA, p) }
+	b.OnReceive = func(p Packet) {
+		toB = append(toB, p)
+		b.Send(p.SrcIP, []byte("pong"))
+	}
+	a.Send("2001:db8:2:0:0:0:0:1", []byte("ping")) // 省略しない表記の宛先
+	runBus(t, n)
+	if len(toB) != 1 || string(toB[0].Data) != "ping" || toB[0].SrcMAC != "RR:RR:RR:RR:RR:02" || toB[0].TTL != DefaultTTL-1 {
+		t.Fatalf("Bに届いたパケット = %v", toB)
+	}
+	if len(toA) != 1 || string(toA[0].Data) != "pong" || !sameIP(toA[0].SrcIP, "2001:db8:2::1") {
+		t.Fatalf("Aに届いた応答 = %v", toA)
+	}
+	if mac := r.arpTable["2001:db8:2::1"]; mac != "AA:AA:AA:AA:AA:02" {
+		t.Errorf("ルータのアドレス解決の表 = %q, 期待値 AA:AA:AA:AA:AA:02", mac)
+	}
+}
+
+func TestNetworkLayerMaskIPv6(t *testing.T) {
+	tests := []struct {
+		ip, mask string
+		want     int // マスクの1のビット数（-1ならnil）
+	}{
+		{"10.0.0.1", "255.255.255.0", 24},
+		{"10.0.0.1", "24", 24},
+		{"2001:db8::1", "64", 64},
+		{"2001:db8::1", "/48", 48},
+		{"2001:db8::1", "ffff:ffff:ffff:ffff::", 64},
+		{"2001:db8::1", "255.255.255.0", -1}, // IPv6にIPv4のマスクは使えない
+		{"10.0.0.1", "64", -1},
+		{"2001:db8::1", "129", -1},
+		{"not-an-ip", "24", -1},
+	}
+	for _, tt := range tests {
+		nl := &NetworkLayer{IP: tt.ip, SubnetMask: tt.mask}
+		m := nl.mask()
+		got := -1
+		if m != nil {
+			got, _ = m.Size()
+		}
+		if got != tt.want {
+			t.Errorf("mask(%s, %s) = %v, 期待値 /%d", tt.ip, tt.mask, m, tt.want)
+		}
+	}
+	if !sameIP("2001:DB8::1", "2001:db8:0:0:0:0:0:1") || sameIP("2001:db8::1", "2001:db8::2") {
+		t.Error("sameIPがIPv6の表記の違いを正しく扱わない")
+	}
+}
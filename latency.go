@@ -0,0 +1,101 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+// LatencyRecorderはホストのアプリケーション層に届いたパケットのエンドツーエンドの遅延を記録し、
+// 区間ごとの度数と百分位数を求める。遅延は仮想時計で記録した送信時刻と受信時刻の差を使う。
+type LatencyRecorder struct {
+	Bins []time.Duration // 度数分布の区間の上限（昇順、最後の上限を超える遅延は最後の区間の次に数える）
+
+	mu      sync.Mutex      // samplesを保護する
+	samples []time.Duration // 記録した遅延（届いた順）
+}
+
+// NewLatencyRecorderは区間の上限binsで度数を数えるLatencyRecorderを作成。binsは昇順に並べ替える。
+func NewLatencyRecorder(bins ...time.Duration) *LatencyRecorder {
+	bins = slices.Clone(bins)
+	slices.Sort(bins)
+	return &LatencyRecorder{Bins: bins}
+}
+
+// Attachはホストに届いたパケットの遅延を記録するようにする。既存のOnReceiveは記録の後に呼ばれる。
+// 送信時刻か受信時刻が設定されていないパケットは記録しない。
+func (lr *LatencyRecorder) Attach(h *Host) {
+	prev := h.OnReceive
+	h.OnReceive = func(p Packet) {
+		if !p.SentAt.IsZero() && !p.ReceivedAt.IsZero() {
+			lr.Record(p.ReceivedAt.Sub(p.SentAt))
+		}
+		if prev != nil {
+			prev(p)
+		}
+	}
+}
+
+// AttachNetworkはネットワーク内の全てのホストにAttachする。
+func (lr *LatencyRecorder) AttachNetwork(n *Network) {
+	for _, d := range n.Devices {
+		if h, ok := d.(*Host); ok {
+			lr.Attach(h)
+		}
+	}
+}
+
+// Recordは遅延dを1つ記録する。
+func (lr *LatencyRecorder) Record(d time.Duration) {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	lr.samples = append(lr.samples, d)
+}
+
+// Countは記録した遅延の数を返す。
+func (lr *LatencyRecorder) Count() int {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	return len(lr.samples)
+}
+
+// Meanは記録した遅延の平均を返す。記録がなければ0を返す。
+func (lr *LatencyRecorder) Mean() time.Duration {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	if len(lr.samples) == 0 {
+		return 0
+	}
+	var total time.Duration
+	for _, d := range lr.samples {
+		total += d
+	}
+	return total / time.Duration(len(lr.samples))
+}
+
+// Histogramは区間ごとの度数を返す。i番目はBins[i-1]より大きくBins[i]以下の遅延の数で、
+// 最後の要素はBinsの最後の上限を超えた遅延の数（長さはlen(Bins)+1）。
+func (lr *LatencyRecorder) Histogram() []int {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	counts := make([]int, len(lr.Bins)+1)
+	for _, d := range lr.samples {
+		i, _ := slices.BinarySearch(lr.Bins, d)
+		counts[i]++
+	}
+	return counts
+}
+
+// Percentileは記録した遅延のq百分位数（0〜100）を最近順位法で返す。記録がなければ0を返す。
+func (lr *LatencyRecorder) Percentile(q float64) time.Duration {
+	lr.mu.Lock()
+	sorted := slices.Clone(lr.samples)
+	lr.mu.Unlock()
+	if len(sorted) == 0 {
+		return 0
+	}
+	slices.Sort(sorted)
+	rank := int(math.Ceil(q / 100 * float64(len(sorted))))
+	return sorted[min(max(rank, 1), len(sorted))-1]
+}
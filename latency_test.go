@@ -0,0 +1,55 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestLatencyRecorder(t *testing.T) {
+	n, a, b, s := newTestLAN(t)
+	skipAnnounce(a, b)
+	n.GetLink(a, s).Bandwidth = 8_000 // 1バイトの送出に1ms
+	var received int
+	b.OnReceive = func(Packet) { received++ } // 記録の後に既存のOnReceiveも呼ばれる
+	lr := NewLatencyRecorder(10*time.Millisecond, 5*time.Millisecond)
+	lr.AttachNetwork(n)
+	for size := 1; size <= 10; size++ { // 遅延はリンク2本の2msと送出のsize ms
+		n.Bus.AddEvent(time.Duration(size)*100*time.Millisecond, func() {
+			a.SendPacket(lanPacket(a, b, string(make([]byte, size))))
+		})
+	}
+	runBus(t, n)
+
+	if lr.Count() != 10 || received != 10 {
+		t.Fatalf("記録した遅延 = %d, OnReceive = %d, 期待値 10", lr.Count(), received)
+	}
+	for _, c := range []struct {
+		name string
+		got  time.Duration
+		want time.Duration
+	}{
+		{"最小", lr.Percentile(0), 3 * time.Millisecond},
+		{"平均", lr.Mean(), 7500 * time.Microsecond},
+		{"50百分位数", lr.Percentile(50), 7 * time.Millisecond},
+		{"90百分位数", lr.Percentile(90), 11 * time.Millisecond},
+		{"最大", lr.Percentile(100), 12 * time.Millisecond},
+	} {
+		if c.got != c.want {
+			t.Errorf("%s = %v, 期待値 %v", c.name, c.got, c.want)
+		}
+	}
+	if got := lr.Histogram(); !slices.Equal(got, []int{3, 5, 2}) {
+		t.Errorf("Histogram = %v, 期待値 [3 5 2]", got)
+	}
+}
+
+func TestLatencyRecorderEmpty(t *testing.T) {
+	lr := NewLatencyRecorder(time.Millisecond)
+	if lr.Count() != 0 || lr.Mean() != 0 || lr.Percentile(50) != 0 {
+		t.Errorf("記録がないときの Count/Mean/Percentile = %d/%v/%v", lr.Count(), lr.Mean(), lr.Percentile(50))
+	}
+	if got := lr.Histogram(); !slices.Equal(got, []int{0, 0}) {
+		t.Errorf("Histogram = %v, 期待値 [0 0]", got)
+	}
+}
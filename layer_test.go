@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDataLinkHandleOutgoingIsAdditive(t *testing.T) {
+	dl := &DataLinkLayer{Name: "DataLink", MAC: "AA:AA:AA:AA:AA:01"}
+	tests := []struct {
+		name     string
+		in       Packet
+		src, dst string
+	}{
+		{"指定した宛先MACは変えない", Packet{DstIP: "10.0.0.2", DstMAC: "AA:AA:AA:AA:AA:02"}, "AA:AA:AA:AA:AA:01", "AA:AA:AA:AA:AA:02"},
+		{"指定した送信元MACは変えない", Packet{SrcMAC: "AA:AA:AA:AA:AA:09", DstMAC: "AA:AA:AA:AA:AA:02"}, "AA:AA:AA:AA:AA:09", "AA:AA:AA:AA:AA:02"},
+		{"宛先IPがあればARPに任せる", Packet{DstIP: "10.0.0.2"}, "AA:AA:AA:AA:AA:01", ""},
+		{"宛先IPもなければブロードキャスト", Packet{}, "AA:AA:AA:AA:AA:01", BroadcastMAC},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := dl.HandleOutgoing(tt.in)
+			if p.SrcMAC != tt.src || p.DstMAC != tt.dst {
+				t.Errorf("MAC = %q -> %q, 期待値 %q -> %q", p.SrcMAC, p.DstMAC, tt.src, tt.dst)
+			}
+		})
+	}
+}
+
+func TestHostKeepsPresetDstMAC(t *testing.T) {
+	n, a, b, _ := newTestLAN(t)
+	a.networkLayer().learnARP("10.0.0.2", "AA:AA:AA:AA:AA:07") // 古いARPのエントリより指定したMACを優先する
+	got := record(b)
+	a.SendPacket(lanPacket(a, b, "hello"))
+	n.Bus.Run()
+	if len(got.in) != 1 || got.in[0].DstMAC != "AA:AA:AA:AA:AA:02" {
+		t.Errorf("届いたパケット = %v", got.in)
+	}
+}
+
+func TestHostBroadcastsWithoutDestination(t *testing.T) {
+	n, a, b, _ := newTestLAN(t)
+	a.SendPacket(Packet{Data: []byte("anyone?")})
+	n.Bus.Run()
+	if b.Stats.Received != 1+1 {
+		t.Errorf("Bが受信したパケット = %d, 期待値 2（Gratuitous ARPとブロードキャスト）", b.Stats.Received)
+	}
+}
+
+func TestDataLinkDropsOversizedFrame(t *testing.T) {
+	n, a, b, _ := newTestLAN(t)
+	a.dataLinkLayer().MaxFrameSize = 100
+	got := record(b)
+	if err := a.SendPacket(lanPacket(a, b, string(make([]byte, 100-FrameOverhead)))); err != nil {
+		t.Fatalf("最大フレーム長ちょうどのSendPacket: %v", err)
+	}
+	err := a.SendPacket(lanPacket(a, b, string(make([]byte, 100-FrameOverhead+1))))
+	var drop *DropError
+	if !errors.As(err, &drop) || drop.Reason != DropFrameTooLarge || drop.Where != "A" {
+		t.Errorf("最大フレーム長を超えたSendPacket = %v, 期待値 Aでの%s", err, DropFrameTooLarge)
+	}
+	runBus(t, n)
+	if len(got.in) != 1 || len(got.in[0].Data) != 100-FrameOverhead {
+		t.Errorf("届いたパケット = %d, 期待値は最大フレーム長ちょうどの1つ", len(got.in))
+	}
+	if d := a.Stats.Dropped[DropFrameTooLarge]; d != 1 {
+		t.Errorf("Aの%s = %d, 期待値 1", DropFrameTooLarge, d)
+	}
+}
+
+// dropLayerはデータがdropと一致するパケットを破棄するレイヤー。
+type dropLayer struct{ drop string }
+
+func (l *dropLayer) HandleOutgoing(p Packet) Packet { return p }
+func (l *dropLayer) HandleIncoming(p Packet) (Packet, bool) {
+	return p, string(p.Data) != l.drop
+}
+func (l *dropLayer) GetName() string { return "Drop" }
+
+func TestLayerDropStopsUpperLayers(t *testing.T) {
+	n, a, b, _ := newTestLAN(t)
+	skipAnnounce(a, b)
+	// データリンク層の直後で破棄し、ネットワーク層と記録用の最上位のレイヤーへ渡さない
+	b.Layers = []Layer{b.Layers[0], &dropLayer{drop: "blocked"}, b.Layers[1]}
+	got := record(b)
+	var delivered []string
+	b.OnReceive = func(p Packet) { delivered = append(delivered, string(p.Data)) }
+	a.SendPacket(lanPacket(a, b, "blocked"))
+	a.SendPacket(lanPacket(a, b, "allowed"))
+	runBus(t, n)
+	if len(got.in) != 1 || string(got.in[0].Data) != "allowed" {
+		t.Errorf("最上位のレイヤーに届いたパケット = %v", got.in)
+	}
+	if len(delivered) != 1 || delivered[0] != "allowed" {
+		t.Errorf("OnReceiveに渡ったパケット = %v, 期待値 [allowed]", delivered)
+	}
+}
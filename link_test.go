@@ -0,0 +1,218 @@
+package main
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestLinkSerializationDelay(t *testing.T) {
+	tests := []struct {
+		name      string
+		bandwidth int64
+		size      int
+		want      time.Duration
+	}{
+		{"1Mbpsで125000バイト", 1_000_000, 125_000, time.Second},
+		{"1Mbpsで1500バイト", 1_000_000, 1500, 12 * time.Millisecond},
+		{"帯域幅が無制限", 0, 125_000, 0},
+		{"空のデータ", 1_000_000, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &Link{Delay: time.Millisecond, Bandwidth: tt.bandwidth}
+			if got := l.SerializationDelay(Packet{Data: make([]byte, tt.size)}); got != tt.want {
+				t.Errorf("SerializationDelay = %v, 期待値 %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSerializationDelayValue(t *testing.T) {
+	l := &Link{Bandwidth: 8_000}
+	if got := l.SerializationDelay(Packet{Data: make([]byte, 10)}); got != 10*time.Millisecond {
+		t.Errorf("SerializationDelay = %v, 期待値 10ms", got)
+	}
+}
+
+// sendWithLossはロス率rateと種seedのリンクでcount個のパケットを送り、届いた数を返す。
+func sendWithLoss(t *testing.T, rate float64, seed int64, count int) (int, *Link) {
+	n, ab, got := newTestQueuedLink(t, 0, 0)
+	ab.LossRate = rate
+	ab.Rand = rand.New(rand.NewSource(seed))
+	for i := 0; i < count; i++ {
+		ab.Transmit(queuedPacket(10, i+1))
+	}
+	n.Bus.Run()
+	return len(got.packets), ab
+}
+
+func TestLinkLossWithSeed(t *testing.T) {
+	delivered, ab := sendWithLoss(t, 0.3, 42, 100)
+	if delivered != 69 {
+		t.Errorf("届いたパケット = %d/100, 期待値 69", delivered)
+	}
+	if ab.Stats.Dropped[DropLoss] != 100-delivered {
+		t.Errorf("ロスによる破棄 = %d, 期待値 %d", ab.Stats.Dropped[DropLoss], 100-delivered)
+	}
+	if again, _ := sendWithLoss(t, 0.3, 42, 100); again != delivered {
+		t.Errorf("同じ種で届いた数が変わった: %d と %d", delivered, again)
+	}
+}
+
+func TestLinkLossExtremes(t *testing.T) {
+	if got, _ := sendWithLoss(t, 0, 1, 50); got != 50 {
+		t.Errorf("ロス率0で届いた数 = %d, 期待値 50", got)
+	}
+	if got, _ := sendWithLoss(t, 1, 1, 50); got != 0 {
+		t.Errorf("ロス率1で届いた数 = %d, 期待値 0", got)
+	}
+}
+
+// sendWithJitterは揺らぎのあるAからBへのリンクでcount個のパケットを1msおきに送り、
+// 届いた順のシーケンス番号と遅延を返す。
+func sendWithJitter(t *testing.T, delay, jitter time.Duration, reorder bool, count int) ([]int, []time.Duration) {
+	n := newTestNetwork(t)
+	a := newTestHost("A", "AA:AA:AA:AA:AA:01", "10.0.0.1")
+	b := newTestHost("B", "AA:AA:AA:AA:AA:02", "10.0.0.2")
+	n.AddDevice(a)
+	n.AddDevice(b)
+	ab, _ := n.AddBidirectionalLink(a, b, delay)
+	ab.Jitter, ab.Reorder = jitter, reorder
+	ab.Rand = rand.New(rand.NewSource(7))
+	var seqs []int
+	var delays []time.Duration
+	b.OnReceive = func(p Packet) {
+		seqs = append(seqs, p.Seq)
+		delays = append(delays, elapsed(n)-time.Duration(p.Seq-1)*time.Millisecond)
+	}
+	for seq := 1; seq <= count; seq++ {
+		p := Packet{SrcIP: "10.0.0.1", DstIP: "10.0.0.2", SrcMAC: "AA:AA:AA:AA:AA:01", DstMAC: "AA:AA:AA:AA:AA:02", Seq: seq}
+		n.Bus.AddEvent(time.Duration(seq-1)*time.Millisecond, func() { ab.Transmit(p) })
+	}
+	n.Bus.Run()
+	if len(seqs) != count {
+		t.Fatalf("届いたパケット = %d, 期待値 %d", len(seqs), count)
+	}
+	return seqs, delays
+}
+
+func TestLinkJitterWindowAndReorder(t *testing.T) {
+	seqs, delays := sendWithJitter(t, 20*time.Millisecond, 10*time.Millisecond, true, 50)
+	distinct := make(map[time.Duration]bool)
+	for i, d := range delays {
+		if d < 10*time.Millisecond || d > 30*time.Millisecond {
+			t.Errorf("パケット %d の遅延 %v が 20ms±10ms の範囲外", seqs[i], d)
+		}
+		distinct[d] = true
+	}
+	if len(distinct) < 10 {
+		t.Errorf("遅延がほとんど揺らいでいない: %d 種類", len(distinct))
+	}
+	if slices.IsSorted(seqs) {
+		t.Error("揺らぎが送信間隔より大きいのに順序が入れ替わらない")
+	}
+	again, _ := sendWithJitter(t, 20*time.Millisecond, 10*time.Millisecond, true, 50)
+	if !slices.Equal(seqs, again) {
+		t.Error("同じシードで到着順が再現しない")
+	}
+}
+
+func TestLinkJitterKeepsOrderByDefault(t *testing.T) {
+	seqs, _ := sendWithJitter(t, 20*time.Millisecond, 10*time.Millisecond, false, 50)
+	if !slices.IsSorted(seqs) {
+		t.Errorf("Reorderが無効なのに順序が入れ替わった: %v", seqs)
+	}
+}
+
+func TestLinkJitterNeverNegative(t *testing.T) {
+	_, delays := sendWithJitter(t, time.Millisecond, 5*time.Millisecond, true, 50)
+	for _, d := range delays {
+		if d < 0 {
+			t.Fatalf("負の遅延 %v", d)
+		}
+	}
+}
+
+// sendWithBitErrorsはビット誤り率berのリンクでcount個のパケットを送り、届いたパケットを返す。
+func sendWithBitErrors(t *testing.T, ber float64, count int) ([]Packet, *Link) {
+	n, ab, got := newTestQueuedLink(t, 0, 0)
+	ab.BitErrorRate = ber
+	ab.Rand = rand.New(rand.NewSource(1))
+	for i := 0; i < count; i++ {
+		ab.Transmit(queuedPacket(10, i+1))
+	}
+	runBus(t, n)
+	return got.packets, ab
+}
+
+func TestLinkBitErrorRateExtremes(t *testing.T) {
+	got, ab := sendWithBitErrors(t, 1, 20)
+	if len(got) != 20 || ab.Corruptions != 20 {
+		t.Fatalf("誤り率1で届いたパケット = %d, 壊したパケット = %d, 期待値 20, 20", len(got), ab.Corruptions)
+	}
+	for _, p := range got {
+		flipped := 0
+		for _, b := range p.Data {
+			for ; b != 0; b &= b - 1 {
+				flipped++
+			}
+		}
+		if !p.Corrupted || flipped != 1 {
+			t.Errorf("パケット %d: Corrupted = %v, 反転したビット = %d, 期待値 true, 1", p.Seq, p.Corrupted, flipped)
+		}
+	}
+
+	got, ab = sendWithBitErrors(t, 0, 20)
+	if len(got) != 20 || ab.Corruptions != 0 {
+		t.Errorf("誤り率0で届いたパケット = %d, 壊したパケット = %d, 期待値 20, 0", len(got), ab.Corruptions)
+	}
+	for _, p := range got {
+		if p.Corrupted || slices.ContainsFunc(p.Data, func(b byte) bool { return b != 0 }) {
+			t.Errorf("誤り率0でパケット %d が壊れた: % x", p.Seq, p.Data)
+		}
+	}
+}
+
+// fairShareFinishは帯域幅を等分するリンクで、flows個のフローが同時に4個ずつ100バイトのパケットを交互に送ったとき、
+// フローごとに最後のパケットが届いた時刻を返す。帯域幅を独占すれば1パケットの送出に10msかかる。
+func fairShareFinish(t *testing.T, flows int) []time.Duration {
+	n, ab, got := newTestQueuedLink(t, 80_000, 0)
+	ab.FairShare = true
+	for i := 0; i < 4; i++ {
+		for f := 0; f < flows; f++ {
+			p := queuedPacket(100, i)
+			p.SrcPort = 5000 + f
+			ab.Transmit(p)
+		}
+	}
+	runBus(t, n)
+	if len(got.packets) != 4*flows {
+		t.Fatalf("届いたパケット = %d, 期待値 %d", len(got.packets), 4*flows)
+	}
+	finish := make([]time.Duration, flows)
+	for i, p := range got.packets {
+		f := p.SrcPort - 5000
+		finish[f] = max(finish[f], got.at[i])
+	}
+	return finish
+}
+
+func TestLinkFairShareSplitsBandwidth(t *testing.T) {
+	alone := fairShareFinish(t, 1)
+	if alone[0] != 41*time.Millisecond { // 送出の4×10msと伝搬遅延の1ms
+		t.Fatalf("1つのフローが送り終える時刻 = %v, 期待値 41ms", alone[0])
+	}
+	// 2つのフローはそれぞれ半分の帯域幅で送るため、どちらも1つの場合の約2倍の時間がかかり、
+	// 終わる時刻の差は1パケット分の送出時間以内になる
+	shared := fairShareFinish(t, 2)
+	for f, at := range shared {
+		if at < 71*time.Millisecond || at > 81*time.Millisecond {
+			t.Errorf("フロー %d が送り終える時刻 = %v, 期待値 71ms〜81ms", f, at)
+		}
+	}
+	if d := shared[1] - shared[0]; d < -10*time.Millisecond || d > 10*time.Millisecond {
+		t.Errorf("2つのフローが送り終える時刻の差 = %v, 期待値 10ms以内", d)
+	}
+}
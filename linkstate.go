@@ -0,0 +1,73 @@
+package main
+
+import (
+	"time"
+)
+
+// SetLinkStateはfromからtoへのリンクをアップ（up=true）またはダウンにする。逆方向のリンクは変更しない。
+// ダウン中のリンクに送ったパケットと伝送中のパケットは破棄される。送信待ちキューのパケットは
+// ダウン中は送出せずに保持し、アップすると送出を再開する。
+// 状態が変わると、ComputeRoutesで経路を求めたルータは経路を再計算し、
+// RIPで学習した経路のうちダウンしたリンクの先を次ホップとするものは取り除き、次の広告で取り消しを伝える。
+func (n *Network) SetLinkState(from, to Device, up bool) {
+	link, ok := n.linkIndex[[2]Device{from, to}]
+	if !ok {
+		n.log().Warnf("[Network] 状態を変更するリンクが見つかりません: %s -> %s", from.GetName(), to.GetName())
+		return
+	}
+	if link.Up == up {
+		return
+	}
+	link.Up = up
+	n.record(Record{Action: RecordLinkState, Devices: []string{from.GetName(), to.GetName()}, Value: onOff(up)})
+	if up {
+		n.log().Infof("[Network] リンクアップ: %s -> %s", from.GetName(), to.GetName())
+		link.resume()
+	} else {
+		n.log().Infof("[Network] リンクダウン: %s -> %s", from.GetName(), to.GetName())
+	}
+	n.reactToLinkChange(link)
+}
+
+// ScheduleLinkStateはdelay後にSetLinkStateを実行するイベントを追加する。
+func (n *Network) ScheduleLinkState(from, to Device, delay time.Duration, up bool) EventHandle {
+	return n.Bus.AddEvent(delay, func() { n.SetLinkState(from, to, up) })
+}
+
+// FlapLinkはa、b間の双方向のリンクをafter後にダウンし、さらにdowntime後にアップするイベントを追加する。
+func (n *Network) FlapLink(a, b Device, after, downtime time.Duration) {
+	for _, pair := range [][2]Device{{a, b}, {b, a}} {
+		n.ScheduleLinkState(pair[0], pair[1], after, false)
+		n.ScheduleLinkState(pair[0], pair[1], after+downtime, true)
+	}
+}
+
+// reactToLinkChangeはリンクの状態の変化をルータの経路表に反映する。
+func (n *Network) reactToLinkChange(link *Link) {
+	dynamic := false
+	for _, d := range n.Devices {
+		r, ok := d.(*Router)
+		if !ok {
+			continue
+		}
+		for _, route := range r.Table.Routes {
+			dynamic = dynamic || route.Dynamic
+		}
+		if r != link.From || link.Up {
+			continue
+		}
+		kept := r.Table.Routes[:0]
+		for _, route := range r.Table.Routes {
+			if route.RIP && route.NextHop == link.To {
+				r.ripWithdrawn = append(r.ripWithdrawn, route.Destination)
+				n.log().Infof("[RIP] %s: リンクダウンにより %s への経路を削除", r.Name, route.Destination.String())
+				continue
+			}
+			kept = append(kept, route)
+		}
+		r.Table.Routes = kept
+	}
+	if dynamic {
+		n.ComputeRoutes()
+	}
+}
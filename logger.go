@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// LogLevelはログの重要度を表す。
+type LogLevel int
+
+const (
+	LevelDebug LogLevel = iota // パケット単位の詳細な動作
+	LevelInfo                  // トポロジーの変更などの主要なイベント
+	LevelWarn                  // パケットの破棄や設定の誤り
+)
+
+// Loggerはシミュレーションのログ出力先を定義。
+type Logger interface {
+	Debugf(format string, args ...any) // 詳細なログを出力
+	Infof(format string, args ...any)  // 通常のログを出力
+	Warnf(format string, args ...any)  // 警告ログを出力
+}
+
+// WriterLoggerは指定したレベル以上のログをio.Writerへ1行ずつ書き出す。
+type WriterLogger struct {
+	W     io.Writer // ログの書き込み先
+	Level LogLevel  // 出力する最低レベル
+
+	mu sync.Mutex // 複数のゴルーチンからの書き込みを直列化する
+}
+
+// NewWriterLoggerはwへlevel以上のログを書き出すLoggerを作成。
+func NewWriterLogger(w io.Writer, level LogLevel) *WriterLogger {
+	return &WriterLogger{W: w, Level: level}
+}
+
+func (l *WriterLogger) logf(level LogLevel, format string, args ...any) {
+	if level < l.Level {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintf(l.W, format+"\n", args...)
+}
+
+func (l *WriterLogger) Debugf(format string, args ...any) { l.logf(LevelDebug, format, args...) }
+func (l *WriterLogger) Infof(format string, args ...any)  { l.logf(LevelInfo, format, args...) }
+func (l *WriterLogger) Warnf(format string, args ...any)  { l.logf(LevelWarn, format, args...) }
+
+var defaultLogger Logger = NewWriterLogger(os.Stdout, LevelDebug) // ロガー未設定時に使う標準出力へのロガー
+
+// SetDefaultLoggerはロガーを設定していないネットワークが使うロガーを変更。
+func SetDefaultLogger(l Logger) {
+	defaultLogger = l
+}
+
+// SetLoggerはネットワークとそのイベントバスが使うロガーを設定。
+func (n *Network) SetLogger(l Logger) {
+	n.logger = l
+	n.Bus.logger = l
+}
+
+// SetVerboseはパケット単位の詳細なログ（各層の処理やイベントの追加などのDebugf）を出力するかを設定する。
+// falseにすると、デバイスやリンクの追加といった主要なイベントとパケットの破棄の警告だけを出力する。
+// 既定ではtrue。ロガーのレベルとは独立に働き、SetLoggerでロガーを変えても設定は保たれる。
+func (n *Network) SetVerbose(v bool) {
+	n.quiet = !v
+	n.Bus.quiet = !v
+}
+
+// Verboseはパケット単位の詳細なログを出力する設定かを返す。
+func (n *Network) Verbose() bool {
+	return !n.quiet
+}
+
+// logはネットワークのロガーを返す（nilのネットワークでも既定のロガーを返す）。
+func (n *Network) log() Logger {
+	if n == nil {
+		return defaultLogger
+	}
+	l := n.logger
+	if l == nil {
+		l = defaultLogger
+	}
+	if n.quiet {
+		return quietLogger{l}
+	}
+	return l
+}
+
+// logはイベントバスのロガーを返す。
+func (eb *EventBus) log() Logger {
+	l := eb.logger
+	if l == nil {
+		l = defaultLogger
+	}
+	if eb.quiet {
+		return quietLogger{l}
+	}
+	return l
+}
+
+// quietLoggerはDebugfのログを捨て、それ以外を元のロガーへ渡す。
+type quietLogger struct {
+	Logger
+}
+
+func (quietLogger) Debugf(format string, args ...any) {}
+
+// hostBinderは所属するホストへの参照を必要とするレイヤーが実装する。
+type hostBinder interface {
+	bindHost(h *Host)
+}
+
+// hostRefはレイヤーが所属するホストへの参照を保持する（レイヤーに埋め込んで使う）。
+type hostRef struct {
+	host *Host // レイヤーを持つホスト
+}
+
+func (r *hostRef) bindHost(h *Host) {
+	r.host = h
+}
+
+// logは所属するホストのネットワークのロガーを返す。
+func (r *hostRef) log() Logger {
+	if r.host == nil {
+		return defaultLogger
+	}
+	return r.host.Network.log()
+}
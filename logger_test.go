@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriterLoggerLevel(t *testing.T) {
+	tests := []struct {
+		level LogLevel
+		want  string
+	}{
+		{LevelDebug, "debug 1\ninfo 2\nwarn 3\n"},
+		{LevelInfo, "info 2\nwarn 3\n"},
+		{LevelWarn, "warn 3\n"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		l := NewWriterLogger(&buf, tt.level)
+		l.Debugf("debug %d", 1)
+		l.Infof("info %d", 2)
+		l.Warnf("warn %d", 3)
+		if buf.String() != tt.want {
+			t.Errorf("レベル %d の出力 = %q, 期待値 %q", tt.level, buf.String(), tt.want)
+		}
+	}
+}
+
+func TestNetworkSetLogger(t *testing.T) {
+	var buf bytes.Buffer
+	n := NewNetwork()
+	n.SetLogger(NewWriterLogger(&buf, LevelDebug))
+	a := newTestHost("A", "AA:AA:AA:AA:AA:01", "10.0.0.1")
+	n.AddDevice(a)
+	a.SendPacket(Packet{SrcIP: "10.0.0.1", DstIP: "10.0.0.2", DstMAC: "AA:AA:AA:AA:AA:02"}) // 接続先がない
+	n.Bus.Run()
+	log := buf.String()
+	for _, want := range []string{
+		"[Network] デバイス追加: A",  // Infof
+		"A がパケットを送信開始",         // Debugf
+		"A: 接続先デバイスが設定されていません", // Warnf
+	} {
+		if !strings.Contains(log, want) {
+			t.Errorf("ログに %q がない:\n%s", want, log)
+		}
+	}
+}
+
+func TestNetworkSetVerbose(t *testing.T) {
+	var buf bytes.Buffer
+	n, a, _, _ := newTestLAN(t)
+	n.SetLogger(NewWriterLogger(&buf, LevelDebug))
+	n.SetVerbose(false)
+	a.Send("10.0.0.2", []byte("hello"))
+	n.RemoveLink(a, n.DeviceByName("S"))
+	a.SendPacket(Packet{SrcIP: "10.0.0.1", DstIP: "10.0.0.2", DstMAC: "AA:AA:AA:AA:AA:02"})
+	runBus(t, n)
+	log := buf.String()
+	if strings.Contains(log, "送信開始") || strings.Contains(log, "[EventBus]") {
+		t.Errorf("詳細なログが出力された:\n%s", log)
+	}
+	if !strings.Contains(log, "へのリンクが見つかりません") {
+		t.Errorf("警告のログが出力されていない:\n%s", log)
+	}
+	if n.Verbose() {
+		t.Error("Verbose = true, 期待値 false")
+	}
+
+	buf.Reset()
+	n.SetVerbose(true)
+	n.Bus.AddEvent(0, func() {})
+	runBus(t, n)
+	if !n.Verbose() || !strings.Contains(buf.String(), "[EventBus]") {
+		t.Errorf("SetVerbose(true)の後に詳細なログが出力されない:\n%s", buf.String())
+	}
+}
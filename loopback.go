@@ -0,0 +1,35 @@
+package main
+
+import "net"
+
+// isLocalはdstがループバックアドレスか、ホストのいずれかのインターフェースのIPアドレスかを返す。
+func (h *Host) isLocal(dst string) bool {
+	if isLoopback(dst) {
+		return true
+	}
+	for _, nic := range h.nics() {
+		if nl := nic.Network; nl != nil && nl.IP != "" && sameIP(nl.IP, dst) {
+			return true
+		}
+	}
+	return false
+}
+
+// isLoopbackはipが127.0.0.0/8や::1のループバックアドレスかを返す。
+func isLoopback(ip string) bool {
+	parsed := net.ParseIP(ip)
+	return parsed != nil && parsed.IsLoopback()
+}
+
+// loopbackは自分宛てのパケットをリンクを通さずに自分の受信処理へ渡す。
+// 宛先のIPアドレスを持つインターフェースのMACを宛先MACにし、他のイベントと同じく次のイベントとして受信する。
+func (h *Host) loopback(p Packet) error {
+	if dl := h.nicWithIP(p.DstIP).DataLink; dl != nil {
+		p.DstMAC = dl.MAC
+	}
+	h.Stats.countSent(p)
+	h.Network.log().Debugf("%s: 自分宛てのパケットをループバックで配送%s", h.Name, p.traceTag())
+	p = p.Clone()
+	h.Network.Bus.AddEvent(0, func() { h.ReceivePacket(p) })
+	return nil
+}
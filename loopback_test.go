@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHostLoopbackWithoutLink(t *testing.T) {
+	n := newTestNetwork(t)
+	h := newTestHost("H", "AA:AA:AA:AA:AA:01", "10.0.0.1")
+	n.AddDevice(h) // リンクを追加しない
+	var got []Packet
+	var at []time.Duration
+	h.OnReceive = func(p Packet) {
+		got = append(got, p)
+		at = append(at, elapsed(n))
+	}
+	for _, dst := range []string{"127.0.0.1", "10.0.0.1", "::1", "127.1.2.3"} {
+		if err := h.Send(dst, []byte(dst)); err != nil {
+			t.Errorf("Send(%s): %v", dst, err)
+		}
+	}
+	runBus(t, n)
+	if len(got) != 4 {
+		t.Fatalf("ループバックで届いたパケット = %d, 期待値 4", len(got))
+	}
+	for i, p := range got {
+		if p.DstMAC != "AA:AA:AA:AA:AA:01" || at[i] != 0 {
+			t.Errorf("%s: 宛先MAC = %s, 到着時刻 = %v, 期待値 AA:AA:AA:AA:AA:01 と 0s", p.Data, p.DstMAC, at[i])
+		}
+	}
+	if h.Stats.Sent != 4 || h.Stats.Received != 4 || len(h.Stats.Dropped) != 0 {
+		t.Errorf("統計 = %+v", h.Stats)
+	}
+}
+
+func TestHostLoopbackSkipsLink(t *testing.T) {
+	n, a, b, s := newTestLAN(t)
+	skipAnnounce(a, b)
+	delivered := 0
+	a.OnReceive = func(Packet) { delivered++ }
+	a.Send("10.0.0.1", []byte("self"))
+	a.Send("127.0.0.1", []byte("loopback"))
+	runBus(t, n)
+	if delivered != 2 {
+		t.Errorf("Aに届いたパケット = %d, 期待値 2", delivered)
+	}
+	if l := n.GetLink(a, s); l.Stats.Sent != 0 {
+		t.Errorf("リンク %s で送出したパケット = %d, 期待値 0", l.Name(), l.Stats.Sent)
+	}
+	if s.Stats.Received != 0 || b.Stats.Received != 0 {
+		t.Errorf("スイッチかBにパケットが届いた: S %d, B %d", s.Stats.Received, b.Stats.Received)
+	}
+}
+
+func TestHostLoopbackOversizedFrame(t *testing.T) {
+	n := newTestNetwork(t)
+	h := newTestHost("H", "AA:AA:AA:AA:AA:01", "10.0.0.1")
+	n.AddDevice(h)
+	h.dataLinkLayer().MaxFrameSize = FrameOverhead + 4
+	delivered := 0
+	h.OnReceive = func(Packet) { delivered++ }
+	err := h.Send("127.0.0.1", []byte("too large"))
+	if !errors.Is(err, DropFrameTooLarge) {
+		t.Errorf("Send = %v, 期待値 %v", err, DropFrameTooLarge)
+	}
+	runBus(t, n)
+	if delivered != 0 {
+		t.Errorf("破棄されたパケットが %d 個届いた", delivered)
+	}
+	if h.Stats.Received != 0 || h.Stats.Dropped[DropFrameTooLarge] != 1 {
+		t.Errorf("統計 = %+v, 期待値 受信 0 と %s 1", h.Stats, DropFrameTooLarge)
+	}
+}
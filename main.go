@@ -2,59 +2,251 @@ package main
 
 import (
 	"container/heap"
+	"errors"
+	"flag"
 	"fmt"
+	"maps"
+	"math/rand"
+	"net"
+	"os"
+	"sync"
 	"time"
 )
 
 // Packetはネットワークパケットを表し、送信元/宛先IPとMACアドレス、データペイロードを持つ。
 type Packet struct {
-	Data   string // パケットのデータ部分
+	Data   []byte // パケットのデータ部分
 	SrcIP  string // 送信元のIPアドレス
 	DstIP  string // 宛先のIPアドレス
 	SrcMAC string // 送信元のMACアドレス
 	DstMAC string // 宛先のMACアドレス
+	TTL    int    // 残りホップ数（ルータ通過ごとに1減る）
+
+	Protocol Protocol // 上位プロトコルの種類（未設定ならRAW）
+	SrcPort  int      // 送信元のポート番号
+	DstPort  int      // 宛先のポート番号
+	VLAN     int      // 所属するVLANのID（0なら既定のVLAN）
+	Seq      int      // シーケンス番号（0なら未割り当て）
+	Ack      int      // 確認応答するシーケンス番号
+	Flags    Flag     // 制御フラグ
+	Checksum uint16   // トランスポート層のチェックサム（UDPLayerが設定・検証する）
+	Priority int      // 優先度（DSCPのクラスに相当、大きいほどリンクのキューで先に送出される）
+
+	HeaderChecksum uint16 // アドレスとプロトコルに対するIPヘッダのチェックサム（NetworkLayerが設定・検証する、0なら未計算）
+
+	PayloadType  string // SetPayloadで符号化した値の型の名前（構造化されたペイロードでなければ空）
+	PayloadCodec string // SetPayloadで使った符号化方式の名前（構造化されたペイロードでなければ空）
+
+	FragID        int  // 分割された場合の元パケットの識別子
+	FragOffset    int  // 元パケットのデータ内での断片の位置（バイト）
+	MoreFragments bool // 後続の断片があればtrue
+
+	TraceID   string // 経路を追跡するための識別子（ホストの送信時に自動で割り当てる）
+	Corrupted bool   // 伝送中にビット誤りでデータが壊れていればtrue
+
+	SentAt     time.Time // ホストが送信した仮想時刻（ホストの送信時に自動で設定する）
+	ReceivedAt time.Time // 宛先ホストが受信した仮想時刻（受信時に自動で設定する）
+
+	ARP  *ARPMessage  // ARPパケットの場合のARPメッセージ（通常のパケットではnil）
+	ICMP *ICMPMessage // ICMPパケットの場合のICMPメッセージ（通常のパケットではnil）
+	DHCP *DHCPMessage // DHCPパケットの場合のDHCPメッセージ（通常のパケットではnil）
+	RIP  *RIPMessage  // RIPの広告の場合の経路の一覧（通常のパケットではnil）
+
+	Meta map[string]any // 拡張機能やレイヤーが自由に読み書きできるパケットごとの付加情報（Cloneでマップを複製する）
+}
+
+// DefaultTTLは送信時にTTLが未設定の場合に使う初期値。
+const DefaultTTL = 64
+
+// DefaultVLANはVLANが指定されていないパケットやポートが属するVLANのID。
+const DefaultVLAN = 1
+
+// VLANIDはパケットが属するVLANのIDを返す（未設定ならDefaultVLAN）。
+func (p Packet) VLANID() int {
+	if p.VLAN == 0 {
+		return DefaultVLAN
+	}
+	return p.VLAN
+}
+
+// Protocolはパケットが運ぶプロトコルの種類を表す。
+type Protocol string
+
+const (
+	ProtocolRaw  Protocol = "RAW"  // 任意のデータ（既定値）
+	ProtocolARP  Protocol = "ARP"  // アドレス解決
+	ProtocolICMP Protocol = "ICMP" // 制御メッセージ
+	ProtocolTCP  Protocol = "TCP"  // コネクション型のトランスポート
+	ProtocolUDP  Protocol = "UDP"  // データグラム型のトランスポート
+)
+
+// Protoはパケットのプロトコルを返す（未設定ならProtocolRaw）。
+func (p Packet) Proto() Protocol {
+	if p.Protocol == "" {
+		return ProtocolRaw
+	}
+	return p.Protocol
+}
+
+// NewPacketは文字列のデータを運ぶパケットを作成。
+func NewPacket(srcIP, dstIP, data string) Packet {
+	return Packet{Data: []byte(data), SrcIP: srcIP, DstIP: dstIP}
 }
 
 // Stringはデバッグ用にパケットを人間が読める形式で返す。
 func (p Packet) String() string {
-	return fmt.Sprintf("From %s (%s) to %s (%s): %s", p.SrcIP, p.SrcMAC, p.DstIP, p.DstMAC, p.Data)
+	return fmt.Sprintf("From %s (%s) to %s (%s): %d bytes %s%s", p.SrcIP, p.SrcMAC, p.DstIP, p.DstMAC, len(p.Data), payloadPreview(p.Data), p.traceTag())
+}
+
+// Latencyは送信から宛先ホストでの受信までにかかった時間を返す（どちらかの時刻が未設定なら0）。
+func (p Packet) Latency() time.Duration {
+	if p.SentAt.IsZero() || p.ReceivedAt.IsZero() {
+		return 0
+	}
+	return p.ReceivedAt.Sub(p.SentAt)
+}
+
+// Cloneはデータと、ARP・ICMP・DHCP・RIPのメッセージ、Metaのマップを複製したパケットのコピーを返す。
+// Metaの値そのものは複製しないため、ポインタなどを入れた場合は複製したパケットと共有される。
+// 同じパケットを複数の宛先へ送るときに、一方の変更が他方に影響しないようにする。
+func (p Packet) Clone() Packet {
+	if p.Data != nil {
+		p.Data = append([]byte(nil), p.Data...)
+	}
+	if p.ARP != nil {
+		arp := *p.ARP
+		p.ARP = &arp
+	}
+	if p.ICMP != nil {
+		icmp := *p.ICMP
+		p.ICMP = &icmp
+	}
+	if p.DHCP != nil {
+		dhcp := *p.DHCP
+		p.DHCP = &dhcp
+	}
+	if p.RIP != nil {
+		p.RIP = &RIPMessage{Entries: append([]RIPEntry(nil), p.RIP.Entries...)}
+	}
+	if p.Meta != nil {
+		p.Meta = maps.Clone(p.Meta)
+	}
+	return p
+}
+
+// SetMetaはパケットの付加情報keyにvを設定する（Metaが未作成なら作成する）。
+func (p *Packet) SetMeta(key string, v any) {
+	if p.Meta == nil {
+		p.Meta = make(map[string]any)
+	}
+	p.Meta[key] = v
+}
+
+// previewLenはStringで表示するペイロードの最大バイト数。
+const previewLen = 32
+
+// payloadPreviewはペイロードの先頭を、表示可能なASCIIなら文字列、それ以外なら16進数で返す。
+func payloadPreview(data []byte) string {
+	head, more := data, ""
+	if len(head) > previewLen {
+		head, more = head[:previewLen], "..."
+	}
+	for _, b := range head {
+		if b < 0x20 || b > 0x7e {
+			return fmt.Sprintf("%x%s", head, more)
+		}
+	}
+	return fmt.Sprintf("%q%s", head, more)
 }
 
 // Deviceはネットワークデバイス（ホスト、スイッチ、ルータ）のインターフェースを定義。
+//
+// リンクは送出するパケットをその時点で複製するため、ReceivePacketに届くパケットのデータやメッセージは
+// 送信元や同じブロードキャストを受け取った他のデバイスとは共有されない。ただし同じデバイスの中では
+// レイヤーのハンドラ、OnReceive、Collectorなどが同じパケットを順に受け取るため、受信側のコールバックは
+// パケットを専有しているとみなさず、データを書き換えたり別のゴルーチンへ渡したりする前にCloneで複製する。
 type Device interface {
-	SendPacket(p Packet)    // パケットを次のデバイスに送信
-	ReceivePacket(p Packet) // 他のデバイスからパケットを受信
-	GetName() string        // デバイスの名前をログ用に返す
+	SendPacket(p Packet) error       // パケットを次のデバイスに送信（その場で破棄した場合はエラーを返す）
+	ReceivePacket(p Packet)          // 他のデバイスからパケットを受信
+	GetName() string                 // デバイスの名前をログ用に返す
+	Interface(name string) *PortInfo // 名前（例："eth0"）でインターフェースを探す（見つからなければnil）
 }
 
 // Layerはプロトコル層（例：ネットワーク層、データリンク層）のインターフェースを定義。
 type Layer interface {
-	HandleOutgoing(p Packet) Packet // 送信パケットを処理（例：ヘッダ追加）
-	HandleIncoming(p Packet) Packet // 受信パケットを処理（例：ヘッダ検証）
-	GetName() string                // 層の名前をログ用に返す
+	HandleOutgoing(p Packet) Packet         // 送信パケットを処理（例：ヘッダ追加）
+	HandleIncoming(p Packet) (Packet, bool) // 受信パケットを処理（例：ヘッダ検証）し、破棄したらfalseを返して上位層へ渡さない
+	GetName() string                        // 層の名前をログ用に返す
 }
 
 // NetworkLayerはOSIモデルのIP層を表す。
 type NetworkLayer struct {
-	Name string // 層の名前（デバッグ用）
-	IP   string // この層に割り当てられたIPアドレス
+	Name     string            // 層の名前（デバッグ用）
+	IP       string            // この層に割り当てられたIPアドレス
+	ARPTable map[string]string // ARPで解決したIPアドレスとMACアドレスの対応
+
+	SubnetMask string // 自分のサブネットのマスク（例："255.255.255.0"、IPv6ならプレフィックス長の"64"、空なら全ての宛先を直結とみなす）
+	Gateway    string // サブネット外への送信に使うデフォルトゲートウェイのIPアドレス
+
+	ReassemblyTimeout time.Duration // 断片の再構築を待つ時間（0なら既定値）
+
+	ConflictMAC      string // 同じIPアドレスを使っている他のデバイスのMAC（重複を検出していなければ空）
+	RefuseOnConflict bool   // trueならIPアドレスの重複を検出した後は送信しない
+
+	fragments map[fragKey]*reassembly // 再構築中の断片
+	announced bool                    // Gratuitous ARPで自分のIPアドレスを通知済みならtrue
+	hostRef
+}
+
+// headerChecksumは送信元IP、宛先IP、プロトコル番号を並べたヘッダに対するインターネットチェックサムを返す。
+// 0は未計算を表すため、計算結果が0なら0xffffにする（UDPと同じ扱い）。
+func headerChecksum(p Packet) uint16 {
+	hdr := make([]byte, 0, 10)
+	hdr = append(hdr, ipBytes(p.SrcIP)...)
+	hdr = append(hdr, ipBytes(p.DstIP)...)
+	hdr = append(hdr, 0, ipProtocolNumber(p.Proto()))
+	if sum := internetChecksum(hdr); sum != 0 {
+		return sum
+	}
+	return 0xffff
 }
 
-// HandleOutgoingは送信パケットに送信元IPを設定。
+// HandleOutgoingは送信パケットに送信元IPとヘッダのチェックサムを設定し、宛先MACが未設定なら次ホップのMACをARPテーブルから補完。
 func (nl *NetworkLayer) HandleOutgoing(p Packet) Packet {
 	p.SrcIP = nl.IP
-	fmt.Printf("[IP] %s: パケット送信中 %s\n", nl.IP, p) // IP層の動作をログ
+	p.HeaderChecksum = headerChecksum(p)
+	if p.DstMAC == "" {
+		hop := nl.nextHop(p.DstIP)
+		if mac, ok := nl.ARPTable[hop]; ok {
+			p.DstMAC = mac
+			nl.log().Debugf("[IP] %s: ARPテーブルから宛先MACを解決 %s -> %s", nl.IP, hop, mac)
+		}
+	}
+	nl.log().Debugf("[IP] %s: %sパケット送信中 %s", nl.IP, p.Proto(), p) // IP層の動作をログ
 	return p
 }
 
-// HandleIncomingはパケットの宛先IPがこのデバイスのIPと一致するか確認。
-func (nl *NetworkLayer) HandleIncoming(p Packet) Packet {
-	if p.DstIP == nl.IP {
-		fmt.Printf("[IP] %s: 自分宛のパケットを受信: %s\n", nl.IP, p) // 受信成功をログ
-	} else {
-		fmt.Printf("[IP] %s: IPが一致しないためパケットを破棄: %s\n", nl.IP, p) // 破棄をログ
+// HandleIncomingはヘッダのチェックサムを検証し（未計算なら省略）、パケットの宛先IPがこのデバイスのIP（またはループバックアドレス）と一致するか確認。
+// チェックサムかIPが一致しないパケットは破棄として記録し、ICMPの処理も上位層への受け渡しも行わない。
+func (nl *NetworkLayer) HandleIncoming(p Packet) (Packet, bool) {
+	if p.HeaderChecksum != 0 {
+		if sum := headerChecksum(p); sum != p.HeaderChecksum {
+			nl.countDrop(DropChecksum)
+			nl.log().Warnf("[IP] %s: ヘッダのチェックサムが一致しないため破棄 (0x%04x != 0x%04x): %s", nl.IP, p.HeaderChecksum, sum, p)
+			return p, false
+		}
 	}
-	return p
+	if sameIP(p.DstIP, nl.IP) || isLoopback(p.DstIP) { // IPv6の表記の違いを吸収して比べる
+		nl.log().Debugf("[IP] %s: 自分宛の%sパケットを受信: %s", nl.IP, p.Proto(), p) // 受信成功をログ
+		if p.ICMP != nil {
+			nl.log().Infof("[ICMP] %s: %s から%sを受信: %s", nl.IP, p.SrcIP, p.ICMP, p.Data)
+			nl.handleICMP(p)
+		}
+		return p, true
+	}
+	nl.countDrop(DropIPMismatch)
+	nl.log().Warnf("[IP] %s: IPが一致しないためパケットを破棄: %s", nl.IP, p) // 破棄をログ
+	return p, false
 }
 
 func (nl *NetworkLayer) GetName() string {
@@ -65,23 +257,50 @@ func (nl *NetworkLayer) GetName() string {
 type DataLinkLayer struct {
 	Name string // 層の名前（デバッグ用）
 	MAC  string // この層に割り当てられたMACアドレス
+
+	MulticastGroups []string // 受信するマルチキャストMACアドレス
+	MaxFrameSize    int      // ヘッダを含む最大フレーム長（バイト、0なら無制限）
+	hostRef
+}
+
+// FrameOverheadはフレームのヘッダとFCSのバイト数（イーサネットと同じ14+4バイト）。
+const FrameOverhead = 18
+
+// oversizedはパケットをフレームにするとMaxFrameSizeを超えるかどうかを返す。
+func (dl *DataLinkLayer) oversized(p Packet) bool {
+	return dl.MaxFrameSize > 0 && len(p.Data)+FrameOverhead > dl.MaxFrameSize
 }
 
-// HandleOutgoingは送信パケットに送信元MACを設定。
+// HandleOutgoingは送信パケットの未設定のMACアドレスだけを補完し、呼び出し元が設定した値は変更しない。
+// 送信元MACが空ならこの層のMACを設定する。宛先MACが空の場合、宛先IPがあればホストのARP解決に任せ、
+// 宛先IPもなければブロードキャストにする。フレームがMaxFrameSizeを超える場合は破棄として記録し、
+// ホストはそのパケットを送出しない。
 func (dl *DataLinkLayer) HandleOutgoing(p Packet) Packet {
-	p.SrcMAC = dl.MAC
-	fmt.Printf("[MAC] %s: パケット送信中 %s\n", dl.Name, dl.MAC) // MAC層の動作をログ
+	if dl.oversized(p) {
+		dl.countDrop(DropFrameTooLarge)
+		dl.log().Warnf("[MAC] %s: フレームが大きすぎるため破棄 (frame too large: %d > %d bytes)%s", dl.Name, len(p.Data)+FrameOverhead, dl.MaxFrameSize, p.traceTag())
+		return p
+	}
+	if p.SrcMAC == "" {
+		p.SrcMAC = dl.MAC
+	}
+	if p.DstMAC == "" && p.DstIP == "" {
+		p.DstMAC = BroadcastMAC
+	}
+	dl.log().Debugf("[MAC] %s: %sパケット送信中 %s%s", dl.Name, p.Proto(), dl.MAC, p.traceTag()) // MAC層の動作をログ
 	return p
 }
 
-// HandleIncomingはパケットの宛先MACがこのデバイスのMACと一致するか確認。
-func (dl *DataLinkLayer) HandleIncoming(p Packet) Packet {
-	if p.DstMAC == dl.MAC {
-		fmt.Printf("[MAC] %s: 自分宛のパケットを受信: %s\n", dl.Name, p) // 受信成功をログ
-	} else {
-		fmt.Printf("[MAC] %s: MACが一致しないためパケットを破棄: %s\n", dl.Name, p) // 破棄をログ
+// HandleIncomingはパケットの宛先MACがこのデバイスのMAC（またはブロードキャスト、参加中のマルチキャスト）と一致するか確認。
+// 一致しないパケットは破棄として記録し、上位層へ渡さない。
+func (dl *DataLinkLayer) HandleIncoming(p Packet) (Packet, bool) {
+	if !dl.accepts(p.DstMAC) {
+		dl.countDrop(DropMACMismatch)
+		dl.log().Warnf("[MAC] %s: MACが一致しないためパケットを破棄: %s", dl.Name, p) // 破棄をログ
+		return p, false
 	}
-	return p
+	dl.log().Debugf("[MAC] %s: 自分宛の%sパケットを受信: %s", dl.Name, p.Proto(), p) // 受信成功をログ
+	return p, true
 }
 
 func (dl *DataLinkLayer) GetName() string {
@@ -92,13 +311,35 @@ func (dl *DataLinkLayer) GetName() string {
 type Event struct {
 	Time    time.Time // イベントが発生する時刻
 	Handler func()    // イベント発生時に実行する関数
+	Seq     uint64    // 追加された順番（同時刻のイベントはこの順に実行する）
+
+	Cancelled bool // trueなら実行せずに破棄する
+
+	Packet *PacketInfo // リンクの配送イベントなら配送するパケットの情報（それ以外はnil）
+}
+
+// EventHandleはスケジュール済みのイベントを指し、キャンセルに使う。
+type EventHandle struct {
+	event    *Event
+	periodic *periodicEvent
+}
+
+// periodicEventは繰り返しイベントの状態を表す。
+type periodicEvent struct {
+	next    *Event // 次に実行される予定のイベント
+	stopped bool   // キャンセルされたか回数の上限に達したらtrue
 }
 
 // EventQueueは時間順にイベントを管理する優先度キュー。
 type EventQueue []*Event
 
-func (eq EventQueue) Len() int            { return len(eq) }
-func (eq EventQueue) Less(i, j int) bool  { return eq[i].Time.Before(eq[j].Time) }
+func (eq EventQueue) Len() int { return len(eq) }
+func (eq EventQueue) Less(i, j int) bool {
+	if !eq[i].Time.Equal(eq[j].Time) {
+		return eq[i].Time.Before(eq[j].Time)
+	}
+	return eq[i].Seq < eq[j].Seq
+}
 func (eq EventQueue) Swap(i, j int)       { eq[i], eq[j] = eq[j], eq[i] }
 func (eq *EventQueue) Push(x interface{}) { *eq = append(*eq, x.(*Event)) }
 func (eq *EventQueue) Pop() interface{} {
@@ -109,177 +350,1295 @@ func (eq *EventQueue) Pop() interface{} {
 	return x
 }
 
+// SimulationEpochは仮想時計の開始時刻。
+var SimulationEpoch = time.Unix(0, 0).UTC()
+
 // EventBusは非同期パケット送信のためのイベントキューを管理。
+// ハンドラや複数のゴルーチンから同時にイベントを追加しても安全。
 type EventBus struct {
-	Events EventQueue // スケジュールされたイベントのキュー
+	Events      EventQueue   // スケジュールされたイベントのキュー
+	CurrentTime time.Time    // 仮想時計の現在時刻
+	RealTime    bool         // trueなら実時間で待機する（従来の動作）
+	Middleware  []Middleware // ハンドラの呼び出しを包むミドルウェア（先に追加したものが外側）
+
+	MaxSimTime time.Duration // RunとRunUntilで進める仮想時計の上限（SimulationEpochからの時間、0なら無制限）
+	MaxEvents  int           // RunとRunUntilで実行するイベント数の上限（これまでの合計、0なら無制限）
+
+	mu      sync.Mutex // EventsとCurrentTimeを保護する
+	logger  Logger     // ログの出力先（nilなら既定のロガー）
+	nextSeq uint64     // 次に追加するイベントの順番
+	events  int        // これまでに実行したイベントの数
+	quiet   bool       // trueならDebugfのログを出力しない
+
+	stopRequested bool // Stopが呼ばれ、RunやRunUntilがまだ止まっていなければtrue
+}
+
+// NewEventBusは仮想時計をSimulationEpochに合わせたイベントバスを作成。
+func NewEventBus() *EventBus {
+	return &EventBus{Events: make(EventQueue, 0), CurrentTime: SimulationEpoch}
+}
+
+// Nowはシミュレーションの現在時刻を返す（RealTimeなら実時刻）。
+func (eb *EventBus) Now() time.Time {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	return eb.now()
+}
+
+// nowはロックを取得済みの状態で現在時刻を返す。
+func (eb *EventBus) now() time.Time {
+	if eb.RealTime {
+		return time.Now()
+	}
+	return eb.CurrentTime
+}
+
+// AddEventは遅延時間後に実行されるイベントを追加し、キャンセル用のハンドルを返す。
+func (eb *EventBus) AddEvent(delay time.Duration, handler func()) EventHandle {
+	eb.mu.Lock()
+	event := &Event{Time: eb.now().Add(delay), Handler: handler}
+	eb.push(event)
+	eb.mu.Unlock()
+	eb.log().Debugf("[EventBus] イベントを追加: 遅延 %v", delay) // イベント追加をログ
+	return EventHandle{event: event}
+}
+
+// Cancelはイベントをキャンセル済みにし、Runで実行されないようにする。
+// 実行済みのイベントやゼロ値のハンドルに対しては何もしない。
+func (eb *EventBus) Cancel(h EventHandle) {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	if h.periodic != nil {
+		h.periodic.stopped = true
+		h.periodic.next.Cancelled = true
+		return
+	}
+	if h.event != nil {
+		h.event.Cancelled = true
+		if h.event.Packet != nil {
+			h.event.Packet.settle()
+		}
+	}
 }
 
-var eventBus = &EventBus{Events: make(EventQueue, 0)} // グローバルなイベントバス
+// AddPeriodicはinterval毎にhandlerを実行する繰り返しイベントを追加する。
+// キャンセルされるまで続くため、仮想時計ではCancelで止めるか、回数を指定するAddPeriodicNを使う。
+func (eb *EventBus) AddPeriodic(interval time.Duration, handler func()) EventHandle {
+	return eb.AddPeriodicN(interval, 0, handler)
+}
+
+// AddPeriodicNはinterval毎にhandlerを最大maxRuns回（0なら無制限）実行する繰り返しイベントを追加する。
+// intervalが0以下だと同じ時刻で無限に繰り返すため、その場合は追加せずにゼロ値のハンドルを返す。
+func (eb *EventBus) AddPeriodicN(interval time.Duration, maxRuns int, handler func()) EventHandle {
+	if interval <= 0 {
+		eb.log().Warnf("[EventBus] 繰り返し間隔 %v が不正なため繰り返しイベントを追加しません", interval)
+		return EventHandle{}
+	}
+	pe := &periodicEvent{}
+	runs := 0
+	var tick func()
+	tick = func() {
+		handler()
+		runs++
+		eb.mu.Lock()
+		defer eb.mu.Unlock()
+		if pe.stopped || (maxRuns > 0 && runs >= maxRuns) {
+			pe.stopped = true
+			return
+		}
+		pe.next = &Event{Time: eb.now().Add(interval), Handler: tick}
+		eb.push(pe.next)
+	}
+	eb.mu.Lock()
+	pe.next = &Event{Time: eb.now().Add(interval), Handler: tick}
+	eb.push(pe.next)
+	eb.mu.Unlock()
+	eb.log().Debugf("[EventBus] 繰り返しイベントを追加: 間隔 %v", interval)
+	return EventHandle{event: pe.next, periodic: pe}
+}
 
-// AddEventは遅延時間後に実行されるイベントを追加。
-func (eb *EventBus) AddEvent(delay time.Duration, handler func()) {
-	time := time.Now().Add(delay)
-	event := &Event{Time: time, Handler: handler}
+// pushはロックを取得済みの状態でイベントに順番を付けてキューに追加する。
+func (eb *EventBus) push(event *Event) {
+	eb.nextSeq++
+	event.Seq = eb.nextSeq
 	heap.Push(&eb.Events, event)
-	fmt.Printf("[EventBus] イベントを追加: 遅延 %v\n", delay) // イベント追加をログ
+}
+
+// popは次に実行するイベントをキューから取り出す（空ならfalse）。
+func (eb *EventBus) pop() (*Event, bool) {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	if eb.Events.Len() == 0 {
+		return nil, false
+	}
+	return heap.Pop(&eb.Events).(*Event), true
 }
 
 // Runはイベントキューを実行し、時間順にハンドラを呼び出す。
-func (eb *EventBus) Run() {
+// 仮想時計では待機せずにイベントの時刻へ進み、RealTimeなら実時間で待機する。
+// ハンドラが追加したイベントも含め、キューが空になるまで実行する。
+// Stopが呼ばれた場合は実行中のハンドラが終わった時点で戻り、残りのイベントはキューに残る。
+// MaxSimTimeかMaxEventsの上限を超える場合は、そのイベントを実行せずにエラーを返す。
+func (eb *EventBus) Run() error {
+	for !eb.takeStop() {
+		if err := eb.checkLimits(); err != nil {
+			return err
+		}
+		if !eb.Step() {
+			break
+		}
+	}
+	return nil
+}
+
+// RunUntilは時刻tより前に予定されたイベントだけを実行し、仮想時計をtまで進める。
+// t以降のイベントはキューに残るため、RunやRunUntilで続きを実行できる。
+// MaxSimTimeかMaxEventsの上限を超える場合は、仮想時計を進めずにエラーを返す。
+func (eb *EventBus) RunUntil(t time.Time) error {
+	for !eb.takeStop() {
+		next, ok := eb.Peek()
+		if !ok || !next.Before(t) {
+			break
+		}
+		if err := eb.checkLimits(); err != nil {
+			return err
+		}
+		eb.Step()
+	}
+	eb.mu.Lock()
+	if !eb.RealTime && t.After(eb.CurrentTime) {
+		eb.CurrentTime = t
+	}
+	eb.mu.Unlock()
+	return nil
+}
+
+// Run・RunUntilが上限に達して中断したときのエラー。errors.Isで判別できる。
+var (
+	ErrMaxEvents  = errors.New("イベント数の上限に達しました")
+	ErrMaxSimTime = errors.New("シミュレーション時間の上限に達しました")
+)
+
+// checkLimitsは次のイベントを実行するとMaxEventsかMaxSimTimeを超える場合にエラーを返す。
+// MaxSimTimeは仮想時計でのみ確かめる。
+func (eb *EventBus) checkLimits() error {
+	eb.mu.Lock()
+	executed := eb.events
+	eb.mu.Unlock()
+	if eb.MaxEvents > 0 && executed >= eb.MaxEvents {
+		eb.log().Warnf("[EventBus] %d 個のイベントを実行したため中断", executed)
+		return fmt.Errorf("%w: %d 個", ErrMaxEvents, eb.MaxEvents)
+	}
+	if eb.MaxSimTime > 0 && !eb.RealTime {
+		if next, ok := eb.Peek(); ok && next.Sub(SimulationEpoch) > eb.MaxSimTime {
+			eb.log().Warnf("[EventBus] 次のイベントの時刻 %v が上限 %v を超えるため中断", next.Sub(SimulationEpoch), eb.MaxSimTime)
+			return fmt.Errorf("%w: %v", ErrMaxSimTime, eb.MaxSimTime)
+		}
+	}
+	return nil
+}
+
+// StopはRunとRunUntilを、実行中のハンドラが終わった時点で止める。
+func (eb *EventBus) Stop() {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	eb.stopRequested = true
+}
+
+// takeStopはStopが要求されていればその要求を消費してtrueを返す。
+func (eb *EventBus) takeStop() bool {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	stop := eb.stopRequested
+	eb.stopRequested = false
+	return stop
+}
+
+// Stepはキャンセルされていない次のイベントを1つだけ実行し、実行したかどうかを返す。
+// テストでシミュレーションを1イベントずつ進め、途中の状態を確かめるのに使う。
+func (eb *EventBus) Step() bool {
+	for {
+		event, ok := eb.pop()
+		if !ok {
+			return false
+		}
+		eb.mu.Lock()
+		cancelled := event.Cancelled
+		eb.mu.Unlock()
+		if cancelled {
+			eb.log().Debugf("[EventBus] キャンセル済みのイベントをスキップ")
+			continue
+		}
+		if eb.RealTime {
+			now := time.Now()
+			if now.Before(event.Time) {
+				eb.log().Debugf("[EventBus] 待機中: %v", event.Time.Sub(now)) // 待機時間をログ
+				time.Sleep(event.Time.Sub(now))
+			}
+		}
+		eb.mu.Lock()
+		if event.Time.After(eb.CurrentTime) {
+			eb.CurrentTime = event.Time
+		}
+		eb.events++
+		if event.Packet != nil {
+			event.Packet.settle() // ミドルウェアがスキップしても伝送は終わる
+		}
+		eb.mu.Unlock()
+		eb.dispatch(event)                     // ハンドラ内からAddEventできるようロック外で実行
+		eb.log().Debugf("[EventBus] イベント実行完了") // イベント実行をログ
+		return true
+	}
+}
+
+// Middlewareはイベントのハンドラ呼び出しを包む関数。
+// nextを呼ぶと内側のミドルウェアか本来のハンドラが実行され、呼ばなければイベントはスキップされる。
+type Middleware func(e *Event, next func())
+
+// Useはミドルウェアをチェーンの最も内側に追加する。
+func (eb *EventBus) Use(m Middleware) {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	eb.Middleware = append(eb.Middleware, m)
+}
+
+// dispatchはミドルウェアのチェーンを通してイベントのハンドラを呼び出す。
+func (eb *EventBus) dispatch(e *Event) {
+	eb.mu.Lock()
+	chain := eb.Middleware
+	eb.mu.Unlock()
+	var call func(i int)
+	call = func(i int) {
+		if i == len(chain) {
+			e.Handler()
+			return
+		}
+		chain[i](e, func() { call(i + 1) })
+	}
+	call(0)
+}
+
+// Peekは次に実行されるイベントの時刻を返す（キャンセルされていないイベントがなければfalse）。
+func (eb *EventBus) Peek() (time.Time, bool) {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
 	for eb.Events.Len() > 0 {
-		event := heap.Pop(&eb.Events).(*Event)
-		now := time.Now()
-		if now.Before(event.Time) {
-			fmt.Printf("[EventBus] 待機中: %v\n", event.Time.Sub(now)) // 待機時間をログ
-			time.Sleep(event.Time.Sub(now))
+		if next := eb.Events[0]; !next.Cancelled {
+			return next.Time, true
 		}
-		event.Handler()
-		fmt.Printf("[EventBus] イベント実行完了\n") // イベント実行をログ
+		heap.Pop(&eb.Events) // 先頭のキャンセル済みイベントは実行されないため捨てる
 	}
+	return time.Time{}, false
 }
 
 // Linkはデバイス間の接続を表し、遅延をシミュレート。
 type Link struct {
-	From  Device        // 送信元デバイス
-	To    Device        // 宛先デバイス
-	Delay time.Duration // 伝送遅延時間
+	From         Device        // 送信元デバイス
+	To           Device        // 宛先デバイス
+	Delay        time.Duration // 伝送遅延時間
+	Jitter       time.Duration // 遅延の揺らぎの幅（パケットごとにDelay±Jitterの範囲で変動）
+	Network      *Network      // リンクが属するネットワーク
+	Bandwidth    int64         // 帯域幅（bps、0なら無制限）
+	LossRate     float64       // パケットロス率（0.0〜1.0）
+	BitErrorRate float64       // 1ビットあたりの誤り率（データが長いほど壊れやすい）
+	Rand         *rand.Rand    // ロス判定と揺らぎに使う乱数源（nilならグローバルな乱数源）
+	MTU          int           // 1パケットで運べる最大データ長（バイト、0なら無制限）
+	Stats        Stats         // リンクを通過したパケットの統計
+
+	Duplex      Duplex          // 通信方式（半二重なら逆方向のリンクと回線を共有し、衝突が起こる）
+	Collisions  int             // 半二重の回線で起きた衝突の回数
+	Corruptions int             // ビット誤りでデータを壊したパケット数
+	QueueSize   int             // 送信待ちキューの最大パケット数（0ならキューを使わず即時に送出）
+	Discipline  QueueDiscipline // キューへの受け入れ方式（nilならDropTail）
+	Bands       int             // 優先度別のキューの数（0か1なら優先度を区別しない）
+	Scheduler   Scheduler       // 次に送出するキューの選び方（nilならStrictPriority）
+	Reorder     bool            // trueなら揺らぎなどで後のパケットが先に届くのを許す（既定では送信順に届ける）
+	FairShare   bool            // trueなら同時に送信中のフローで帯域幅を等分する（QueueSizeが0の場合のみ）
+	Preempt     bool            // trueならキューが一杯のとき、優先度の低い待機中のパケットを破棄して新しいパケットを入れる
+
+	removed bool         // ネットワークから削除済みならtrue
+	busy    bool         // 回線が前のパケットを送出中ならtrue
+	queue   [][]Packet   // 回線が空くのを待つパケット（優先度別、添字が大きいほど優先）
+	samples []linkSample // SampleInterval毎に集計した送出バイト数（送出のあった区間だけ、利用率の計算用）
+	medium  *medium      // 半二重の場合に逆方向のリンクと共有する回線
+
+	lastArrival time.Time // 最後に送出したパケットの到着予定時刻（送信順に届けるために使う）
+
+	Up bool // リンクが使用可能ならtrue（AddLinkで作成したリンクは最初から使用可能）
+
+	SampleInterval time.Duration // 利用率とスループットを集計する区間の最小単位（0ならDefaultSampleInterval）
+
+	flows map[uint32]time.Time // FairShareでフローごとに送出を終える時刻
+
+	overloaded bool // 伝送中のバイト数が帯域幅遅延積を超えていると警告済みならtrue
+	inFlight   int  // 伝送中（配送イベントを待っている）のパケットのデータの合計バイト数
+}
+
+// randFloatは0.0以上1.0未満の乱数を返す（Randが設定されていればそれを使う）。
+func (l *Link) randFloat() float64 {
+	if l.Rand != nil {
+		return l.Rand.Float64()
+	}
+	return rand.Float64()
+}
+
+// propagationDelayはDelayにJitterの範囲で一様な揺らぎを加えた遅延を返す（負にはならない）。
+func (l *Link) propagationDelay() time.Duration {
+	if l.Jitter <= 0 {
+		return l.Delay
+	}
+	offset := time.Duration((2*l.randFloat() - 1) * float64(l.Jitter))
+	return max(l.Delay+offset, 0)
+}
+
+// SerializationDelayはパケットを帯域幅に応じて送出するのにかかる時間を返す。
+func (l *Link) SerializationDelay(p Packet) time.Duration {
+	if l.Bandwidth <= 0 {
+		return 0
+	}
+	bits := int64(len(p.Data)) * 8
+	return time.Duration(bits * int64(time.Second) / l.Bandwidth)
+}
+
+// linkReceiverはどのリンクから受信したかを必要とするデバイスが実装する。
+type linkReceiver interface {
+	receiveFrom(l *Link, p Packet)
 }
 
 // Transmitはパケットをリンク経由で送信（イベントバスを使用）。
-func (l *Link) Transmit(p Packet) {
-	fmt.Printf("リンク: %s から %s へパケット送信中、遅延 %v\n", l.From.GetName(), l.To.GetName(), l.Delay)
-	eventBus.AddEvent(l.Delay, func() {
+// リンクが削除済みかダウンしている、または送信待ちキューで破棄した場合は*DropErrorを返す。
+// 伝送中のロスやビット誤りは送信側にはわからないためエラーにならない。
+func (l *Link) Transmit(p Packet) error {
+	if l.removed {
+		l.Stats.countDrop(DropLinkRemoved)
+		l.Network.log().Warnf("リンク: %s から %s へのリンクは削除済みのためパケットを破棄: %s", l.From.GetName(), l.To.GetName(), p)
+		return dropError(l.Name(), DropLinkRemoved)
+	}
+	if !l.Up {
+		l.Stats.countDrop(DropLinkDown)
+		l.Network.recordTrace(p, l.Name(), TraceDrop)
+		l.Network.log().Warnf("リンク: %s から %s へのリンクがダウンしているためパケットを破棄: %s", l.From.GetName(), l.To.GetName(), p)
+		return dropError(l.Name(), DropLinkDown)
+	}
+	if l.MTU > 0 && len(p.Data) > l.MTU {
+		var errs []error
+		for _, f := range l.fragment(p) {
+			errs = append(errs, l.Transmit(f))
+		}
+		return errors.Join(errs...)
+	}
+	if l.Duplex == HalfDuplex {
+		l.transmitHalfDuplex(p.Clone(), 0) // 媒体が空くのを待つ間も送信元の書き換えの影響を受けない
+		return nil
+	}
+	if l.QueueSize > 0 {
+		return l.enqueue(p)
+	}
+	l.send(p)
+	return nil
+}
+
+// sendはパケットを回線に送出し、遅延後に宛先デバイスへ届けるイベントを登録する。
+// 返すハンドルで配送をキャンセルできる（パケットロスの場合はゼロ値）。
+// 送信側がパケットのデータを後から書き換えても伝送中のパケットに影響しないよう、送出時に複製する。
+func (l *Link) send(p Packet) EventHandle {
+	p = p.Clone()
+	if l.Network.Capture != nil {
+		if err := l.Network.Capture.WritePacket(l.Network.Bus.Now(), p); err != nil {
+			l.Network.log().Warnf("リンク: パケットの記録に失敗: %v", err)
+		}
+	}
+	l.Stats.countSent(p)
+	l.recordSample(l.Network.Bus.Now(), len(p.Data))
+	l.Network.recordTrace(p, l.Name(), TraceTransmit)
+	if l.LossRate > 0 && l.randFloat() < l.LossRate {
+		l.Stats.countDrop(DropLoss)
+		l.Network.recordTrace(p, l.Name(), TraceDrop)
+		l.Network.log().Warnf("リンク: %s から %s へのパケットロス: %s", l.From.GetName(), l.To.GetName(), p) // ロスをログ
+		return EventHandle{}
+	}
+	if l.BitErrorRate > 0 && len(p.Data) > 0 && l.randFloat() < l.corruptionProb(p) {
+		p = l.corrupt(p)
+	}
+	serialization := l.SerializationDelay(p)
+	if l.FairShare && l.QueueSize == 0 {
+		serialization = l.fairShareDelay(p, serialization)
+	}
+	delay := l.propagationDelay() + serialization
+	if !l.Reorder {
+		now := l.Network.Bus.Now()
+		if arrival := now.Add(delay); arrival.Before(l.lastArrival) {
+			delay = l.lastArrival.Sub(now)
+		}
+		l.lastArrival = now.Add(delay)
+	}
+	l.Network.log().Debugf("リンク: %s から %s へパケット送信中、遅延 %v%s", l.From.GetName(), l.To.GetName(), delay, p.traceTag())
+	handle := l.Network.Bus.addPacketEvent(delay, l, p, func() {
+		if l.removed { // 伝送中にリンクが削除された
+			l.Stats.countDrop(DropLinkRemoved)
+			l.Network.recordTrace(p, l.Name(), TraceDrop)
+			l.Network.log().Warnf("リンク: %s から %s へのリンクが伝送中に削除されたためパケットを破棄: %s", l.From.GetName(), l.To.GetName(), p)
+			return
+		}
+		if !l.Up { // 伝送中にリンクがダウンした
+			l.Stats.countDrop(DropLinkDown)
+			l.Network.recordTrace(p, l.Name(), TraceDrop)
+			l.Network.log().Warnf("リンク: %s から %s へのリンクが伝送中にダウンしたためパケットを破棄: %s", l.From.GetName(), l.To.GetName(), p)
+			return
+		}
+		l.Stats.countReceived(p)
+		if r, ok := l.To.(linkReceiver); ok {
+			r.receiveFrom(l, p)
+			return
+		}
 		l.To.ReceivePacket(p)
 	})
+	l.checkOverload(len(p.Data))
+	return handle
 }
 
-// Networkはネットワークトポロジーを管理。
+// Networkはネットワークトポロジーを管理し、専用のイベントバスを持つ。
 type Network struct {
-	Devices []Device // ネットワーク内の全デバイス
-	Links   []*Link  // デバイス間の全リンク
+	Devices []Device    // ネットワーク内の全デバイス
+	Links   []*Link     // デバイス間の全リンク
+	Bus     *EventBus   // このネットワークのイベントバス
+	Capture *PcapWriter // 送信パケットの記録先（nilなら記録しない）
+
+	logger    Logger                  // ログの出力先（nilなら既定のロガー）
+	linkIndex map[[2]Device]*Link     // 送信元と宛先の組からリンクを引く索引
+	fragID    int                     // 最後に割り当てた断片の識別子
+	pingID    int                     // 最後に割り当てたpingの識別子
+	traceSeq  int                     // 最後に割り当てたトレースIDの番号
+	traces    map[string][]TraceEvent // トレースIDごとの処理の記録
+	quiet     bool                    // trueならパケット単位の詳細なログ（Debugf）を出力しない
+	recording *recording              // 記録中の操作（nilなら記録しない）
+	receiving int                     // ホストが受信したパケットを処理している深さ（処理中の操作は記録しない）
+}
+
+// NewNetworkは新しいイベントバスを持つ空のネットワークを作成。
+func NewNetwork() *Network {
+	return &Network{Bus: NewEventBus()}
+}
+
+// networkMemberは所属するネットワークを記憶するデバイスが実装する。
+type networkMember interface {
+	setNetwork(n *Network)
 }
 
 // AddDeviceはネットワークにデバイスを追加。
 func (n *Network) AddDevice(d Device) {
 	n.Devices = append(n.Devices, d)
-	fmt.Printf("[Network] デバイス追加: %s\n", d.GetName()) // デバイス追加をログ
+	if m, ok := d.(networkMember); ok {
+		m.setNetwork(n)
+	}
+	n.log().Infof("[Network] デバイス追加: %s", d.GetName()) // デバイス追加をログ
 }
 
-// AddLinkはデバイス間にリンクを追加。
-func (n *Network) AddLink(from, to Device, delay time.Duration) {
-	link := &Link{From: from, To: to, Delay: delay}
+// AddLinkはデバイス間にリンクを追加し、作成したリンクを返す。
+func (n *Network) AddLink(from, to Device, delay time.Duration) *Link {
+	link := &Link{From: from, To: to, Delay: delay, Network: n, Up: true}
 	n.Links = append(n.Links, link)
-	fmt.Printf("[Network] リンク追加: %s -> %s\n", from.GetName(), to.GetName()) // リンク追加をログ
+	if n.linkIndex == nil {
+		n.linkIndex = make(map[[2]Device]*Link)
+	}
+	if _, exists := n.linkIndex[[2]Device{from, to}]; !exists { // 同じ組のリンクは最初のものを優先
+		n.linkIndex[[2]Device{from, to}] = link
+	}
+	n.log().Infof("[Network] リンク追加: %s -> %s", from.GetName(), to.GetName()) // リンク追加をログ
+	return link
+}
+
+// AddBidirectionalLinkはデバイス間に同じ遅延の双方向リンクを追加し、
+// スイッチのリンク表やホストの接続先にも登録する。a->b、b->aの順にリンクを返す。
+func (n *Network) AddBidirectionalLink(a, b Device, delay time.Duration) (*Link, *Link) {
+	ab := n.AddLink(a, b, delay)
+	ba := n.AddLink(b, a, delay)
+	wireLink(a, b, ab)
+	wireLink(b, a, ba)
+	return ab, ba
+}
+
+// wireLinkはリンクの送信元デバイスに接続先の情報を設定。
+func wireLink(from, to Device, link *Link) {
+	switch f := from.(type) {
+	case *Host:
+		if f.ConnectedDev == nil {
+			f.ConnectedDev = to
+		}
+	case *Switch:
+		f.AddPort(to, link)
+	}
 }
 
 // GetLinkは指定されたデバイス間のリンクを返す（存在しない場合はnil）。
 func (n *Network) GetLink(from, to Device) *Link {
-	for _, link := range n.Links {
-		if link.From == from && link.To == to {
-			return link
-		}
+	if link, ok := n.linkIndex[[2]Device{from, to}]; ok {
+		return link
 	}
-	fmt.Printf("[Network] リンクが見つかりません: %s -> %s\n", from.GetName(), to.GetName()) // リンク未発見をログ
+	n.log().Warnf("[Network] リンクが見つかりません: %s -> %s", from.GetName(), to.GetName()) // リンク未発見をログ
 	return nil
 }
 
-var network = &Network{} // グローバルなネットワークインスタンス
+// RemoveLinkは指定されたデバイス間のリンクを削除する。伝送中のパケットは配送されない。
+func (n *Network) RemoveLink(from, to Device) {
+	link, ok := n.linkIndex[[2]Device{from, to}]
+	if !ok {
+		n.log().Warnf("[Network] 削除するリンクが見つかりません: %s -> %s", from.GetName(), to.GetName())
+		return
+	}
+	n.removeLink(link)
+	n.log().Infof("[Network] リンク削除: %s -> %s", from.GetName(), to.GetName()) // リンク削除をログ
+}
+
+// removeLinkはリンクを一覧と索引から取り除き、削除済みにする。
+func (n *Network) removeLink(link *Link) {
+	link.removed = true
+	key := [2]Device{link.From, link.To}
+	delete(n.linkIndex, key)
+	links := n.Links[:0]
+	for _, l := range n.Links {
+		if l == link {
+			continue
+		}
+		links = append(links, l)
+		if _, exists := n.linkIndex[key]; !exists && l.From == link.From && l.To == link.To {
+			n.linkIndex[key] = l // 同じ組の残りのリンクを索引に戻す
+		}
+	}
+	n.Links = links
+}
+
+// RemoveDeviceはデバイスと、そのデバイスに接続する全てのリンクを削除する。
+// 他のデバイスが持つ削除対象への参照（スイッチのポートや学習済みMAC、ホストの接続先）も取り除く。
+func (n *Network) RemoveDevice(d Device) {
+	for _, link := range append([]*Link(nil), n.Links...) {
+		if link.From == d || link.To == d {
+			n.removeLink(link)
+		}
+	}
+	devices := n.Devices[:0]
+	for _, dev := range n.Devices {
+		if dev != d {
+			devices = append(devices, dev)
+		}
+	}
+	n.Devices = devices
+	for _, dev := range n.Devices {
+		switch other := dev.(type) {
+		case *Host:
+			if other.ConnectedDev == d {
+				other.ConnectedDev = nil
+			}
+			for _, nic := range other.NICs {
+				if nic.ConnectedDev == d {
+					nic.ConnectedDev = nil
+				}
+			}
+		case *Switch:
+			other.forget(d)
+		}
+	}
+	n.log().Infof("[Network] デバイス削除: %s", d.GetName()) // デバイス削除をログ
+}
+
+// afterDelayはデバイスの処理遅延の後にfnを実行する。遅延が0以下かネットワークがなければすぐに実行する。
+func (n *Network) afterDelay(delay time.Duration, fn func()) {
+	if n == nil || delay <= 0 {
+		fn()
+		return
+	}
+	n.Bus.AddEvent(delay, fn)
+}
+
+// SendByIPはsrcHostからdstIPへdataを送信する。送信元のIPとMACはホストの層から設定し、
+// 接続先デバイスが未設定ならホストから出るリンクの宛先を最初のホップとして使う。
+func (n *Network) SendByIP(srcHost *Host, dstIP string, data []byte) error {
+	if srcHost.Network != n {
+		return fmt.Errorf("ホスト %s はこのネットワークに属していません", srcHost.Name)
+	}
+	if net.ParseIP(dstIP) == nil {
+		return fmt.Errorf("不正な宛先IP %q", dstIP)
+	}
+	if srcHost.ConnectedDev == nil {
+		for _, l := range n.Links {
+			if l.From == srcHost {
+				srcHost.ConnectedDev = l.To
+				break
+			}
+		}
+		if srcHost.ConnectedDev == nil {
+			return fmt.Errorf("ホスト %s から出るリンクがありません", srcHost.Name)
+		}
+	}
+	return srcHost.Send(dstIP, data)
+}
 
 // Hostはネットワークホストを表す。
 type Host struct {
-	Name         string  // ホストの名前
-	Layers       []Layer // プロトコル層のスタック
-	ConnectedDev Device  // 接続先デバイス（例：スイッチ）
+	Name         string   // ホストの名前
+	Layers       []Layer  // プロトコル層のスタック
+	ConnectedDev Device   // 接続先デバイス（例：スイッチ）
+	Network      *Network // ホストが属するネットワーク
+	Stats        Stats    // ホストが処理したパケットの統計
+	poweredOff   bool     // 電源が切れていればtrue（ゼロ値は電源が入った状態。Network.SetDeviceStateで変更する）
+
+	OnReceive func(p Packet) // 自分宛のパケットがレイヤーを通過した後に呼ばれるアプリケーションのコールバック
+	NICs      []*NIC         // 追加のネットワークインターフェース（LayersとConnectedDevが1つ目のインターフェース）
+	InLimit   *TokenBucket   // 1つ目のインターフェースで受信するパケットに適用するレートの制限（nilなら制限しない）
+	OutLimit  *TokenBucket   // 1つ目のインターフェースからリンクへ送出するパケットに適用するレートの制限（nilなら制限しない）
+
+	pendingARP map[string][]Packet  // ARP解決待ちの送信パケット（宛先IPごと）
+	pings      map[int]*pingSession // 実行中のpingの状態（ICMPの識別子ごと）
+}
+
+// setNetworkはホストと、ホストへの参照を必要とするレイヤーをネットワークに関連付ける。
+func (h *Host) setNetwork(n *Network) {
+	h.Network = n
+	for _, layer := range h.Layers {
+		if b, ok := layer.(hostBinder); ok {
+			b.bindHost(h)
+		}
+	}
+	for _, nic := range h.NICs {
+		nic.DataLink.bindHost(h)
+		nic.Network.bindHost(h)
+	}
+	h.announceLinked()
 }
 
 // SendPacketはパケットを送信し、レイヤーを経由して接続先へ転送。
-func (h *Host) SendPacket(p Packet) {
-	fmt.Printf("%s がパケットを送信開始\n", h.Name)
-	for i := len(h.Layers) - 1; i >= 0; i-- { // 高レイヤから低レイヤへ処理
-		p = h.Layers[i].HandleOutgoing(p)
+// 送信元IPが設定されていればそのインターフェースから、なければ宛先に応じて選んだインターフェースから送出する。
+// 宛先MACが解決できない場合はARPで解決してから送信する（ARPの解決を待つ間はエラーにならない）。
+// 宛先が自分のいずれかのアドレスかループバックアドレスなら、リンクを通さずに自分の受信処理へ渡す。
+// 電源が切れている、IPアドレスが重複している、フレームが大きすぎる、送出先のリンクがないなどの理由で
+// 送れなかった場合は*DropErrorを返す。
+func (h *Host) SendPacket(p Packet) error {
+	if err := h.Network.dropOffline(h.poweredOff, h.Name, &h.Stats, p); err != nil {
+		return err
+	}
+	if p.TraceID == "" && h.Network != nil {
+		p.TraceID = h.Network.nextTraceID()
+	}
+	if p.SentAt.IsZero() && h.Network != nil {
+		p.SentAt = h.Network.Bus.Now()
+	}
+	h.Network.recordTrace(p, h.Name, TraceSend)
+	h.Network.log().Debugf("%s がパケットを送信開始%s", h.Name, p.traceTag())
+	if p.TTL == 0 {
+		p.TTL = DefaultTTL
+	}
+	if p.Protocol == "" {
+		p.Protocol = ProtocolRaw
+	}
+	nic := h.nicFor(p.DstIP)
+	if p.SrcIP != "" {
+		nic = h.nicWithIP(p.SrcIP)
+	}
+	if nl := nic.Network; nl != nil && nl.RefuseOnConflict && nl.ConflictMAC != "" {
+		h.Stats.countDrop(DropIPConflict)
+		h.Network.log().Warnf("%s: IPアドレス %s が %s と重複しているため送信しません%s", h.Name, nl.IP, nl.ConflictMAC, p.traceTag())
+		return dropError(h.Name, DropIPConflict)
+	}
+	layers := h.stack(nic)
+	for i := len(layers) - 1; i >= 0; i-- { // 高レイヤから低レイヤへ処理
+		p = layers[i].HandleOutgoing(p)
+	}
+	if dl := nic.DataLink; dl != nil && dl.oversized(p) {
+		return dropError(h.Name, DropFrameTooLarge) // データリンク層で破棄済み（自分宛てでも配送しない）
+	}
+	if h.Network != nil && h.isLocal(p.DstIP) {
+		return h.loopback(p)
+	}
+	if p.DstMAC == "" {
+		h.resolveARP(p)
+		return nil
+	}
+	return h.transmit(p)
+}
+
+// transmitはレイヤー処理済みのパケットを、送信元IPのインターフェースの接続先へのリンクに送出。
+// インターフェースのOutLimitの予算を超えた場合は、制限の方式に従って送出を遅らせるか破棄する。
+func (h *Host) transmit(p Packet) error {
+	if h.Network == nil {
+		h.Stats.countDrop(DropNoLink)
+		defaultLogger.Warnf("%s: ネットワークに追加されていません", h.Name) // ネットワークがないため既定のロガーに出す
+		return dropError(h.Name, DropNoLink)
+	}
+	delay, err := h.nicWithIP(p.SrcIP).OutLimit.admit(h.Network, &h.Stats, h.Name, p)
+	if err != nil {
+		return err
+	}
+	if delay > 0 {
+		p = p.Clone() // 送出を待つ間に送信元がデータやMetaを書き換えても影響しない
+		h.Network.Bus.AddEvent(delay, func() { h.transmitLink(p) })
+		return nil
 	}
-	if h.ConnectedDev != nil {
-		link := network.GetLink(h, h.ConnectedDev)
+	return h.transmitLink(p)
+}
+
+// transmitLinkはパケットを送信元IPのインターフェースの接続先へのリンクに送出する。
+func (h *Host) transmitLink(p Packet) error {
+	nic := h.nicWithIP(p.SrcIP)
+	if dev := nic.ConnectedDev; dev != nil {
+		link := h.Network.GetLink(h, dev)
 		if link != nil {
-			link.Transmit(p)
-			fmt.Printf("%s: %s へパケット送信完了\n", h.Name, h.ConnectedDev.GetName())
-		} else {
-			fmt.Printf("%s: %s へのリンクが見つかりません\n", h.Name, h.ConnectedDev.GetName()) // エラーケースをログ
+			if nl := nic.Network; nl != nil && !nl.announced {
+				h.announce(nic) // インターフェースから最初に送るときはアドレスを通知してから送る
+			}
+			h.Stats.countSent(p)
+			if err := link.Transmit(p); err != nil {
+				return err
+			}
+			h.Network.log().Debugf("%s: %s へパケット送信完了%s", h.Name, dev.GetName(), p.traceTag())
+			return nil
 		}
+		h.Stats.countDrop(DropNoLink)
+		h.Network.log().Warnf("%s: %s へのリンクが見つかりません", h.Name, dev.GetName()) // エラーケースをログ
 	} else {
-		fmt.Printf("%s: 接続先デバイスが設定されていません\n", h.Name) // 接続先未設定をログ
+		h.Stats.countDrop(DropNoLink)
+		h.Network.log().Warnf("%s: 接続先デバイスが設定されていません", h.Name) // 接続先未設定をログ
 	}
+	return dropError(h.Name, DropNoLink)
 }
 
-// ReceivePacketは受信パケットを低レイヤから高レイヤへ処理。
+// ReceivePacketは受信パケットを低レイヤから高レイヤへ処理。いずれかの層が破棄したらそこで処理をやめ、OnReceiveも呼ばない。
+// 受信したインターフェースのInLimitの予算を超えた場合は、制限の方式に従って受信処理を遅らせるか破棄する。
 func (h *Host) ReceivePacket(p Packet) {
-	fmt.Printf("%s がパケットを受信\n", h.Name)
-	for _, layer := range h.Layers { // 低レイヤから高レイヤへ処理
-		p = layer.HandleIncoming(p)
+	if h.Network.dropOffline(h.poweredOff, h.Name, &h.Stats, p) != nil {
+		return
+	}
+	delay, err := h.nicReceiving(p).InLimit.admit(h.Network, &h.Stats, h.Name, p)
+	if err != nil {
+		return
+	}
+	if delay > 0 {
+		h.Network.Bus.AddEvent(delay, func() { h.receive(p) })
+		return
+	}
+	h.receive(p)
+}
+
+// receiveはレートの制限を通過した受信パケットを処理する。
+func (h *Host) receive(p Packet) {
+	h.Network.log().Debugf("%s がパケットを受信%s", h.Name, p.traceTag())
+	if n := h.Network; n != nil {
+		p.ReceivedAt = n.Bus.Now()
+		n.receiving++ // OnReceiveなどから送ったパケットは再生時に同じように送られる
+		defer func() { n.receiving-- }()
+	}
+	h.Stats.countReceived(p)
+	h.Network.recordTrace(p, h.Name, TraceReceive)
+	if p.ARP != nil {
+		h.handleARP(p)
+		return
+	}
+	if p.DHCP != nil {
+		h.handleDHCP(p)
+		return
+	}
+	nic := h.nicReceiving(p)
+	if nl := nic.Network; nl != nil && p.IsFragment() && sameIP(p.DstIP, nl.IP) {
+		whole, ok := nl.reassemble(p)
+		if !ok {
+			return
+		}
+		p = whole
+	}
+	for _, layer := range h.stack(nic) { // 低レイヤから高レイヤへ処理
+		var ok bool
+		if p, ok = layer.HandleIncoming(p); !ok {
+			return // 破棄したパケットは上位層とアプリケーションへ渡さない
+		}
+	}
+	if h.OnReceive != nil && h.addressedToMe(p) {
+		h.OnReceive(p)
+	}
+}
+
+// addressedToMeはパケットの宛先がこのホストのいずれかのインターフェースのMACとIPに一致するかを返す。
+func (h *Host) addressedToMe(p Packet) bool {
+	for _, nic := range h.nics() {
+		if dl := nic.DataLink; dl != nil && !dl.accepts(p.DstMAC) {
+			continue
+		}
+		if nl := nic.Network; nl != nil && !sameIP(p.DstIP, nl.IP) && !isLoopback(p.DstIP) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// Sendは宛先に応じて選んだインターフェースのアドレスを送信元として、dstのIPアドレスへdataを送信する。
+func (h *Host) Send(dst string, data []byte) error {
+	return h.sendTo(dst, Packet{Data: data})
+}
+
+// sendToはpの宛先をdstにし、送信元のアドレスを宛先に向かうインターフェースのものにして送信する。
+func (h *Host) sendTo(dst string, p Packet) error {
+	h.Network.record(Record{Action: RecordSend, Devices: []string{h.Name}, Value: dst, Data: append([]byte(nil), p.Data...)})
+	p.DstIP = canonicalIP(dst)
+	nic := h.nicFor(dst)
+	if nl := nic.Network; nl != nil {
+		p.SrcIP = nl.IP
+	}
+	if dl := nic.DataLink; dl != nil {
+		p.SrcMAC = dl.MAC
 	}
+	return h.SendPacket(p)
 }
 
 func (h *Host) GetName() string {
 	return h.Name
 }
 
+// SwitchPortはスイッチの番号付きの物理ポートを表す。
+type SwitchPort struct {
+	Number  int    // ポート番号（1から順に割り当て、削除したポートの番号は再利用しない）
+	Name    string // ポートの名前（AddPortで番号の1つ前の数字から「eth0」などと付ける）
+	Peer    Device // ポートの先に直接接続されたデバイス
+	Link    *Link  // このポートからの送出に使うリンク
+	Blocked bool   // 全域木によりブロックされていればtrue（送受信しない）
+	VLAN    int    // アクセスポートとして割り当てたVLAN（0なら全てのVLANを通す）
+	InACL   *ACL   // このポートで受信するパケットに適用するACL（nilなら全て通す）
+	OutACL  *ACL   // このポートから送出するパケットに適用するACL（nilなら全て通す）
+
+	InLimit  *TokenBucket // このポートで受信するフレームに適用するレートの制限（nilなら制限しない）
+	OutLimit *TokenBucket // このポートから送出するフレームに適用するレートの制限（nilなら制限しない）
+
+	MirrorTo *SwitchPort // このポートで送受信するフレームの複製を送る監視用のポート（nilならミラーしない）
+}
+
+// allowsはポートが指定したVLANのフレームを送出できるかを返す。
+func (port *SwitchPort) allows(vlan int) bool {
+	return port.VLAN == 0 || port.VLAN == vlan
+}
+
+// MACEntryはスイッチが学習したMACアドレスの情報を表す。
+type MACEntry struct {
+	Port      *SwitchPort // MACアドレスが存在する方向のポート
+	LearnedAt time.Time   // 学習した時刻
+}
+
 // SwitchはL2スイッチを表す。
 type Switch struct {
-	Name     string            // スイッチの名前
-	Ports    map[string]Device // MACアドレスとデバイスのマッピング
-	MACTable map[string]Device // 学習したMACアドレスとデバイスのテーブル
-	Links    map[Device]*Link  // デバイスごとのリンク
-}
-
-// SendPacketはパケットを転送し、MACテーブルを更新。
-func (s *Switch) SendPacket(p Packet) {
-	if dev, ok := s.Ports[p.SrcMAC]; ok {
-		s.MACTable[p.SrcMAC] = dev // 送信元MACを学習
-		fmt.Printf("[Switch] %s: MACテーブル更新 %s -> %s\n", s.Name, p.SrcMAC, dev.GetName())
-	}
-	if dst, exists := s.MACTable[p.DstMAC]; exists {
-		fmt.Printf("[Switch] %s: %s へパケット転送\n", s.Name, p.DstMAC)
-		link := s.Links[dst]
-		link.Transmit(p)
-	} else {
-		fmt.Printf("[Switch] %s: 不明なMAC %s、ブロードキャスト実行\n", s.Name, p.DstMAC)
-		for mac, dev := range s.Ports {
-			if mac != p.SrcMAC { // 送信元には送らない
-				link := s.Links[dev]
-				link.Transmit(p)
+	Name       string              // スイッチの名前
+	Ports      []*SwitchPort       // ポート番号順のポート一覧
+	MACTable   map[string]MACEntry // 学習したMACアドレスとポートのテーブル
+	AgeTime    time.Duration       // MACテーブルのエントリの有効期間（0なら無期限）
+	Network    *Network            // スイッチが属するネットワーク
+	Stats      Stats               // スイッチが処理したパケットの統計
+	poweredOff bool                // 電源が切れていればtrue（ゼロ値は電源が入った状態。Network.SetDeviceStateで変更する）
+
+	ProcessingDelay time.Duration            // 受信してから転送を始めるまでの処理遅延（0なら即時に転送）
+	MulticastGroups map[string][]*SwitchPort // マルチキャストMACアドレスごとの参加ポート
+
+	DropUnknownUnicast bool // trueなら未学習のユニキャストMAC宛てのフレームをフラッディングせずに破棄する（既定ではフラッディングする）
+
+	nextPort int // 最後に割り当てたポート番号
+}
+
+func (s *Switch) setNetwork(n *Network) {
+	s.Network = n
+}
+
+// AddPortはpeerへのリンクを持つポートを追加する。
+// peerへのポートが既にある場合は、そのポートのリンクを置き換える。
+func (s *Switch) AddPort(peer Device, link *Link) *SwitchPort {
+	if port := s.PortTo(peer); port != nil {
+		port.Link = link
+		return port
+	}
+	s.nextPort++
+	port := &SwitchPort{Number: s.nextPort, Name: portName("", s.nextPort-1), Peer: peer, Link: link}
+	s.Ports = append(s.Ports, port)
+	return port
+}
+
+// PortToはpeerに直接接続されたポートを返す（存在しない場合はnil）。
+func (s *Switch) PortTo(peer Device) *SwitchPort {
+	for _, port := range s.Ports {
+		if port.Peer == peer {
+			return port
+		}
+	}
+	return nil
+}
+
+// lookupMACは学習済みのMACアドレスを検索し、有効期間を過ぎたエントリは削除する。
+func (s *Switch) lookupMAC(mac string) (*SwitchPort, bool) {
+	entry, ok := s.MACTable[mac]
+	if !ok {
+		return nil, false
+	}
+	if s.AgeTime > 0 && s.Network.Bus.Now().Sub(entry.LearnedAt) > s.AgeTime {
+		delete(s.MACTable, mac)
+		s.Network.log().Debugf("[Switch] %s: MACテーブルのエントリが期限切れ %s", s.Name, mac)
+		return nil, false
+	}
+	return entry.Port, true
+}
+
+// forgetはデバイスに接続するポートと、そのポートで学習したMACアドレスを削除。
+func (s *Switch) forget(d Device) {
+	ports := s.Ports[:0]
+	for _, port := range s.Ports {
+		if port.Peer != d {
+			ports = append(ports, port)
+			continue
+		}
+		for mac, entry := range s.MACTable {
+			if entry.Port == port {
+				delete(s.MACTable, mac)
 			}
 		}
 	}
+	s.Ports = ports
+}
+
+// SendPacketは受信ポートを特定せずにパケットを転送する。
+// 学習済みの宛先へのポートで破棄した場合はエラーを返す（フラッディングではエラーにならない）。
+func (s *Switch) SendPacket(p Packet) error {
+	return s.forward(p, nil)
+}
+
+// forwardは受信ポートで送信元MACを学習し、宛先MACに応じて転送またはフラッディングする。
+// ingressがnilの場合は学習せず、全ポートへフラッディングする。
+func (s *Switch) forward(p Packet, ingress *SwitchPort) error {
+	if err := s.Network.dropOffline(s.poweredOff, s.Name, &s.Stats, p); err != nil {
+		return err
+	}
+	if ingress != nil && ingress.Blocked {
+		s.Stats.countDrop(DropBlockedPort)
+		s.Network.log().Debugf("[Switch] %s: ブロック中のポート %d で受信したため破棄%s", s.Name, ingress.Number, p.traceTag())
+		return dropError(s.Name, DropBlockedPort)
+	}
+	if ingress != nil && !ingress.InACL.permits(s.Network, p, "%s ポート %d 受信", s.Name, ingress.Number) {
+		s.Stats.countDrop(DropACL)
+		return dropError(s.Name, DropACL)
+	}
+	if ingress != nil && ingress.VLAN != 0 {
+		p.VLAN = ingress.VLAN // アクセスポートで受信したフレームはポートのVLANに属する
+	}
+	vlan := p.VLANID()
+	s.mirror(p, ingress)
+	if ingress != nil {
+		if s.MACTable == nil {
+			s.MACTable = make(map[string]MACEntry)
+		}
+		s.MACTable[p.SrcMAC] = MACEntry{Port: ingress, LearnedAt: s.Network.Bus.Now()} // 送信元MACを学習
+		s.Network.log().Debugf("[Switch] %s: MACテーブル更新 %s -> ポート %d", s.Name, p.SrcMAC, ingress.Number)
+	}
+	switch {
+	case p.DstMAC == BroadcastMAC:
+		s.Network.log().Debugf("[Switch] %s: VLAN %d 内でブロードキャスト実行%s", s.Name, vlan, p.traceTag())
+		s.flood(p, ingress, vlan, s.Ports)
+		return nil
+	case isMulticastMAC(p.DstMAC):
+		if members, ok := s.MulticastGroups[p.DstMAC]; ok {
+			s.Network.log().Debugf("[Switch] %s: マルチキャスト %s を参加ポート %d 個へ転送%s", s.Name, p.DstMAC, len(members), p.traceTag())
+			s.flood(p, ingress, vlan, members)
+			return nil
+		}
+	}
+	port, exists := s.lookupMAC(p.DstMAC)
+	if exists && port.Link == nil {
+		// リンクが未設定のポートへは送れないため、エントリを忘れてフラッディングする
+		s.Network.log().Warnf("[Switch] %s: %s を学習したポート %d (%s 方向) にリンクがないためフラッディング%s", s.Name, p.DstMAC, port.Number, port.Peer.GetName(), p.traceTag())
+		delete(s.MACTable, p.DstMAC)
+		exists = false
+	}
+	if exists {
+		if port == ingress {
+			s.Network.log().Debugf("[Switch] %s: %s は受信ポート %d の先にいるため転送しない%s", s.Name, p.DstMAC, port.Number, p.traceTag())
+			return nil
+		}
+		if port.Blocked {
+			s.Stats.countDrop(DropBlockedPort)
+			s.Network.log().Warnf("[Switch] %s: 転送先のポート %d がブロック中のため破棄%s", s.Name, port.Number, p.traceTag())
+			return dropError(s.Name, DropBlockedPort)
+		}
+		if !port.allows(vlan) {
+			s.Stats.countDrop(DropVLANMismatch)
+			s.Network.log().Warnf("[Switch] %s: VLAN %d のフレームをVLAN %d のポート %d へ転送できないため破棄%s", s.Name, vlan, port.VLAN, port.Number, p.traceTag())
+			return dropError(s.Name, DropVLANMismatch)
+		}
+		if !port.OutACL.permits(s.Network, p, "%s ポート %d 送信", s.Name, port.Number) {
+			s.Stats.countDrop(DropACL)
+			return dropError(s.Name, DropACL)
+		}
+		s.Network.log().Debugf("[Switch] %s: %s へパケット転送 (ポート %d)%s", s.Name, p.DstMAC, port.Number, p.traceTag())
+		s.Stats.countSent(p)
+		s.mirror(p, port)
+		return port.OutLimit.transmit(s.Network, &s.Stats, s.Name, port.Link, p)
+	}
+	if s.DropUnknownUnicast && !isMulticastMAC(p.DstMAC) {
+		s.Stats.countDrop(DropUnknownUnicast)
+		s.Network.log().Warnf("[Switch] %s: 未学習のMAC %s 宛てのためフラッディングせずに破棄%s", s.Name, p.DstMAC, p.traceTag())
+		return dropError(s.Name, DropUnknownUnicast)
+	}
+	s.Network.log().Debugf("[Switch] %s: 不明なMAC %s、VLAN %d 内でブロードキャスト実行%s", s.Name, p.DstMAC, vlan, p.traceTag())
+	s.flood(p, ingress, vlan, s.Ports)
+	return nil
+}
+
+// floodはportsのうち受信ポート以外で、ブロックされておらずVLANが一致するポートへパケットの複製を送る。
+// portsはポート番号順に並んでいるため、同じトポロジーなら実行のたびに同じ順序で送出する。
+func (s *Switch) flood(p Packet, ingress *SwitchPort, vlan int, ports []*SwitchPort) {
+	for _, port := range ports {
+		if port != ingress && !port.Blocked && port.allows(vlan) { // 受信ポート、ブロック中のポート、別VLANのポートには送らない
+			if port.Link == nil {
+				s.Stats.countDrop(DropNoLink)
+				s.Network.log().Warnf("[Switch] %s: ポート %d (%s 方向) にリンクがないため送信しない%s", s.Name, port.Number, port.Peer.GetName(), p.traceTag())
+				continue
+			}
+			if !port.OutACL.permits(s.Network, p, "%s ポート %d 送信", s.Name, port.Number) {
+				s.Stats.countDrop(DropACL)
+				continue
+			}
+			s.Stats.countSent(p)
+			s.mirror(p, port)
+			port.OutLimit.transmit(s.Network, &s.Stats, s.Name, port.Link, p.Clone())
+		}
+	}
 }
 
 // ReceivePacketは受信したパケットを転送処理に渡す。
 func (s *Switch) ReceivePacket(p Packet) {
-	fmt.Printf("[Switch] %s: パケット受信\n", s.Name)
-	s.SendPacket(p)
+	if s.Network.dropOffline(s.poweredOff, s.Name, &s.Stats, p) != nil {
+		return
+	}
+	s.Network.log().Debugf("[Switch] %s: パケット受信%s", s.Name, p.traceTag())
+	s.Stats.countReceived(p)
+	s.Network.recordTrace(p, s.Name, TraceReceive)
+	s.Network.afterDelay(s.ProcessingDelay, func() { s.forward(p, nil) })
+}
+
+// receiveFromはリンク経由で届いたパケットを、そのリンクの送信元に接続するポートで受信する。
+// 送信元へのポートがまだなければ、到着したリンクを受信ポートとして追加してから学習する。
+// ポートのInLimitの予算を超えた場合は、制限の方式に従って転送を遅らせるか破棄する。
+func (s *Switch) receiveFrom(link *Link, p Packet) {
+	if s.Network.dropOffline(s.poweredOff, s.Name, &s.Stats, p) != nil {
+		return
+	}
+	port := s.PortTo(link.From)
+	if port == nil {
+		var back *Link
+		if s.Network != nil {
+			back = s.Network.linkIndex[[2]Device{s, link.From}]
+		}
+		port = s.AddPort(link.From, back)
+		s.Network.log().Infof("[Switch] %s: %s からの受信によりポート %d を追加", s.Name, link.From.GetName(), port.Number)
+	}
+	wait, err := port.InLimit.admit(s.Network, &s.Stats, s.Name, p)
+	if err != nil {
+		return
+	}
+	s.Network.log().Debugf("[Switch] %s: ポート %d でパケット受信%s", s.Name, port.Number, p.traceTag())
+	s.Stats.countReceived(p)
+	s.Network.recordTrace(p, s.Name, TraceReceive)
+	s.Network.afterDelay(wait+s.ProcessingDelay, func() { s.forward(p, port) })
 }
 
 func (s *Switch) GetName() string {
 	return s.Name
 }
 
-// RouterはL3ルータを表す（現在未使用）。
+// RouterはL3ルータを表す。
 type Router struct {
-	Name  string            // ルータの名前
-	Ports map[string]Device // IPアドレスとデバイスのマッピング
+	Name       string       // ルータの名前
+	IP         string       // ICMPメッセージの送信元として使うIPアドレス（空なら最初のインターフェースのIP）
+	Interfaces []*Interface // サブネットに直結するインターフェース
+	Table      RoutingTable // 経路表
+	NAT        *NAT         // 送信元アドレス変換（nilなら変換しない）
+	Stats      Stats        // ルータが処理したパケットの統計
+	Network    *Network     // ルータが属するネットワーク
+	poweredOff bool         // 電源が切れていればtrue（ゼロ値は電源が入った状態。Network.SetDeviceStateで変更する）
+
+	ProcessingDelay time.Duration // 受信してから転送を始めるまでの処理遅延（0なら即時に転送）
+	ProxyARP        bool          // trueなら転送できる他のサブネットのIPへのARP要求に自分のMACで応答する
+
+	arpTable     map[string]string   // 直結サブネット上のIPアドレスとMACアドレスの対応
+	pendingARP   map[string][]Packet // ARP解決待ちの転送パケット（宛先IPごと）
+	ripWithdrawn []net.IPNet         // 次のRIPの広告で到達不能として伝える宛先
 }
 
-func (r *Router) SendPacket(p Packet) {
-	if nextHop, exists := r.Ports[p.DstIP]; exists {
-		fmt.Printf("[Router] %s: %s へパケット転送\n", r.Name, p.DstIP)
-		nextHop.ReceivePacket(p)
-	} else {
-		fmt.Printf("[Router] %s: %s への経路なし\n", r.Name, p.DstIP)
+func (r *Router) setNetwork(n *Network) {
+	r.Network = n
+}
+
+// AddRouteはCIDR表記の宛先ネットワークへの経路を追加。
+func (r *Router) AddRoute(cidr string, nextHop Device, metric int) error {
+	_, dst, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return fmt.Errorf("不正な経路の宛先 %q: %w", cidr, err)
 	}
+	r.Table.Add(Route{Destination: *dst, NextHop: nextHop, Metric: metric})
+	r.Network.log().Infof("[Router] %s: 経路追加 %s -> %s (metric %d)", r.Name, dst, nextHop.GetName(), metric) // 経路追加をログ
+	return nil
+}
+
+// SetDefaultRouteはどの経路にも一致しないIPv4の宛先を送るデフォルトルート（0.0.0.0/0）をnextHopへ設定する。
+// プレフィックス長が0のため、より具体的な経路が一致すればそちらが優先される。
+// 既に手動で設定したデフォルトルートがあれば置き換える（IPv6は AddRoute("::/0", ...) で追加する）。
+func (r *Router) SetDefaultRoute(nextHop Device) {
+	def := net.IPNet{IP: net.IPv4zero.To4(), Mask: net.CIDRMask(0, 32)}
+	kept := r.Table.Routes[:0]
+	for _, route := range r.Table.Routes {
+		if route.Dynamic || route.RIP || route.Destination.String() != def.String() {
+			kept = append(kept, route)
+		}
+	}
+	r.Table.Routes = kept
+	r.Table.Add(Route{Destination: def, NextHop: nextHop})
+	r.Network.log().Infof("[Router] %s: デフォルトルートを設定 %s -> %s", r.Name, &def, nextHop.GetName())
+}
+
+// SendPacketはルータからパケットを送信する。TTLが未設定ならDefaultTTLを使い、relayで転送する。
+// 宛先が不正、TTL切れ、経路がないなどの理由でその場で破棄した場合は*DropErrorを返す。
+func (r *Router) SendPacket(p Packet) error {
+	if p.TTL == 0 {
+		p.TTL = DefaultTTL
+	}
+	return r.relay(p)
+}
+
+// relayはTTLを減らし、宛先が直結サブネットならそのインターフェースへ、
+// そうでなければ経路表を最長一致で検索して次ホップへパケットを転送。
+// 受信したパケットはTTLを補わないため、TTLが0のまま届いたパケットはTTL切れとして破棄する。
+func (r *Router) relay(p Packet) error {
+	if err := r.Network.dropOffline(r.poweredOff, r.Name, &r.Stats, p); err != nil {
+		return err
+	}
+	dst := net.ParseIP(p.DstIP)
+	if dst == nil {
+		r.Stats.countDrop(DropInvalidAddress)
+		r.Network.log().Warnf("[Router] %s: 不正な宛先IP %q、パケットを破棄%s", r.Name, p.DstIP, p.traceTag())
+		return dropError(r.Name, DropInvalidAddress)
+	}
+	if r.NAT != nil && !r.translate(&p) {
+		return dropError(r.Name, DropNATExhausted)
+	}
+	if r.ownsIP(p.DstIP) {
+		r.Network.log().Debugf("[Router] %s: 自分宛のパケットを受信: %s", r.Name, p)
+		return nil
+	}
+	p.TTL--
+	if p.TTL <= 0 {
+		r.Stats.countDrop(DropTTLExpired)
+		r.Network.log().Warnf("[Router] %s: TTL切れのためパケットを破棄: %s", r.Name, p)
+		r.sendTimeExceeded(p)
+		return dropError(r.Name, DropTTLExpired)
+	}
+	err := r.route(p)
+	if errors.Is(err, DropNoRoute) {
+		r.Stats.countDrop(DropNoRoute)
+		r.Network.log().Warnf("[Router] %s: %s への経路なし%s", r.Name, p.DstIP, p.traceTag())
+		r.sendUnreachable(p)
+	}
+	return err
+}
+
+// routeはパケットを直結サブネットか経路表の次ホップへ送る。宛先に届ける手段がなければ
+// DropNoRouteの*DropErrorを返し（破棄の記録は呼び出し元が行う）、送出先で破棄すればそのエラーを返す。
+// 等コストの経路が複数あれば、フローごとにハッシュで選んだ1つを使う。
+func (r *Router) route(p Packet) error {
+	dst := net.ParseIP(p.DstIP)
+	if iface := r.connectedInterface(dst); iface != nil {
+		return r.deliverConnected(iface, p)
+	}
+	routes := r.Table.LookupAll(dst)
+	if len(routes) == 0 {
+		return dropError(r.Name, DropNoRoute)
+	}
+	return r.forward(p, selectRoute(routes, p))
+}
+
+// forwardはパケットを経路の次ホップへ渡す。
+// 次ホップへのインターフェースかリンクがあればそのリンクで送信し、なければ次ホップへ直接渡す。
+func (r *Router) forward(p Packet, route Route) error {
+	r.Network.log().Debugf("[Router] %s: %s へパケット転送 (経路 %s, 次ホップ %s)%s", r.Name, p.DstIP, &route.Destination, route.NextHop.GetName(), p.traceTag())
+	iface := r.interfaceTo(route.NextHop)
+	if iface != nil && !iface.OutACL.permits(r.Network, p, "%s インターフェース %s 送信", r.Name, iface.IP) {
+		r.Stats.countDrop(DropACL)
+		return dropError(r.Name, DropACL)
+	}
+	r.Stats.countSent(p)
+	if iface != nil {
+		p.SrcMAC = iface.MAC
+		if next, ok := route.NextHop.(*Router); ok {
+			if back := next.interfaceTo(r); back != nil {
+				p.DstMAC = back.MAC
+			}
+		}
+	}
+	if h, ok := route.NextHop.(*Host); ok {
+		if dl := h.nicWithIP(p.DstIP).DataLink; dl != nil {
+			p.DstMAC = dl.MAC
+		}
+	}
+	if iface != nil {
+		return iface.OutLimit.transmit(r.Network, &r.Stats, r.Name, iface.Link, p)
+	}
+	if r.Network != nil {
+		if l := r.Network.linkIndex[[2]Device{r, route.NextHop}]; l != nil {
+			return l.Transmit(p)
+		}
+	}
+	route.NextHop.ReceivePacket(p)
+	return nil
 }
 
 func (r *Router) ReceivePacket(p Packet) {
-	fmt.Printf("[Router] %s: パケット受信\n", r.Name)
-	r.SendPacket(p)
+	if r.Network.dropOffline(r.poweredOff, r.Name, &r.Stats, p) != nil {
+		return
+	}
+	r.receive(p, nil)
+}
+
+// receiveFromはリンク経由で届いたパケットを、そのリンクの送信元に接続するインターフェースで受信する。
+// RIPの広告は送信元のルータを学習元として処理する。それ以外のパケットがインターフェースのInLimitの予算を
+// 超えた場合は、制限の方式に従って受信処理を遅らせるか破棄する。
+func (r *Router) receiveFrom(link *Link, p Packet) {
+	if r.Network.dropOffline(r.poweredOff, r.Name, &r.Stats, p) != nil {
+		return
+	}
+	if p.RIP != nil {
+		r.Stats.countReceived(p)
+		r.handleRIP(link.From, p.RIP)
+		return
+	}
+	ingress := r.interfaceTo(link.From)
+	if ingress == nil {
+		r.receive(p, nil)
+		return
+	}
+	wait, err := ingress.InLimit.admit(r.Network, &r.Stats, r.Name, p)
+	if err != nil {
+		return
+	}
+	r.Network.afterDelay(wait, func() { r.receive(p, ingress) })
+}
+
+// receiveは受信インターフェースで自分宛のフレームだけを受け取り、ARPに応答するか転送処理に渡す。
+func (r *Router) receive(p Packet, ingress *Interface) {
+	r.Network.log().Debugf("[Router] %s: パケット受信%s", r.Name, p.traceTag())
+	r.Stats.countReceived(p)
+	r.Network.recordTrace(p, r.Name, TraceReceive)
+	if ingress != nil && ingress.MAC != "" && p.DstMAC != ingress.MAC && p.DstMAC != BroadcastMAC {
+		r.Stats.countDrop(DropMACMismatch)
+		r.Network.log().Debugf("[Router] %s: インターフェース %s 宛てではないフレームを破棄%s", r.Name, ingress.IP, p.traceTag())
+		return
+	}
+	if p.ARP != nil {
+		r.handleARP(ingress, p)
+		return
+	}
+	if ingress != nil && !ingress.InACL.permits(r.Network, p, "%s インターフェース %s 受信", r.Name, ingress.IP) {
+		r.Stats.countDrop(DropACL)
+		return
+	}
+	r.Network.afterDelay(r.ProcessingDelay, func() { r.relay(p) })
 }
 
 func (r *Router) GetName() string {
@@ -288,6 +1647,17 @@ func (r *Router) GetName() string {
 
 // mainはシミュレーションのエントリーポイント。
 func main() {
+	script := flag.String("script", "", "実行するコマンドのファイル（\"-\"なら標準入力から対話的に読む）")
+	flag.Parse()
+	if *script != "" {
+		if err := runScript(*script); err != nil {
+			os.Exit(1)
+		}
+		return
+	}
+
+	network := NewNetwork()
+
 	// ホスト1の初期化
 	host1 := &Host{
 		Name: "Host1",
@@ -305,36 +1675,22 @@ func main() {
 		},
 	}
 	// スイッチの初期化
-	switch1 := &Switch{
-		Name: "Switch1",
-		Ports: map[string]Device{
-			"AA:BB:CC:DD:EE:01": host1,
-			"AA:BB:CC:DD:EE:02": host2,
-		},
-		MACTable: make(map[string]Device),
-		Links:    make(map[Device]*Link),
-	}
+	switch1 := &Switch{Name: "Switch1"}
 
 	// ネットワークトポロジーの設定
 	network.AddDevice(host1)
 	network.AddDevice(host2)
 	network.AddDevice(switch1)
-	network.AddLink(host1, switch1, 50*time.Millisecond) // ホスト1 -> スイッチ
-	network.AddLink(switch1, host1, 50*time.Millisecond) // スイッチ -> ホスト1
-	network.AddLink(switch1, host2, 50*time.Millisecond) // スイッチ -> ホスト2
-
-	// ホストとスイッチの接続設定
-	host1.ConnectedDev = switch1
-	switch1.Links[host1] = network.GetLink(switch1, host1)
-	switch1.Links[host2] = network.GetLink(switch1, host2)
-
-	// パケットの作成と送信
-	packet := Packet{Data: "Hello Network!!", SrcIP: "192.168.1.1", DstIP: "192.168.1.2", SrcMAC: "AA:BB:CC:DD:EE:01", DstMAC: "AA:BB:CC:DD:EE:02"}
-	fmt.Printf("[Main] パケット送信開始: %s\n", packet)
+	network.AddBidirectionalLink(host1, switch1, 50*time.Millisecond) // ホスト1 <-> スイッチ
+	network.AddBidirectionalLink(host2, switch1, 50*time.Millisecond) // ホスト2 <-> スイッチ
+
+	// パケットの作成と送信（宛先MACはARPで解決）
+	packet := NewPacket("192.168.1.1", "192.168.1.2", "Hello Network!!")
+	network.log().Infof("[Main] パケット送信開始: %s", packet)
 	host1.SendPacket(packet)
 
 	// イベントバスの実行
-	fmt.Printf("[Main] イベントバス実行開始\n")
-	eventBus.Run()
-	fmt.Printf("[Main] シミュレーション終了\n")
+	network.log().Infof("[Main] イベントバス実行開始")
+	network.Bus.Run()
+	network.log().Infof("[Main] シミュレーション終了")
 }
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// testLogWriterはネットワークのログをテストのログに書き出す。
+type testLogWriter struct{ t testing.TB }
+
+func (w testLogWriter) Write(p []byte) (int, error) {
+	w.t.Log(strings.TrimSuffix(string(p), "\n"))
+	return len(p), nil
+}
+
+// newTestNetworkは警告以上のログだけをテストのログに出すネットワークを作る。
+func newTestNetwork(t testing.TB) *Network {
+	n := NewNetwork()
+	n.SetLogger(NewWriterLogger(testLogWriter{t}, LevelWarn))
+	return n
+}
+
+// newTestHostはデータリンク層とネットワーク層を持つホストを作る。
+func newTestHost(name, mac, ip string) *Host {
+	return &Host{
+		Name: name,
+		Layers: []Layer{
+			&DataLinkLayer{Name: "DataLink", MAC: mac},
+			&NetworkLayer{Name: "Network", IP: ip},
+		},
+	}
+}
+
+// newTestLANはスイッチSにホストA（10.0.0.1）とB（10.0.0.2）を1msのリンクでつないだネットワークを作る。
+func newTestLAN(t testing.TB) (*Network, *Host, *Host, *Switch) {
+	n := newTestNetwork(t)
+	a := newTestHost("A", "AA:AA:AA:AA:AA:01", "10.0.0.1")
+	b := newTestHost("B", "AA:AA:AA:AA:AA:02", "10.0.0.2")
+	s := &Switch{Name: "S"}
+	n.AddDevice(a)
+	n.AddDevice(b)
+	n.AddDevice(s)
+	n.AddBidirectionalLink(a, s, time.Millisecond)
+	n.AddBidirectionalLink(b, s, time.Millisecond)
+	return n, a, b, s
+}
+
+// newTestRoutedNetはルータRのインターフェース10.0.0.254/24にホストA（10.0.0.1）を、
+// 203.0.113.254/24にホストB（203.0.113.1）を1msのリンクで直結したネットワークを作る。
+func newTestRoutedNet(t testing.TB) (*Network, *Host, *Host, *Router) {
+	t.Helper()
+	n := newTestNetwork(t)
+	a := newTestHost("A", "AA:AA:AA:AA:AA:01", "10.0.0.1")
+	b := newTestHost("B", "AA:AA:AA:AA:AA:02", "203.0.113.1")
+	a.networkLayer().SubnetMask, a.networkLayer().Gateway = "255.255.255.0", "10.0.0.254"
+	b.networkLayer().SubnetMask, b.networkLayer().Gateway = "255.255.255.0", "203.0.113.254"
+	r := &Router{Name: "R"}
+	n.AddDevice(a)
+	n.AddDevice(b)
+	n.AddDevice(r)
+	ra, _ := n.AddBidirectionalLink(r, a, time.Millisecond)
+	rb, _ := n.AddBidirectionalLink(r, b, time.Millisecond)
+	if _, err := r.AddInterface("10.0.0.254/24", "RR:RR:RR:RR:RR:01", ra); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.AddInterface("203.0.113.254/24", "RR:RR:RR:RR:RR:02", rb); err != nil {
+		t.Fatal(err)
+	}
+	return n, a, b, r
+}
+
+// skipAnnounceはホストの全てのインターフェースをGratuitous ARPで通知済みにし、
+// 最初の送信の前に自動で送るGratuitous ARPがテストするフレームに混ざらないようにする。
+func skipAnnounce(hosts ...*Host) {
+	for _, h := range hosts {
+		for _, nic := range h.nics() {
+			if nic.Network != nil {
+				nic.Network.announced = true
+			}
+		}
+	}
+}
+
+// runBusはイベントバスを最後まで進め、上限などのエラーがあればテストを失敗させる。
+func runBus(t testing.TB, n *Network) {
+	t.Helper()
+	if err := n.Bus.Run(); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+}
+
+// elapsedはシミュレーションの開始からの仮想時間を返す。
+func elapsed(n *Network) time.Duration {
+	return n.Bus.Now().Sub(SimulationEpoch)
+}
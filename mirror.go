@@ -0,0 +1,39 @@
+package main
+
+// MirrorPortはsrcに接続するポートで送受信する全てのフレームの複製を、monitorに接続するポートへ送るようにする。
+// monitorがnilならsrcのポートのミラーを止める。
+func (s *Switch) MirrorPort(src, monitor Device) {
+	port := s.PortTo(src)
+	if port == nil {
+		s.Network.log().Warnf("[Switch] %s: %s へのポートがないためミラーできません", s.Name, src.GetName())
+		return
+	}
+	if monitor == nil {
+		port.MirrorTo = nil
+		s.Network.log().Infof("[Switch] %s: ポート %d のミラーを停止", s.Name, port.Number)
+		return
+	}
+	dst := s.PortTo(monitor)
+	if dst == nil || dst == port {
+		s.Network.log().Warnf("[Switch] %s: %s へのポートをミラー先にできません", s.Name, monitor.GetName())
+		return
+	}
+	port.MirrorTo = dst
+	s.Network.log().Infof("[Switch] %s: ポート %d (%s 方向) をポート %d (%s 方向) へミラー", s.Name, port.Number, src.GetName(), dst.Number, monitor.GetName())
+}
+
+// mirrorはportがミラー対象なら、フレームの複製をミラー先のポートへ送る。
+func (s *Switch) mirror(p Packet, port *SwitchPort) {
+	if port == nil || port.MirrorTo == nil {
+		return
+	}
+	monitor := port.MirrorTo
+	if monitor.Link == nil {
+		s.Stats.countDrop(DropNoLink)
+		s.Network.log().Warnf("[Switch] %s: ミラー先のポート %d にリンクがないため複製を送れません%s", s.Name, monitor.Number, p.traceTag())
+		return
+	}
+	s.Network.log().Debugf("[Switch] %s: ポート %d のフレームをポート %d へミラー%s", s.Name, port.Number, monitor.Number, p.traceTag())
+	s.Stats.countSent(p)
+	monitor.Link.Transmit(p.Clone())
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net"
+	"slices"
+)
+
+// isMulticastMACはMACアドレスがマルチキャスト（先頭オクテットの最下位ビットが1）かどうかを返す。
+// ブロードキャストアドレスはマルチキャストとして扱わない。
+func isMulticastMAC(mac string) bool {
+	if mac == BroadcastMAC {
+		return false
+	}
+	hw, err := net.ParseMAC(mac)
+	return err == nil && len(hw) > 0 && hw[0]&1 == 1
+}
+
+// acceptsはこの層が宛先MACのフレームを受信するかどうかを返す。
+func (dl *DataLinkLayer) accepts(mac string) bool {
+	return mac == dl.MAC || mac == BroadcastMAC || slices.Contains(dl.MulticastGroups, mac)
+}
+
+// JoinMulticastはpeerに接続するポートをマルチキャストMACアドレスmacのグループに参加させる。
+// 参加ポートのあるグループ宛てのフレームは、参加ポートにだけ転送される。
+func (s *Switch) JoinMulticast(mac string, peer Device) {
+	if !isMulticastMAC(mac) {
+		s.Network.log().Warnf("[Switch] %s: %s はマルチキャストアドレスではありません", s.Name, mac)
+		return
+	}
+	port := s.PortTo(peer)
+	if port == nil {
+		s.Network.log().Warnf("[Switch] %s: %s へのポートがないためマルチキャスト %s に参加できません", s.Name, peer.GetName(), mac)
+		return
+	}
+	if slices.Contains(s.MulticastGroups[mac], port) {
+		return
+	}
+	if s.MulticastGroups == nil {
+		s.MulticastGroups = make(map[string][]*SwitchPort)
+	}
+	// フラッディングの順序をブロードキャストと同じポート番号順にそろえるため、参加順ではなく番号順に並べる
+	members := append(s.MulticastGroups[mac], port)
+	slices.SortFunc(members, func(a, b *SwitchPort) int { return a.Number - b.Number })
+	s.MulticastGroups[mac] = members
+	s.Network.log().Infof("[Switch] %s: ポート %d (%s 方向) がマルチキャスト %s に参加", s.Name, port.Number, peer.GetName(), mac)
+}
+
+// LeaveMulticastはpeerに接続するポートをマルチキャストMACアドレスmacのグループから外す。
+func (s *Switch) LeaveMulticast(mac string, peer Device) {
+	port := s.PortTo(peer)
+	members := slices.DeleteFunc(s.MulticastGroups[mac], func(p *SwitchPort) bool { return p == port })
+	if len(members) == 0 {
+		delete(s.MulticastGroups, mac)
+		return
+	}
+	s.MulticastGroups[mac] = members
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"net"
+)
+
+const (
+	DefaultNATPortStart   = 49152 // 変換後の送信元ポートの既定の開始番号
+	DefaultNATMaxMappings = 16384 // 既定の変換表の最大エントリ数
+)
+
+// natKeyは変換前の内部の送信元を識別する。
+type natKey struct {
+	Protocol Protocol
+	IP       string
+	Port     int
+}
+
+// NATは内部サブネットから外部への送信元アドレスとポートを変換する（PAT）。
+// ポートのないICMPは、エコー要求の識別子をポートの代わりに変換する。
+type NAT struct {
+	ExternalIP  string    // 変換後の送信元IPアドレス
+	Inside      net.IPNet // 変換対象の内部サブネット
+	PortStart   int       // 割り当てる外部ポートの開始番号（0なら既定値）
+	MaxMappings int       // 変換表の最大エントリ数（0なら既定値）
+
+	mappings map[natKey]int // 内部の送信元から外部ポートへの対応
+	reverse  map[int]natKey // 外部ポートから内部の送信元への対応
+	nextPort int            // 次に割り当てる外部ポート
+}
+
+// NewNATはinsideCIDRの内部サブネットをexternalIPに変換するNATを作成。
+func NewNAT(externalIP, insideCIDR string) (*NAT, error) {
+	if net.ParseIP(externalIP) == nil {
+		return nil, fmt.Errorf("不正な外部IPアドレス %q", externalIP)
+	}
+	_, inside, err := net.ParseCIDR(insideCIDR)
+	if err != nil {
+		return nil, fmt.Errorf("不正な内部サブネット %q: %w", insideCIDR, err)
+	}
+	return &NAT{ExternalIP: externalIP, Inside: *inside}, nil
+}
+
+// Lenは変換表のエントリ数を返す。
+func (nat *NAT) Len() int {
+	return len(nat.mappings)
+}
+
+// natPortsはNATがポートとして書き換える送信元と宛先の値を返す。
+// ICMPにはポートがないため、エコー要求と応答、エラー通知が持つエコー要求の識別子を両方に使う。
+// ICMPのメッセージは他のパケットの複製と共有しないよう複製してから返す。
+func natPorts(p *Packet) (src, dst *int) {
+	if p.ICMP != nil {
+		icmp := *p.ICMP
+		p.ICMP = &icmp
+		return &icmp.ID, &icmp.ID
+	}
+	return &p.SrcPort, &p.DstPort
+}
+
+// outboundは内部から外部へのパケットの送信元を外部IPと割り当てたポートに書き換える。
+// 変換表が一杯で新しい対応を作れなければfalseを返す。
+func (nat *NAT) outbound(p *Packet) bool {
+	srcPort, _ := natPorts(p)
+	key := natKey{Protocol: p.Proto(), IP: p.SrcIP, Port: *srcPort}
+	port, ok := nat.mappings[key]
+	if !ok {
+		maxMappings := nat.MaxMappings
+		if maxMappings == 0 {
+			maxMappings = DefaultNATMaxMappings
+		}
+		if len(nat.mappings) >= maxMappings {
+			return false
+		}
+		if nat.mappings == nil {
+			nat.mappings = make(map[natKey]int)
+			nat.reverse = make(map[int]natKey)
+		}
+		if nat.nextPort == 0 {
+			nat.nextPort = nat.PortStart
+			if nat.nextPort == 0 {
+				nat.nextPort = DefaultNATPortStart
+			}
+		}
+		port = nat.nextPort
+		nat.nextPort++
+		nat.mappings[key] = port
+		nat.reverse[port] = key
+	}
+	p.SrcIP, *srcPort = nat.ExternalIP, port
+	return true
+}
+
+// inboundは外部IPの割り当て済みポート宛てのパケットの宛先を内部の送信元へ戻す。
+// 対応がなければfalseを返し、パケットは変更しない。
+func (nat *NAT) inbound(p *Packet) bool {
+	if !sameIP(p.DstIP, nat.ExternalIP) {
+		return false
+	}
+	id := p.DstPort
+	if p.ICMP != nil {
+		id = p.ICMP.ID
+	}
+	key, ok := nat.reverse[id]
+	if !ok || key.Protocol != p.Proto() {
+		return false
+	}
+	_, dstPort := natPorts(p)
+	p.DstIP, *dstPort = key.IP, key.Port
+	return true
+}
+
+// translateはルータのNATでパケットのアドレスを変換し、破棄すべきならfalseを返す。
+// ヘッダのチェックサムが計算済みなら、変換後のアドレスで計算し直す。
+func (r *Router) translate(p *Packet) bool {
+	if !r.rewrite(p) {
+		return false
+	}
+	if p.HeaderChecksum != 0 {
+		p.HeaderChecksum = headerChecksum(*p)
+	}
+	return true
+}
+
+// rewriteはNATの変換表に従ってパケットのアドレスとポートを書き換える。
+func (r *Router) rewrite(p *Packet) bool {
+	nat := r.NAT
+	src, dst := net.ParseIP(p.SrcIP), net.ParseIP(p.DstIP)
+	if nat.inbound(p) {
+		r.Network.log().Debugf("[NAT] %s: %s:%d へ宛先を変換", r.Name, p.DstIP, p.DstPort)
+		return true
+	}
+	if src == nil || !nat.Inside.Contains(src) || nat.Inside.Contains(dst) {
+		return true
+	}
+	orig := fmt.Sprintf("%s:%d", p.SrcIP, p.SrcPort)
+	if !nat.outbound(p) {
+		r.Stats.countDrop(DropNATExhausted)
+		r.Network.log().Warnf("[NAT] %s: 変換表が一杯のため %s からのパケットを破棄", r.Name, orig)
+		return false
+	}
+	r.Network.log().Debugf("[NAT] %s: 送信元 %s を %s:%d に変換", r.Name, orig, p.SrcIP, p.SrcPort)
+	return true
+}
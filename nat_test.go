@@ -0,0 +1,90 @@
+package main
+
+import (
+	"testing"
+)
+
+// newTestNATNetはAの10.0.0.0/24をルータの外側のアドレス203.0.113.254に変換するネットワークを作る。
+func newTestNATNet(t *testing.T) (*Network, *Host, *Host, *Router) {
+	n, a, b, r := newTestRoutedNet(t)
+	nat, err := NewNAT("203.0.113.254", "10.0.0.0/24")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.NAT = nat
+	return n, a, b, r
+}
+
+func TestNATTranslatesUDPAndReturnsReplies(t *testing.T) {
+	n, a, b, r := newTestNATNet(t)
+	b.OnReceive = func(p Packet) {
+		b.SendPacket(Packet{SrcIP: "203.0.113.1", DstIP: p.SrcIP, Protocol: ProtocolUDP, SrcPort: p.DstPort, DstPort: p.SrcPort, Data: []byte("pong")})
+	}
+	atB, atA := NewCollector(), NewCollector()
+	atB.Attach(b)
+	atA.Attach(a)
+	a.SendPacket(Packet{SrcIP: "10.0.0.1", DstIP: "203.0.113.1", Protocol: ProtocolUDP, SrcPort: 5000, DstPort: 53, Data: []byte("ping")})
+	runBus(t, n)
+
+	if atB.Len() != 1 {
+		t.Fatalf("Bに届いたパケット = %d, 期待値 1", atB.Len())
+	}
+	if got := atB.Received()[0]; got.SrcIP != "203.0.113.254" || got.SrcPort != DefaultNATPortStart {
+		t.Errorf("変換後の送信元 = %s:%d, 期待値 203.0.113.254:%d", got.SrcIP, got.SrcPort, DefaultNATPortStart)
+	}
+	if atA.Len() != 1 {
+		t.Fatalf("Aに届いた返信 = %d, 期待値 1", atA.Len())
+	}
+	if got := atA.Received()[0]; got.DstIP != "10.0.0.1" || got.DstPort != 5000 {
+		t.Errorf("戻した宛先 = %s:%d, 期待値 10.0.0.1:5000", got.DstIP, got.DstPort)
+	}
+	if r.NAT.Len() != 1 {
+		t.Errorf("変換表のエントリ = %d, 期待値 1", r.NAT.Len())
+	}
+}
+
+func TestNATPing(t *testing.T) {
+	n, a, _, r := newTestNATNet(t)
+	res, err := n.Ping(a, "203.0.113.1", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Received != 3 {
+		t.Errorf("NAT越しのpingの応答 = %d/%d, 期待値 3/3", res.Received, res.Sent)
+	}
+	if r.NAT.Len() != 1 {
+		t.Errorf("変換表のエントリ = %d, 期待値 1（同じpingの識別子は1つに対応付ける）", r.NAT.Len())
+	}
+}
+
+func TestNATInboundNormalizesExternalIP(t *testing.T) {
+	nat := &NAT{ExternalIP: "2001:db8::1"}
+	out := Packet{SrcIP: "fd00::5", SrcPort: 4000, Protocol: ProtocolUDP}
+	if !nat.outbound(&out) {
+		t.Fatal("outbound が失敗")
+	}
+	in := Packet{DstIP: "2001:DB8:0:0::1", DstPort: out.SrcPort, Protocol: ProtocolUDP}
+	if !nat.inbound(&in) {
+		t.Fatal("表記の異なる外部IP宛てのパケットを変換しない")
+	}
+	if in.DstIP != "fd00::5" || in.DstPort != 4000 {
+		t.Errorf("戻した宛先 = %s:%d, 期待値 fd00::5:4000", in.DstIP, in.DstPort)
+	}
+}
+
+func TestNATExhausted(t *testing.T) {
+	n, a, b, r := newTestNATNet(t)
+	r.NAT.MaxMappings = 1
+	got := NewCollector()
+	got.Attach(b)
+	a.SendPacket(Packet{SrcIP: "10.0.0.1", DstIP: "203.0.113.1", Protocol: ProtocolUDP, SrcPort: 1, DstPort: 9})
+	runBus(t, n)
+	a.SendPacket(Packet{SrcIP: "10.0.0.1", DstIP: "203.0.113.1", Protocol: ProtocolUDP, SrcPort: 2, DstPort: 9})
+	runBus(t, n)
+	if got.Len() != 1 {
+		t.Errorf("Bに届いたパケット = %d, 期待値 1", got.Len())
+	}
+	if r.Stats.Dropped[DropNATExhausted] != 1 {
+		t.Errorf("変換表が一杯による破棄 = %d, 期待値 1", r.Stats.Dropped[DropNATExhausted])
+	}
+}
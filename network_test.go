@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newNamedLANはprefixを付けた名前のホスト2台とスイッチからなるネットワークを作り、
+// 全てのログをbufへ書き出すようにする。送信側のホストと受信側のホストが受け取ったパケットの記録を返す。
+func newNamedLAN(prefix string, buf *bytes.Buffer) (*Network, *Host, *recordLayer) {
+	n := NewNetwork()
+	n.SetLogger(NewWriterLogger(buf, LevelDebug))
+	a := newTestHost(prefix+"-A", "AA:AA:AA:AA:AA:01", "10.0.0.1")
+	b := newTestHost(prefix+"-B", "AA:AA:AA:AA:AA:02", "10.0.0.2")
+	rec := &recordLayer{}
+	b.Layers = append(b.Layers, rec)
+	s := &Switch{Name: prefix + "-S"}
+	n.AddDevice(a)
+	n.AddDevice(b)
+	n.AddDevice(s)
+	n.AddBidirectionalLink(a, s, time.Millisecond)
+	n.AddBidirectionalLink(b, s, time.Millisecond)
+	return n, a, rec
+}
+
+func TestNetworksRunIndependently(t *testing.T) {
+	prefixes := []string{"left", "right"}
+	bufs := make([]bytes.Buffer, len(prefixes))
+	nets := make([]*Network, len(prefixes))
+	got := make([]*recordLayer, len(prefixes))
+	var wg sync.WaitGroup
+	for i, prefix := range prefixes {
+		n, a, rec := newNamedLAN(prefix, &bufs[i])
+		nets[i], got[i] = n, rec
+		wg.Add(1)
+		go func(count int) {
+			defer wg.Done()
+			for j := 0; j < count; j++ {
+				a.SendPacket(Packet{DstIP: "10.0.0.2", DstMAC: "AA:AA:AA:AA:AA:02", Data: []byte("hello")})
+			}
+			n.Bus.Run()
+		}(10 * (i + 1)) // 送る数を変えて、互いの配送が混ざらないことを確かめる
+	}
+	wg.Wait()
+	for i, prefix := range prefixes {
+		log := bufs[i].String()
+		if !strings.Contains(log, prefix+"-A がパケットを送信開始") {
+			t.Errorf("%s のログに自分のホストの送信がない", prefix)
+		}
+		for j, other := range prefixes {
+			if j != i && strings.Contains(log, other+"-") {
+				t.Errorf("%s のログに %s のデバイスのログが混ざっている", prefix, other)
+			}
+		}
+		if want := 10 * (i + 1); len(got[i].in) != want {
+			t.Errorf("%s: Bに届いたパケット = %d, 期待値 %d", prefix, len(got[i].in), want)
+		}
+		if at := nets[i].Bus.Now().Sub(SimulationEpoch); at != 2*time.Millisecond {
+			t.Errorf("%s: 終了時刻 = %v, 期待値 2ms", prefix, at)
+		}
+	}
+	if nets[0].Bus == nets[1].Bus {
+		t.Error("ネットワークがイベントバスを共有している")
+	}
+}
+
+func TestAddBidirectionalLink(t *testing.T) {
+	n := newTestNetwork(t)
+	a := newTestHost("A", "AA:AA:AA:AA:AA:01", "10.0.0.1")
+	s := &Switch{Name: "S"}
+	n.AddDevice(a)
+	n.AddDevice(s)
+	ab, ba := n.AddBidirectionalLink(a, s, 5*time.Millisecond)
+	if n.GetLink(a, s) != ab || n.GetLink(s, a) != ba {
+		t.Fatal("GetLinkで作成したリンクを引けない")
+	}
+	if ab.From != a || ab.To != s || ba.From != s || ba.To != a {
+		t.Errorf("リンクの向きが逆: %s->%s, %s->%s", ab.From.GetName(), ab.To.GetName(), ba.From.GetName(), ba.To.GetName())
+	}
+	if ab.Delay != 5*time.Millisecond || ba.Delay != 5*time.Millisecond {
+		t.Errorf("遅延 = %v, %v, 期待値 5ms", ab.Delay, ba.Delay)
+	}
+	if a.ConnectedDev != s {
+		t.Error("ホストの接続先が設定されていない")
+	}
+	if port := s.PortTo(a); port == nil || port.Link != ba {
+		t.Error("スイッチのポートにS->Aのリンクが登録されていない")
+	}
+	ab.Delay = 20 * time.Millisecond // 片方向だけ変更できる
+	if ba.Delay != 5*time.Millisecond {
+		t.Error("片方向の変更が逆方向に影響した")
+	}
+}
+
+func TestGetLinkIndex(t *testing.T) {
+	n := newTestNetwork(t)
+	a := newTestHost("A", "AA:AA:AA:AA:AA:01", "10.0.0.1")
+	b := newTestHost("B", "AA:AA:AA:AA:AA:02", "10.0.0.2")
+	n.AddDevice(a)
+	n.AddDevice(b)
+	first := n.AddLink(a, b, time.Millisecond)
+	n.AddLink(a, b, 2*time.Millisecond)
+	if n.GetLink(a, b) != first {
+		t.Fatal("同じ組のリンクは最初のものを返すこと")
+	}
+	if n.GetLink(b, a) != nil {
+		t.Error("逆向きのリンクを返した")
+	}
+}
+
+// newLargeTopologyはスイッチ1台にhosts台のホストを接続したネットワークを作る。
+func newLargeTopology(b *testing.B, hosts int) (*Network, []*Host, *Switch) {
+	n := newTestNetwork(b)
+	s := &Switch{Name: "S"}
+	n.AddDevice(s)
+	hs := make([]*Host, hosts)
+	for i := range hs {
+		hs[i] = &Host{Name: fmt.Sprintf("H%d", i)}
+		n.AddDevice(hs[i])
+		n.AddBidirectionalLink(hs[i], s, time.Millisecond)
+	}
+	return n, hs, s
+}
+
+func BenchmarkGetLink(b *testing.B) {
+	n, hosts, s := newLargeTopology(b, 5000)
+	b.Run("index", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if n.GetLink(s, hosts[i%len(hosts)]) == nil {
+				b.Fatal("リンクが見つからない")
+			}
+		}
+	})
+	b.Run("scan", func(b *testing.B) { // 索引を使う前の線形探索
+		for i := 0; i < b.N; i++ {
+			to := hosts[i%len(hosts)]
+			var found *Link
+			for _, l := range n.Links {
+				if l.From == s && l.To == to {
+					found = l
+					break
+				}
+			}
+			if found == nil {
+				b.Fatal("リンクが見つからない")
+			}
+		}
+	})
+}
+
+func TestGetLinkIndexAfterRemoval(t *testing.T) {
+	n := newTestNetwork(t)
+	a := newTestHost("A", "AA:AA:AA:AA:AA:01", "10.0.0.1")
+	b := newTestHost("B", "AA:AA:AA:AA:AA:02", "10.0.0.2")
+	n.AddDevice(a)
+	n.AddDevice(b)
+	n.AddLink(a, b, time.Millisecond)
+	second := n.AddLink(a, b, 2*time.Millisecond)
+	n.RemoveLink(a, b)
+	if n.GetLink(a, b) != second {
+		t.Fatal("削除した後に同じ組の残りのリンクを返さない")
+	}
+	n.RemoveLink(a, b)
+	if n.GetLink(a, b) != nil || len(n.Links) != 0 {
+		t.Error("全て削除した後にリンクが残っている")
+	}
+}
+
+func TestRemoveLinkDropsInFlight(t *testing.T) {
+	n, a, b, s := newTestLAN(t)
+	got := &recordLayer{}
+	b.Layers = append(b.Layers, got)
+	ab := n.GetLink(a, s)
+	a.SendPacket(Packet{DstIP: "10.0.0.2", DstMAC: "AA:AA:AA:AA:AA:02", Data: []byte("hello")})
+	n.Bus.AddEvent(500*time.Microsecond, func() { n.RemoveLink(a, s) }) // 1msの伝送の途中で削除
+	n.Bus.Run()
+	if len(got.in) != 0 {
+		t.Errorf("削除したリンクのパケットが届いた: %v", got.in)
+	}
+	if n.GetLink(a, s) != nil {
+		t.Error("削除したリンクがGetLinkで見つかる")
+	}
+	ab.Transmit(Packet{DstIP: "10.0.0.2", DstMAC: "AA:AA:AA:AA:AA:02", Data: []byte("again")})
+	n.Bus.Run()
+	if len(got.in) != 0 {
+		t.Errorf("削除したリンクへ送ったパケットが届いた: %v", got.in)
+	}
+}
+
+func TestRemoveDevice(t *testing.T) {
+	n, a, b, s := newTestLAN(t)
+	a.SendPacket(Packet{DstIP: "10.0.0.2", DstMAC: "AA:AA:AA:AA:AA:02", Data: []byte("learn")})
+	b.SendPacket(Packet{DstIP: "10.0.0.1", DstMAC: "AA:AA:AA:AA:AA:01", Data: []byte("learn")})
+	n.Bus.Run()
+	n.RemoveDevice(b)
+	for _, d := range n.Devices {
+		if d == b {
+			t.Error("削除したデバイスが残っている")
+		}
+	}
+	for _, l := range n.Links {
+		if l.From == b || l.To == b {
+			t.Errorf("削除したデバイスのリンク %s -> %s が残っている", l.From.GetName(), l.To.GetName())
+		}
+	}
+	if len(n.Links) != 2 {
+		t.Errorf("残りのリンク = %d, 期待値 2", len(n.Links))
+	}
+	if s.PortTo(b) != nil || len(s.Ports) != 1 {
+		t.Error("スイッチに削除したデバイスへのポートが残っている")
+	}
+	if _, ok := s.MACTable["AA:AA:AA:AA:AA:02"]; ok {
+		t.Error("スイッチが削除したデバイスのMACアドレスを覚えている")
+	}
+	a.SendPacket(Packet{DstIP: "10.0.0.2", DstMAC: "AA:AA:AA:AA:AA:02", Data: []byte("gone")})
+	n.Bus.Run()
+}
+
+func TestSendByIP(t *testing.T) {
+	n, a, b, s := newTestLAN(t)
+	got := record(b)
+	if err := n.SendByIP(a, "10.0.0.2", []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	n.Bus.Run()
+	if len(got.in) != 1 {
+		t.Fatalf("届いたパケット = %d, 期待値 1", len(got.in))
+	}
+	if p := got.in[0]; p.SrcIP != "10.0.0.1" || p.SrcMAC != "AA:AA:AA:AA:AA:01" || string(p.Data) != "hello" {
+		t.Errorf("届いたパケット = %v", p)
+	}
+
+	// 接続先が未設定でも、ホストから出るリンクの宛先を最初のホップにする
+	a.ConnectedDev = nil
+	if err := n.SendByIP(a, "10.0.0.2", []byte("again")); err != nil {
+		t.Fatal(err)
+	}
+	n.Bus.Run()
+	if a.ConnectedDev != s || len(got.in) != 2 {
+		t.Errorf("接続先 = %v, 届いたパケット = %d", a.ConnectedDev, len(got.in))
+	}
+}
+
+func TestSendByIPErrors(t *testing.T) {
+	n, a, _, _ := newTestLAN(t)
+	other := newTestNetwork(t)
+	lonely := newTestHost("L", "AA:AA:AA:AA:AA:09", "10.0.0.9")
+	n.AddDevice(lonely)
+	tests := []struct {
+		name string
+		net  *Network
+		src  *Host
+		dst  string
+	}{
+		{"別のネットワークのホスト", other, a, "10.0.0.2"},
+		{"不正な宛先IP", n, a, "10.0.0.300"},
+		{"リンクのないホスト", n, lonely, "10.0.0.2"},
+	}
+	for _, tt := range tests {
+		if err := tt.net.SendByIP(tt.src, tt.dst, nil); err == nil {
+			t.Errorf("%s: エラーにならない", tt.name)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"net"
+)
+
+// NICはホストのネットワークインターフェースを表す。ホストのLayersにある層とConnectedDevが
+// 1つ目のインターフェースとなり、AddNICで追加したNICは2つ目以降として別のサブネットに接続する。
+type NIC struct {
+	DataLink     *DataLinkLayer // このインターフェースのMAC層
+	Network      *NetworkLayer  // このインターフェースのIP層
+	ConnectedDev Device         // このインターフェースの接続先デバイス
+	Name         string         // インターフェースの名前（1つ目が「eth0」、AddNICで追加した順に「eth1」以降）
+	InLimit      *TokenBucket   // このインターフェースで受信するパケットに適用するレートの制限（nilなら制限しない）
+	OutLimit     *TokenBucket   // このインターフェースから送出するパケットに適用するレートの制限（nilなら制限しない）
+}
+
+// AddNICはIPアドレス、サブネットマスク、MACアドレスを持つインターフェースをホストに追加し、
+// connectedに接続する。connectedへのリンクは別途AddLinkなどで作成する。
+func (h *Host) AddNIC(ip, mask, mac string, connected Device) *NIC {
+	nic := &NIC{
+		Name:         portName("", len(h.NICs)+1),
+		DataLink:     &DataLinkLayer{Name: "DataLink", MAC: mac},
+		Network:      &NetworkLayer{Name: "Network", IP: ip, SubnetMask: mask},
+		ConnectedDev: connected,
+	}
+	if h.Network != nil {
+		nic.DataLink.bindHost(h)
+		nic.Network.bindHost(h)
+	}
+	h.NICs = append(h.NICs, nic)
+	return nic
+}
+
+// onLinkは宛先IPが自分のサブネット内にあるかを返す（サブネットマスクが空なら常にtrue）。
+func (nl *NetworkLayer) onLink(dst string) bool {
+	if nl.SubnetMask == "" {
+		return true
+	}
+	mask := nl.mask()
+	ip, dstIP := net.ParseIP(nl.IP), net.ParseIP(dst)
+	if mask == nil || ip == nil || dstIP == nil {
+		return true
+	}
+	return ip.Mask(mask).Equal(dstIP.Mask(mask))
+}
+
+// nicsはLayersの層とホストのレートの制限から作る1つ目のインターフェースと、追加したインターフェースを順に返す。
+func (h *Host) nics() []*NIC {
+	primary := &NIC{DataLink: h.dataLinkLayer(), Network: h.networkLayer(), ConnectedDev: h.ConnectedDev, Name: portName("", 0), InLimit: h.InLimit, OutLimit: h.OutLimit}
+	return append([]*NIC{primary}, h.NICs...)
+}
+
+// nicForは宛先IPへの送信に使うインターフェースを選ぶ。
+// 宛先をサブネットに含むインターフェース、ゲートウェイを持つインターフェース、1つ目の順に優先する。
+func (h *Host) nicFor(dst string) *NIC {
+	nics := h.nics()
+	if len(nics) == 1 {
+		return nics[0]
+	}
+	for _, nic := range nics {
+		if nic.Network != nil && nic.Network.SubnetMask != "" && nic.Network.onLink(dst) {
+			return nic
+		}
+	}
+	for _, nic := range nics {
+		if nic.Network != nil && nic.Network.Gateway != "" {
+			return nic
+		}
+	}
+	return nics[0]
+}
+
+// nicWithIPはIPアドレスを持つインターフェースを返す（見つからなければ1つ目）。
+func (h *Host) nicWithIP(ip string) *NIC {
+	nics := h.nics()
+	for _, nic := range nics[1:] {
+		if nic.Network != nil && sameIP(nic.Network.IP, ip) {
+			return nic
+		}
+	}
+	return nics[0]
+}
+
+// nicReceivingは受信パケットを処理するインターフェースを、宛先MACか宛先IPで選ぶ（見つからなければ1つ目）。
+func (h *Host) nicReceiving(p Packet) *NIC {
+	nics := h.nics()
+	for _, nic := range nics[1:] {
+		if (nic.DataLink != nil && nic.DataLink.MAC == p.DstMAC) || (nic.Network != nil && sameIP(nic.Network.IP, p.DstIP)) {
+			return nic
+		}
+	}
+	return nics[0]
+}
+
+// stackはインターフェースで送受信するときのレイヤースタックを返す。
+// 追加したインターフェースでは、Layersのネットワーク層とデータリンク層をそのインターフェースの層に置き換える。
+func (h *Host) stack(nic *NIC) []Layer {
+	if nic.Network == h.networkLayer() && nic.DataLink == h.dataLinkLayer() {
+		return h.Layers
+	}
+	layers := make([]Layer, len(h.Layers))
+	for i, layer := range h.Layers {
+		switch layer.(type) {
+		case *NetworkLayer:
+			layers[i] = nic.Network
+		case *DataLinkLayer:
+			layers[i] = nic.DataLink
+		default:
+			layers[i] = layer
+		}
+	}
+	return layers
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// newTestMultihomedはホストH（eth0が10.0.0.1/24、eth1が192.168.1.1/24）に、
+// eth0側のホストA（10.0.0.2）とeth1側のホストB（192.168.1.2）を1msのリンクで直結したネットワークを作る。
+func newTestMultihomed(t *testing.T) (*Network, *Host, *Host, *Host) {
+	n := newTestNetwork(t)
+	h := newTestHost("H", "AA:AA:AA:AA:AA:01", "10.0.0.1")
+	h.networkLayer().SubnetMask = "255.255.255.0"
+	a := newTestHost("A", "AA:AA:AA:AA:AA:02", "10.0.0.2")
+	b := newTestHost("B", "BB:BB:BB:BB:BB:02", "192.168.1.2")
+	n.AddDevice(h)
+	n.AddDevice(a)
+	n.AddDevice(b)
+	n.AddBidirectionalLink(h, a, time.Millisecond)
+	h.AddNIC("192.168.1.1", "255.255.255.0", "BB:BB:BB:BB:BB:01", b)
+	n.AddBidirectionalLink(h, b, time.Millisecond)
+	return n, h, a, b
+}
+
+func TestHostAddNICChoosesInterfaceBySubnet(t *testing.T) {
+	n, h, a, b := newTestMultihomed(t)
+	gotA, gotB := record(a), record(b)
+	h.Send("192.168.1.2", []byte("to b"))
+	h.Send("10.0.0.2", []byte("to a"))
+	runBus(t, n)
+
+	if len(gotB.in) != 1 || string(gotB.in[0].Data) != "to b" {
+		t.Fatalf("Bに届いたパケット = %v, 期待値 to b の1つ", gotB.in)
+	}
+	if p := gotB.in[0]; p.SrcIP != "192.168.1.1" || p.SrcMAC != "BB:BB:BB:BB:BB:01" {
+		t.Errorf("Bに届いたパケットの送信元 = %s/%s, 期待値 eth1の192.168.1.1/BB:BB:BB:BB:BB:01", p.SrcIP, p.SrcMAC)
+	}
+	if len(gotA.in) != 1 || string(gotA.in[0].Data) != "to a" {
+		t.Fatalf("Aに届いたパケット = %v, 期待値 to a の1つ", gotA.in)
+	}
+	if p := gotA.in[0]; p.SrcIP != "10.0.0.1" || p.SrcMAC != "AA:AA:AA:AA:AA:01" {
+		t.Errorf("Aに届いたパケットの送信元 = %s/%s, 期待値 eth0の10.0.0.1/AA:AA:AA:AA:AA:01", p.SrcIP, p.SrcMAC)
+	}
+
+	// ARPはそれぞれのサブネットのインターフェースで解決し、もう一方のインターフェースには載らない
+	eth0, eth1 := h.networkLayer(), h.NICs[0].Network
+	if mac := eth1.ARPTable["192.168.1.2"]; mac != "BB:BB:BB:BB:BB:02" {
+		t.Errorf("eth1のARPテーブルのB = %q, 期待値 BB:BB:BB:BB:BB:02", mac)
+	}
+	if _, ok := eth0.ARPTable["192.168.1.2"]; ok {
+		t.Error("eth0でBのアドレスを解決した")
+	}
+	if mac := eth0.ARPTable["10.0.0.2"]; mac != "AA:AA:AA:AA:AA:02" {
+		t.Errorf("eth0のARPテーブルのA = %q, 期待値 AA:AA:AA:AA:AA:02", mac)
+	}
+	if _, ok := eth1.ARPTable["10.0.0.2"]; ok {
+		t.Error("eth1でAのアドレスを解決した")
+	}
+	// AにはHのeth0のGratuitous ARP、自分宛てのARP要求とデータだけが届き、Bの解決のARP要求はeth0から出ない
+	if got := a.Stats.Received; got != 3 {
+		t.Errorf("Aが受信したパケット = %d, 期待値 3（Gratuitous ARP、ARP要求とデータ）", got)
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProtocolSurvivesLayerStack(t *testing.T) {
+	tests := []struct {
+		proto Protocol
+		want  Protocol
+	}{
+		{"", ProtocolRaw},
+		{ProtocolRaw, ProtocolRaw},
+		{ProtocolTCP, ProtocolTCP},
+		{ProtocolUDP, ProtocolUDP},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.want), func(t *testing.T) {
+			n, a, b, _ := newTestLAN(t)
+			var buf bytes.Buffer
+			n.SetLogger(NewWriterLogger(&buf, LevelDebug))
+			got := &recordLayer{}
+			b.Layers = append(b.Layers, got)
+			a.SendPacket(Packet{DstIP: "10.0.0.2", DstMAC: "AA:AA:AA:AA:AA:02", Protocol: tt.proto, Data: []byte("data")})
+			n.Bus.Run()
+			if len(got.in) != 1 {
+				t.Fatalf("届いたパケット = %d, 期待値 1", len(got.in))
+			}
+			if pr := got.in[0].Protocol; pr != tt.want {
+				t.Errorf("届いたパケットのプロトコル = %q, 期待値 %q", pr, tt.want)
+			}
+			for _, want := range []string{"[IP] 10.0.0.1: " + string(tt.want) + "パケット送信中", "[MAC] DataLink: 自分宛の" + string(tt.want) + "パケットを受信"} {
+				if !strings.Contains(buf.String(), want) {
+					t.Errorf("ログに %q がない", want)
+				}
+			}
+		})
+	}
+}
+
+func TestPacketProtoDefault(t *testing.T) {
+	if got := (Packet{}).Proto(); got != ProtocolRaw {
+		t.Errorf("未設定のプロトコル = %q, 期待値 %q", got, ProtocolRaw)
+	}
+	if got := (Packet{Protocol: ProtocolICMP}).Proto(); got != ProtocolICMP {
+		t.Errorf("Proto = %q, 期待値 %q", got, ProtocolICMP)
+	}
+}
+
+func TestPacketString(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"ASCII", []byte("hi"), `From 10.0.0.1 (AA) to 10.0.0.2 (BB): 2 bytes "hi"`},
+		{"バイナリ", []byte{0x00, 0xff, 0x10}, "From 10.0.0.1 (AA) to 10.0.0.2 (BB): 3 bytes 00ff10"},
+		{"空", nil, `From 10.0.0.1 (AA) to 10.0.0.2 (BB): 0 bytes ""`},
+		{"長いデータ", bytes.Repeat([]byte("a"), 40), `From 10.0.0.1 (AA) to 10.0.0.2 (BB): 40 bytes "` + strings.Repeat("a", 32) + `"...`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := Packet{SrcIP: "10.0.0.1", DstIP: "10.0.0.2", SrcMAC: "AA", DstMAC: "BB", Data: tt.data}
+			if got := p.String(); got != tt.want {
+				t.Errorf("String() = %q, 期待値 %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBinaryPayloadRoundTrip(t *testing.T) {
+	n, a, b, _ := newTestLAN(t)
+	got := record(b)
+	data := make([]byte, 256)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	a.SendPacket(Packet{DstIP: "10.0.0.2", Data: data})
+	n.Bus.Run()
+	if len(got.in) != 1 {
+		t.Fatalf("届いたパケット = %d, 期待値 1", len(got.in))
+	}
+	if recv := got.in[0].Data; !bytes.Equal(recv, data) {
+		t.Errorf("届いたデータが壊れている: % x", recv)
+	}
+}
+
+func TestNewPacket(t *testing.T) {
+	p := NewPacket("10.0.0.1", "10.0.0.2", "こんにちは")
+	if len(p.Data) != len("こんにちは") || string(p.Data) != "こんにちは" {
+		t.Errorf("NewPacketのデータ = %q", p.Data)
+	}
+}
+
+func TestPacketCloneDeepCopies(t *testing.T) {
+	orig := Packet{
+		Data: []byte("hello"),
+		ARP:  &ARPMessage{Op: ARPRequest, SenderIP: "10.0.0.1"},
+		ICMP: &ICMPMessage{Type: ICMPEchoRequest, Seq: 1},
+	}
+	c := orig.Clone()
+	c.Data[0] = 'J'
+	c.ARP.SenderIP = "10.0.0.9"
+	c.ICMP.Seq = 2
+	if string(orig.Data) != "hello" || orig.ARP.SenderIP != "10.0.0.1" || orig.ICMP.Seq != 1 {
+		t.Errorf("複製を変更したら元のパケットも変わった: %+v", orig)
+	}
+}
+
+// tapLayerは受信パケットをそのままfnに渡すだけの層。
+type tapLayer struct{ fn func(p Packet) }
+
+func (l tapLayer) HandleOutgoing(p Packet) Packet { return p }
+func (l tapLayer) HandleIncoming(p Packet) (Packet, bool) {
+	l.fn(p)
+	return p, true
+}
+func (l tapLayer) GetName() string { return "Tap" }
+
+func TestFloodedPacketsDoNotAlias(t *testing.T) {
+	n, a, b, c, _ := newTestLAN3(t)
+	// Bの最下層が受信データを書き換え、Cの最下層が受信データを記録する
+	b.Layers = append([]Layer{tapLayer{func(p Packet) { p.Data[0] = 'X' }}}, b.Layers...)
+	var atC []byte
+	c.Layers = append([]Layer{tapLayer{func(p Packet) { atC = p.Data }}}, c.Layers...)
+	broadcast(a)
+	n.Bus.Run()
+	if string(atC) != "hello" {
+		t.Errorf("Cが受信したデータ = %q, 期待値 \"hello\"（Bの変更が見えている）", atC)
+	}
+}
+
+func TestHeaderChecksum(t *testing.T) {
+	p := Packet{SrcIP: "10.0.0.1", DstIP: "10.0.0.2", Protocol: ProtocolUDP}
+	// 0a00 0001 0a00 0002 0011 の1の補数和 0x1414 の補数
+	if sum := headerChecksum(p); sum != 0xebeb {
+		t.Errorf("headerChecksum = 0x%04x, 期待値 0xebeb", sum)
+	}
+	p.DstIP = "10.0.0.3"
+	if sum := headerChecksum(p); sum == 0xebeb {
+		t.Error("宛先IPを変えてもチェックサムが変わらない")
+	}
+}
+
+func TestNetworkLayerVerifiesHeaderChecksum(t *testing.T) {
+	n, a, b, _ := newTestLAN(t)
+	got := record(b)
+	a.Send("10.0.0.2", []byte("hello"))
+	runBus(t, n)
+	if len(got.in) != 1 {
+		t.Fatalf("届いたパケット = %d, 期待値 1", len(got.in))
+	}
+	sent := got.in[0]
+	if sent.HeaderChecksum == 0 || sent.HeaderChecksum != headerChecksum(sent) {
+		t.Errorf("送信したパケットのチェックサム = 0x%04x, 期待値 0x%04x", sent.HeaderChecksum, headerChecksum(sent))
+	}
+
+	tampered := sent.Clone()
+	tampered.SrcIP = "10.0.0.9" // 伝送中に送信元アドレスが壊れた
+	b.ReceivePacket(tampered)
+	if len(got.in) != 1 || b.Stats.Dropped[DropChecksum] != 1 {
+		t.Errorf("壊れたヘッダのパケット: 届いた数 %d, %s %d, 期待値 1, 1", len(got.in), DropChecksum, b.Stats.Dropped[DropChecksum])
+	}
+
+	unchecked := tampered.Clone()
+	unchecked.HeaderChecksum = 0 // 未計算なら検証しない
+	b.ReceivePacket(unchecked)
+	if len(got.in) != 2 {
+		t.Errorf("チェックサムが未計算のパケットが届かない: %d", len(got.in))
+	}
+}
+
+func TestPacketMetaSurvivesMultiHopPath(t *testing.T) {
+	// A - S - R - B：スイッチとルータを経由して届ける。A->Sは帯域が狭くパケットはキューで待ち、
+	// ルータはBのMACを解決するまでパケットを保留する
+	n := newTestNetwork(t)
+	a := newTestHost("A", "AA:AA:AA:AA:AA:01", "10.0.0.1")
+	b := newTestHost("B", "AA:AA:AA:AA:AA:02", "203.0.113.1")
+	a.networkLayer().SubnetMask, a.networkLayer().Gateway = "255.255.255.0", "10.0.0.254"
+	b.networkLayer().SubnetMask, b.networkLayer().Gateway = "255.255.255.0", "203.0.113.254"
+	s, r := &Switch{Name: "S"}, &Router{Name: "R"}
+	for _, d := range []Device{a, b, s, r} {
+		n.AddDevice(d)
+	}
+	n.AddBidirectionalLink(a, s, time.Millisecond)
+	rs, _ := n.AddBidirectionalLink(r, s, time.Millisecond)
+	rb, _ := n.AddBidirectionalLink(r, b, time.Millisecond)
+	if _, err := r.AddInterface("10.0.0.254/24", "RR:RR:RR:RR:RR:01", rs); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.AddInterface("203.0.113.254/24", "RR:RR:RR:RR:RR:02", rb); err != nil {
+		t.Fatal(err)
+	}
+	as := n.GetLink(a, s)
+	as.Bandwidth, as.QueueSize = 8000, 4 // 1000バイト/秒：どちらのパケットもキューで送出を待つ
+
+	var got []Packet
+	b.OnReceive = func(p Packet) { got = append(got, p) }
+	if err := a.SendPacket(Packet{DstIP: "203.0.113.1", DstMAC: "RR:RR:RR:RR:RR:01", Data: []byte("first")}); err != nil {
+		t.Fatalf("SendPacket: %v", err)
+	}
+	p := Packet{DstIP: "203.0.113.1", DstMAC: "RR:RR:RR:RR:RR:01", Data: []byte("tagged")}
+	p.SetMeta("flow", "video")
+	p.SetMeta("priority", 3)
+	if err := a.SendPacket(p); err != nil {
+		t.Fatalf("SendPacket: %v", err)
+	}
+	if q := as.queueLen(); q != 2 {
+		t.Fatalf("A->Sのキュー長 = %d, 期待値 2", q)
+	}
+	// 送信した後に送信元が書き換えてもキューやARP解決待ちのパケットは変わらない
+	p.Meta["flow"] = "changed"
+	copy(p.Data, "XXXXXX")
+	runBus(t, n)
+
+	if len(got) != 2 {
+		t.Fatalf("Bに届いたパケット = %d, 期待値 2", len(got))
+	}
+	tagged := got[1]
+	if string(tagged.Data) != "tagged" {
+		t.Errorf("Bに届いたデータ = %q, 期待値 %q", tagged.Data, "tagged")
+	}
+	if tagged.Meta["flow"] != "video" || tagged.Meta["priority"] != 3 || len(tagged.Meta) != 2 {
+		t.Errorf("Bに届いたMeta = %v, 期待値 map[flow:video priority:3]", tagged.Meta)
+	}
+	if tagged.SrcMAC != "RR:RR:RR:RR:RR:02" || tagged.TTL != DefaultTTL-1 {
+		t.Errorf("ルータを経由していない: %v (TTL %d)", tagged, tagged.TTL)
+	}
+	if got[0].Meta != nil {
+		t.Errorf("Metaを設定していないパケットのMeta = %v, 期待値 nil", got[0].Meta)
+	}
+}
+
+func TestPacketLatencyOverMultiHopPath(t *testing.T) {
+	n, a, b, r1, r2 := newTestTwoRouterNet(t)
+	n.GetLink(a, r1).Delay = 2 * time.Millisecond
+	n.GetLink(r1, r2).Delay = 3 * time.Millisecond
+	n.GetLink(r2, b).Delay = 5 * time.Millisecond
+	var got []Packet
+	b.OnReceive = func(p Packet) { got = append(got, p) }
+	a.Send("203.0.113.1", []byte("warmup")) // 経路上のARPを解決しておく
+	runBus(t, n)
+	a.Send("203.0.113.1", []byte("measured"))
+	runBus(t, n)
+
+	if len(got) != 2 {
+		t.Fatalf("Bに届いたパケット = %d, 期待値 2", len(got))
+	}
+	p := got[1]
+	if want := 10 * time.Millisecond; p.Latency() != want {
+		t.Errorf("Latency() = %v, 期待値 %v（各リンクの遅延の合計）", p.Latency(), want)
+	}
+	c := p.Clone()
+	if !c.SentAt.Equal(p.SentAt) || !c.ReceivedAt.Equal(p.ReceivedAt) || c.Latency() != p.Latency() {
+		t.Errorf("複製の時刻 = %v / %v, 期待値 %v / %v", c.SentAt, c.ReceivedAt, p.SentAt, p.ReceivedAt)
+	}
+	if (Packet{}).Latency() != 0 {
+		t.Errorf("時刻のないパケットのLatency() = %v, 期待値 0", (Packet{}).Latency())
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// PayloadCodecはアプリケーションの値とパケットのデータを相互に変換する符号化方式を表す。
+type PayloadCodec interface {
+	Name() string                       // パケットに記録する符号化方式の名前
+	Marshal(v any) ([]byte, error)      // 値をデータに符号化
+	Unmarshal(data []byte, v any) error // データを値（ポインタ）に復号
+}
+
+// JSONCodecはencoding/jsonで値を符号化する既定の符号化方式。
+type JSONCodec struct{}
+
+func (JSONCodec) Name() string                       { return "json" }
+func (JSONCodec) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (JSONCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+
+// DefaultCodecはSetPayloadとSendPayloadが使う符号化方式。
+var DefaultCodec PayloadCodec = JSONCodec{}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]PayloadCodec{"json": JSONCodec{}} // 名前で引ける符号化方式
+)
+
+// RegisterCodecはDecodePayloadで使えるよう符号化方式を登録する。同じ名前の方式は置き換える。
+func RegisterCodec(c PayloadCodec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[c.Name()] = c
+}
+
+// lookupCodecは名前で登録済みの符号化方式を返す（なければnil）。
+func lookupCodec(name string) PayloadCodec {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	return codecs[name]
+}
+
+// payloadTypeNameは値の型をパケットに記録する名前にする（ポインタは指す先の型の名前）。
+func payloadTypeName(t reflect.Type) string {
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil {
+		return ""
+	}
+	return t.String()
+}
+
+// SetPayloadはvをDefaultCodecで符号化してデータにし、型と符号化方式の名前をパケットに記録する。
+func (p *Packet) SetPayload(v any) error {
+	return p.SetPayloadWith(DefaultCodec, v)
+}
+
+// SetPayloadWithはvをcで符号化してデータにし、型と符号化方式の名前をパケットに記録する。
+// 受信側でDecodePayloadを使うには、cをRegisterCodecで登録しておく（JSONCodecは登録済み）。
+func (p *Packet) SetPayloadWith(c PayloadCodec, v any) error {
+	data, err := c.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("ペイロードを %s で符号化できません: %w", c.Name(), err)
+	}
+	p.Data, p.PayloadType, p.PayloadCodec = data, payloadTypeName(reflect.TypeOf(v)), c.Name()
+	return nil
+}
+
+// DecodePayloadはSetPayloadで符号化したデータを、記録された符号化方式でvの指す先に復号する。
+// パケットが構造化されたペイロードを運んでいない、符号化方式が登録されていない、
+// 記録された型とvの型が異なる場合はエラーを返す。
+func (p Packet) DecodePayload(v any) error {
+	if p.PayloadCodec == "" {
+		return fmt.Errorf("パケットは構造化されたペイロードを運んでいません")
+	}
+	c := lookupCodec(p.PayloadCodec)
+	if c == nil {
+		return fmt.Errorf("符号化方式 %q が登録されていません", p.PayloadCodec)
+	}
+	t := reflect.TypeOf(v)
+	if t == nil || t.Kind() != reflect.Pointer || reflect.ValueOf(v).IsNil() {
+		return fmt.Errorf("復号先には nil でないポインタを渡してください")
+	}
+	if got := payloadTypeName(t); got != p.PayloadType {
+		return fmt.Errorf("ペイロードの型 %s を %s に復号できません", p.PayloadType, got)
+	}
+	if err := c.Unmarshal(p.Data, v); err != nil {
+		return fmt.Errorf("ペイロードを %s で復号できません: %w", c.Name(), err)
+	}
+	return nil
+}
+
+// SendPayloadはvをDefaultCodecで符号化し、IPアドレスdstへ送信する。
+// 受信側のOnReceiveではDecodePayloadで元の型の値に戻せる。
+// 操作の記録には符号化したデータだけを残すため、ReplayLogで再生したパケットは型の情報を持たない。
+func (h *Host) SendPayload(dst string, v any) error {
+	var p Packet
+	if err := p.SetPayload(v); err != nil {
+		return err
+	}
+	return h.sendTo(dst, p)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type testReading struct {
+	Sensor string
+	Value  float64
+	Tags   []string
+}
+
+// upperCodecはテスト用の符号化方式で、文字列を大文字にしてそのまま運ぶ。
+type upperCodec struct{}
+
+func (upperCodec) Name() string { return "upper" }
+func (upperCodec) Marshal(v any) ([]byte, error) {
+	s, ok := v.(string)
+	if !ok {
+		return nil, fmt.Errorf("文字列ではありません: %T", v)
+	}
+	return []byte(strings.ToUpper(s)), nil
+}
+func (upperCodec) Unmarshal(data []byte, v any) error {
+	*v.(*string) = string(data)
+	return nil
+}
+
+func TestSendPayloadRoundTrip(t *testing.T) {
+	n, a, b, _ := newTestLAN(t)
+	sent := testReading{Sensor: "temp", Value: 21.5, Tags: []string{"room1", "floor2"}}
+	var got testReading
+	var recvErr error
+	b.OnReceive = func(p Packet) {
+		if p.PayloadType != "main.testReading" || p.PayloadCodec != "json" {
+			t.Errorf("ペイロードの型 = %q, 符号化方式 = %q", p.PayloadType, p.PayloadCodec)
+		}
+		recvErr = p.DecodePayload(&got)
+	}
+	if err := a.SendPayload("10.0.0.2", sent); err != nil {
+		t.Fatalf("SendPayload: %v", err)
+	}
+	n.Bus.Run()
+	if recvErr != nil {
+		t.Fatalf("DecodePayload: %v", recvErr)
+	}
+	if got.Sensor != sent.Sensor || got.Value != sent.Value || strings.Join(got.Tags, ",") != "room1,floor2" {
+		t.Errorf("復号した値 = %+v, 期待値 %+v", got, sent)
+	}
+}
+
+func TestPayloadCustomCodec(t *testing.T) {
+	RegisterCodec(upperCodec{})
+	var p Packet
+	if err := p.SetPayloadWith(upperCodec{}, "hello"); err != nil {
+		t.Fatalf("SetPayloadWith: %v", err)
+	}
+	if string(p.Data) != "HELLO" || p.PayloadType != "string" || p.PayloadCodec != "upper" {
+		t.Fatalf("パケット = %q %q %q", p.Data, p.PayloadType, p.PayloadCodec)
+	}
+	var s string
+	if err := p.DecodePayload(&s); err != nil || s != "HELLO" {
+		t.Errorf("DecodePayload = %q, %v", s, err)
+	}
+	if err := p.SetPayloadWith(upperCodec{}, 42); err == nil {
+		t.Error("符号化できない値でエラーになりません")
+	}
+}
+
+func TestDecodePayloadErrors(t *testing.T) {
+	var valid Packet
+	if err := valid.SetPayload(testReading{Sensor: "temp"}); err != nil {
+		t.Fatalf("SetPayload: %v", err)
+	}
+	var r testReading
+	var s string
+	tests := []struct {
+		name string
+		p    Packet
+		v    any
+		want string
+	}{
+		{"構造化されていない", Packet{Data: []byte("raw")}, &r, "構造化されたペイロードを運んでいません"},
+		{"未登録の符号化方式", Packet{Data: valid.Data, PayloadType: valid.PayloadType, PayloadCodec: "gob"}, &r, "登録されていません"},
+		{"ポインタでない", valid, r, "nil でないポインタ"},
+		{"nilポインタ", valid, (*testReading)(nil), "nil でないポインタ"},
+		{"型が異なる", valid, &s, "に復号できません"},
+		{"壊れたデータ", Packet{Data: []byte(`{"Sensor":`), PayloadType: valid.PayloadType, PayloadCodec: "json"}, &r, "json で復号できません"},
+		{"データの型が合わない", Packet{Data: []byte(`{"Value":"hot"}`), PayloadType: valid.PayloadType, PayloadCodec: "json"}, &r, "json で復号できません"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.p.DecodePayload(tt.v)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("DecodePayload = %v, 期待値 %q を含むエラー", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetPayloadMarshalError(t *testing.T) {
+	var p Packet
+	if err := p.SetPayload(make(chan int)); err == nil {
+		t.Error("符号化できない値でエラーになりません")
+	}
+	if p.PayloadCodec != "" || p.Data != nil {
+		t.Errorf("失敗してもパケットが変更されています: %+v", p)
+	}
+}
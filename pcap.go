@@ -0,0 +1,304 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+const (
+	pcapMagic        = 0xa1b2c3d4 // マイクロ秒精度のlibpcapファイルを示すマジックナンバー
+	pcapVersionMajor = 2
+	pcapVersionMinor = 4
+	pcapSnapLen      = 65535
+	pcapLinkEthernet = 1 // LINKTYPE_ETHERNET
+
+	etherTypeIPv4 = 0x0800
+	etherTypeARP  = 0x0806
+	etherTypeIPv6 = 0x86DD
+
+	ipProtoICMP         = 1
+	ipProtoTCP          = 6
+	ipProtoUDP          = 17
+	ipProtoICMPv6       = 58
+	ipProtoExperimental = 253 // 任意のペイロード用（RFC 3692の実験用番号）
+
+	tcpFlagSYN = 0x02
+	tcpFlagACK = 0x10
+)
+
+// PcapWriterは送信されたパケットをlibpcap形式で書き出す。
+type PcapWriter struct {
+	w io.Writer // 書き込み先
+}
+
+// NewPcapWriterはpcapのグローバルヘッダを書き込み、PcapWriterを作成。
+func NewPcapWriter(w io.Writer) (*PcapWriter, error) {
+	hdr := make([]byte, 24)
+	binary.LittleEndian.PutUint32(hdr[0:4], pcapMagic)
+	binary.LittleEndian.PutUint16(hdr[4:6], pcapVersionMajor)
+	binary.LittleEndian.PutUint16(hdr[6:8], pcapVersionMinor)
+	// hdr[8:16]はタイムゾーン補正と精度で、常に0
+	binary.LittleEndian.PutUint32(hdr[16:20], pcapSnapLen)
+	binary.LittleEndian.PutUint32(hdr[20:24], pcapLinkEthernet)
+	if _, err := w.Write(hdr); err != nil {
+		return nil, fmt.Errorf("pcapヘッダの書き込みに失敗: %w", err)
+	}
+	return &PcapWriter{w: w}, nil
+}
+
+// WritePacketはパケットからEthernetフレームを組み立て、時刻tのレコードとして書き込む。
+func (pw *PcapWriter) WritePacket(t time.Time, p Packet) error {
+	frame := ethernetFrame(p)
+	rec := make([]byte, 16, 16+len(frame))
+	binary.LittleEndian.PutUint32(rec[0:4], uint32(t.Unix()))
+	binary.LittleEndian.PutUint32(rec[4:8], uint32(t.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(rec[8:12], uint32(len(frame)))
+	binary.LittleEndian.PutUint32(rec[12:16], uint32(len(frame)))
+	if _, err := pw.w.Write(append(rec, frame...)); err != nil {
+		return fmt.Errorf("pcapレコードの書き込みに失敗: %w", err)
+	}
+	return nil
+}
+
+// EnableCaptureはネットワーク内のリンクで送信されるパケットをwへpcap形式で記録する。
+func (n *Network) EnableCapture(w io.Writer) error {
+	pw, err := NewPcapWriter(w)
+	if err != nil {
+		return err
+	}
+	n.Capture = pw
+	return nil
+}
+
+// ethernetFrameはパケットの内容から合成したEthernetフレームを返す。
+// 送信元か宛先がIPv6のアドレスならIPv6パケットを、そうでなければIPv4パケットを組み立てる。
+func ethernetFrame(p Packet) []byte {
+	frame := make([]byte, 14)
+	copy(frame[0:6], macBytes(p.DstMAC))
+	copy(frame[6:12], macBytes(p.SrcMAC))
+	if p.ARP != nil {
+		binary.BigEndian.PutUint16(frame[12:14], etherTypeARP)
+		return append(frame, arpBody(p.ARP)...)
+	}
+	if isIPv6(p.SrcIP) || isIPv6(p.DstIP) {
+		binary.BigEndian.PutUint16(frame[12:14], etherTypeIPv6)
+		return append(frame, ipv6Packet(p)...)
+	}
+	binary.BigEndian.PutUint16(frame[12:14], etherTypeIPv4)
+	return append(frame, ipv4Packet(p)...)
+}
+
+// ipv4PacketはパケットのアドレスとデータからIPv4パケットを組み立てる。
+// TCP、UDP、ICMPにはポートやICMPのメッセージから合成したヘッダをデータの前に付け、
+// ICMPのメッセージを持たないICMPパケットは任意のペイロードとして書く。
+func ipv4Packet(p Packet) []byte {
+	proto := ipProtocolNumber(p.Proto())
+	if proto == ipProtoICMP && p.ICMP == nil {
+		proto = ipProtoExperimental
+	}
+	payload := append(transportHeader(p, proto, ipv4Bytes(p.SrcIP), ipv4Bytes(p.DstIP)), p.Data...)
+	hdr := make([]byte, 20)
+	hdr[0] = 0x45 // バージョン4、ヘッダ長20バイト
+	binary.BigEndian.PutUint16(hdr[2:4], uint16(20+len(payload)))
+	hdr[8] = byte(min(max(p.TTL, 0), 255))
+	hdr[9] = proto
+	copy(hdr[12:16], ipv4Bytes(p.SrcIP))
+	copy(hdr[16:20], ipv4Bytes(p.DstIP))
+	binary.BigEndian.PutUint16(hdr[10:12], internetChecksum(hdr))
+	return append(hdr, payload...)
+}
+
+// ipv6PacketはパケットのアドレスとデータからIPv6パケットを組み立てる。
+// ICMPのメッセージはICMPv6として書き、IPv4のアドレスはIPv4射影アドレスにする。
+func ipv6Packet(p Packet) []byte {
+	proto := ipProtocolNumber(p.Proto())
+	if proto == ipProtoICMP {
+		proto = ipProtoICMPv6
+		if p.ICMP == nil {
+			proto = ipProtoExperimental
+		}
+	}
+	src, dst := ipv6Bytes(p.SrcIP), ipv6Bytes(p.DstIP)
+	payload := append(transportHeader(p, proto, src, dst), p.Data...)
+	hdr := make([]byte, 40)
+	hdr[0] = 0x60 // バージョン6、トラフィッククラスとフローラベルは0
+	binary.BigEndian.PutUint16(hdr[4:6], uint16(len(payload)))
+	hdr[6] = proto
+	hdr[7] = byte(min(max(p.TTL, 0), 255)) // ホップリミット
+	copy(hdr[8:24], src)
+	copy(hdr[24:40], dst)
+	return append(hdr, payload...)
+}
+
+// transportHeaderはプロトコル番号protoのトランスポート層のヘッダを合成する（任意のペイロードならnil）。
+// チェックサムは合成したヘッダとデータから計算するため、解析ツールで検証しても正しい値になる。
+// src、dstは疑似ヘッダに含めるアドレスで、IPv4なら4バイト、IPv6なら16バイト。
+func transportHeader(p Packet, proto byte, src, dst []byte) []byte {
+	var hdr []byte
+	checksumAt := 0
+	switch proto {
+	case ipProtoUDP:
+		hdr = make([]byte, 8)
+		binary.BigEndian.PutUint16(hdr[0:2], uint16(p.SrcPort))
+		binary.BigEndian.PutUint16(hdr[2:4], uint16(p.DstPort))
+		binary.BigEndian.PutUint16(hdr[4:6], uint16(8+len(p.Data)))
+		checksumAt = 6
+	case ipProtoTCP:
+		hdr = make([]byte, 20)
+		binary.BigEndian.PutUint16(hdr[0:2], uint16(p.SrcPort))
+		binary.BigEndian.PutUint16(hdr[2:4], uint16(p.DstPort))
+		binary.BigEndian.PutUint32(hdr[4:8], uint32(p.Seq))
+		binary.BigEndian.PutUint32(hdr[8:12], uint32(p.Ack))
+		hdr[12] = 5 << 4 // ヘッダ長20バイト
+		if p.Flags&FlagSYN != 0 {
+			hdr[13] |= tcpFlagSYN
+		}
+		if p.Flags&FlagACK != 0 {
+			hdr[13] |= tcpFlagACK
+		}
+		binary.BigEndian.PutUint16(hdr[14:16], 0xffff) // ウィンドウサイズ
+		checksumAt = 16
+	case ipProtoICMP, ipProtoICMPv6:
+		hdr = make([]byte, 8)
+		hdr[0], hdr[1] = byte(p.ICMP.Type), byte(p.ICMP.Code)
+		if proto == ipProtoICMPv6 {
+			hdr[0] = icmpv6Type(p.ICMP.Type)
+		}
+		if !p.ICMP.IsError() { // エラー通知では残りの4バイトは未使用
+			binary.BigEndian.PutUint16(hdr[4:6], uint16(p.ICMP.ID))
+			binary.BigEndian.PutUint16(hdr[6:8], uint16(p.ICMP.Seq))
+		}
+		if proto == ipProtoICMP { // ICMPv4のチェックサムは疑似ヘッダを含めない
+			binary.BigEndian.PutUint16(hdr[2:4], internetChecksum(append(hdr, p.Data...)))
+			return hdr
+		}
+		checksumAt = 2
+	default:
+		return nil
+	}
+	// TCP、UDP、ICMPv6のチェックサムは送信元・宛先のアドレスなどの疑似ヘッダも含めて計算する
+	segment := append(hdr, p.Data...)
+	sum := internetChecksum(append(pseudoHeader(src, dst, proto, len(segment)), segment...))
+	if proto == ipProtoUDP && sum == 0 {
+		sum = 0xffff // UDPでは0が未計算を表す
+	}
+	binary.BigEndian.PutUint16(hdr[checksumAt:checksumAt+2], sum)
+	return hdr
+}
+
+// pseudoHeaderはチェックサムの計算に使う疑似ヘッダを返す（IPv4なら12バイト、IPv6なら40バイト）。
+func pseudoHeader(src, dst []byte, proto byte, length int) []byte {
+	if len(src) == net.IPv4len {
+		pseudo := make([]byte, 12)
+		copy(pseudo[0:4], src)
+		copy(pseudo[4:8], dst)
+		pseudo[9] = proto
+		binary.BigEndian.PutUint16(pseudo[10:12], uint16(length))
+		return pseudo
+	}
+	pseudo := make([]byte, 40)
+	copy(pseudo[0:16], src)
+	copy(pseudo[16:32], dst)
+	binary.BigEndian.PutUint32(pseudo[32:36], uint32(length))
+	pseudo[39] = proto
+	return pseudo
+}
+
+// icmpv6TypeはICMPのメッセージ種別を対応するICMPv6の種別の番号に変換する。
+func icmpv6Type(t ICMPType) byte {
+	switch t {
+	case ICMPEchoReply:
+		return 129
+	case ICMPEchoRequest:
+		return 128
+	case ICMPDestUnreachable:
+		return 1
+	case ICMPTimeExceeded:
+		return 3
+	}
+	return byte(t)
+}
+
+// ipProtocolNumberはプロトコルに対応するIPヘッダのプロトコル番号を返す。
+func ipProtocolNumber(proto Protocol) byte {
+	switch proto {
+	case ProtocolICMP:
+		return ipProtoICMP
+	case ProtocolTCP:
+		return ipProtoTCP
+	case ProtocolUDP:
+		return ipProtoUDP
+	}
+	return ipProtoExperimental
+}
+
+// arpBodyはARPメッセージをEthernet用のARPパケットに変換。
+// アドレスがIPv6なら、プロトコル種別をIPv6、プロトコルアドレス長を16バイトにする。
+func arpBody(m *ARPMessage) []byte {
+	ptype, sender, target := uint16(etherTypeIPv4), ipv4Bytes(m.SenderIP), ipv4Bytes(m.TargetIP)
+	if isIPv6(m.SenderIP) || isIPv6(m.TargetIP) {
+		ptype, sender, target = etherTypeIPv6, ipv6Bytes(m.SenderIP), ipv6Bytes(m.TargetIP)
+	}
+	plen := len(sender)
+	body := make([]byte, 8+2*(6+plen))
+	binary.BigEndian.PutUint16(body[0:2], 1) // ハードウェア種別: Ethernet
+	binary.BigEndian.PutUint16(body[2:4], ptype)
+	body[4], body[5] = 6, byte(plen)
+	binary.BigEndian.PutUint16(body[6:8], uint16(m.Op))
+	copy(body[8:14], macBytes(m.SenderMAC))
+	copy(body[14:14+plen], sender)
+	// 続く6バイトは対象MACで、要求時は不明なので0
+	copy(body[20+plen:], target)
+	return body
+}
+
+// internetChecksumはRFC 1071のインターネットチェックサムを計算。
+func internetChecksum(b []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
+
+// macBytesはMACアドレス文字列を6バイトに変換（不正な場合は0）。
+func macBytes(s string) []byte {
+	mac, err := net.ParseMAC(s)
+	if err != nil || len(mac) != 6 {
+		return make([]byte, 6)
+	}
+	return mac
+}
+
+// isIPv6はアドレス文字列がIPv6のアドレスかどうかを返す。
+func isIPv6(s string) bool {
+	ip := net.ParseIP(s)
+	return ip != nil && ip.To4() == nil
+}
+
+// ipv6BytesはIPアドレス文字列を16バイトに変換（IPv4ならIPv4射影アドレス、不正な場合は0）。
+func ipv6Bytes(s string) []byte {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return make([]byte, 16)
+	}
+	return ip.To16()
+}
+
+// ipv4BytesはIPv4アドレス文字列を4バイトに変換（不正な場合は0）。
+func ipv4Bytes(s string) []byte {
+	ip := net.ParseIP(s).To4()
+	if ip == nil {
+		return make([]byte, 4)
+	}
+	return ip
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+// readPcapはpcapファイルのグローバルヘッダを確かめ、各レコードのフレームを返す。
+func readPcap(t *testing.T, data []byte) [][]byte {
+	t.Helper()
+	if len(data) < 24 || binary.LittleEndian.Uint32(data[0:4]) != pcapMagic || binary.LittleEndian.Uint32(data[20:24]) != pcapLinkEthernet {
+		t.Fatalf("不正なpcapのグローバルヘッダ: % x", data[:min(len(data), 24)])
+	}
+	var frames [][]byte
+	for rest := data[24:]; len(rest) > 0; {
+		if len(rest) < 16 {
+			t.Fatalf("途中で切れたレコードヘッダ: %d バイト", len(rest))
+		}
+		incl := int(binary.LittleEndian.Uint32(rest[8:12]))
+		if orig := int(binary.LittleEndian.Uint32(rest[12:16])); orig != incl || len(rest) < 16+incl {
+			t.Fatalf("不正なレコード長 %d/%d", incl, orig)
+		}
+		frames = append(frames, rest[16:16+incl])
+		rest = rest[16+incl:]
+	}
+	return frames
+}
+
+// writeFrameはパケット1つをpcapに書き、そのフレームを返す。
+func writeFrame(t *testing.T, p Packet) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	pw, err := NewPcapWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pw.WritePacket(SimulationEpoch.Add(1500*time.Millisecond), p); err != nil {
+		t.Fatalf("WritePacket: %v", err)
+	}
+	frames := readPcap(t, buf.Bytes())
+	if len(frames) != 1 {
+		t.Fatalf("レコード数 = %d, 期待値 1", len(frames))
+	}
+	if ts := binary.LittleEndian.Uint32(buf.Bytes()[24+4:]); ts != 500000 {
+		t.Errorf("タイムスタンプのマイクロ秒 = %d, 期待値 500000", ts)
+	}
+	return frames[0]
+}
+
+// checkTransportChecksumはTCPかUDPのセグメントのチェックサムを疑似ヘッダ付きで検証する。
+func checkTransportChecksum(t *testing.T, ip []byte) {
+	t.Helper()
+	segment := ip[20:]
+	pseudo := make([]byte, 12)
+	copy(pseudo[0:8], ip[12:20])
+	pseudo[9] = ip[9]
+	binary.BigEndian.PutUint16(pseudo[10:12], uint16(len(segment)))
+	if sum := internetChecksum(append(pseudo, segment...)); sum != 0 {
+		t.Errorf("トランスポート層のチェックサムが一致しない（検証値 %#x）", sum)
+	}
+}
+
+func TestPcapUDP(t *testing.T) {
+	frame := writeFrame(t, Packet{SrcMAC: "AA:AA:AA:AA:AA:01", DstMAC: "AA:AA:AA:AA:AA:02", SrcIP: "10.0.0.1", DstIP: "10.0.0.2", TTL: 64,
+		Protocol: ProtocolUDP, SrcPort: 5000, DstPort: 53, Data: []byte("query")})
+	if got := binary.BigEndian.Uint16(frame[12:14]); got != etherTypeIPv4 {
+		t.Fatalf("EtherType = %#x, 期待値 IPv4", got)
+	}
+	if !bytes.Equal(frame[0:6], []byte{0xAA, 0xAA, 0xAA, 0xAA, 0xAA, 0x02}) {
+		t.Errorf("宛先MAC = % x", frame[0:6])
+	}
+	ip := frame[14:]
+	if ip[9] != ipProtoUDP || ip[8] != 64 || int(binary.BigEndian.Uint16(ip[2:4])) != 20+8+5 || internetChecksum(ip[:20]) != 0 {
+		t.Errorf("IPv4ヘッダが不正: % x", ip[:20])
+	}
+	udp := ip[20:]
+	if binary.BigEndian.Uint16(udp[0:2]) != 5000 || binary.BigEndian.Uint16(udp[2:4]) != 53 || binary.BigEndian.Uint16(udp[4:6]) != 13 {
+		t.Errorf("UDPヘッダが不正: % x", udp[:8])
+	}
+	if string(udp[8:]) != "query" {
+		t.Errorf("データ = %q", udp[8:])
+	}
+	checkTransportChecksum(t, ip)
+}
+
+func TestPcapTCP(t *testing.T) {
+	frame := writeFrame(t, Packet{SrcIP: "10.0.0.1", DstIP: "10.0.0.2", Protocol: ProtocolTCP, SrcPort: 40000, DstPort: 80,
+		Seq: 1000, Ack: 2000, Flags: FlagSYN | FlagACK, Data: []byte("abc")})
+	ip := frame[14:]
+	tcp := ip[20:]
+	if ip[9] != ipProtoTCP || len(tcp) != 20+3 {
+		t.Fatalf("TCPセグメントが不正: % x", tcp)
+	}
+	if binary.BigEndian.Uint32(tcp[4:8]) != 1000 || binary.BigEndian.Uint32(tcp[8:12]) != 2000 || tcp[12]>>4 != 5 || tcp[13] != tcpFlagSYN|tcpFlagACK {
+		t.Errorf("TCPヘッダが不正: % x", tcp[:20])
+	}
+	checkTransportChecksum(t, ip)
+}
+
+func TestPcapICMP(t *testing.T) {
+	frame := writeFrame(t, Packet{SrcIP: "10.0.0.1", DstIP: "10.0.0.2", Protocol: ProtocolICMP,
+		ICMP: &ICMPMessage{Type: ICMPEchoRequest, ID: 7, Seq: 3}, Data: make([]byte, pingPayloadSize)})
+	ip := frame[14:]
+	icmp := ip[20:]
+	if ip[9] != ipProtoICMP || len(icmp) != 8+pingPayloadSize {
+		t.Fatalf("ICMPメッセージが不正: % x", icmp)
+	}
+	if icmp[0] != byte(ICMPEchoRequest) || binary.BigEndian.Uint16(icmp[4:6]) != 7 || binary.BigEndian.Uint16(icmp[6:8]) != 3 {
+		t.Errorf("ICMPヘッダが不正: % x", icmp[:8])
+	}
+	if internetChecksum(icmp) != 0 {
+		t.Error("ICMPのチェックサムが一致しない")
+	}
+}
+
+func TestPcapRawAndARP(t *testing.T) {
+	raw := writeFrame(t, Packet{SrcMAC: "AA:AA:AA:AA:AA:01", DstMAC: "AA:AA:AA:AA:AA:02", SrcIP: "10.0.0.1", DstIP: "10.0.0.2", TTL: 64, Data: []byte("hi")})
+	if got := binary.BigEndian.Uint16(raw[12:14]); got != etherTypeIPv4 {
+		t.Fatalf("EtherType = %#x, 期待値 IPv4", got)
+	}
+	if !bytes.Equal(raw[0:6], []byte{0xAA, 0xAA, 0xAA, 0xAA, 0xAA, 0x02}) {
+		t.Errorf("宛先MAC = % x", raw[0:6])
+	}
+	ip := raw[14:]
+	if ip[9] != ipProtoExperimental || ip[8] != 64 || int(binary.BigEndian.Uint16(ip[2:4])) != 20+2 || internetChecksum(ip[:20]) != 0 {
+		t.Errorf("IPv4ヘッダが不正: % x", ip[:20])
+	}
+	if string(ip[20:]) != "hi" {
+		t.Errorf("データ = %q", ip[20:])
+	}
+	arp := writeFrame(t, Packet{DstMAC: BroadcastMAC, SrcMAC: "AA:AA:AA:AA:AA:01",
+		ARP: &ARPMessage{Op: ARPRequest, SenderMAC: "AA:AA:AA:AA:AA:01", SenderIP: "10.0.0.1", TargetIP: "10.0.0.2"}})
+	if binary.BigEndian.Uint16(arp[12:14]) != etherTypeARP || len(arp) != 14+28 {
+		t.Fatalf("ARPフレームが不正: % x", arp)
+	}
+	if !bytes.Equal(arp[14+24:14+28], []byte{10, 0, 0, 2}) {
+		t.Errorf("ARPの対象IP = % x", arp[14+24:14+28])
+	}
+}
+
+func TestPcapProtocolNumbers(t *testing.T) {
+	tests := []struct {
+		proto Protocol
+		want  byte
+	}{
+		{ProtocolICMP, ipProtoExperimental}, // ICMPのメッセージがなければ任意のペイロードとして書く
+		{ProtocolTCP, ipProtoTCP},
+		{ProtocolUDP, ipProtoUDP},
+		{ProtocolRaw, ipProtoExperimental},
+		{"", ipProtoExperimental},
+	}
+	for _, tt := range tests {
+		frame := writeFrame(t, Packet{SrcIP: "10.0.0.1", DstIP: "10.0.0.2", Protocol: tt.proto})
+		if got := frame[14+9]; got != tt.want {
+			t.Errorf("%q のプロトコル番号 = %d, 期待値 %d", tt.proto, got, tt.want)
+		}
+	}
+}
+
+func TestPcapIPv6(t *testing.T) {
+	src, dst := net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2")
+	// checkはIPv6ヘッダを確かめ、上位層のチェックサムを疑似ヘッダ付きで検証してペイロードを返す。
+	check := func(frame []byte, next byte) []byte {
+		t.Helper()
+		if got := binary.BigEndian.Uint16(frame[12:14]); got != etherTypeIPv6 {
+			t.Fatalf("EtherType = %#x, 期待値 IPv6", got)
+		}
+		ip := frame[14:]
+		if ip[0]>>4 != 6 || ip[6] != next || ip[7] != 64 || int(binary.BigEndian.Uint16(ip[4:6])) != len(ip)-40 {
+			t.Errorf("IPv6ヘッダが不正: % x", ip[:40])
+		}
+		if !bytes.Equal(ip[8:24], src) || !bytes.Equal(ip[24:40], dst) {
+			t.Errorf("アドレス = % x, % x", ip[8:24], ip[24:40])
+		}
+		pseudo := make([]byte, 40)
+		copy(pseudo[0:32], ip[8:40])
+		binary.BigEndian.PutUint32(pseudo[32:36], uint32(len(ip)-40))
+		pseudo[39] = next
+		if sum := internetChecksum(append(pseudo, ip[40:]...)); sum != 0 {
+			t.Errorf("上位層のチェックサムが一致しない（検証値 %#x）", sum)
+		}
+		return ip[40:]
+	}
+
+	udp := check(writeFrame(t, Packet{SrcIP: "2001:DB8::1", DstIP: "2001:db8::2", TTL: 64,
+		Protocol: ProtocolUDP, SrcPort: 5000, DstPort: 53, Data: []byte("query")}), ipProtoUDP)
+	if binary.BigEndian.Uint16(udp[0:2]) != 5000 || binary.BigEndian.Uint16(udp[2:4]) != 53 || string(udp[8:]) != "query" {
+		t.Errorf("UDPセグメントが不正: % x", udp)
+	}
+	icmp := check(writeFrame(t, Packet{SrcIP: "2001:db8::1", DstIP: "2001:db8::2", TTL: 64, Protocol: ProtocolICMP,
+		ICMP: &ICMPMessage{Type: ICMPEchoRequest, ID: 7, Seq: 3}}), ipProtoICMPv6)
+	if icmp[0] != 128 || binary.BigEndian.Uint16(icmp[4:6]) != 7 || binary.BigEndian.Uint16(icmp[6:8]) != 3 {
+		t.Errorf("ICMPv6ヘッダが不正: % x", icmp)
+	}
+
+	arp := writeFrame(t, Packet{DstMAC: BroadcastMAC, SrcMAC: "AA:AA:AA:AA:AA:01", Protocol: ProtocolARP,
+		ARP: &ARPMessage{Op: ARPRequest, SenderMAC: "AA:AA:AA:AA:AA:01", SenderIP: "2001:db8::1", TargetIP: "2001:db8::2"}})
+	body := arp[14:]
+	if binary.BigEndian.Uint16(body[2:4]) != etherTypeIPv6 || body[5] != 16 || len(body) != 8+2*(6+16) {
+		t.Fatalf("IPv6のARPパケットが不正: % x", body)
+	}
+	if !bytes.Equal(body[14:30], src) || !bytes.Equal(body[36:52], dst) {
+		t.Errorf("ARPのアドレス = % x, % x", body[14:30], body[36:52])
+	}
+}
+
+func TestEnableCapture(t *testing.T) {
+	n, a, _, _ := newTestLAN(t)
+	var buf bytes.Buffer
+	if err := n.EnableCapture(&buf); err != nil {
+		t.Fatal(err)
+	}
+	a.SendPacket(Packet{DstIP: "10.0.0.2", Data: []byte("hello")})
+	n.Bus.Run()
+	// AのGratuitous ARPとARP要求（A->S、S->B）、BのGratuitous ARPとARP応答（B->S、S->A）、データ（A->S、S->B）
+	if frames := readPcap(t, buf.Bytes()); len(frames) != 10 {
+		t.Errorf("記録したフレーム = %d, 期待値 10", len(frames))
+	}
+}
+
+func TestPcapGlobalHeaderBytes(t *testing.T) {
+	var buf bytes.Buffer
+	if _, err := NewPcapWriter(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{
+		0xd4, 0xc3, 0xb2, 0xa1, // マジックナンバー（リトルエンディアン）
+		0x02, 0x00, 0x04, 0x00, // バージョン2.4
+		0x00, 0x00, 0x00, 0x00, // タイムゾーン補正
+		0x00, 0x00, 0x00, 0x00, // タイムスタンプの精度
+		0xff, 0xff, 0x00, 0x00, // スナップ長65535
+		0x01, 0x00, 0x00, 0x00, // LINKTYPE_ETHERNET
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("グローバルヘッダ = % x, 期待値 % x", buf.Bytes(), want)
+	}
+}
+
+func TestEnableCaptureRecordHeaders(t *testing.T) {
+	n, a, _, _ := newTestLAN(t)
+	var buf bytes.Buffer
+	if err := n.EnableCapture(&buf); err != nil {
+		t.Fatal(err)
+	}
+	n.Bus.AddEvent(2*time.Second, func() { a.SendPacket(Packet{DstIP: "10.0.0.2", Data: []byte("hello")}) })
+	n.Bus.Run()
+	frames := readPcap(t, buf.Bytes())
+	rest := buf.Bytes()[24:]
+	// 各リンクの遅延は1msのため、Gratuitous ARPとARP要求、ARP応答の組、データの順に1msずつ遅れて送出される
+	sentAt := []int{0, 0, 1, 1, 2, 2, 3, 3, 4, 5}
+	for i, frame := range frames {
+		if i >= len(sentAt) {
+			break
+		}
+		want := make([]byte, 16)
+		binary.LittleEndian.PutUint32(want[0:4], 2)
+		binary.LittleEndian.PutUint32(want[4:8], uint32(sentAt[i]*1000))
+		binary.LittleEndian.PutUint32(want[8:12], uint32(len(frame)))
+		binary.LittleEndian.PutUint32(want[12:16], uint32(len(frame)))
+		if !bytes.Equal(rest[:16], want) {
+			t.Errorf("レコード %d のヘッダ = % x, 期待値 % x", i, rest[:16], want)
+		}
+		rest = rest[16+len(frame):]
+	}
+	if len(frames) != len(sentAt) {
+		t.Errorf("記録したフレーム = %d, 期待値 %d", len(frames), len(sentAt))
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+const (
+	DefaultPingInterval = time.Second     // エコー要求を送る間隔
+	DefaultPingTimeout  = 2 * time.Second // エコー応答を待つ時間
+	pingPayloadSize     = 56              // エコー要求のデータ長（バイト）
+)
+
+// PingResultはpingの結果を表す。RTTは仮想時計で測った往復時間。
+type PingResult struct {
+	Sent     int           // 送信したエコー要求の数
+	Received int           // 時間内に受信したエコー応答の数
+	MinRTT   time.Duration // 最小の往復時間
+	AvgRTT   time.Duration // 平均の往復時間
+	MaxRTT   time.Duration // 最大の往復時間
+}
+
+// Lossは応答のなかった要求の割合（0.0〜1.0）を返す。
+func (r PingResult) Loss() float64 {
+	if r.Sent == 0 {
+		return 0
+	}
+	return float64(r.Sent-r.Received) / float64(r.Sent)
+}
+
+// pingSessionは実行中のpingの状態を表す。
+type pingSession struct {
+	bus     *EventBus
+	sentAt  map[int]time.Time // シーケンス番号ごとの送信時刻（応答かタイムアウトで削除）
+	rtts    []time.Duration   // 受信した応答の往復時間
+	pending int               // 応答もタイムアウトもしていない要求の数
+
+	onReply func(seq int, from string, rtt time.Duration) // 応答ごとに呼ばれるコールバック（nilなら呼ばない）
+}
+
+// replyはシーケンス番号seqの要求へのfromからの応答を受け取り、往復時間を記録する。
+func (ps *pingSession) reply(seq int, from string) {
+	sent, ok := ps.sentAt[seq]
+	if !ok {
+		return // タイムアウト後の応答や重複した応答は数えない
+	}
+	delete(ps.sentAt, seq)
+	ps.pending--
+	rtt := ps.bus.Now().Sub(sent)
+	ps.rtts = append(ps.rtts, rtt)
+	if ps.onReply != nil {
+		ps.onReply(seq, from, rtt)
+	}
+}
+
+// Pingはsrcからdstへcount回のエコー要求をDefaultPingInterval毎に送り、結果を返す。
+// 応答を待つ間はイベントバスを進め、DefaultPingTimeout以内に応答がなければ損失とみなす。
+func (n *Network) Ping(src *Host, dstIP string, count int) (PingResult, error) {
+	if src.Network != n {
+		return PingResult{}, fmt.Errorf("ホスト %s はこのネットワークに属していません", src.Name)
+	}
+	if net.ParseIP(dstIP) == nil {
+		return PingResult{}, fmt.Errorf("不正な宛先IP %q", dstIP)
+	}
+	if count <= 0 {
+		return PingResult{}, fmt.Errorf("不正な送信回数 %d", count)
+	}
+	if src.networkLayer() == nil {
+		return PingResult{}, fmt.Errorf("ホスト %s にネットワーク層がありません", src.Name)
+	}
+
+	n.pingID++
+	id := n.pingID
+	ps := &pingSession{bus: n.Bus, sentAt: make(map[int]time.Time), pending: count}
+	if src.pings == nil {
+		src.pings = make(map[int]*pingSession)
+	}
+	src.pings[id] = ps
+	defer delete(src.pings, id)
+
+	for i := 0; i < count; i++ {
+		seq := i + 1
+		n.Bus.AddEvent(time.Duration(i)*DefaultPingInterval, func() {
+			ps.sentAt[seq] = n.Bus.Now()
+			n.log().Debugf("[Ping] %s: %s へエコー要求 (id %d, seq %d)", src.Name, dstIP, id, seq)
+			src.SendPacket(Packet{
+				Data:     make([]byte, pingPayloadSize),
+				DstIP:    dstIP,
+				Protocol: ProtocolICMP,
+				ICMP:     &ICMPMessage{Type: ICMPEchoRequest, ID: id, Seq: seq},
+			})
+			n.Bus.AddEvent(DefaultPingTimeout, func() {
+				if _, waiting := ps.sentAt[seq]; waiting {
+					delete(ps.sentAt, seq)
+					ps.pending--
+					n.log().Warnf("[Ping] %s: %s からの応答がタイムアウト (seq %d)", src.Name, dstIP, seq)
+				}
+			})
+		})
+	}
+	for ps.pending > 0 && n.Bus.Step() {
+	}
+
+	result := PingResult{Sent: count, Received: len(ps.rtts)}
+	var total time.Duration
+	for i, rtt := range ps.rtts {
+		if i == 0 || rtt < result.MinRTT {
+			result.MinRTT = rtt
+		}
+		result.MaxRTT = max(result.MaxRTT, rtt)
+		total += rtt
+	}
+	if result.Received > 0 {
+		result.AvgRTT = total / time.Duration(result.Received)
+	}
+	n.log().Infof("[Ping] %s -> %s: %d 送信, %d 受信, RTT min/avg/max = %v/%v/%v", src.Name, dstIP, result.Sent, result.Received, result.MinRTT, result.AvgRTT, result.MaxRTT)
+	return result, nil
+}
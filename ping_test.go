@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPingReachable(t *testing.T) {
+	n, a, _, _ := newTestLAN(t)
+	result, err := n.Ping(a, "10.0.0.2", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Sent != 3 || result.Received != 3 || result.Loss() != 0 {
+		t.Errorf("送信 %d, 受信 %d, 損失 %v, 期待値 3, 3, 0", result.Sent, result.Received, result.Loss())
+	}
+	// 最初の要求だけARP解決の往復（4ms）を待つ。以降はスイッチ経由の往復（4ms）だけ。
+	if result.MinRTT != 4*time.Millisecond || result.MaxRTT != 8*time.Millisecond || result.AvgRTT != 16*time.Millisecond/3 {
+		t.Errorf("RTT min/avg/max = %v/%v/%v, 期待値 4ms/5.333333ms/8ms", result.MinRTT, result.AvgRTT, result.MaxRTT)
+	}
+}
+
+func TestPingUnreachable(t *testing.T) {
+	n, a, _, _ := newTestLAN(t)
+	result, err := n.Ping(a, "10.0.0.99", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Received != 0 || result.Loss() != 1 {
+		t.Errorf("受信 %d, 損失 %v, 期待値 0, 1", result.Received, result.Loss())
+	}
+	if result.MinRTT != 0 || result.AvgRTT != 0 || result.MaxRTT != 0 {
+		t.Errorf("応答がないのにRTTが記録された: %+v", result)
+	}
+	// 最後の要求（2s）からタイムアウトを待って終わる。
+	if want := 2*DefaultPingInterval + DefaultPingTimeout; elapsed(n) != want {
+		t.Errorf("経過時間 = %v, 期待値 %v", elapsed(n), want)
+	}
+}
+
+func TestPingErrors(t *testing.T) {
+	n, a, _, _ := newTestLAN(t)
+	other := newTestHost("X", "AA:AA:AA:AA:AA:09", "10.0.0.9")
+	tests := []struct {
+		name  string
+		src   *Host
+		dst   string
+		count int
+	}{
+		{"別のネットワークのホスト", other, "10.0.0.2", 1},
+		{"不正な宛先IP", a, "10.0.0", 1},
+		{"不正な送信回数", a, "10.0.0.2", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := n.Ping(tt.src, tt.dst, tt.count); err == nil {
+				t.Error("エラーにならない")
+			}
+		})
+	}
+}
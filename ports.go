@@ -0,0 +1,100 @@
+package main
+
+import "fmt"
+
+// PortInfoはデバイスの名前付きのインターフェース（スイッチのポート、ルータやホストのインターフェース）を表す。
+type PortInfo struct {
+	Name   string // インターフェースの名前（例："eth0"）
+	Device Device // インターフェースを持つデバイス
+	Peer   Device // 接続先のデバイス（わからなければnil）
+	Link   *Link  // このインターフェースから送出するリンク（未接続ならnil）
+}
+
+// portNameは名前が未設定のインターフェースにi番目（0から数える）を表す「eth0」などの名前を付ける。
+func portName(name string, i int) string {
+	if name != "" {
+		return name
+	}
+	return fmt.Sprintf("eth%d", i)
+}
+
+// DeviceByNameは名前でデバイスを探す（見つからなければnil）。
+func (n *Network) DeviceByName(name string) Device {
+	for _, d := range n.Devices {
+		if d.GetName() == name {
+			return d
+		}
+	}
+	return nil
+}
+
+// Interfaceは名前でホストのインターフェースを探す（見つからなければnil）。
+// 1つ目のインターフェースが「eth0」で、AddNICで追加したものは順に「eth1」以降になる。
+func (h *Host) Interface(name string) *PortInfo {
+	for i, nic := range h.nics() {
+		if portName(nic.Name, i) != name {
+			continue
+		}
+		info := &PortInfo{Name: name, Device: h, Peer: nic.ConnectedDev}
+		if h.Network != nil && nic.ConnectedDev != nil {
+			info.Link = h.Network.linkIndex[[2]Device{h, nic.ConnectedDev}]
+		}
+		return info
+	}
+	return nil
+}
+
+// Interfaceは名前でスイッチのポートを探す（見つからなければnil）。ポートは番号順に「eth0」から名前が付く。
+func (s *Switch) Interface(name string) *PortInfo {
+	for i, port := range s.Ports {
+		if portName(port.Name, i) == name {
+			return &PortInfo{Name: name, Device: s, Peer: port.Peer, Link: port.Link}
+		}
+	}
+	return nil
+}
+
+// Interfaceは名前でルータのインターフェースを探す（見つからなければnil）。
+// AddInterfaceで追加した順に「eth0」から名前が付く。
+func (r *Router) Interface(name string) *PortInfo {
+	for i, iface := range r.Interfaces {
+		if portName(iface.Name, i) != name {
+			continue
+		}
+		info := &PortInfo{Name: name, Device: r, Link: iface.Link}
+		if iface.Link != nil {
+			info.Peer = iface.Link.To
+		}
+		return info
+	}
+	return nil
+}
+
+// Interfaceは名前でハブのポートを探す（見つからなければnil）。ハブから出るリンクを追加した順に「eth0」から名前が付く。
+func (hub *Hub) Interface(name string) *PortInfo {
+	return linkPort(hub, hub.Network, name)
+}
+
+// Interfaceは名前でDHCPサーバのインターフェースを探す（見つからなければnil）。
+// サーバから出るリンクを追加した順に「eth0」から名前が付く（通常は「eth0」だけを使う）。
+func (srv *DHCPServer) Interface(name string) *PortInfo {
+	return linkPort(srv, srv.Network, name)
+}
+
+// linkPortはポートの構造を持たないデバイスで、d から出るi番目のリンクを「eth<i>」として扱う。
+func linkPort(d Device, n *Network, name string) *PortInfo {
+	if n == nil {
+		return nil
+	}
+	i := 0
+	for _, l := range n.Links {
+		if l.From != d {
+			continue
+		}
+		if portName("", i) == name {
+			return &PortInfo{Name: name, Device: d, Peer: l.To, Link: l}
+		}
+		i++
+	}
+	return nil
+}
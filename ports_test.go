@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNetworkDeviceByName(t *testing.T) {
+	n, a, _, s := newTestLAN(t)
+	if got := n.DeviceByName("A"); got != a {
+		t.Errorf("DeviceByName(A) = %v, 期待値 A", got)
+	}
+	if got := n.DeviceByName("S"); got != s {
+		t.Errorf("DeviceByName(S) = %v, 期待値 S", got)
+	}
+	for _, name := range []string{"Z", "", "a"} {
+		if got := n.DeviceByName(name); got != nil {
+			t.Errorf("DeviceByName(%q) = %v, 期待値 nil", name, got)
+		}
+	}
+}
+
+// checkPortはインターフェースの情報が名前、device、peer、linkと一致するかを確かめる。
+func checkPort(t *testing.T, got *PortInfo, name string, device, peer Device, link *Link) {
+	t.Helper()
+	if got == nil {
+		t.Errorf("%s がnil", name)
+		return
+	}
+	if got.Name != name || got.Device != device || got.Peer != peer || got.Link != link {
+		t.Errorf("%s = %+v, 期待値 %s の %s (接続先 %v, リンク %v)", name, got, device.GetName(), name, peer, link)
+	}
+}
+
+func TestDeviceInterface(t *testing.T) {
+	n, h, a, b := newTestMultihomed(t)
+	checkPort(t, h.Interface("eth0"), "eth0", h, a, n.GetLink(h, a))
+	checkPort(t, h.Interface("eth1"), "eth1", h, b, n.GetLink(h, b))
+
+	_, ra, rb, r := newTestRoutedNet(t)
+	checkPort(t, r.Interface("eth1"), "eth1", r, rb, r.Network.GetLink(r, rb))
+	r.Interfaces[0].Name = "lan" // 名前を設定したインターフェースはその名前で引く
+	checkPort(t, r.Interface("lan"), "lan", r, ra, r.Network.GetLink(r, ra))
+
+	ln, la, lb, s := newTestLAN(t)
+	checkPort(t, s.Interface("eth1"), "eth1", s, lb, ln.GetLink(s, lb))
+
+	hub := &Hub{Name: "Hub"}
+	ln.AddDevice(hub)
+	ln.AddBidirectionalLink(hub, la, time.Millisecond)
+	checkPort(t, hub.Interface("eth0"), "eth0", hub, la, ln.GetLink(hub, la))
+
+	for _, c := range []struct {
+		name string
+		got  *PortInfo
+	}{
+		{"ホストの存在しないインターフェース", h.Interface("eth2")},
+		{"ルータの名前を変えたインターフェースの既定の名前", r.Interface("eth0")},
+		{"スイッチの存在しないポート", s.Interface("eth9")},
+		{"ハブの存在しないポート", hub.Interface("eth1")},
+		{"ネットワークに追加していないハブ", (&Hub{Name: "X"}).Interface("eth0")},
+	} {
+		if c.got != nil {
+			t.Errorf("%s = %+v, 期待値 nil", c.name, c.got)
+		}
+	}
+}
+
+func TestHostInterfaceWithoutNetwork(t *testing.T) {
+	h := newTestHost("H", "AA:AA:AA:AA:AA:01", "10.0.0.1")
+	got := h.Interface("eth0")
+	if got == nil || got.Device != h || got.Peer != nil || got.Link != nil {
+		t.Errorf("未接続のホストのeth0 = %+v, 期待値は接続先もリンクもない情報", got)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+// powerSwitchは電源を入れたり切ったりできるデバイスが実装する。
+type powerSwitch interface {
+	setEnabled(on bool)
+}
+
+func (s *Switch) setEnabled(on bool)       { s.poweredOff = !on }
+func (r *Router) setEnabled(on bool)       { r.poweredOff = !on }
+func (hub *Hub) setEnabled(on bool)        { hub.poweredOff = !on }
+func (srv *DHCPServer) setEnabled(on bool) { srv.poweredOff = !on }
+
+// setEnabledはホストの電源を入れるか切る。電源を入れたときは、接続済みのインターフェースからIPアドレスを通知し直す。
+func (h *Host) setEnabled(on bool) {
+	wasOff := h.poweredOff
+	h.poweredOff = !on
+	if on && wasOff {
+		for _, nic := range h.nics() {
+			if nic.Network != nil {
+				nic.Network.announced = false
+			}
+		}
+		h.announceLinked()
+	}
+}
+
+// SetDeviceStateはデバイスの電源を入れる（enabled=true）か切る。電源の切れたデバイスは
+// 受信したパケットも自分から送るパケットも破棄し、伝送中のパケットも届いた時点で破棄される。
+// 電源を切ってもMACテーブルや経路表などの状態は保たれる。
+// 電源の状態はデバイスの非公開フィールドに持ち、変更はこのメソッドだけで行う。
+func (n *Network) SetDeviceState(d Device, enabled bool) {
+	ps, ok := d.(powerSwitch)
+	if !ok {
+		n.log().Warnf("[Network] %s は電源の状態を変更できません", d.GetName())
+		return
+	}
+	ps.setEnabled(enabled)
+	n.record(Record{Action: RecordDeviceState, Devices: []string{d.GetName()}, Value: onOff(enabled)})
+	if enabled {
+		n.log().Infof("[Network] %s の電源を入れました", d.GetName())
+	} else {
+		n.log().Infof("[Network] %s の電源を切りました (device offline)", d.GetName())
+	}
+}
+
+// dropOfflineはデバイスの電源が切れていればパケットを破棄として記録し、その旨のエラーを返す。
+func (n *Network) dropOffline(off bool, name string, stats *Stats, p Packet) error {
+	if !off {
+		return nil
+	}
+	stats.countDrop(DropDeviceOffline)
+	n.recordTrace(p, name, TraceDrop)
+	n.log().Warnf("[Network] %s: 電源が切れているためパケットを破棄 (device offline)%s", name, p.traceTag())
+	return dropError(name, DropDeviceOffline)
+}
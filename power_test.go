@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSetDeviceState(t *testing.T) {
+	n, a, b, s := newTestLAN(t)
+	got := record(b)
+	a.Send("10.0.0.2", []byte("first"))
+	runBus(t, n)
+	if len(got.in) != 1 {
+		t.Fatalf("電源を入れたまま届いたパケット = %d, 期待値 1（追加したデバイスは電源が入っている）", len(got.in))
+	}
+
+	// スイッチの電源を切ると中継せずに破棄する
+	n.SetDeviceState(s, false)
+	a.Send("10.0.0.2", []byte("off"))
+	runBus(t, n)
+	if len(got.in) != 1 {
+		t.Errorf("電源を切ったスイッチを越えて届いた: %v", got.in[1:])
+	}
+	if d := s.Stats.Dropped[DropDeviceOffline]; d != 1 {
+		t.Errorf("スイッチの%s = %d, 期待値 1", DropDeviceOffline, d)
+	}
+
+	// 電源の切れたホストは送信もしない
+	n.SetDeviceState(a, false)
+	if err := a.Send("10.0.0.2", []byte("host off")); !errors.Is(err, DropDeviceOffline) {
+		t.Errorf("電源の切れたホストのSend = %v, 期待値 %s", err, DropDeviceOffline)
+	}
+
+	// 電源を入れ直すと再び転送する
+	n.SetDeviceState(a, true)
+	n.SetDeviceState(s, true)
+	a.Send("10.0.0.2", []byte("on"))
+	runBus(t, n)
+	if len(got.in) != 2 || string(got.in[1].Data) != "on" {
+		t.Fatalf("電源を入れ直した後に届いたパケット = %v, 期待値 on を含む2つ", got.in)
+	}
+	if d := s.Stats.Dropped[DropDeviceOffline]; d != 1 {
+		t.Errorf("電源を入れ直した後のスイッチの%s = %d, 期待値 1", DropDeviceOffline, d)
+	}
+}
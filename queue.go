@@ -0,0 +1,217 @@
+package main
+
+// QueueDisciplineはリンクの送信待ちキューにパケットを受け入れるかどうかを決める。
+type QueueDiscipline interface {
+	// Admitはキュー長queueLenと最大長capacityから受け入れるかを返す。
+	// 受け入れない場合は破棄理由も返す。rndは0.0以上1.0未満の乱数。
+	Admit(queueLen, capacity int, rnd float64) (bool, DropReason)
+}
+
+// DropTailはキューが一杯になったときだけ新しいパケットを破棄する。
+type DropTail struct{}
+
+func (DropTail) Admit(queueLen, capacity int, _ float64) (bool, DropReason) {
+	if queueLen >= capacity {
+		return false, DropQueueFull
+	}
+	return true, ""
+}
+
+// REDはキュー長に応じた確率でパケットを早期に破棄する簡易版のRandom Early Detectionを表す。
+// キュー長がMinThreshold未満なら受け入れ、MaxThreshold以上なら破棄し、
+// その間は0からMaxProbまで線形に増える確率で破棄する。
+type RED struct {
+	MinThreshold int     // 早期破棄を始めるキュー長
+	MaxThreshold int     // 全て破棄するキュー長（0ならキューの最大長）
+	MaxProb      float64 // MaxThreshold直前での破棄確率
+}
+
+func (r RED) Admit(queueLen, capacity int, rnd float64) (bool, DropReason) {
+	if queueLen >= capacity {
+		return false, DropQueueFull
+	}
+	maxTh := r.MaxThreshold
+	if maxTh == 0 || maxTh > capacity {
+		maxTh = capacity
+	}
+	switch {
+	case queueLen < r.MinThreshold:
+		return true, ""
+	case queueLen >= maxTh:
+		return false, DropEarly
+	}
+	prob := r.MaxProb * float64(queueLen-r.MinThreshold) / float64(maxTh-r.MinThreshold)
+	if rnd < prob {
+		return false, DropEarly
+	}
+	return true, ""
+}
+
+// enqueueは回線が空いていればすぐに送出し、送出中なら受け入れ方式に従ってキューに入れる。
+func (l *Link) enqueue(p Packet) error {
+	if !l.busy {
+		l.startSending(p)
+		return nil
+	}
+	discipline := l.Discipline
+	if discipline == nil {
+		discipline = DropTail{}
+	}
+	queued := l.queueLen()
+	ok, reason := discipline.Admit(queued, l.QueueSize, l.randFloat())
+	if !ok && reason == DropQueueFull && l.Preempt && l.preempt(p) {
+		ok, queued = true, queued-1
+	}
+	if !ok {
+		l.Stats.countDrop(reason)
+		l.Network.recordTrace(p, l.Name(), TraceDrop)
+		l.Network.log().Warnf("リンク: %s から %s へのキュー (%d/%d) でパケットを破棄 (%s): %s", l.From.GetName(), l.To.GetName(), queued, l.QueueSize, reason, p)
+		return dropError(l.Name(), reason)
+	}
+	if l.queue == nil {
+		l.queue = make([][]Packet, max(l.Bands, 1))
+	}
+	band := min(max(p.Priority, 0), len(l.queue)-1)
+	l.queue[band] = append(l.queue[band], p.Clone()) // 待機中に送信元がデータやMetaを書き換えても影響しない
+	l.Network.log().Debugf("リンク: %s から %s へのキュー %d で待機 (%d/%d)%s", l.From.GetName(), l.To.GetName(), band, queued+1, l.QueueSize, p.traceTag())
+	return nil
+}
+
+// preemptはキューで待機中のパケットのうちpより優先度が低く、その中で最も優先度が低いものを破棄する。
+// 同じ優先度のパケットが複数あれば最後にキューに入ったものを選ぶ。破棄できるパケットがなければfalseを返す。
+func (l *Link) preempt(p Packet) bool {
+	victimBand, victimIdx := -1, -1
+	for band, q := range l.queue {
+		for i, queued := range q {
+			if queued.Priority >= p.Priority {
+				continue
+			}
+			if victimBand < 0 || queued.Priority <= l.queue[victimBand][victimIdx].Priority {
+				victimBand, victimIdx = band, i
+			}
+		}
+	}
+	if victimBand < 0 {
+		return false
+	}
+	victim := l.queue[victimBand][victimIdx]
+	l.queue[victimBand] = append(l.queue[victimBand][:victimIdx], l.queue[victimBand][victimIdx+1:]...)
+	l.Stats.countDrop(DropPreempted)
+	l.Network.recordTrace(victim, l.Name(), TraceDrop)
+	l.Network.log().Warnf("リンク: %s から %s へのキューで優先度 %d のパケットのために優先度 %d のパケットを破棄: %s", l.From.GetName(), l.To.GetName(), p.Priority, victim.Priority, victim)
+	return true
+}
+
+// queueLenは全ての優先度のキューで待機中のパケット数を返す。
+func (l *Link) queueLen() int {
+	n := 0
+	for _, q := range l.queue {
+		n += len(q)
+	}
+	return n
+}
+
+// startSendingはパケットを送出し、送出し終わるまで回線を使用中にする。
+func (l *Link) startSending(p Packet) {
+	l.busy = true
+	_ = l.send(p)
+	l.Network.Bus.AddEvent(l.SerializationDelay(p), l.wireFree)
+}
+
+// wireFreeは回線が空いたときに、キューの先頭のパケットの送出を始める。
+// リンクがダウンしていれば送信待ちのパケットは保持したまま送出せず、アップしたときにresumeで再開する。
+func (l *Link) wireFree() {
+	l.busy = false
+	if l.removed {
+		for _, q := range l.queue {
+			for _, p := range q {
+				l.Stats.countDrop(DropLinkRemoved)
+				l.Network.recordTrace(p, l.Name(), TraceDrop)
+			}
+		}
+		l.queue = nil
+		return
+	}
+	if !l.Up {
+		return
+	}
+	l.sendNext()
+}
+
+// resumeはリンクがアップしたときに、ダウン中に保持していた送信待ちのパケットの送出を再開する。
+func (l *Link) resume() {
+	if !l.busy && !l.removed {
+		l.sendNext()
+	}
+}
+
+// sendNextはスケジューラが選んだキューの先頭のパケットの送出を始める（キューが空なら何もしない）。
+func (l *Link) sendNext() {
+	if l.queueLen() == 0 {
+		return
+	}
+	scheduler := l.Scheduler
+	if scheduler == nil {
+		scheduler = StrictPriority{}
+	}
+	backlog := make([]int, len(l.queue))
+	for i, q := range l.queue {
+		backlog[i] = len(q)
+	}
+	band := scheduler.Select(backlog)
+	next := l.queue[band][0]
+	l.queue[band] = l.queue[band][1:]
+	l.startSending(next)
+}
+
+// Schedulerは優先度別のキューのうち、次にパケットを送出するものを選ぶ。
+type Scheduler interface {
+	// Selectはキューごとの待機パケット数backlog（添字が大きいほど優先）から、
+	// 次に送出するキューの添字を返す。少なくとも1つのキューは空でない。
+	Select(backlog []int) int
+}
+
+// StrictPriorityは常に空でない最も優先度の高いキューから送出する。
+// 高優先度のパケットが続くと低優先度のパケットは送出されない。
+type StrictPriority struct{}
+
+func (StrictPriority) Select(backlog []int) int {
+	for band := len(backlog) - 1; band > 0; band-- {
+		if backlog[band] > 0 {
+			return band
+		}
+	}
+	return 0
+}
+
+// WeightedRoundRobinは優先度の高いキューから順に、重みの数だけ送出しては次のキューへ移る。
+// 低優先度のキューにも必ず順番が回るため、厳密な優先度で起こる飢餓を防げる。
+type WeightedRoundRobin struct {
+	Weights []int // キューごとに1巡で送出する最大パケット数（添字はキューと同じ、未設定や0以下は1）
+
+	band   int  // 現在送出しているキュー
+	served int  // 現在のキューでこの巡に送出した数
+	active bool // 巡回を始めていればtrue
+}
+
+func (w *WeightedRoundRobin) Select(backlog []int) int {
+	if !w.active || w.band >= len(backlog) {
+		w.band, w.served, w.active = len(backlog)-1, 0, true
+	}
+	for range 2 * len(backlog) {
+		if backlog[w.band] > 0 && w.served < w.weight(w.band) {
+			w.served++
+			return w.band
+		}
+		w.band, w.served = (w.band+len(backlog)-1)%len(backlog), 0
+	}
+	return w.band
+}
+
+// weightはキューの重みを返す（未設定なら1）。
+func (w *WeightedRoundRobin) weight(band int) int {
+	if band < len(w.Weights) && w.Weights[band] > 0 {
+		return w.Weights[band]
+	}
+	return 1
+}
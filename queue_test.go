@@ -0,0 +1,217 @@
+package main
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+	"time"
+)
+
+// arrivalsはホストに届いたパケットと、その到着時刻を記録する。
+type arrivals struct {
+	packets []Packet
+	at      []time.Duration
+}
+
+// newTestQueuedLinkはAからBへ直結した1msの遅延のリンクに、帯域幅bandwidthと長さqueueSizeのキューを設定する。
+func newTestQueuedLink(t *testing.T, bandwidth int64, queueSize int) (*Network, *Link, *arrivals) {
+	n := newTestNetwork(t)
+	a := newTestHost("A", "AA:AA:AA:AA:AA:01", "10.0.0.1")
+	b := newTestHost("B", "AA:AA:AA:AA:AA:02", "10.0.0.2")
+	n.AddDevice(a)
+	n.AddDevice(b)
+	ab, _ := n.AddBidirectionalLink(a, b, time.Millisecond)
+	ab.Bandwidth, ab.QueueSize = bandwidth, queueSize
+	return n, ab, recordArrivals(n, b)
+}
+
+// recordArrivalsはhに届いたパケットを記録するarrivalsを返す。
+func recordArrivals(n *Network, h *Host) *arrivals {
+	got := &arrivals{}
+	h.OnReceive = func(p Packet) {
+		got.packets = append(got.packets, p)
+		got.at = append(got.at, elapsed(n))
+	}
+	return got
+}
+
+// queuedPacketはBに届くdataバイトのパケットを作る。
+func queuedPacket(data int, seq int) Packet {
+	return Packet{SrcIP: "10.0.0.1", DstIP: "10.0.0.2", SrcMAC: "AA:AA:AA:AA:AA:01", DstMAC: "AA:AA:AA:AA:AA:02", Data: make([]byte, data), Seq: seq}
+}
+
+func TestQueueHoldsPacketsWhileLinkDown(t *testing.T) {
+	n, ab, got := newTestQueuedLink(t, 100_000, 5) // 125バイトの送出に10ms
+	for seq := 1; seq <= 3; seq++ {
+		if err := ab.Transmit(queuedPacket(125, seq)); err != nil {
+			t.Fatalf("Transmit %d: %v", seq, err)
+		}
+	}
+	n.ScheduleLinkState(ab.From, ab.To, 5*time.Millisecond, false)
+	n.ScheduleLinkState(ab.From, ab.To, 50*time.Millisecond, true)
+	runBus(t, n)
+
+	if ab.Stats.Dropped[DropLinkDown] != 1 {
+		t.Errorf("ダウン中に届いたパケットの破棄 = %d, 期待値 1", ab.Stats.Dropped[DropLinkDown])
+	}
+	wantAt := []time.Duration{61 * time.Millisecond, 71 * time.Millisecond}
+	if len(got.packets) != len(wantAt) {
+		t.Fatalf("届いたパケット = %d, 期待値 %d", len(got.packets), len(wantAt))
+	}
+	for i, p := range got.packets {
+		if p.Seq != i+2 {
+			t.Errorf("%d番目に届いたパケットのSeq = %d, 期待値 %d", i, p.Seq, i+2)
+		}
+		if got.at[i] != wantAt[i] {
+			t.Errorf("Seq %d の到着時刻 = %v, 期待値 %v", p.Seq, got.at[i], wantAt[i])
+		}
+	}
+}
+
+func TestQueueDropTail(t *testing.T) {
+	n, ab, got := newTestQueuedLink(t, 100_000, 2) // 125バイトの送出に10ms
+	for seq := 1; seq <= 5; seq++ {
+		ab.Transmit(queuedPacket(125, seq))
+	}
+	n.Bus.Run()
+	// 1つ目はすぐに送出し、2つをキューに入れ、残りの2つを破棄する
+	if ab.Stats.Dropped[DropQueueFull] != 2 {
+		t.Errorf("キューが一杯による破棄 = %d, 期待値 2", ab.Stats.Dropped[DropQueueFull])
+	}
+	if len(got.packets) != 3 {
+		t.Fatalf("届いたパケット = %d, 期待値 3", len(got.packets))
+	}
+	for i, p := range got.packets {
+		if p.Seq != i+1 {
+			t.Errorf("%d番目に届いたパケットのSeq = %d, 期待値 %d", i, p.Seq, i+1)
+		}
+		if want := time.Duration(i+1)*10*time.Millisecond + time.Millisecond; got.at[i] != want {
+			t.Errorf("Seq %d の到着時刻 = %v, 期待値 %v", p.Seq, got.at[i], want)
+		}
+	}
+}
+
+func TestREDAdmit(t *testing.T) {
+	red := RED{MinThreshold: 2, MaxThreshold: 6, MaxProb: 0.5}
+	tests := []struct {
+		queueLen int
+		rnd      float64
+		ok       bool
+		reason   DropReason
+	}{
+		{1, 0, true, ""},                 // MinThreshold未満は必ず受け入れる
+		{4, 0.24, false, DropEarly},      // (4-2)/(6-2)*0.5 = 0.25 の確率で破棄
+		{4, 0.26, true, ""},              // 乱数が確率以上なら受け入れる
+		{6, 0.99, false, DropEarly},      // MaxThreshold以上は全て破棄
+		{10, 0.99, false, DropQueueFull}, // キューが一杯
+	}
+	for _, tt := range tests {
+		ok, reason := red.Admit(tt.queueLen, 10, tt.rnd)
+		if ok != tt.ok || reason != tt.reason {
+			t.Errorf("Admit(%d, 10, %v) = %v %q, 期待値 %v %q", tt.queueLen, tt.rnd, ok, reason, tt.ok, tt.reason)
+		}
+	}
+}
+
+func TestQueueREDDropsEarly(t *testing.T) {
+	n, ab, got := newTestQueuedLink(t, 100_000, 10)
+	ab.Discipline = RED{MinThreshold: 2, MaxThreshold: 5, MaxProb: 0.5}
+	ab.Rand = rand.New(rand.NewSource(1))
+	for seq := 1; seq <= 20; seq++ {
+		ab.Transmit(queuedPacket(125, seq))
+	}
+	n.Bus.Run()
+	early := ab.Stats.Dropped[DropEarly]
+	if early == 0 || ab.Stats.Dropped[DropQueueFull] != 0 {
+		t.Errorf("早期破棄 = %d, キューが一杯による破棄 = %d, 期待値 1以上と0", early, ab.Stats.Dropped[DropQueueFull])
+	}
+	if len(got.packets)+early != 20 {
+		t.Errorf("届いたパケット %d と早期破棄 %d の合計が20にならない", len(got.packets), early)
+	}
+	if len(got.packets) > 1+5 { // 送出中の1つと、MaxThresholdまでのキュー
+		t.Errorf("届いたパケット = %d, 期待値 6以下", len(got.packets))
+	}
+	for i := 1; i < len(got.at); i++ {
+		if gap := got.at[i] - got.at[i-1]; gap != 10*time.Millisecond {
+			t.Errorf("到着間隔 = %v, 期待値 10ms（1つずつシリアライズする）", gap)
+		}
+	}
+}
+
+// priorityOrderは2つの優先度別のキューを持つリンクで、先頭の1つを送出している間に
+// 低優先度と高優先度のパケットをcount個ずつ交互にキューに入れ、先頭以降に届いた順の優先度を返す。
+func priorityOrder(t *testing.T, scheduler Scheduler, count int) []int {
+	n, ab, got := newTestQueuedLink(t, 100_000, 2*count) // 125バイトの送出に10ms
+	ab.Bands, ab.Scheduler = 2, scheduler
+	ab.Transmit(queuedPacket(125, 0))
+	for i := 1; i <= count; i++ {
+		high := queuedPacket(125, count+i)
+		high.Priority = 1
+		ab.Transmit(queuedPacket(125, i))
+		ab.Transmit(high)
+	}
+	runBus(t, n)
+	if len(got.packets) != 2*count+1 {
+		t.Fatalf("届いたパケット = %d, 期待値 %d", len(got.packets), 2*count+1)
+	}
+	var order []int
+	for _, p := range got.packets[1:] {
+		order = append(order, p.Priority)
+	}
+	return order
+}
+
+func TestQueueStrictPriority(t *testing.T) {
+	want := []int{1, 1, 1, 1, 0, 0, 0, 0}
+	if got := priorityOrder(t, nil, 4); !slices.Equal(got, want) {
+		t.Errorf("送出した優先度の順 = %v, 期待値 %v", got, want)
+	}
+}
+
+func TestQueueWeightedRoundRobin(t *testing.T) {
+	// 重み3:1で高優先度を3つ送るごとに低優先度を1つ送り、高優先度が尽きたら残りを送る
+	want := []int{1, 1, 1, 0, 1, 1, 1, 0, 1, 1, 0, 0, 0, 0, 0, 0}
+	if got := priorityOrder(t, &WeightedRoundRobin{Weights: []int{1, 3}}, 8); !slices.Equal(got, want) {
+		t.Errorf("送出した優先度の順 = %v, 期待値 %v", got, want)
+	}
+}
+
+func TestQueuePreemption(t *testing.T) {
+	tests := []struct {
+		name    string
+		preempt bool
+		want    []int // 届く順のSeq
+		dropped DropReason
+	}{
+		{"優先度の高いパケットが低いパケットを押し出す", true, []int{0, 3, 1}, DropPreempted},
+		{"押し出さなければ優先度の高いパケットを破棄", false, []int{0, 1, 2}, DropQueueFull},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, ab, got := newTestQueuedLink(t, 100_000, 2) // 125バイトの送出に10ms
+			ab.Bands, ab.Preempt = 2, tt.preempt
+			for seq := 0; seq <= 2; seq++ { // 0は送出中、1と2がキューで待機
+				if err := ab.Transmit(queuedPacket(125, seq)); err != nil {
+					t.Fatalf("Transmit %d: %v", seq, err)
+				}
+			}
+			high := queuedPacket(125, 3)
+			high.Priority = 1
+			err := ab.Transmit(high)
+			if (err == nil) != tt.preempt {
+				t.Errorf("優先度の高いパケットのTransmit = %v", err)
+			}
+			runBus(t, n)
+			var order []int
+			for _, p := range got.packets {
+				order = append(order, p.Seq)
+			}
+			if !slices.Equal(order, tt.want) {
+				t.Errorf("届いた順 = %v, 期待値 %v", order, tt.want)
+			}
+			if d := ab.Stats.Dropped[tt.dropped]; d != 1 {
+				t.Errorf("%s = %d, 期待値 1", tt.dropped, d)
+			}
+		})
+	}
+}
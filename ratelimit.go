@@ -0,0 +1,77 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// RateLimitModeはトークンバケットの予算を超えたパケットの扱いを表す。
+type RateLimitMode int
+
+const (
+	RateLimitDelay RateLimitMode = iota // 予算がたまるまで遅らせてから通す（シェーピング）
+	RateLimitDrop                       // その場で破棄する（ポリシング）
+)
+
+// TokenBucketはトークンバケットによる送受信レートの制限を表す。
+// ホストのNIC、ルータのInterface、スイッチのSwitchPortにインターフェースごとに設定する。
+// バケットはBurstバイトで満杯の状態から始まり、Rateの速さでトークンがたまる。
+// パケットはデータのバイト数だけトークンを使い、足りなければModeに従って遅らせるか破棄する。
+type TokenBucket struct {
+	Rate  int64         // トークンがたまる速さ（bps、0以下なら制限しない）
+	Burst int           // バケットの容量（バイト、一度に通せる最大のデータ量）
+	Mode  RateLimitMode // 予算を超えたパケットの扱い
+
+	tokens  float64   // 残りのトークン（バイト、遅らせたパケットの分だけ負になる）
+	last    time.Time // 最後にトークンを補充した仮想時刻
+	started bool      // 最初のパケットを処理済みならtrue
+}
+
+// NewTokenBucketはrate（bps）とburst（バイト）で制限するトークンバケットを作成。
+func NewTokenBucket(rate int64, burst int, mode RateLimitMode) *TokenBucket {
+	return &TokenBucket{Rate: rate, Burst: burst, Mode: mode}
+}
+
+// admitはpを通すまでに待つ時間を返す。RateLimitDropで予算が足りなければ破棄として記録して*DropErrorを返す。
+// バケットがnilかRateが0以下なら常にすぐに通す。
+func (tb *TokenBucket) admit(n *Network, stats *Stats, who string, p Packet) (time.Duration, error) {
+	if tb == nil || tb.Rate <= 0 || n == nil {
+		return 0, nil
+	}
+	now := n.Bus.Now()
+	if !tb.started {
+		tb.tokens, tb.last, tb.started = float64(tb.Burst), now, true
+	}
+	bytesPerSec := float64(tb.Rate) / 8
+	tb.tokens = math.Min(float64(tb.Burst), tb.tokens+now.Sub(tb.last).Seconds()*bytesPerSec)
+	tb.last = now
+	size := float64(len(p.Data))
+	if tb.tokens >= size {
+		tb.tokens -= size
+		return 0, nil
+	}
+	if tb.Mode == RateLimitDrop {
+		stats.countDrop(DropRateLimit)
+		n.log().Warnf("%s: 送受信レートの制限を超えたためパケットを破棄 (残り %.0f バイト)%s", who, tb.tokens, p.traceTag())
+		return 0, dropError(who, DropRateLimit)
+	}
+	wait := time.Duration((size - tb.tokens) / bytesPerSec * float64(time.Second))
+	tb.tokens -= size
+	n.log().Debugf("%s: 送受信レートの制限により %v 遅らせる%s", who, wait, p.traceTag())
+	return wait, nil
+}
+
+// transmitはtbの制限に従ってパケットをリンクlへ送出する。予算を超えた場合は制限の方式に従って
+// 送出を遅らせるか破棄する。whoとstatsは破棄を記録するデバイスの名前と統計。
+func (tb *TokenBucket) transmit(n *Network, stats *Stats, who string, l *Link, p Packet) error {
+	delay, err := tb.admit(n, stats, who, p)
+	if err != nil {
+		return err
+	}
+	if delay > 0 {
+		p = p.Clone() // 送出を待つ間に送信元がデータやMetaを書き換えても影響しない
+		n.Bus.AddEvent(delay, func() { l.Transmit(p) })
+		return nil
+	}
+	return l.Transmit(p)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+// sendBurstはAからBへ100バイトのパケットをcount個、同じ時刻に送る。
+func sendBurst(a, b *Host, count int) {
+	for seq := 1; seq <= count; seq++ {
+		p := lanPacket(a, b, string(make([]byte, 100)))
+		p.Seq = seq
+		a.SendPacket(p)
+	}
+}
+
+func TestRateLimitPerInterfacePolicing(t *testing.T) {
+	// 1000バイト/秒、バースト300バイトのバケットは100バイトのパケットを3つまで通す
+	limit := func() *TokenBucket { return NewTokenBucket(8_000, 300, RateLimitDrop) }
+	tests := []struct {
+		name  string
+		setup func(n *Network, a, b *Host, s *Switch) *Stats // 制限を設定し、破棄を記録する統計を返す
+	}{
+		{"ホストの送信", func(n *Network, a, b *Host, s *Switch) *Stats {
+			a.OutLimit = limit()
+			return &a.Stats
+		}},
+		{"スイッチのポートの受信", func(n *Network, a, b *Host, s *Switch) *Stats {
+			s.PortTo(a).InLimit = limit()
+			return &s.Stats
+		}},
+		{"スイッチのポートの送信", func(n *Network, a, b *Host, s *Switch) *Stats {
+			s.PortTo(b).OutLimit = limit()
+			return &s.Stats
+		}},
+		{"ホストの受信", func(n *Network, a, b *Host, s *Switch) *Stats {
+			b.InLimit = limit()
+			return &b.Stats
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, a, b, s := newTestLAN(t)
+			skipAnnounce(a, b)
+			b.SendPacket(lanPacket(b, a, "learn")) // スイッチにBのポートを学習させる
+			runBus(t, n)
+			stats := tt.setup(n, a, b, s)
+			got := recordArrivals(n, b)
+			sendBurst(a, b, 10)
+			runBus(t, n)
+			var seqs []int
+			for _, p := range got.packets {
+				seqs = append(seqs, p.Seq)
+			}
+			if !slices.Equal(seqs, []int{1, 2, 3}) {
+				t.Errorf("届いたパケット = %v, 期待値 [1 2 3]", seqs)
+			}
+			if d := stats.Dropped[DropRateLimit]; d != 7 {
+				t.Errorf("%s = %d, 期待値 7", DropRateLimit, d)
+			}
+
+			// 1秒で1000バイト分のトークンがたまるが、バケットの容量の300バイトまでしか通さない
+			n.Bus.AddEvent(time.Second, func() { sendBurst(a, b, 10) })
+			runBus(t, n)
+			if len(got.packets) != 6 {
+				t.Errorf("1秒後までに届いたパケット = %d, 期待値 6", len(got.packets))
+			}
+		})
+	}
+}
+
+func TestRateLimitRouterInterfaceShaping(t *testing.T) {
+	n, a, b, r := newTestRoutedNet(t)
+	skipAnnounce(a, b)
+	a.Send("203.0.113.1", []byte("warm up")) // ARPを解決しておく
+	runBus(t, n)
+	start := elapsed(n)
+	r.Interfaces[1].OutLimit = NewTokenBucket(8_000, 100, RateLimitDelay) // 100バイトごとに100ms待つ
+	got := recordArrivals(n, b)
+	for i := 0; i < 4; i++ {
+		a.Send("203.0.113.1", make([]byte, 100))
+	}
+	runBus(t, n)
+	var at []time.Duration
+	for _, d := range got.at {
+		at = append(at, d-start)
+	}
+	want := []time.Duration{2 * time.Millisecond, 102 * time.Millisecond, 202 * time.Millisecond, 302 * time.Millisecond}
+	if !slices.Equal(at, want) {
+		t.Errorf("到着時刻 = %v, 期待値 %v", at, want)
+	}
+	if len(r.Stats.Dropped) != 0 {
+		t.Errorf("遅らせるだけの制限で破棄した: %v", r.Stats.Dropped)
+	}
+}
+
+func TestRateLimitRouterInterfaceIngress(t *testing.T) {
+	n, a, b, r := newTestRoutedNet(t)
+	skipAnnounce(a, b)
+	a.Send("203.0.113.1", []byte("warm up"))
+	runBus(t, n)
+	r.Interfaces[0].InLimit = NewTokenBucket(8_000, 200, RateLimitDrop)
+	got := recordArrivals(n, b)
+	for i := 1; i <= 5; i++ {
+		a.Send("203.0.113.1", []byte(fmt.Sprintf("%099d", i)))
+	}
+	b.Send("10.0.0.1", make([]byte, 100)) // 逆方向のインターフェースは制限しない
+	runBus(t, n)
+	if len(got.packets) != 2 || r.Stats.Dropped[DropRateLimit] != 3 {
+		t.Errorf("届いたパケット = %d, 破棄 = %d, 期待値 2と3", len(got.packets), r.Stats.Dropped[DropRateLimit])
+	}
+}
+
+func TestRateLimitPerNIC(t *testing.T) {
+	n, h, a, b := newTestMultihomed(t)
+	h.NICs[0].OutLimit = NewTokenBucket(8_000, 0, RateLimitDrop) // eth1だけ全て破棄する
+	gotA, gotB := record(a), record(b)
+	h.Send("10.0.0.2", []byte("eth0"))
+	err := h.Send("192.168.1.2", []byte("eth1"))
+	runBus(t, n)
+	if len(gotA.in) != 1 {
+		t.Errorf("eth0からAに届いたパケット = %d, 期待値 1", len(gotA.in))
+	}
+	if len(gotB.in) != 0 || h.Stats.Dropped[DropRateLimit] == 0 {
+		t.Errorf("eth1からBに届いたパケット = %d, 破棄 = %d, Send = %v", len(gotB.in), h.Stats.Dropped[DropRateLimit], err)
+	}
+}
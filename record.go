@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"strconv"
+	"time"
+)
+
+// RecordActionは記録した操作の種類を表す。
+type RecordAction string
+
+const (
+	RecordSeed        RecordAction = "seed"         // リンクの乱数の種を設定（Devicesは送信元と宛先、Valueは種）
+	RecordSend        RecordAction = "send"         // ホストがデータを送信（Devicesは送信元、Valueは宛先IP）
+	RecordLinkState   RecordAction = "link_state"   // リンクの状態を変更（Devicesは送信元と宛先、Valueはonかoff）
+	RecordDeviceState RecordAction = "device_state" // デバイスの電源を変更（Devicesは対象、Valueはonかoff）
+)
+
+// Recordはシミュレーション中に外から加えた操作1つを表す。デバイスは名前で記録するため、
+// 同じトポロジーを組み立て直したネットワークでReplayLogに渡せば同じ操作を再現できる。
+type Record struct {
+	At      time.Duration `json:"at"`                // 記録を始めてからの仮想時間
+	Action  RecordAction  `json:"action"`            // 操作の種類
+	Devices []string      `json:"devices,omitempty"` // 操作に関わるデバイスの名前
+	Value   string        `json:"value,omitempty"`   // 操作の引数（宛先IP、状態、乱数の種）
+	Data    []byte        `json:"data,omitempty"`    // 送信したデータ
+}
+
+// recordingは記録中の操作を保持する。
+type recording struct {
+	start   time.Time // 記録を始めた仮想時刻
+	records []Record  // 記録した操作（時刻順）
+}
+
+// StartRecordingは操作の記録を始める。記録するのはホストのSend（TrafficGeneratorやSendByIPを含む）、
+// SetLinkState（ScheduleLinkStateやFlapLinkを含む）、SetDeviceStateで、それらが引き起こす転送やARPなどは
+// 再生時に同じように起こるため記録しない。ロスや揺らぎを再現できるよう、全てのリンクの乱数源を
+// seedから作った乱数源に置き換え、その種も記録する。
+//
+// AddEventに渡す処理は任意の関数で書き出せないため、AddEvent自体は記録しない。イベントから上の操作を
+// 呼べば記録されるが、それ以外は再生されない。再生されない主なものは次のとおり。
+//   - Ping、Traceroute、TCPLayer.DialやTCPConn.Write、直接のSendPacketで送ったパケット
+//   - OnReceiveなどのコールバックから送ったパケット（受信から再生時にも同じように送られる）
+//   - Linkのフィールド（DelayやLossRateなど）の直接の変更、記録中のリンクやデバイスの追加と削除
+//   - StartRIP、StartAging、AddPeriodicなどで登録した定期的な処理。再生するネットワークを組み立てるときに
+//     記録時と同じように開始すれば同じ時刻に動く
+func (n *Network) StartRecording(seed int64) {
+	n.recording = &recording{start: n.Bus.Now()}
+	for i, l := range n.Links {
+		s := seed + int64(i)
+		l.Rand = rand.New(rand.NewSource(s))
+		n.record(Record{Action: RecordSeed, Devices: []string{l.From.GetName(), l.To.GetName()}, Value: strconv.FormatInt(s, 10)})
+	}
+	n.log().Infof("[Record] 操作の記録を開始 (乱数の種 %d)", seed)
+}
+
+// StopRecordingは記録を止め、記録した操作を返す。
+func (n *Network) StopRecording() []Record {
+	if n.recording == nil {
+		return nil
+	}
+	records := n.recording.records
+	n.recording = nil
+	n.log().Infof("[Record] 操作の記録を終了: %d 件", len(records))
+	return records
+}
+
+// recordは記録中なら操作を現在の時刻で記録する。ホストが受信したパケットの処理中
+// （OnReceiveやTCPのOnDataなどのコールバック）の操作は、再生時に受信から同じように起こるため記録しない。
+func (n *Network) record(r Record) {
+	if n == nil || n.recording == nil || n.receiving > 0 {
+		return
+	}
+	r.At = n.Bus.Now().Sub(n.recording.start)
+	n.recording.records = append(n.recording.records, r)
+}
+
+// ReplayLogは記録した操作を、同じトポロジーを新しく組み立てたネットワークnで再生する。
+// 乱数の種はすぐに設定し、それ以外の操作は現在の時刻から記録と同じ時間後に実行してイベントバスを最後まで進める。
+// 記録にあるデバイスやリンクがnに見つからない場合、何も実行せずにエラーを返す。
+func ReplayLog(n *Network, log []Record) error {
+	actions := make([]func(), len(log))
+	for i, r := range log {
+		action, err := n.replayAction(r)
+		if err != nil {
+			return fmt.Errorf("記録 %d (%s): %w", i, r.Action, err)
+		}
+		actions[i] = action
+	}
+	for i, r := range log {
+		if r.Action == RecordSeed {
+			actions[i]()
+			continue
+		}
+		n.Bus.AddEvent(r.At, actions[i])
+	}
+	n.log().Infof("[Record] %d 件の操作を再生", len(log))
+	return n.Bus.Run()
+}
+
+// replayActionは記録した操作を実行する関数を作る。
+func (n *Network) replayAction(r Record) (func(), error) {
+	devices := make([]Device, len(r.Devices))
+	for i, name := range r.Devices {
+		if devices[i] = n.DeviceByName(name); devices[i] == nil {
+			return nil, fmt.Errorf("デバイス %q が存在しません", name)
+		}
+	}
+	need := map[RecordAction]int{RecordSeed: 2, RecordSend: 1, RecordLinkState: 2, RecordDeviceState: 1}
+	count, known := need[r.Action]
+	if !known {
+		return nil, fmt.Errorf("不明な操作です")
+	}
+	if len(devices) != count {
+		return nil, fmt.Errorf("デバイスの数 %d が不正です", len(devices))
+	}
+	switch r.Action {
+	case RecordSeed:
+		seed, err := strconv.ParseInt(r.Value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("乱数の種 %q が不正です", r.Value)
+		}
+		l := n.linkIndex[[2]Device{devices[0], devices[1]}]
+		if l == nil {
+			return nil, fmt.Errorf("リンク %s -> %s が存在しません", r.Devices[0], r.Devices[1])
+		}
+		return func() { l.Rand = rand.New(rand.NewSource(seed)) }, nil
+	case RecordSend:
+		h, ok := devices[0].(*Host)
+		if !ok {
+			return nil, fmt.Errorf("%s はホストではありません", r.Devices[0])
+		}
+		data := append([]byte(nil), r.Data...)
+		return func() { h.Send(r.Value, data) }, nil
+	case RecordLinkState:
+		if n.linkIndex[[2]Device{devices[0], devices[1]}] == nil {
+			return nil, fmt.Errorf("リンク %s -> %s が存在しません", r.Devices[0], r.Devices[1])
+		}
+		return func() { n.SetLinkState(devices[0], devices[1], r.Value == "on") }, nil
+	default:
+		return func() { n.SetDeviceState(devices[0], r.Value == "on") }, nil
+	}
+}
+
+// onOffは状態を記録用の文字列にする。
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
+
+// WriteRecordsは記録した操作を1行に1件のJSONとしてwへ書き出す。
+func WriteRecords(w io.Writer, log []Record) error {
+	enc := json.NewEncoder(w)
+	for _, r := range log {
+		if err := enc.Encode(r); err != nil {
+			return fmt.Errorf("記録の書き出しに失敗: %w", err)
+		}
+	}
+	return nil
+}
+
+// ReadRecordsはWriteRecordsで書き出した記録を読み込む。
+func ReadRecords(r io.Reader) ([]Record, error) {
+	var log []Record
+	dec := json.NewDecoder(r)
+	for dec.More() {
+		var rec Record
+		if err := dec.Decode(&rec); err != nil {
+			return nil, fmt.Errorf("記録 %d の読み込みに失敗: %w", len(log), err)
+		}
+		log = append(log, rec)
+	}
+	return log, nil
+}
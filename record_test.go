@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+// recordScenarioはBがAから受信するたびにOnReceiveから返信するLANで、Aの送信とリンクの切断を行う。
+// A->Sのリンクには揺らぎがあり、到着時刻は乱数の種で決まる。全てのホストに届いたパケットを記録する
+// Collectorを返し、recordがtrueなら操作を記録して返す。
+func recordScenario(t *testing.T, n *Network, a, b *Host, record bool) ([]Record, *Collector) {
+	b.OnReceive = func(p Packet) {
+		if p.SrcIP == "10.0.0.1" {
+			b.Send("10.0.0.1", []byte("reply"))
+		}
+	}
+	n.GetLink(a, a.ConnectedDev).Jitter = 500 * time.Microsecond
+	delivered := NewCollector()
+	delivered.AttachNetwork(n)
+	if !record {
+		return nil, delivered
+	}
+	n.StartRecording(1)
+	a.Send("10.0.0.2", []byte("first"))
+	n.Bus.AddEvent(10*time.Millisecond, func() { a.Send("10.0.0.2", []byte("second")) })
+	n.Bus.AddEvent(20*time.Millisecond, func() { n.SetLinkState(a, a.ConnectedDev, false) })
+	n.Bus.AddEvent(30*time.Millisecond, func() { a.Send("10.0.0.2", []byte("lost")) })
+	runBus(t, n)
+	return n.StopRecording(), delivered
+}
+
+// deliveryLogはCollectorが記録したパケットを、届いた時刻、アドレス、データの文字列にして返す。
+func deliveryLog(c *Collector) []string {
+	var out []string
+	for _, p := range c.Received() {
+		out = append(out, fmt.Sprintf("%v %s(%s) -> %s(%s) %q", p.ReceivedAt.Sub(SimulationEpoch), p.SrcIP, p.SrcMAC, p.DstIP, p.DstMAC, p.Data))
+	}
+	return out
+}
+
+func TestRecordSkipsSendsFromCallbacks(t *testing.T) {
+	n, a, b, _ := newTestLAN(t)
+	log, _ := recordScenario(t, n, a, b, true)
+	sends := 0
+	for _, r := range log {
+		if r.Action == RecordSend {
+			sends++
+			if r.Devices[0] != "A" {
+				t.Errorf("OnReceiveからの送信を記録: %+v", r)
+			}
+		}
+	}
+	if sends != 3 {
+		t.Errorf("記録した送信 = %d, 期待値 3", sends)
+	}
+}
+
+func TestReplayLogMatchesLiveRun(t *testing.T) {
+	live, a, b, _ := newTestLAN(t)
+	log, liveDelivered := recordScenario(t, live, a, b, true)
+
+	var buf bytes.Buffer
+	if err := WriteRecords(&buf, log); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadRecords(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replay, ra, rb, _ := newTestLAN(t)
+	_, replayDelivered := recordScenario(t, replay, ra, rb, false)
+	if err := ReplayLog(replay, read); err != nil {
+		t.Fatalf("ReplayLog: %v", err)
+	}
+	want := deliveryLog(liveDelivered)
+	if len(want) != 4 {
+		t.Fatalf("記録時に届いたパケット = %d, 期待値 4（ダウン後の送信は届かない）: %v", len(want), want)
+	}
+	if got := deliveryLog(replayDelivered); !slices.Equal(got, want) {
+		t.Errorf("再生時に届いたパケットが記録時と異なる:\n got  %v\n want %v", got, want)
+	}
+	if got, want := replay.Stats(), live.Stats(); !reflect.DeepEqual(got, want) {
+		t.Errorf("再生後の統計が記録時と異なる:\n got  %+v\n want %+v", got, want)
+	}
+}
+
+func TestReplayLogUnknownDevice(t *testing.T) {
+	n, _, _, _ := newTestLAN(t)
+	err := ReplayLog(n, []Record{{Action: RecordSend, Devices: []string{"X"}, Value: "10.0.0.2"}})
+	if err == nil {
+		t.Fatal("存在しないデバイスの記録でエラーにならない")
+	}
+	if n.Bus.PendingCount() != 0 {
+		t.Errorf("エラー時にイベントを追加した: %d 個", n.Bus.PendingCount())
+	}
+}
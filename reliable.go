@@ -0,0 +1,143 @@
+package main
+
+import (
+	"time"
+)
+
+// Flagはパケットの制御フラグを表す。
+type Flag int
+
+const (
+	FlagACK Flag = 1 << iota // 確認応答
+	FlagSYN                  // コネクションの確立要求（TCPLayerが使う）
+)
+
+const (
+	DefaultRetransmitTimeout = time.Second // ACKを待つ既定の時間
+	DefaultMaxRetries        = 3           // 既定の最大再送回数
+)
+
+// pendingSendはACK待ちの送信パケットを表す。
+type pendingSend struct {
+	packet  Packet      // 再送に使う送信パケット
+	retries int         // これまでの再送回数
+	timer   EventHandle // ACK待ちのタイムアウトイベント
+}
+
+// deliveredKeyは受信済みのパケットを送信元とシーケンス番号で識別する。
+type deliveredKey struct {
+	SrcIP string
+	Seq   int
+}
+
+// ReliableLayerはシーケンス番号とACK、再送で信頼性のある配送を行う層を表す。
+// 重複を除いた受信パケットはOnDeliverに渡される。
+type ReliableLayer struct {
+	Name       string         // 層の名前（デバッグ用）
+	Timeout    time.Duration  // ACKを待つ時間（0なら既定値）
+	MaxRetries int            // 最大再送回数（0なら既定値）
+	OnDeliver  func(p Packet) // 重複を除いた受信パケットを受け取るコールバック
+
+	Retransmits int // 再送した回数
+	Delivered   int // OnDeliverへ渡したパケット数
+
+	nextSeq   int                   // 最後に割り当てたシーケンス番号
+	pending   map[int]*pendingSend  // ACK待ちの送信パケット
+	delivered map[deliveredKey]bool // 受信済みのシーケンス番号
+	hostRef
+}
+
+// HandleOutgoingは新しい送信パケットにシーケンス番号を割り当て、ACK待ちにする。
+// ACKや再送のパケットはそのまま通す。
+func (rl *ReliableLayer) HandleOutgoing(p Packet) Packet {
+	if p.Flags&FlagACK != 0 || p.Seq != 0 {
+		return p
+	}
+	rl.nextSeq++
+	p.Seq = rl.nextSeq
+	if rl.pending == nil {
+		rl.pending = make(map[int]*pendingSend)
+	}
+	ps := &pendingSend{packet: p}
+	rl.pending[p.Seq] = ps
+	rl.startTimer(ps)
+	rl.log().Debugf("[Reliable] %s: シーケンス %d を送信", rl.Name, p.Seq)
+	return p
+}
+
+// HandleIncomingはACKを受け取ってACK待ちを解除し、データにはACKを返して重複を除いて配送する。
+// 受信済みのデータは破棄し、上位層へ渡さない。
+func (rl *ReliableLayer) HandleIncoming(p Packet) (Packet, bool) {
+	if rl.host == nil || !rl.host.addressedToMe(p) {
+		return p, true
+	}
+	if p.Flags&FlagACK != 0 {
+		if ps, ok := rl.pending[p.Ack]; ok {
+			rl.host.Network.Bus.Cancel(ps.timer)
+			delete(rl.pending, p.Ack)
+			rl.log().Debugf("[Reliable] %s: シーケンス %d のACKを受信", rl.Name, p.Ack)
+		}
+		return p, true
+	}
+	if p.Seq == 0 {
+		return p, true
+	}
+	rl.host.SendPacket(Packet{
+		DstIP:    p.SrcIP,
+		DstMAC:   p.SrcMAC,
+		SrcPort:  p.DstPort,
+		DstPort:  p.SrcPort,
+		Protocol: p.Protocol,
+		Flags:    FlagACK,
+		Ack:      p.Seq,
+	})
+	key := deliveredKey{SrcIP: p.SrcIP, Seq: p.Seq}
+	if rl.delivered[key] {
+		rl.log().Debugf("[Reliable] %s: %s からのシーケンス %d は受信済みのため破棄", rl.Name, p.SrcIP, p.Seq)
+		return p, false
+	}
+	if rl.delivered == nil {
+		rl.delivered = make(map[deliveredKey]bool)
+	}
+	rl.delivered[key] = true
+	rl.Delivered++
+	if rl.OnDeliver != nil {
+		rl.OnDeliver(p)
+	}
+	return p, true
+}
+
+// startTimerはACK待ちのタイムアウトを登録し、期限までにACKがなければ再送する。
+func (rl *ReliableLayer) startTimer(ps *pendingSend) {
+	if rl.host == nil || rl.host.Network == nil {
+		return
+	}
+	timeout := rl.Timeout
+	if timeout == 0 {
+		timeout = DefaultRetransmitTimeout
+	}
+	ps.timer = rl.host.Network.Bus.AddEvent(timeout, func() {
+		seq := ps.packet.Seq
+		if rl.pending[seq] != ps {
+			return
+		}
+		maxRetries := rl.MaxRetries
+		if maxRetries == 0 {
+			maxRetries = DefaultMaxRetries
+		}
+		if ps.retries >= maxRetries {
+			delete(rl.pending, seq)
+			rl.log().Warnf("[Reliable] %s: シーケンス %d は %d 回再送してもACKがないため送信を中止", rl.Name, seq, ps.retries)
+			return
+		}
+		ps.retries++
+		rl.Retransmits++
+		rl.log().Debugf("[Reliable] %s: シーケンス %d を再送 (%d 回目)", rl.Name, seq, ps.retries)
+		rl.startTimer(ps)
+		rl.host.SendPacket(ps.packet)
+	})
+}
+
+func (rl *ReliableLayer) GetName() string {
+	return rl.Name
+}
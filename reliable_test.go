@@ -0,0 +1,65 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// newTestReliableLANはnewTestLANの両ホストにReliableLayerを積み、互いのMACを学習済みにする。
+func newTestReliableLAN(t *testing.T) (*Network, *Host, *Host, *Switch, *ReliableLayer, *ReliableLayer) {
+	n, a, b, s := newTestLAN(t)
+	ra := &ReliableLayer{Name: "Reliable", Timeout: 100 * time.Millisecond, MaxRetries: 10}
+	rb := &ReliableLayer{Name: "Reliable", Timeout: 100 * time.Millisecond, MaxRetries: 10}
+	for _, pair := range []struct {
+		h  *Host
+		rl *ReliableLayer
+	}{{a, ra}, {b, rb}} {
+		pair.h.Layers = append(pair.h.Layers, pair.rl)
+		pair.rl.bindHost(pair.h)
+	}
+	skipAnnounce(a, b)
+	a.networkLayer().learnARP("10.0.0.2", "AA:AA:AA:AA:AA:02")
+	b.networkLayer().learnARP("10.0.0.1", "AA:AA:AA:AA:AA:01")
+	return n, a, b, s, ra, rb
+}
+
+func TestReliableOverLossyLink(t *testing.T) {
+	n, a, _, s, ra, rb := newTestReliableLAN(t)
+	as := n.GetLink(a, s)
+	as.LossRate = 0.5
+	as.Rand = rand.New(rand.NewSource(9))
+	var got []Packet
+	rb.OnDeliver = func(p Packet) { got = append(got, p) }
+	a.Send("10.0.0.2", []byte("important"))
+	n.Bus.Run()
+	if rb.Delivered != 1 || len(got) != 1 || string(got[0].Data) != "important" {
+		t.Fatalf("配送したパケット = %d (%v), 期待値 1", rb.Delivered, got)
+	}
+	lost := as.Stats.Dropped[DropLoss]
+	if ra.Retransmits != lost || lost != 2 { // シード9では最初の2回が失われる
+		t.Errorf("再送回数 = %d, ロス = %d, 期待値 2", ra.Retransmits, lost)
+	}
+	if len(ra.pending) != 0 {
+		t.Error("ACKを受け取った後もACK待ちが残っている")
+	}
+}
+
+func TestReliableDeduplicates(t *testing.T) {
+	n, a, b, s, ra, rb := newTestReliableLAN(t)
+	bs := n.GetLink(b, s)
+	bs.LossRate = 1 // ACKが全て失われる
+	delivered := 0
+	rb.OnDeliver = func(Packet) { delivered++ }
+	a.Send("10.0.0.2", []byte("once"))
+	n.Bus.Run()
+	if ra.Retransmits != 10 {
+		t.Errorf("再送回数 = %d, 期待値 10", ra.Retransmits)
+	}
+	if rb.Delivered != 1 || delivered != 1 {
+		t.Errorf("重複を除いて配送したパケット = %d, OnDeliverの呼び出し = %d, 期待値 1", rb.Delivered, delivered)
+	}
+	if b.Stats.Received != 11 {
+		t.Errorf("Bが受信したパケット = %d, 期待値 11（初回と再送10回）", b.Stats.Received)
+	}
+}
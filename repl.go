@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Interpreterは1行に1つのコマンドでネットワークを組み立て、シミュレーションを進める。
+// 使えるコマンドは次の通り。空行と「#」で始まる行は無視する。
+//
+//	add host 名前 IP MAC [サブネットマスク [ゲートウェイ]]
+//	add switch|router|hub 名前
+//	link 名前 名前 遅延 [帯域幅(bps)]
+//	routes
+//	send 名前 宛先IP "データ"
+//	ping 名前 宛先IP [回数]
+//	run [時間]
+//	stats
+//	verbose on|off
+type Interpreter struct {
+	Network *Network  // コマンドで操作するネットワーク
+	Out     io.Writer // コマンドの結果とエラーの出力先
+}
+
+// NewInterpreterはnを操作し、結果をoutへ書き出すインタープリタを作成。
+func NewInterpreter(n *Network, out io.Writer) *Interpreter {
+	return &Interpreter{Network: n, Out: out}
+}
+
+// Runはrから1行ずつコマンドを読んで実行する。失敗したコマンドは行番号付きでOutに報告して次の行へ進み、
+// 全ての失敗をまとめたエラーを返す（全て成功すればnil）。
+func (in *Interpreter) Run(r io.Reader) error {
+	var errs []error
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		if err := in.Exec(scanner.Text()); err != nil {
+			err = fmt.Errorf("行 %d: %w", lineNo, err)
+			fmt.Fprintln(in.Out, err)
+			errs = append(errs, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		errs = append(errs, fmt.Errorf("コマンドの読み込みに失敗: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// Execは1行のコマンドを実行する。
+func (in *Interpreter) Exec(line string) error {
+	args, err := splitCommand(line)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 || strings.HasPrefix(args[0], "#") {
+		return nil
+	}
+	n := in.Network
+	switch cmd, args := args[0], args[1:]; cmd {
+	case "add":
+		if len(args) < 2 {
+			return fmt.Errorf("使い方: add 種類 名前 ...")
+		}
+		if n.DeviceByName(args[1]) != nil {
+			return fmt.Errorf("デバイス名 %q が重複しています", args[1])
+		}
+		dc := DeviceConfig{Type: args[0], Name: args[1]}
+		if dc.Type == "host" {
+			if len(args) < 4 || len(args) > 6 {
+				return fmt.Errorf("使い方: add host 名前 IP MAC [サブネットマスク [ゲートウェイ]]")
+			}
+			dc.IP, dc.MAC = args[2], args[3]
+			if len(args) > 4 {
+				dc.SubnetMask = args[4]
+			}
+			if len(args) > 5 {
+				dc.Gateway = args[5]
+			}
+		} else if len(args) != 2 {
+			return fmt.Errorf("使い方: add %s 名前", dc.Type)
+		}
+		d, err := dc.newDevice()
+		if err != nil {
+			return err
+		}
+		n.AddDevice(d)
+	case "link":
+		if len(args) < 3 || len(args) > 4 {
+			return fmt.Errorf("使い方: link 名前 名前 遅延 [帯域幅]")
+		}
+		a, b := n.DeviceByName(args[0]), n.DeviceByName(args[1])
+		if a == nil || b == nil {
+			return fmt.Errorf("デバイス %q または %q が存在しません", args[0], args[1])
+		}
+		delay, err := time.ParseDuration(args[2])
+		if err != nil {
+			return fmt.Errorf("遅延 %q が不正です: %w", args[2], err)
+		}
+		var bandwidth int64
+		if len(args) == 4 {
+			if bandwidth, err = strconv.ParseInt(args[3], 10, 64); err != nil {
+				return fmt.Errorf("帯域幅 %q が不正です: %w", args[3], err)
+			}
+		}
+		ab, ba := n.AddBidirectionalLink(a, b, delay)
+		ab.Bandwidth, ba.Bandwidth = bandwidth, bandwidth
+	case "routes":
+		n.ComputeRoutes()
+	case "send":
+		if len(args) != 3 {
+			return fmt.Errorf("使い方: send 名前 宛先IP \"データ\"")
+		}
+		h, err := in.host(args[0])
+		if err != nil {
+			return err
+		}
+		return n.SendByIP(h, args[1], []byte(args[2]))
+	case "ping":
+		if len(args) < 2 || len(args) > 3 {
+			return fmt.Errorf("使い方: ping 名前 宛先IP [回数]")
+		}
+		h, err := in.host(args[0])
+		if err != nil {
+			return err
+		}
+		count := 1
+		if len(args) == 3 {
+			if count, err = strconv.Atoi(args[2]); err != nil {
+				return fmt.Errorf("回数 %q が不正です: %w", args[2], err)
+			}
+		}
+		result, err := n.Ping(h, args[1], count)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(in.Out, "%s -> %s: %d 送信, %d 受信, 平均RTT %v\n", h.Name, args[1], result.Sent, result.Received, result.AvgRTT)
+	case "run":
+		switch len(args) {
+		case 0:
+			return n.Bus.Run()
+		case 1:
+			d, err := time.ParseDuration(args[0])
+			if err != nil {
+				return fmt.Errorf("時間 %q が不正です: %w", args[0], err)
+			}
+			return n.Bus.RunUntil(n.Bus.Now().Add(d))
+		default:
+			return fmt.Errorf("使い方: run [時間]")
+		}
+	case "verbose":
+		if len(args) != 1 || (args[0] != "on" && args[0] != "off") {
+			return fmt.Errorf("使い方: verbose on|off")
+		}
+		n.SetVerbose(args[0] == "on")
+	case "stats":
+		stats := n.Stats()
+		for _, d := range n.Devices {
+			fmt.Fprintf(in.Out, "%s: %+v\n", d.GetName(), stats[d.GetName()])
+		}
+	default:
+		return fmt.Errorf("不明なコマンド %q", cmd)
+	}
+	return nil
+}
+
+// runScriptはpathのファイル（"-"なら標準入力）のコマンドを新しいネットワークで実行する。
+func runScript(path string) error {
+	r := io.Reader(os.Stdin)
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "コマンドファイルを開けません: %v\n", err)
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	return NewInterpreter(NewNetwork(), os.Stdout).Run(r)
+}
+
+// hostは名前でホストを探す。
+func (in *Interpreter) host(name string) (*Host, error) {
+	h, ok := in.Network.DeviceByName(name).(*Host)
+	if !ok {
+		return nil, fmt.Errorf("ホスト %q が存在しません", name)
+	}
+	return h, nil
+}
+
+// splitCommandは行を空白で区切り、二重引用符で囲まれた部分はGoの文字列リテラルとして1つの引数にする。
+func splitCommand(line string) ([]string, error) {
+	var args []string
+	rest := strings.TrimSpace(line)
+	for rest != "" {
+		if rest[0] == '"' {
+			end, escaped := 1, false
+			for ; end < len(rest); end++ {
+				if escaped {
+					escaped = false
+				} else if rest[end] == '\\' {
+					escaped = true
+				} else if rest[end] == '"' {
+					break
+				}
+			}
+			if end == len(rest) {
+				return nil, fmt.Errorf("引用符が閉じられていません: %s", rest)
+			}
+			arg, err := strconv.Unquote(rest[:end+1])
+			if err != nil {
+				return nil, fmt.Errorf("不正な文字列 %s: %w", rest[:end+1], err)
+			}
+			args = append(args, arg)
+			rest = strings.TrimSpace(rest[end+1:])
+			continue
+		}
+		end := strings.IndexAny(rest, " \t")
+		if end < 0 {
+			end = len(rest)
+		}
+		args = append(args, rest[:end])
+		rest = strings.TrimSpace(rest[end:])
+	}
+	return args, nil
+}
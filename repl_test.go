@@ -0,0 +1,120 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestInterpreterScript(t *testing.T) {
+	n := newTestNetwork(t)
+	var out strings.Builder
+	script := `# スイッチにホストを2台つなぐ
+add host A 10.0.0.1 AA:AA:AA:AA:AA:01
+add host B 10.0.0.2 AA:AA:AA:AA:AA:02
+add switch S
+
+link A S 1ms
+link B S 1ms 1000000
+send A 10.0.0.2 "hello world"
+run
+ping A 10.0.0.2 2
+stats
+`
+	if err := NewInterpreter(n, &out).Run(strings.NewReader(script)); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(n.Devices) != 3 || len(n.Links) != 4 {
+		t.Fatalf("デバイス %d, リンク %d, 期待値 3, 4", len(n.Devices), len(n.Links))
+	}
+	if bs := n.GetLink(n.DeviceByName("B"), n.DeviceByName("S")); bs == nil || bs.Bandwidth != 1000000 {
+		t.Errorf("B->S のリンク = %+v, 期待値 帯域幅 1000000", bs)
+	}
+	b := n.DeviceByName("B").(*Host)
+	if b.Stats.BytesReceived < int64(len("hello world")) {
+		t.Errorf("Bが受信したバイト数 = %d, 期待値 %d以上", b.Stats.BytesReceived, len("hello world"))
+	}
+	// 帯域幅のあるB->Sの送出時間を含む平均RTTと、デバイスを追加した順の統計
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 4 || lines[0] != "A -> 10.0.0.2: 2 送信, 2 受信, 平均RTT 4.896ms" {
+		t.Fatalf("出力 = %q", out.String())
+	}
+	for i, name := range []string{"A", "B", "S"} {
+		if !strings.HasPrefix(lines[i+1], name+": {Sent:") {
+			t.Errorf("統計の%d行目 = %q, 期待値 %s の統計", i+1, lines[i+1], name)
+		}
+	}
+}
+
+func TestInterpreterErrors(t *testing.T) {
+	tests := []struct {
+		line string
+		want string // エラーメッセージに含まれる文字列
+	}{
+		{"jump A", "不明なコマンド"},
+		{"add host C 10.0.0.3", "使い方: add host"},
+		{"add switch S", "重複"},
+		{"add router R extra", "使い方: add router"},
+		{"add bridge X", "bridge"},
+		{"link A X 1ms", "存在しません"},
+		{"link A S fast", "遅延"},
+		{"link A S 1ms wide", "帯域幅"},
+		{"send S 10.0.0.2 hi", "ホスト \"S\" が存在しません"},
+		{"send A 10.0.0.2", "使い方: send"},
+		{"ping A 10.0.0.2 many", "回数"},
+		{"run soon", "時間"},
+		{"run 1s 2s", "使い方: run"},
+		{"verbose maybe", "使い方: verbose"},
+		{`send A 10.0.0.2 "unterminated`, "引用符"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			n := newTestNetwork(t)
+			in := NewInterpreter(n, &strings.Builder{})
+			for _, line := range []string{"add host A 10.0.0.1 AA:AA:AA:AA:AA:01", "add switch S"} {
+				if err := in.Exec(line); err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := in.Exec(tt.line)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("エラー = %v, 期待値 %q を含むエラー", err, tt.want)
+			}
+			if len(n.Devices) != 2 || len(n.Links) != 0 {
+				t.Errorf("失敗したコマンドでネットワークが変わった: デバイス %d, リンク %d", len(n.Devices), len(n.Links))
+			}
+		})
+	}
+}
+
+func TestInterpreterRunContinuesAfterError(t *testing.T) {
+	n := newTestNetwork(t)
+	var out strings.Builder
+	script := "add host A 10.0.0.1 AA:AA:AA:AA:AA:01\nbogus\nadd switch S\nlink A S\n"
+	err := NewInterpreter(n, &out).Run(strings.NewReader(script))
+	if err == nil {
+		t.Fatal("失敗したコマンドがあるのにエラーにならない")
+	}
+	for _, want := range []string{"行 2: 不明なコマンド \"bogus\"", "行 4: 使い方: link"} {
+		if !strings.Contains(err.Error(), want) || !strings.Contains(out.String(), want) {
+			t.Errorf("エラー = %q, 出力 = %q, 期待値 %q を含む", err, out.String(), want)
+		}
+	}
+	if n.DeviceByName("S") == nil {
+		t.Error("失敗した行の後のコマンドが実行されていない")
+	}
+}
+
+func TestSplitCommand(t *testing.T) {
+	got, err := splitCommand(`  send A  10.0.0.2 "hello \"world\"\n" tail`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"send", "A", "10.0.0.2", "hello \"world\"\n", "tail"}
+	if !slices.Equal(got, want) {
+		t.Errorf("splitCommand = %q, 期待値 %q", got, want)
+	}
+	if _, err := splitCommand(`send A 10.0.0.2 "bad \q"`); err == nil {
+		t.Error("不正なエスケープでエラーにならない")
+	}
+}
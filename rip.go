@@ -0,0 +1,135 @@
+package main
+
+import (
+	"net"
+	"time"
+)
+
+const (
+	DefaultRIPInterval  = 30 * time.Second // 経路を広告する既定の間隔
+	RIPInfinity         = 16               // 到達不能を表すホップ数
+	RIPPort             = 520              // RIPの広告に使うUDPポート
+	RIPTimeoutIntervals = 6                // 学習元から広告が届かなくなってから経路を取り除くまでの広告間隔の数
+)
+
+// RIPEntryはRIPの広告に含まれる1つの宛先とホップ数を表す。
+type RIPEntry struct {
+	Destination net.IPNet // 宛先ネットワーク
+	Metric      int       // 広告したルータから宛先までのホップ数
+}
+
+// RIPMessageはルータが隣接ルータへ送る経路の広告を表す。
+type RIPMessage struct {
+	Entries []RIPEntry // 広告する経路
+}
+
+// StartRIPは全てのルータがinterval毎（0以下なら既定値）に直結サブネットとRIPで学習した経路を
+// 隣接ルータへ広告するようにする。最初の広告はすぐに行う。受け取ったルータはホップ数に1を足して
+// 経路表を更新し、スプリットホライズンにより学習元のルータへはその経路を広告しない。
+// 学習元からRIPTimeoutIntervals回分の間隔の間広告が届かなかった経路は取り除き、
+// 次の広告でホップ数をRIPInfinityとして隣接ルータへ取り消しを伝える。
+// 広告は止めるまで続くため、RunUntilで進めるか、返したハンドルをCancelで止める。
+func (n *Network) StartRIP(interval time.Duration) EventHandle {
+	if interval <= 0 {
+		interval = DefaultRIPInterval
+	}
+	round := func() {
+		expiry := n.Bus.Now().Add(-RIPTimeoutIntervals * interval)
+		for _, d := range n.Devices {
+			if r, ok := d.(*Router); ok && !r.poweredOff {
+				r.expireRIP(expiry)
+				r.advertiseRIP()
+			}
+		}
+	}
+	n.Bus.AddEvent(0, round)
+	return n.Bus.AddPeriodic(interval, round)
+}
+
+// expireRIPはexpiryより前から広告で確認できていないRIPの経路を取り除き、取り消しの広告に加える。
+func (r *Router) expireRIP(expiry time.Time) {
+	kept := r.Table.Routes[:0]
+	for _, route := range r.Table.Routes {
+		if route.RIP && route.Updated.Before(expiry) {
+			r.ripWithdrawn = append(r.ripWithdrawn, route.Destination)
+			r.Network.log().Infof("[RIP] %s: %s への経路の広告が途絶えたため削除", r.Name, route.Destination.String())
+			continue
+		}
+		kept = append(kept, route)
+	}
+	r.Table.Routes = kept
+}
+
+// advertiseRIPは直接リンクでつながった隣接ルータそれぞれへ、スプリットホライズンを適用した経路と
+// 取り消した宛先を送る。取り消しは一度だけ伝える。
+func (r *Router) advertiseRIP() {
+	defer func() { r.ripWithdrawn = nil }()
+	for _, l := range r.Network.Links {
+		neighbor, ok := l.To.(*Router)
+		if l.From != r || !ok || !l.Up {
+			continue
+		}
+		var entries []RIPEntry
+		for _, iface := range r.Interfaces {
+			entries = append(entries, RIPEntry{Destination: iface.Subnet, Metric: 0})
+		}
+		for _, route := range r.Table.Routes {
+			if route.RIP && route.NextHop != neighbor {
+				entries = append(entries, RIPEntry{Destination: route.Destination, Metric: route.Metric})
+			}
+		}
+		for _, dst := range r.ripWithdrawn {
+			entries = append(entries, RIPEntry{Destination: dst, Metric: RIPInfinity})
+		}
+		r.Network.log().Debugf("[RIP] %s: %s へ %d 個の経路を広告", r.Name, neighbor.Name, len(entries))
+		l.Transmit(Packet{
+			SrcIP:    r.sourceIP(),
+			DstMAC:   BroadcastMAC,
+			TTL:      1,
+			Protocol: ProtocolUDP,
+			SrcPort:  RIPPort,
+			DstPort:  RIPPort,
+			RIP:      &RIPMessage{Entries: entries},
+		})
+	}
+}
+
+// handleRIPは隣接ルータfromの広告で経路表を更新する。直結サブネットは更新しない。
+// 新しい宛先と、既存よりホップ数の少ない経路は採用し、学習元と同じルータからの広告は悪化していても反映する。
+// ホップ数がRIPInfinityに達した経路は取り除き、次の広告で隣接ルータへ取り消しを伝える。
+func (r *Router) handleRIP(from Device, msg *RIPMessage) {
+	now := r.Network.Bus.Now()
+	for _, e := range msg.Entries {
+		if r.connectedInterface(e.Destination.IP) != nil {
+			continue
+		}
+		metric := min(e.Metric+1, RIPInfinity)
+		i := r.Table.ripRoute(e.Destination)
+		switch {
+		case i < 0 && metric < RIPInfinity:
+			r.Table.Add(Route{Destination: e.Destination, NextHop: from, Metric: metric, RIP: true, Updated: now})
+			r.Network.log().Infof("[RIP] %s: %s への経路を学習 (次ホップ %s, %d ホップ)", r.Name, e.Destination.String(), from.GetName(), metric)
+		case i < 0:
+		case r.Table.Routes[i].NextHop == from && metric >= RIPInfinity:
+			r.Table.Routes = append(r.Table.Routes[:i], r.Table.Routes[i+1:]...)
+			r.ripWithdrawn = append(r.ripWithdrawn, e.Destination)
+			r.Network.log().Infof("[RIP] %s: %s への経路が到達不能になったため削除", r.Name, e.Destination.String())
+		case r.Table.Routes[i].NextHop == from || metric < r.Table.Routes[i].Metric:
+			r.Table.Routes[i].Updated = now
+			if old := r.Table.Routes[i]; old.NextHop != from || old.Metric != metric {
+				r.Table.Routes[i].NextHop, r.Table.Routes[i].Metric = from, metric
+				r.Network.log().Infof("[RIP] %s: %s への経路を更新 (次ホップ %s, %d ホップ)", r.Name, e.Destination.String(), from.GetName(), metric)
+			}
+		}
+	}
+}
+
+// ripRouteはRIPで学習した宛先ネットワークの経路の位置を返す（なければ-1）。
+func (rt *RoutingTable) ripRoute(dst net.IPNet) int {
+	for i, route := range rt.Routes {
+		if route.RIP && route.Destination.String() == dst.String() {
+			return i
+		}
+	}
+	return -1
+}
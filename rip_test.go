@@ -0,0 +1,125 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// newTestRIPChainはルータR1、R2、R3を1msのリンクで一列につなぐ。R1は10.1.0.0/24、R3は10.3.0.0/24の
+// サブネットを持ち、R1とR2は10.12.0.0/24、R2とR3は10.23.0.0/24で直結する。
+func newTestRIPChain(t *testing.T) (*Network, *Router, *Router, *Router) {
+	t.Helper()
+	n := newTestNetwork(t)
+	r1, r2, r3 := &Router{Name: "R1"}, &Router{Name: "R2"}, &Router{Name: "R3"}
+	for _, r := range []*Router{r1, r2, r3} {
+		n.AddDevice(r)
+	}
+	r1r2, r2r1 := n.AddBidirectionalLink(r1, r2, time.Millisecond)
+	r2r3, r3r2 := n.AddBidirectionalLink(r2, r3, time.Millisecond)
+	for _, c := range []struct {
+		r    *Router
+		cidr string
+		link *Link
+	}{
+		{r1, "10.1.0.254/24", nil},
+		{r1, "10.12.0.1/24", r1r2},
+		{r2, "10.12.0.2/24", r2r1},
+		{r2, "10.23.0.2/24", r2r3},
+		{r3, "10.23.0.3/24", r3r2},
+		{r3, "10.3.0.254/24", nil},
+	} {
+		if _, err := c.r.AddInterface(c.cidr, "", c.link); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return n, r1, r2, r3
+}
+
+// ripRouteToはrがRIPで学習したcidrへの経路を返す。
+func ripRouteTo(t *testing.T, r *Router, cidr string) (Route, bool) {
+	t.Helper()
+	_, dst, err := net.ParseCIDR(cidr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i := r.Table.ripRoute(*dst); i >= 0 {
+		return r.Table.Routes[i], true
+	}
+	return Route{}, false
+}
+
+// runForはイベントバスをdだけ進める。
+func runFor(t *testing.T, n *Network, d time.Duration) {
+	t.Helper()
+	if err := n.Bus.RunUntil(n.Bus.Now().Add(d)); err != nil {
+		t.Fatalf("RunUntil: %v", err)
+	}
+}
+
+func TestRIPConvergesOverThreeRouters(t *testing.T) {
+	n, r1, r2, r3 := newTestRIPChain(t)
+	n.StartRIP(time.Second)
+	runFor(t, n, 3*time.Second)
+	for _, c := range []struct {
+		r      *Router
+		cidr   string
+		next   *Router
+		metric int
+	}{
+		{r1, "10.23.0.0/24", r2, 1},
+		{r1, "10.3.0.0/24", r2, 2},
+		{r2, "10.1.0.0/24", r1, 1},
+		{r2, "10.3.0.0/24", r3, 1},
+		{r3, "10.12.0.0/24", r2, 1},
+		{r3, "10.1.0.0/24", r2, 2},
+	} {
+		route, ok := ripRouteTo(t, c.r, c.cidr)
+		if !ok || route.NextHop != c.next || route.Metric != c.metric {
+			t.Errorf("%s の %s への経路 = %+v (%v), 期待値 次ホップ %s, %d ホップ", c.r.Name, c.cidr, route, ok, c.next.Name, c.metric)
+		}
+	}
+	// 直結サブネットはRIPで学習しない
+	if _, ok := ripRouteTo(t, r2, "10.12.0.0/24"); ok {
+		t.Error("R2が直結サブネットをRIPで学習した")
+	}
+}
+
+func TestRIPWithdrawsOnLinkDown(t *testing.T) {
+	n, r1, r2, r3 := newTestRIPChain(t)
+	n.StartRIP(time.Second)
+	runFor(t, n, 3*time.Second)
+	n.SetLinkState(r2, r3, false)
+	n.SetLinkState(r3, r2, false)
+	if _, ok := ripRouteTo(t, r2, "10.3.0.0/24"); ok {
+		t.Error("リンクダウンの後もR2に10.3.0.0/24への経路が残っている")
+	}
+	// 次の広告でR2からR1へ取り消しが伝わる
+	runFor(t, n, time.Second)
+	if route, ok := ripRouteTo(t, r1, "10.3.0.0/24"); ok {
+		t.Errorf("取り消しの後もR1に経路が残っている: %+v", route)
+	}
+	if _, ok := ripRouteTo(t, r1, "10.23.0.0/24"); !ok {
+		t.Error("R2の直結サブネット10.23.0.0/24への経路まで取り除いた")
+	}
+	if _, ok := ripRouteTo(t, r3, "10.1.0.0/24"); ok {
+		t.Error("リンクダウンの後もR3に10.1.0.0/24への経路が残っている")
+	}
+}
+
+func TestRIPExpiresSilentNeighbor(t *testing.T) {
+	n, r1, r2, r3 := newTestRIPChain(t)
+	n.StartRIP(time.Second)
+	runFor(t, n, 3*time.Second)
+	n.SetDeviceState(r3, false) // R3は広告を止めるが、リンクはアップのまま
+	runFor(t, n, (RIPTimeoutIntervals-2)*time.Second)
+	if _, ok := ripRouteTo(t, r2, "10.3.0.0/24"); !ok {
+		t.Fatal("タイムアウトの前にR2の経路が取り除かれた")
+	}
+	runFor(t, n, 4*time.Second)
+	for _, r := range []*Router{r1, r2} {
+		if route, ok := ripRouteTo(t, r, "10.3.0.0/24"); ok {
+			t.Errorf("広告が途絶えた後も %s に経路が残っている: %+v", r.Name, route)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// recordLayerは通過したパケットを記録するだけの層。
+type recordLayer struct {
+	out, in []Packet
+}
+
+func (l *recordLayer) HandleOutgoing(p Packet) Packet { l.out = append(l.out, p); return p }
+func (l *recordLayer) HandleIncoming(p Packet) (Packet, bool) {
+	l.in = append(l.in, p)
+	return p, true
+}
+func (l *recordLayer) GetName() string { return "record" }
+
+// newTestRouterChainは名前の順にルータを並べ、各ルータに次のルータを経由してdstCIDRへ向かう経路を登録する。
+func newTestRouterChain(t *testing.T, dstCIDR string, names ...string) []*Router {
+	routers := make([]*Router, len(names))
+	for i, name := range names {
+		routers[i] = &Router{Name: name}
+		if i > 0 {
+			if err := routers[i-1].AddRoute(dstCIDR, routers[i], 1); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return routers
+}
+
+func TestTTLExpiresAtCorrectHop(t *testing.T) {
+	rs := newTestRouterChain(t, "10.9.9.0/24", "R1", "R2", "R3")
+	rs[0].SendPacket(Packet{DstIP: "10.9.9.9", TTL: 2})
+	if got := rs[1].Stats.Dropped[DropTTLExpired]; got != 1 {
+		t.Errorf("R2 のTTL切れによる破棄 = %d, 期待値 1", got)
+	}
+	if got := rs[0].Stats.Dropped[DropTTLExpired] + rs[2].Stats.Dropped[DropTTLExpired]; got != 0 {
+		t.Errorf("R1 と R3 でTTL切れ = %d, 期待値 0", got)
+	}
+	if rs[2].Stats.Received != 0 {
+		t.Errorf("R3 がTTL切れのパケットを受信した")
+	}
+}
+
+func TestTTLDecrementsPerHop(t *testing.T) {
+	rs := newTestRouterChain(t, "10.9.9.0/24", "R1", "R2")
+	rec := &recordLayer{}
+	dst := &Host{Name: "D", Layers: []Layer{rec}}
+	rs[1].AddRoute("10.9.9.0/24", dst, 1)
+	rs[0].SendPacket(Packet{DstIP: "10.9.9.9", TTL: 5})
+	if len(rec.in) != 1 || rec.in[0].TTL != 3 {
+		t.Errorf("届いたパケット = %v, TTL 3 の1個を期待", rec.in)
+	}
+}
+
+func TestTTLExpiresAtFirstRouter(t *testing.T) {
+	rs := newTestRouterChain(t, "10.9.9.0/24", "R1", "R2")
+	rs[0].SendPacket(Packet{DstIP: "10.9.9.9", TTL: 1})
+	if rs[0].Stats.Dropped[DropTTLExpired] != 1 || rs[1].Stats.Received != 0 {
+		t.Errorf("R1 のTTL切れ = %d, R2 の受信 = %d, 期待値 1 と 0", rs[0].Stats.Dropped[DropTTLExpired], rs[1].Stats.Received)
+	}
+}
+
+func TestRouterSendPacketDefaultTTL(t *testing.T) {
+	rs := newTestRouterChain(t, "10.9.9.0/24", "R1", "R2")
+	rec := &recordLayer{}
+	dst := &Host{Name: "D", Layers: []Layer{rec}}
+	rs[1].AddRoute("10.9.9.0/24", dst, 1)
+	if err := rs[0].SendPacket(Packet{DstIP: "10.9.9.9"}); err != nil {
+		t.Fatalf("TTL未設定のパケットを破棄: %v", err)
+	}
+	if len(rec.in) != 1 || rec.in[0].TTL != DefaultTTL-2 {
+		t.Errorf("届いたパケット = %v, TTL %d の1個を期待", rec.in, DefaultTTL-2)
+	}
+}
+
+func TestRouterDropsReceivedZeroTTL(t *testing.T) {
+	rs := newTestRouterChain(t, "10.9.9.0/24", "R1", "R2")
+	rs[0].ReceivePacket(Packet{DstIP: "10.9.9.9"}) // 受信したパケットのTTLは補わない
+	if rs[0].Stats.Dropped[DropTTLExpired] != 1 || rs[1].Stats.Received != 0 {
+		t.Errorf("R1 のTTL切れ = %d, R2 の受信 = %d, 期待値 1 と 0", rs[0].Stats.Dropped[DropTTLExpired], rs[1].Stats.Received)
+	}
+}
+
+func TestHostSetsDefaultTTL(t *testing.T) {
+	rec := &recordLayer{}
+	h := &Host{Name: "A", Layers: []Layer{rec}}
+	h.SendPacket(Packet{DstIP: "10.0.0.2"})
+	h.SendPacket(Packet{DstIP: "10.0.0.2", TTL: 7})
+	if len(rec.out) != 2 {
+		t.Fatalf("送信したパケット = %d, 期待値 2", len(rec.out))
+	}
+	if rec.out[0].TTL != DefaultTTL || rec.out[1].TTL != 7 {
+		t.Errorf("TTL = %d, %d, 期待値 %d, 7", rec.out[0].TTL, rec.out[1].TTL, DefaultTTL)
+	}
+}
+
+func TestRouterProcessingDelay(t *testing.T) {
+	arrival := func(delay time.Duration) time.Duration {
+		n, a, b, r := newTestRoutedNet(t)
+		r.ProcessingDelay = delay
+		got := record(b)
+		a.Send("203.0.113.1", []byte("hello"))
+		runBus(t, n)
+		if len(got.in) != 1 {
+			t.Fatalf("届いたパケット = %d, 期待値 1", len(got.in))
+		}
+		return got.in[0].ReceivedAt.Sub(SimulationEpoch)
+	}
+	// ARPには応答するだけで処理遅延はかからず、転送するデータだけが遅れる
+	if d := arrival(5*time.Millisecond) - arrival(0); d != 5*time.Millisecond {
+		t.Errorf("処理遅延による到着の遅れ = %v, 期待値 5ms", d)
+	}
+}
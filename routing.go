@@ -0,0 +1,249 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net"
+	"slices"
+	"time"
+)
+
+// Routeは経路表の1エントリを表す。
+type Route struct {
+	Destination net.IPNet // 宛先ネットワーク
+	NextHop     Device    // 次ホップのデバイス
+	Metric      int       // 経路のコスト（小さいほど優先）
+	Dynamic     bool      // ComputeRoutesが自動で追加した経路か
+	RIP         bool      // RIPで学習した経路か（Metricはホップ数）
+	Updated     time.Time // RIPの経路を最後に広告で確認した時刻
+}
+
+// RoutingTableはルータの経路表を表す。
+type RoutingTable struct {
+	Routes []Route // 登録された経路の一覧
+}
+
+// Addは経路表に経路を追加。
+func (rt *RoutingTable) Add(r Route) {
+	rt.Routes = append(rt.Routes, r)
+}
+
+// Lookupは宛先IPに最長一致する経路を返す。
+// プレフィックス長が同じ経路が複数ある場合はメトリックが小さい方を選ぶ。
+func (rt *RoutingTable) Lookup(ip net.IP) (Route, bool) {
+	var best Route
+	bestLen := -1
+	for _, r := range rt.Routes {
+		if !r.Destination.Contains(ip) {
+			continue
+		}
+		ones, _ := r.Destination.Mask.Size()
+		if ones > bestLen || (ones == bestLen && r.Metric < best.Metric) {
+			best = r
+			bestLen = ones
+		}
+	}
+	return best, bestLen >= 0
+}
+
+// removeDynamicはComputeRoutesが追加した経路を全て取り除く。
+func (rt *RoutingTable) removeDynamic() {
+	kept := rt.Routes[:0]
+	for _, r := range rt.Routes {
+		if !r.Dynamic {
+			kept = append(kept, r)
+		}
+	}
+	rt.Routes = kept
+}
+
+// ComputeRoutesはリンクの遅延を重みとしてダイクストラ法で最短経路を求め、
+// 全ルータの経路表に各ホストのIPアドレスへの経路（/32）を登録する。
+// 以前に自動で追加した経路は置き換えるため、トポロジーの変更後に再度呼び出せる。
+// 次ホップには経路上で最初に現れるルータまたはホストを使い、スイッチは経由するだけとする。
+// 遅延の等しい最短経路が複数あれば、次ホップごとに同じメトリックの経路を登録する（ECMP）。
+func (n *Network) ComputeRoutes() {
+	hosts := make(map[Device][]string)
+	for _, d := range n.Devices {
+		if h, ok := d.(*Host); ok {
+			for _, nic := range h.nics() {
+				if nl := nic.Network; nl != nil && net.ParseIP(nl.IP) != nil {
+					hosts[d] = append(hosts[d], nl.IP)
+				}
+			}
+		}
+	}
+	for _, d := range n.Devices {
+		r, ok := d.(*Router)
+		if !ok {
+			continue
+		}
+		r.Table.removeDynamic()
+		dist, prev := n.shortestPaths(r)
+		memo := make(map[Device][]Device)
+		for _, dst := range n.Devices {
+			ips, ok := hosts[dst]
+			if !ok {
+				continue
+			}
+			if _, reached := dist[dst]; !reached {
+				continue
+			}
+			for _, next := range n.nextHops(r, dst, prev, memo) {
+				for _, ip := range ips {
+					r.Table.Add(Route{
+						Destination: hostNet(ip),
+						NextHop:     next,
+						Metric:      int(dist[dst] / time.Microsecond),
+						Dynamic:     true,
+					})
+					n.log().Debugf("[Routing] %s: %s への経路 (次ホップ %s, 遅延 %v)", r.Name, ip, next.GetName(), dist[dst])
+				}
+			}
+		}
+	}
+}
+
+// nextHopsはsrcからdstへの最短経路それぞれで最初に現れるルータまたはホストを、デバイスの追加順で返す。
+func (n *Network) nextHops(src, dst Device, prev map[Device][]Device, memo map[Device][]Device) []Device {
+	if hops, ok := memo[dst]; ok {
+		return hops
+	}
+	found := make(map[Device]bool)
+	for _, u := range prev[dst] {
+		candidates := []Device{dst}
+		if u != src {
+			candidates = n.nextHops(src, u, prev, memo)
+		}
+		for _, c := range candidates {
+			if _, isSwitch := c.(*Switch); isSwitch {
+				c = dst // ここまでスイッチだけを経由しているので、dstが最初の候補になる
+			}
+			found[c] = true
+		}
+	}
+	var hops []Device
+	for _, d := range n.Devices {
+		if found[d] {
+			hops = append(hops, d)
+		}
+	}
+	memo[dst] = hops
+	return hops
+}
+
+// hostNetはIPアドレスだけを含むネットワーク（IPv4なら/32）を返す。
+func hostNet(addr string) net.IPNet {
+	ip := net.ParseIP(addr)
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	return net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)}
+}
+
+// shortestPathsはsrcから各デバイスへの最短の遅延と、最短経路上の直前のデバイス（等コストなら全て）を返す。
+// ホストはパケットを中継しないため、経路の途中には含めない。
+// 全域木でブロックされたスイッチのポートとダウンしているリンクは通らない。
+func (n *Network) shortestPaths(src Device) (map[Device]time.Duration, map[Device][]Device) {
+	dist := map[Device]time.Duration{src: 0}
+	prev := make(map[Device][]Device)
+	done := make(map[Device]bool)
+	for {
+		var u Device
+		for _, d := range n.Devices {
+			if best, ok := dist[d]; ok && !done[d] && (u == nil || best < dist[u]) {
+				u = d
+			}
+		}
+		if u == nil {
+			return dist, prev
+		}
+		done[u] = true
+		if _, isHost := u.(*Host); isHost && u != src {
+			continue
+		}
+		for _, l := range n.Links {
+			if l.From != u || done[l.To] || !l.Up {
+				continue
+			}
+			if s, ok := u.(*Switch); ok {
+				if port := s.PortTo(l.To); port != nil && port.Blocked {
+					continue
+				}
+			}
+			d, ok := dist[l.To]
+			switch cost := dist[u] + l.Delay; {
+			case !ok || cost < d:
+				dist[l.To] = cost
+				prev[l.To] = []Device{u}
+			case cost == d && !slices.Contains(prev[l.To], u):
+				prev[l.To] = append(prev[l.To], u)
+			}
+		}
+	}
+}
+
+// FindPathはリンクの向きに従った幅優先探索で、srcからdstまでのホップ数が最小のデバイスの並び
+// （srcとdstを含む）と、到達できるかどうかを返す。shortestPathsと同じく、ホストと
+// 全域木でブロックされたスイッチのポートは経路の途中に含めず、ダウンしているリンクは通らない。
+func (n *Network) FindPath(src, dst Device) ([]Device, bool) {
+	prev := map[Device]Device{src: nil}
+	queue := []Device{src}
+	for len(queue) > 0 {
+		u := queue[0]
+		queue = queue[1:]
+		if u == dst {
+			var path []Device
+			for d := dst; d != nil; d = prev[d] {
+				path = append(path, d)
+			}
+			slices.Reverse(path)
+			return path, true
+		}
+		if _, isHost := u.(*Host); isHost && u != src {
+			continue
+		}
+		for _, l := range n.Links {
+			if _, seen := prev[l.To]; l.From != u || seen || !l.Up {
+				continue
+			}
+			if s, ok := u.(*Switch); ok {
+				if port := s.PortTo(l.To); port != nil && port.Blocked {
+					continue
+				}
+			}
+			prev[l.To] = u
+			queue = append(queue, l.To)
+		}
+	}
+	return nil, false
+}
+
+// LookupAllは宛先IPに最長一致し、メトリックが最小の経路を全て返す（等コストの次ホップ）。
+func (rt *RoutingTable) LookupAll(ip net.IP) []Route {
+	best, ok := rt.Lookup(ip)
+	if !ok {
+		return nil
+	}
+	bestLen, _ := best.Destination.Mask.Size()
+	var routes []Route
+	for _, r := range rt.Routes {
+		ones, _ := r.Destination.Mask.Size()
+		if ones == bestLen && r.Metric == best.Metric && r.Destination.Contains(ip) {
+			routes = append(routes, r)
+		}
+	}
+	return routes
+}
+
+// flowHashはパケットの送信元・宛先のIPとポート、プロトコルからフローのハッシュ値を計算する。
+func flowHash(p Packet) uint32 {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%s|%s|%d|%d|%s", p.SrcIP, p.DstIP, p.SrcPort, p.DstPort, p.Proto())
+	return h.Sum32()
+}
+
+// selectRouteは等コストの経路からフローのハッシュ値で1つを選ぶ。同じフローは常に同じ経路を通る。
+func selectRoute(routes []Route, p Packet) Route {
+	return routes[flowHash(p)%uint32(len(routes))]
+}
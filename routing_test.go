@@ -0,0 +1,301 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"testing"
+	"time"
+)
+
+// mustCIDRはCIDR表記のネットワークを返す。
+func mustCIDR(t testing.TB, cidr string) net.IPNet {
+	t.Helper()
+	_, ipnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *ipnet
+}
+
+func TestRoutingTableLongestPrefixMatch(t *testing.T) {
+	wide, narrow, host, cheap := &Router{Name: "wide"}, &Router{Name: "narrow"}, &Router{Name: "host"}, &Router{Name: "cheap"}
+	var rt RoutingTable
+	rt.Add(Route{Destination: mustCIDR(t, "192.168.0.0/16"), NextHop: wide, Metric: 1})
+	rt.Add(Route{Destination: mustCIDR(t, "192.168.1.0/24"), NextHop: narrow, Metric: 10})
+	rt.Add(Route{Destination: mustCIDR(t, "192.168.1.7/32"), NextHop: host, Metric: 5})
+	rt.Add(Route{Destination: mustCIDR(t, "10.0.0.0/8"), NextHop: wide, Metric: 3})
+	rt.Add(Route{Destination: mustCIDR(t, "10.0.0.0/8"), NextHop: cheap, Metric: 2})
+
+	tests := []struct {
+		dst  string
+		want Device // nilなら一致する経路がない
+	}{
+		{"192.168.1.5", narrow}, // /16と/24の両方に一致するが、より長い/24を選ぶ
+		{"192.168.2.5", wide},
+		{"192.168.1.7", host},
+		{"192.168.1.8", narrow},
+		{"10.1.2.3", cheap}, // 同じ/8の経路ではメトリックの小さい方
+		{"172.16.0.1", nil},
+	}
+	for _, tt := range tests {
+		route, ok := rt.Lookup(net.ParseIP(tt.dst))
+		if tt.want == nil {
+			if ok {
+				t.Errorf("Lookup(%s) = %s, 経路なしを期待", tt.dst, route.NextHop.GetName())
+			}
+			continue
+		}
+		if !ok || route.NextHop != tt.want {
+			t.Errorf("Lookup(%s) = %v (ok=%v), 期待値 %s", tt.dst, route.Destination.String(), ok, tt.want.GetName())
+		}
+	}
+}
+
+func TestRouterForwardsByLongestPrefix(t *testing.T) {
+	r, wide, narrow := &Router{Name: "R"}, &Router{Name: "wide"}, &Router{Name: "narrow"}
+	if err := r.AddRoute("192.168.0.0/16", wide, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.AddRoute("192.168.1.0/24", narrow, 1); err != nil {
+		t.Fatal(err)
+	}
+	for _, dst := range []string{"192.168.1.5", "192.168.1.6", "192.168.200.1"} {
+		r.SendPacket(Packet{DstIP: dst, TTL: 8})
+	}
+	if got := narrow.Stats.Received; got != 2 {
+		t.Errorf("/24の次ホップへ送った数 = %d, 期待値 2", got)
+	}
+	if got := wide.Stats.Received; got != 1 {
+		t.Errorf("/16の次ホップへ送った数 = %d, 期待値 1", got)
+	}
+}
+
+func TestRouterNoRouteCountsDrop(t *testing.T) {
+	r, wide := &Router{Name: "R"}, &Router{Name: "wide"}
+	r.AddRoute("192.168.0.0/16", wide, 1)
+	r.SendPacket(Packet{DstIP: "172.16.0.1", TTL: 8})
+	r.SendPacket(Packet{DstIP: "not-an-ip", TTL: 8})
+	if r.Stats.Dropped[DropNoRoute] != 1 || r.Stats.Dropped[DropInvalidAddress] != 1 {
+		t.Errorf("破棄数 = %v, 経路なしと不正な宛先が1ずつを期待", r.Stats.Dropped)
+	}
+	if wide.Stats.Received != 0 {
+		t.Errorf("次ホップに届いた数 = %d, 期待値 0", wide.Stats.Received)
+	}
+	if err := r.AddRoute("not-a-cidr", wide, 1); err == nil {
+		t.Error("不正なCIDRでエラーにならない")
+	}
+}
+
+func TestRouterSetDefaultRoute(t *testing.T) {
+	r, wide, def, other := &Router{Name: "R"}, &Router{Name: "wide"}, &Router{Name: "default"}, &Router{Name: "other"}
+	r.AddRoute("192.168.0.0/16", wide, 1)
+	r.SetDefaultRoute(other)
+	r.SetDefaultRoute(def) // 2回目の設定は前のデフォルトルートを置き換える
+	if len(r.Table.Routes) != 2 {
+		t.Fatalf("経路表 = %v, 期待値は/16とデフォルトルートの2つ", r.Table.Routes)
+	}
+	for _, dst := range []string{"172.16.0.1", "8.8.8.8", "192.168.1.1"} {
+		if err := r.SendPacket(Packet{DstIP: dst, TTL: 8}); err != nil {
+			t.Errorf("SendPacket(%s): %v", dst, err)
+		}
+	}
+	if got := def.Stats.Received; got != 2 {
+		t.Errorf("デフォルトルートの次ホップへ送った数 = %d, 期待値 2", got)
+	}
+	if got := wide.Stats.Received; got != 1 {
+		t.Errorf("より具体的な/16の次ホップへ送った数 = %d, 期待値 1", got)
+	}
+	if other.Stats.Received != 0 || r.Stats.Dropped[DropNoRoute] != 0 {
+		t.Errorf("置き換えたデフォルトルートに届いた数 = %d, 経路なしの破棄 = %d", other.Stats.Received, r.Stats.Dropped[DropNoRoute])
+	}
+}
+
+func TestSetDefaultRouteForwardsToHost(t *testing.T) {
+	n, a, b, r1, r2 := newTestTwoRouterNet(t)
+	r1.Table.Routes = nil
+	r1.SetDefaultRoute(r2)
+	var got []Packet
+	b.OnReceive = func(p Packet) { got = append(got, p) }
+	a.Send("203.0.113.1", []byte("via default"))
+	runBus(t, n)
+	if len(got) != 1 || string(got[0].Data) != "via default" || got[0].TTL != DefaultTTL-2 {
+		t.Errorf("Bに届いたパケット = %v", got)
+	}
+}
+
+// newTestDiamondはホストHA・HBの間にR1からR2（各1ms）とR3（各10ms）を経由してR4へ至る菱形のネットワークを作る。
+func newTestDiamond(t *testing.T) (*Network, *Host, *Host, map[string]*Router) {
+	n := newTestNetwork(t)
+	ha := newTestHost("HA", "AA:AA:AA:AA:AA:01", "10.0.1.1")
+	hb := newTestHost("HB", "AA:AA:AA:AA:AA:02", "10.0.2.1")
+	rs := make(map[string]*Router)
+	for _, name := range []string{"R1", "R2", "R3", "R4"} {
+		rs[name] = &Router{Name: name}
+		n.AddDevice(rs[name])
+	}
+	n.AddDevice(ha)
+	n.AddDevice(hb)
+	n.AddBidirectionalLink(ha, rs["R1"], time.Millisecond)
+	n.AddBidirectionalLink(hb, rs["R4"], time.Millisecond)
+	n.AddBidirectionalLink(rs["R1"], rs["R2"], time.Millisecond)
+	n.AddBidirectionalLink(rs["R2"], rs["R4"], time.Millisecond)
+	n.AddBidirectionalLink(rs["R1"], rs["R3"], 10*time.Millisecond)
+	n.AddBidirectionalLink(rs["R3"], rs["R4"], 10*time.Millisecond)
+	return n, ha, hb, rs
+}
+
+// nextHopはルータの経路表でipへの次ホップの名前を返す（経路がなければ空）。
+func nextHop(r *Router, ip string) string {
+	route, ok := r.Table.Lookup(net.ParseIP(ip))
+	if !ok {
+		return ""
+	}
+	return route.NextHop.GetName()
+}
+
+func TestComputeRoutesDiamond(t *testing.T) {
+	n, ha, hb, rs := newTestDiamond(t)
+	n.ComputeRoutes()
+	tests := []struct {
+		router, ip, want string
+	}{
+		{"R1", "10.0.2.1", "R2"},
+		{"R2", "10.0.2.1", "R4"},
+		{"R4", "10.0.2.1", "HB"},
+		{"R4", "10.0.1.1", "R2"},
+		{"R2", "10.0.1.1", "R1"},
+		{"R1", "10.0.1.1", "HA"},
+		{"R3", "10.0.2.1", "R4"},
+	}
+	for _, tt := range tests {
+		if got := nextHop(rs[tt.router], tt.ip); got != tt.want {
+			t.Errorf("%s の %s への次ホップ = %q, 期待値 %s", tt.router, tt.ip, got, tt.want)
+		}
+	}
+
+	var got []Packet
+	var at time.Duration
+	hb.OnReceive = func(p Packet) {
+		got = append(got, p)
+		at = elapsed(n)
+	}
+	ha.SendPacket(lanPacket(ha, hb, "hello"))
+	n.Bus.Run()
+	if len(got) != 1 {
+		t.Fatalf("届いたパケット = %d, 期待値 1", len(got))
+	}
+	if rs["R2"].Stats.Received != 1 || rs["R3"].Stats.Received != 0 {
+		t.Errorf("R2 の受信 = %d, R3 の受信 = %d, 期待値 1 と 0", rs["R2"].Stats.Received, rs["R3"].Stats.Received)
+	}
+	if at != 4*time.Millisecond {
+		t.Errorf("遅延 = %v, 期待値 4ms", at)
+	}
+}
+
+func TestComputeRoutesAfterTopologyChange(t *testing.T) {
+	n, _, _, rs := newTestDiamond(t)
+	n.ComputeRoutes()
+	n.RemoveDevice(rs["R2"])
+	n.ComputeRoutes()
+	if got := nextHop(rs["R1"], "10.0.2.1"); got != "R3" {
+		t.Errorf("R2を削除した後のR1の次ホップ = %q, 期待値 R3", got)
+	}
+	for _, route := range rs["R1"].Table.Routes {
+		if route.NextHop == Device(rs["R2"]) {
+			t.Errorf("削除したR2への経路が残っている: %s", &route.Destination)
+		}
+	}
+}
+
+func TestComputeRoutesECMPSplitsFlows(t *testing.T) {
+	n, ha, hb, rs := newTestDiamond(t)
+	for _, pair := range [][2]Device{{rs["R1"], rs["R3"]}, {rs["R3"], rs["R1"]}, {rs["R3"], rs["R4"]}, {rs["R4"], rs["R3"]}} {
+		n.GetLink(pair[0], pair[1]).Delay = time.Millisecond // R2経由と等コストにする
+	}
+	n.ComputeRoutes()
+	if routes := rs["R1"].Table.LookupAll(net.ParseIP("10.0.2.1")); len(routes) != 2 {
+		t.Fatalf("R1の等コスト経路 = %d, 期待値 2", len(routes))
+	}
+
+	received := 0
+	hb.OnReceive = func(Packet) { received++ }
+	const flows, perFlow = 16, 3
+	for port := 1000; port < 1000+flows; port++ {
+		for i := 0; i < perFlow; i++ {
+			p := lanPacket(ha, hb, "flow")
+			p.SrcPort, p.DstPort = port, 80
+			p.TraceID = fmt.Sprintf("f%d-%d", port, i)
+			ha.SendPacket(p)
+		}
+	}
+	n.Bus.Run()
+	if received != flows*perFlow {
+		t.Fatalf("届いたパケット = %d, 期待値 %d", received, flows*perFlow)
+	}
+	used := make(map[string]int)
+	for port := 1000; port < 1000+flows; port++ {
+		hops := make(map[string]bool) // このフローでR1が転送した先
+		for i := 0; i < perFlow; i++ {
+			for _, e := range n.Trace(fmt.Sprintf("f%d-%d", port, i)) {
+				if e.Action == TraceTransmit && (e.Name == "R1->R2" || e.Name == "R1->R3") {
+					hops[e.Name] = true
+				}
+			}
+		}
+		if len(hops) != 1 {
+			t.Errorf("ポート %d のフローの経路 = %v, 期待値は1本", port, hops)
+		}
+		for hop := range hops {
+			used[hop]++
+		}
+	}
+	if used["R1->R2"] == 0 || used["R1->R3"] == 0 {
+		t.Errorf("経路ごとのフロー数 = %v, 期待値は両方の経路を使う", used)
+	}
+}
+
+func TestFindPath(t *testing.T) {
+	n, a, b, r1, r2 := newTestTwoRouterNet(t)
+	isolated := newTestHost("X", "AA:AA:AA:AA:AA:09", "10.0.0.9")
+	n.AddDevice(isolated)
+	oneWay := newTestHost("Y", "AA:AA:AA:AA:AA:0A", "10.0.0.10")
+	n.AddDevice(oneWay)
+	n.AddLink(r1, oneWay, time.Millisecond) // Yへ向かうリンクだけ
+
+	names := func(path []Device) []string {
+		var s []string
+		for _, d := range path {
+			s = append(s, d.GetName())
+		}
+		return s
+	}
+	tests := []struct {
+		name     string
+		src, dst Device
+		want     []string // nilなら到達できない
+	}{
+		{"ルータ2台を経由", a, b, []string{"A", "R1", "R2", "B"}},
+		{"逆向き", b, a, []string{"B", "R2", "R1", "A"}},
+		{"送信元と宛先が同じ", a, a, []string{"A"}},
+		{"リンクのないホスト", a, isolated, nil},
+		{"片方向のリンクの向き", a, oneWay, []string{"A", "R1", "Y"}},
+		{"片方向のリンクの逆向き", oneWay, a, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, ok := n.FindPath(tt.src, tt.dst)
+			if ok != (tt.want != nil) || !slices.Equal(names(path), tt.want) {
+				t.Errorf("FindPath = %v %v, 期待値 %v", names(path), ok, tt.want)
+			}
+		})
+	}
+
+	n.SetLinkState(r1, r2, false) // ダウンしたリンクは通らない
+	if path, ok := n.FindPath(a, b); ok {
+		t.Errorf("リンクダウンの後のFindPath = %v, 期待値 到達不能", names(path))
+	}
+	if _, ok := n.FindPath(b, a); !ok {
+		t.Error("逆向きのリンクはアップのままなのに到達できない")
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"container/heap"
+	"maps"
+	"slices"
+	"time"
+)
+
+// Stateはある時点のシミュレーションの状態を表す。Network.Snapshotで取得し、
+// Network.Restoreでその時点へ巻き戻す。スナップショット後の変更の影響は受けない。
+//
+// イベントのハンドラが閉じ込めた変数（繰り返しイベントの実行回数など）や、
+// 上位の層が持つ状態（再送待ちのパケットなど）は保存されない。
+type State struct {
+	Time time.Time // 仮想時計の時刻
+
+	events    []eventState                        // 実行待ちのイベント
+	nextSeq   uint64                              // 次に追加するイベントの順番
+	executed  int                                 // それまでに実行したイベントの数（MaxEventsの判定に使う）
+	macTables map[*Switch]map[string]MACEntry     // スイッチごとのMACテーブル
+	arpCaches map[*NetworkLayer]map[string]string // ホストのインターフェースごとのARPキャッシュ
+	routerARP map[*Router]map[string]string       // ルータごとのARPキャッシュ
+	pending   map[Device]map[string][]Packet      // ホストとルータごとのARP解決待ちのパケット
+	routes    map[*Router][]Route                 // ルータごとの経路表
+	links     map[*Link]linkState                 // リンクごとの送信待ちキューと状態
+}
+
+// eventStateは実行待ちのイベント1つ分の状態を表す。
+type eventState struct {
+	event     *Event    // 元のイベント（キャンセル用のハンドルが指すものと同じ）
+	time      time.Time // 発生時刻
+	seq       uint64    // 追加された順番
+	cancelled bool      // キャンセル済みならtrue
+	settled   bool      // パケットの配送イベントなら、リンクの伝送中のバイト数から差し引き済みならtrue
+}
+
+// linkStateはリンクの送信待ちの状態を表す。
+type linkState struct {
+	busy        bool       // 回線が送出中ならtrue
+	queue       [][]Packet // 優先度別の送信待ちパケット
+	lastArrival time.Time  // 最後に送出したパケットの到着予定時刻
+	up          bool       // リンクが使用可能ならtrue
+
+	flows    map[uint32]time.Time // FairShareでフローごとに送出を終える時刻
+	inFlight int                  // 伝送中のパケットのデータの合計バイト数
+}
+
+// Snapshotは仮想時計、実行待ちのイベントと実行済みのイベント数、スイッチのMACテーブル、
+// ホストとルータのARPキャッシュとARP解決待ちのパケット、ルータの経路表、リンクの送信待ちキューと状態を複製して返す。
+func (n *Network) Snapshot() State {
+	s := State{
+		macTables: make(map[*Switch]map[string]MACEntry),
+		arpCaches: make(map[*NetworkLayer]map[string]string),
+		routerARP: make(map[*Router]map[string]string),
+		pending:   make(map[Device]map[string][]Packet),
+		routes:    make(map[*Router][]Route),
+		links:     make(map[*Link]linkState),
+	}
+
+	eb := n.Bus
+	eb.mu.Lock()
+	s.Time = eb.CurrentTime
+	s.nextSeq = eb.nextSeq
+	s.executed = eb.events
+	for _, e := range eb.Events {
+		es := eventState{event: e, time: e.Time, seq: e.Seq, cancelled: e.Cancelled}
+		if e.Packet != nil {
+			es.settled = e.Packet.settled
+		}
+		s.events = append(s.events, es)
+	}
+	for _, l := range n.Links {
+		s.links[l] = linkState{busy: l.busy, queue: cloneQueue(l.queue), lastArrival: l.lastArrival, up: l.Up, flows: maps.Clone(l.flows), inFlight: l.inFlight}
+	}
+	eb.mu.Unlock()
+
+	for _, d := range n.Devices {
+		switch dev := d.(type) {
+		case *Switch:
+			s.macTables[dev] = maps.Clone(dev.MACTable)
+		case *Host:
+			for _, nic := range dev.nics() {
+				if nl := nic.Network; nl != nil {
+					s.arpCaches[nl] = maps.Clone(nl.ARPTable)
+				}
+			}
+			s.pending[dev] = clonePending(dev.pendingARP)
+		case *Router:
+			s.routerARP[dev] = maps.Clone(dev.arpTable)
+			s.routes[dev] = slices.Clone(dev.Table.Routes)
+			s.pending[dev] = clonePending(dev.pendingARP)
+		}
+	}
+	n.log().Infof("[Network] スナップショットを取得: 時刻 %v、イベント %d 個", s.Time.Sub(SimulationEpoch), len(s.events))
+	return s
+}
+
+// Restoreはネットワークの状態をスナップショットの時点に戻す。
+// スナップショット後に追加されたイベントは破棄され、実行済みのイベントは再び実行待ちになる。
+// スナップショット後に追加されたデバイスやリンクの状態は変更しない。
+func (n *Network) Restore(s State) {
+	eb := n.Bus
+	eb.mu.Lock()
+	eb.CurrentTime = s.Time
+	eb.nextSeq = s.nextSeq
+	eb.events = s.executed
+	eb.Events = make(EventQueue, 0, len(s.events))
+	for _, es := range s.events {
+		es.event.Time, es.event.Seq, es.event.Cancelled = es.time, es.seq, es.cancelled
+		if es.event.Packet != nil {
+			es.event.Packet.settled = es.settled
+		}
+		eb.Events = append(eb.Events, es.event)
+	}
+	for l, ls := range s.links {
+		l.inFlight = ls.inFlight
+	}
+	heap.Init(&eb.Events)
+	eb.stopRequested = false
+	eb.mu.Unlock()
+
+	for sw, table := range s.macTables {
+		sw.MACTable = maps.Clone(table)
+	}
+	for nl, table := range s.arpCaches {
+		nl.ARPTable = maps.Clone(table)
+	}
+	for r, table := range s.routerARP {
+		r.arpTable = maps.Clone(table)
+	}
+	for d, pending := range s.pending {
+		switch dev := d.(type) {
+		case *Host:
+			dev.pendingARP = clonePending(pending)
+		case *Router:
+			dev.pendingARP = clonePending(pending)
+		}
+	}
+	for r, routes := range s.routes {
+		r.Table.Routes = slices.Clone(routes)
+	}
+	for l, ls := range s.links {
+		l.busy = ls.busy
+		l.queue = cloneQueue(ls.queue)
+		l.lastArrival = ls.lastArrival
+		l.Up = ls.up
+		l.flows = maps.Clone(ls.flows)
+	}
+	n.log().Infof("[Network] スナップショットに復元: 時刻 %v、イベント %d 個", s.Time.Sub(SimulationEpoch), len(s.events))
+}
+
+// cloneQueueは優先度別の送信待ちキューを複製する。
+func cloneQueue(queue [][]Packet) [][]Packet {
+	if queue == nil {
+		return nil
+	}
+	out := make([][]Packet, len(queue))
+	for i, q := range queue {
+		out[i] = make([]Packet, len(q))
+		for j, p := range q {
+			out[i][j] = p.Clone()
+		}
+	}
+	return out
+}
+
+// clonePendingはARP解決待ちのパケットを複製する。
+func clonePending(pending map[string][]Packet) map[string][]Packet {
+	if pending == nil {
+		return nil
+	}
+	out := make(map[string][]Packet, len(pending))
+	for ip, ps := range pending {
+		out[ip] = cloneQueue([][]Packet{ps})[0]
+	}
+	return out
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRestoreReplaysFromSnapshot(t *testing.T) {
+	n, a, b, s := newTestLAN(t)
+	got := NewCollector()
+	got.Attach(b)
+	a.Send("10.0.0.2", []byte("hi"))
+	n.Bus.Step() // スイッチがAからのARP要求を受信してAを学習する
+	snap := n.Snapshot()
+	runBus(t, n)
+	if got.Len() != 1 {
+		t.Fatalf("届いたパケット = %d, 期待値 1", got.Len())
+	}
+	end := n.Bus.Now()
+
+	n.Restore(snap)
+	if n.Bus.Now() != snap.Time {
+		t.Errorf("復元後の時刻 = %v, 期待値 %v", n.Bus.Now(), snap.Time)
+	}
+	if _, ok := s.MACTable["AA:AA:AA:AA:AA:02"]; ok || len(s.MACTable) != 1 {
+		t.Errorf("復元後のMACテーブル = %v, 期待値はAだけ", s.MACTable)
+	}
+	if mac := a.networkLayer().ARPTable["10.0.0.2"]; mac != "" {
+		t.Errorf("復元後もARPキャッシュに %s が残っている", mac)
+	}
+	runBus(t, n)
+	if got.Len() != 2 {
+		t.Errorf("復元後に届いたパケット = %d, 期待値 2", got.Len())
+	}
+	if n.Bus.Now() != end {
+		t.Errorf("復元後に進めた時刻 = %v, 期待値 %v", n.Bus.Now(), end)
+	}
+}
+
+func TestRestoreKeepsMaxEventsBudget(t *testing.T) {
+	n, a, _, _ := newTestLAN(t)
+	a.Send("10.0.0.2", []byte("hi"))
+	n.Bus.Step()
+	snap := n.Snapshot()
+	runBus(t, n)
+	n.Bus.MaxEvents = n.Bus.events + 1 // 最初の実行では上限に達しない
+
+	n.Restore(snap)
+	if err := n.Bus.Run(); errors.Is(err, ErrMaxEvents) {
+		t.Errorf("復元後の実行が上限に達した: %v", err)
+	}
+}
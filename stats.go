@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+)
+
+// DropReasonはパケットが破棄された理由を表す。
+// errorとしても使え、errors.Is(err, DropNoRoute)のように送信時のエラーの理由を調べられる。
+type DropReason string
+
+func (r DropReason) Error() string {
+	return string(r)
+}
+
+// DropErrorはデバイスやリンクが送信しようとしたパケットをその場で破棄したことを表す。
+// ARP解決待ちやリンク上での伝送中など、後で起きた破棄はエラーにならず統計とログにだけ残る。
+type DropError struct {
+	Where  string     // 破棄したデバイスかリンクの名前
+	Reason DropReason // 破棄した理由
+}
+
+func (e *DropError) Error() string {
+	return fmt.Sprintf("%s: パケットを破棄 (%s)", e.Where, e.Reason)
+}
+
+// UnwrapはDropReasonとして比べられるよう破棄の理由を返す。
+func (e *DropError) Unwrap() error {
+	return e.Reason
+}
+
+// dropErrorはwhereでreasonにより破棄したことを表すエラーを作る。
+func dropError(where string, reason DropReason) error {
+	return &DropError{Where: where, Reason: reason}
+}
+
+const (
+	DropNoRoute         DropReason = "no_route"         // 宛先への経路がない
+	DropTTLExpired      DropReason = "ttl_expired"      // TTLが0になった
+	DropLoss            DropReason = "loss"             // リンク上でのパケットロス
+	DropMACMismatch     DropReason = "mac_mismatch"     // 宛先MACが自分ではない
+	DropIPMismatch      DropReason = "ip_mismatch"      // 宛先IPが自分ではない
+	DropInvalidAddress  DropReason = "invalid_address"  // 宛先アドレスが不正
+	DropNoLink          DropReason = "no_link"          // 送出先のリンクがない
+	DropLinkRemoved     DropReason = "link_removed"     // リンクが削除された
+	DropBlockedPort     DropReason = "blocked_port"     // 全域木でブロックされたポート
+	DropVLANMismatch    DropReason = "vlan_mismatch"    // VLANが異なる
+	DropPortUnreachable DropReason = "port_unreachable" // 宛先ポートにハンドラがない
+	DropReassembly      DropReason = "reassembly"       // 断片がそろわなかった
+	DropNATExhausted    DropReason = "nat_exhausted"    // NATの変換表が一杯
+	DropQueueFull       DropReason = "queue_full"       // リンクの送信待ちキューが一杯
+	DropEarly           DropReason = "early_drop"       // REDによる早期破棄
+	DropChecksum        DropReason = "checksum"         // チェックサムが一致しない
+	DropCollision       DropReason = "collision"        // 衝突が続き再送を諦めた
+	DropACL             DropReason = "acl"              // ACLで拒否された
+	DropIPConflict      DropReason = "ip_conflict"      // IPアドレスの重複を検出したため送信しない
+	DropFrameTooLarge   DropReason = "frame_too_large"  // フレームが最大フレーム長を超えた
+	DropLinkDown        DropReason = "link_down"        // リンクがダウンしている
+	DropDeviceOffline   DropReason = "device_offline"   // デバイスの電源が切れている
+	DropPreempted       DropReason = "preempted"        // 優先度の高いパケットに送信待ちキューの場所を譲った
+	DropUnknownUnicast  DropReason = "unknown_unicast"  // 未学習の宛先MACへのフラッディングが無効
+	DropRateLimit       DropReason = "rate_limit"       // トークンバケットによるレートの制限を超えた
+)
+
+// Statsはデバイスやリンクが処理したパケットの統計を表す。
+type Stats struct {
+	Sent          int                // 送信したパケット数
+	Received      int                // 受信したパケット数
+	BytesSent     int64              // 送信したデータのバイト数
+	BytesReceived int64              // 受信したデータのバイト数
+	Dropped       map[DropReason]int // 理由ごとの破棄したパケット数
+}
+
+func (s *Stats) countSent(p Packet) {
+	s.Sent++
+	s.BytesSent += int64(len(p.Data))
+}
+
+func (s *Stats) countReceived(p Packet) {
+	s.Received++
+	s.BytesReceived += int64(len(p.Data))
+}
+
+func (s *Stats) countDrop(reason DropReason) {
+	if s.Dropped == nil {
+		s.Dropped = make(map[DropReason]int)
+	}
+	s.Dropped[reason]++
+}
+
+// TotalDroppedは理由を問わず破棄したパケットの総数を返す。
+func (s Stats) TotalDropped() int {
+	total := 0
+	for _, n := range s.Dropped {
+		total += n
+	}
+	return total
+}
+
+// cloneは破棄数のマップも複製した統計のコピーを返す。
+func (s Stats) clone() Stats {
+	if s.Dropped != nil {
+		dropped := make(map[DropReason]int, len(s.Dropped))
+		for reason, n := range s.Dropped {
+			dropped[reason] = n
+		}
+		s.Dropped = dropped
+	}
+	return s
+}
+
+// statsHolderは統計を持つデバイスが実装する。
+type statsHolder interface {
+	stats() *Stats
+}
+
+func (h *Host) stats() *Stats   { return &h.Stats }
+func (s *Switch) stats() *Stats { return &s.Stats }
+func (r *Router) stats() *Stats { return &r.Stats }
+
+// Nameはリンクを「送信元->宛先」の形式で返す。
+func (l *Link) Name() string {
+	return l.From.GetName() + "->" + l.To.GetName()
+}
+
+// Statsはデバイス名とリンク名（「送信元->宛先」）をキーとした統計のスナップショットを返す。
+func (n *Network) Stats() map[string]Stats {
+	snapshot := make(map[string]Stats)
+	for _, d := range n.Devices {
+		if h, ok := d.(statsHolder); ok {
+			snapshot[d.GetName()] = h.stats().clone()
+		}
+	}
+	for _, l := range n.Links {
+		snapshot[l.Name()] = l.Stats.clone()
+	}
+	return snapshot
+}
+
+// countDropは所属するホストの破棄数を数える。
+func (r *hostRef) countDrop(reason DropReason) {
+	if r.host != nil {
+		r.host.Stats.countDrop(reason)
+	}
+}
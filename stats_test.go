@@ -0,0 +1,58 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNetworkStats(t *testing.T) {
+	n, a, b, s := newTestLAN(t)
+	sb := n.GetLink(s, b)
+	stray := lanPacket(a, b, "stray")
+	stray.DstMAC = "AA:AA:AA:AA:AA:09" // 誰も持っていないMACはBへフラッディングされ、Bが破棄する
+	a.SendPacket(lanPacket(a, b, "hello"))
+	a.SendPacket(stray)
+	n.Bus.AddEvent(10*time.Millisecond, func() {
+		sb.LossRate = 1
+		a.SendPacket(lanPacket(a, b, "lost!"))
+	})
+	n.Bus.Run()
+
+	// 最初の送信の前にAが送るデータのないGratuitous ARPも、パケット数にだけ数える
+	want := map[string]Stats{
+		"A":    {Sent: 4, BytesSent: 15},
+		"S":    {Sent: 4, BytesSent: 15, Received: 4, BytesReceived: 15},
+		"B":    {Received: 3, BytesReceived: 10, Dropped: map[DropReason]int{DropMACMismatch: 1}},
+		"A->S": {Sent: 4, BytesSent: 15, Received: 4, BytesReceived: 15},
+		"S->A": {},
+		"S->B": {Sent: 4, BytesSent: 15, Received: 3, BytesReceived: 10, Dropped: map[DropReason]int{DropLoss: 1}},
+		"B->S": {},
+	}
+	got := n.Stats()
+	if !reflect.DeepEqual(got, want) {
+		for name := range want {
+			if !reflect.DeepEqual(got[name], want[name]) {
+				t.Errorf("%s の統計 = %+v, 期待値 %+v", name, got[name], want[name])
+			}
+		}
+		if len(got) != len(want) {
+			t.Errorf("統計の数 = %d, 期待値 %d", len(got), len(want))
+		}
+	}
+	if total := got["B"].TotalDropped() + got["S->B"].TotalDropped(); total != 2 {
+		t.Errorf("破棄の合計 = %d, 期待値 2", total)
+	}
+}
+
+func TestNetworkStatsIsSnapshot(t *testing.T) {
+	n, a, b, _ := newTestLAN(t)
+	b.Stats.countDrop(DropLoss)
+	snapshot := n.Stats()
+	b.Stats.countDrop(DropLoss)
+	a.SendPacket(lanPacket(a, b, "hello"))
+	n.Bus.Run()
+	if snapshot["A"].Sent != 0 || snapshot["B"].Dropped[DropLoss] != 1 {
+		t.Errorf("スナップショットが後の変更の影響を受けた: %+v %+v", snapshot["A"], snapshot["B"])
+	}
+}
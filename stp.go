@@ -0,0 +1,62 @@
+package main
+
+import (
+	"sort"
+)
+
+// ComputeSpanningTreeはスイッチ間のリンクから全域木を計算し、
+// 木に含まれないスイッチ間ポートをブロックしてブロードキャストのループを防ぐ。
+// 連結成分ごとに名前が最小のスイッチをルートブリッジとし、ルートから幅優先で木を作る。
+func (n *Network) ComputeSpanningTree() {
+	var switches []*Switch
+	for _, d := range n.Devices {
+		if s, ok := d.(*Switch); ok {
+			switches = append(switches, s)
+		}
+	}
+	sort.Slice(switches, func(i, j int) bool { return switches[i].Name < switches[j].Name })
+
+	// 一旦すべてのスイッチ間ポートをブロックし、木の辺になったポートだけを開く
+	for _, s := range switches {
+		for _, port := range s.Ports {
+			_, toSwitch := port.Peer.(*Switch)
+			port.Blocked = toSwitch
+		}
+	}
+
+	visited := make(map[*Switch]bool)
+	for _, root := range switches {
+		if visited[root] {
+			continue
+		}
+		n.log().Infof("[STP] ルートブリッジ: %s", root.Name)
+		visited[root] = true
+		queue := []*Switch{root}
+		for len(queue) > 0 {
+			s := queue[0]
+			queue = queue[1:]
+			for _, port := range s.Ports {
+				peer, ok := port.Peer.(*Switch)
+				if !ok || visited[peer] {
+					continue
+				}
+				back := peer.PortTo(s)
+				if back == nil {
+					continue // 逆方向のリンクがないスイッチは木に含めない
+				}
+				visited[peer] = true
+				port.Blocked = false
+				back.Blocked = false
+				queue = append(queue, peer)
+			}
+		}
+	}
+
+	for _, s := range switches {
+		for _, port := range s.Ports {
+			if port.Blocked {
+				n.log().Infof("[STP] %s: ポート %d (%s 方向) をブロック", s.Name, port.Number, port.Peer.GetName())
+			}
+		}
+	}
+}
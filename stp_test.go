@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+)
+
+// newTestTriangleは3台のスイッチS1〜S3を三角形につなぎ、それぞれにホストH1〜H3を接続したネットワークを作る。
+func newTestTriangle(t *testing.T) (*Network, []*Host, []*Switch) {
+	n := newTestNetwork(t)
+	hosts := make([]*Host, 3)
+	switches := make([]*Switch, 3)
+	for i := range switches {
+		switches[i] = &Switch{Name: fmt.Sprintf("S%d", i+1)}
+		hosts[i] = newTestHost(fmt.Sprintf("H%d", i+1), fmt.Sprintf("AA:AA:AA:AA:AA:0%d", i+1), fmt.Sprintf("10.0.0.%d", i+1))
+		n.AddDevice(switches[i])
+		n.AddDevice(hosts[i])
+		n.AddBidirectionalLink(hosts[i], switches[i], time.Millisecond)
+	}
+	n.AddBidirectionalLink(switches[0], switches[1], time.Millisecond)
+	n.AddBidirectionalLink(switches[1], switches[2], time.Millisecond)
+	n.AddBidirectionalLink(switches[2], switches[0], time.Millisecond)
+	return n, hosts, switches
+}
+
+// broadcastはhからブロードキャストを1つ送る。
+func broadcast(h *Host) {
+	h.SendPacket(Packet{SrcIP: h.networkLayer().IP, DstIP: "10.0.0.255", DstMAC: BroadcastMAC, Data: []byte("hello")})
+}
+
+func TestSpanningTreePreventsBroadcastStorm(t *testing.T) {
+	n, hosts, switches := newTestTriangle(t)
+	n.ComputeSpanningTree()
+	blocked := 0
+	for _, s := range switches {
+		for _, port := range s.Ports {
+			if port.Blocked {
+				blocked++
+				if _, ok := port.Peer.(*Switch); !ok {
+					t.Errorf("%s: ホストへのポート %d をブロックした", s.Name, port.Number)
+				}
+			}
+		}
+	}
+	if blocked != 2 { // 木に含まれない1本のリンクの両端
+		t.Errorf("ブロックしたポート = %d, 期待値 2", blocked)
+	}
+	broadcast(hosts[0])
+	n.Bus.Run()
+	for _, h := range hosts[1:] {
+		if h.Stats.Received != 2 { // 送信の前のGratuitous ARPとブロードキャストが1回ずつ
+			t.Errorf("%s が受信したブロードキャスト = %d, 期待値 2", h.Name, h.Stats.Received)
+		}
+	}
+	if hosts[0].Stats.Received != 0 {
+		t.Errorf("送信元に自分のブロードキャストが戻った: %d", hosts[0].Stats.Received)
+	}
+}
+
+func TestBroadcastLoopsWithoutSpanningTree(t *testing.T) {
+	n, hosts, _ := newTestTriangle(t)
+	n.SetLogger(NewWriterLogger(io.Discard, LevelWarn)) // 嵐の間の破棄の警告は出さない
+	n.Bus.MaxEvents = 1000
+	broadcast(hosts[0])
+	if err := n.Bus.Run(); !errors.Is(err, ErrMaxEvents) {
+		t.Errorf("ループのあるトポロジーでRunのエラー = %v, 期待値 %v", err, ErrMaxEvents)
+	}
+}
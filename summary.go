@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Summaryはシミュレーションの結果を人間が読める表にまとめて返す。
+// 経過した仮想時間、デバイスごとの送受信数と破棄数、リンクごとの送受信数、破棄数、
+// 経過時間全体での利用率（帯域幅が無制限なら「-」）を追加した順に並べる。
+// tabwriterは全角文字の幅を考慮しないため、表の見出しは英字にしている。
+func (n *Network) Summary() string {
+	var b strings.Builder
+	elapsed := n.Bus.Now().Sub(SimulationEpoch)
+	fmt.Fprintf(&b, "シミュレーション時間: %v\n\n", elapsed)
+
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DEVICE\tSENT\tRECEIVED\tDROPPED")
+	for _, d := range n.Devices {
+		h, ok := d.(statsHolder)
+		if !ok {
+			fmt.Fprintf(w, "%s\t-\t-\t-\n", d.GetName())
+			continue
+		}
+		s := h.stats()
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\n", d.GetName(), s.Sent, s.Received, s.TotalDropped())
+	}
+	w.Flush()
+
+	b.WriteString("\n")
+	w = tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "LINK\tSENT\tRECEIVED\tDROPPED\tUTILIZATION")
+	for _, l := range n.Links {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%s\n", l.Name(), l.Stats.Sent, l.Stats.Received, l.Stats.TotalDropped(), l.overallUtilization(elapsed))
+	}
+	w.Flush()
+	return b.String()
+}
+
+// overallUtilizationは経過時間全体で送出したビット数の帯域幅に対する割合を百分率の文字列で返す。
+// 帯域幅が無制限か時間が経過していなければ「-」を返す。
+func (l *Link) overallUtilization(elapsed time.Duration) string {
+	if l.Bandwidth <= 0 || elapsed <= 0 {
+		return "-"
+	}
+	var bits int64
+	for _, s := range l.samples {
+		bits += int64(s.Bytes) * 8
+	}
+	return fmt.Sprintf("%.1f%%", 100*float64(bits)/(float64(l.Bandwidth)*elapsed.Seconds()))
+}
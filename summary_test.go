@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+func TestNetworkSummary(t *testing.T) {
+	n, a, b, s := newTestLAN(t)
+	skipAnnounce(a, b)
+	n.GetLink(a, s).Bandwidth = 8_000 // 5バイトの送出に5ms
+	n.SetLinkState(b, s, false)
+	a.SendPacket(lanPacket(a, b, "hello"))
+	b.SendPacket(lanPacket(b, a, "down"))
+	runBus(t, n)
+	// A->Sは7msのうち5ms使用し、B->Sはダウンしているため破棄する
+	want := `シミュレーション時間: 7ms
+
+DEVICE  SENT  RECEIVED  DROPPED
+A       1     0         0
+B       1     1         0
+S       1     1         0
+
+LINK  SENT  RECEIVED  DROPPED  UTILIZATION
+A->S  1     1         0        71.4%
+S->A  0     0         0        -
+B->S  0     0         1        -
+S->B  1     1         0        -
+`
+	if got := n.Summary(); got != want {
+		t.Errorf("Summary =\n%s\n期待値\n%s", got, want)
+	}
+}
+
+func TestNetworkSummaryEmpty(t *testing.T) {
+	n := newTestNetwork(t)
+	n.AddDevice(&Hub{Name: "H"})
+	want := "シミュレーション時間: 0s\n\nDEVICE  SENT  RECEIVED  DROPPED\nH       0     0         0\n\nLINK  SENT  RECEIVED  DROPPED  UTILIZATION\n"
+	if got := n.Summary(); got != want {
+		t.Errorf("Summary =\n%q\n期待値\n%q", got, want)
+	}
+}
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// lanPacketはfromからtoへ、アドレスを全て埋めたパケットを作る。
+func lanPacket(from, to *Host, data string) Packet {
+	p := NewPacket(from.networkLayer().IP, to.networkLayer().IP, data)
+	p.SrcMAC = from.dataLinkLayer().MAC
+	p.DstMAC = to.dataLinkLayer().MAC
+	return p
+}
+
+// newTestLAN3はnewTestLANのスイッチにホストC（10.0.0.3）を加えたネットワークを作る。
+func newTestLAN3(t testing.TB) (*Network, *Host, *Host, *Host, *Switch) {
+	n, a, b, s := newTestLAN(t)
+	c := newTestHost("C", "AA:AA:AA:AA:AA:03", "10.0.0.3")
+	n.AddDevice(c)
+	n.AddBidirectionalLink(c, s, time.Millisecond)
+	return n, a, b, c, s
+}
+
+// recordは受信したパケットを記録するレイヤーをhの最上位に積む。
+func record(h *Host) *recordLayer {
+	rec := &recordLayer{}
+	h.Layers = append(h.Layers, rec)
+	return rec
+}
+
+func TestSwitchMACAging(t *testing.T) {
+	tests := []struct {
+		name    string
+		wait    time.Duration // BがAへ送ってからAがBへ送るまでの時間
+		flooded bool
+	}{
+		{"有効期間内なら学習したポートへ転送", 5 * time.Second, false},
+		{"有効期間を過ぎたらフラッディング", 15 * time.Second, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, a, b, c, s := newTestLAN3(t)
+			skipAnnounce(a, b, c)
+			s.AgeTime = 10 * time.Second
+			gotB := record(b)
+			b.SendPacket(lanPacket(b, a, "learn"))
+			n.Bus.Run()
+			if _, ok := s.MACTable[b.dataLinkLayer().MAC]; !ok {
+				t.Fatal("BのMACアドレスを学習していない")
+			}
+			received := c.Stats.Received
+			n.Bus.AddEvent(tt.wait, func() { a.SendPacket(lanPacket(a, b, "hello")) })
+			n.Bus.Run()
+			if got := c.Stats.Received > received; got != tt.flooded {
+				t.Errorf("Cにフレームが届いた = %v, 期待値 %v", got, tt.flooded)
+			}
+			if len(gotB.in) != 1 {
+				t.Errorf("Bが受信したパケット = %d, 期待値 1", len(gotB.in))
+			}
+		})
+	}
+}
+
+func TestSwitchMACAgingDisabled(t *testing.T) {
+	n, a, b, c, s := newTestLAN3(t)
+	gotC := record(c)
+	b.SendPacket(lanPacket(b, a, "learn"))
+	n.Bus.Run()
+	received := len(gotC.in)
+	n.Bus.AddEvent(time.Hour, func() { a.SendPacket(lanPacket(a, b, "hello")) })
+	n.Bus.Run()
+	if len(gotC.in) != received {
+		t.Error("AgeTimeが0なのにエントリが期限切れになった")
+	}
+	if len(s.MACTable) != 2 {
+		t.Errorf("MACテーブルのエントリ数 = %d, 期待値 2", len(s.MACTable))
+	}
+}
+
+func TestCascadedSwitchesLearnUplinkPort(t *testing.T) {
+	n := newTestNetwork(t)
+	a := newTestHost("A", "AA:AA:AA:AA:AA:01", "10.0.0.1")
+	b := newTestHost("B", "AA:AA:AA:AA:AA:02", "10.0.0.2")
+	c := newTestHost("C", "AA:AA:AA:AA:AA:03", "10.0.0.3")
+	sa, sb := &Switch{Name: "SA"}, &Switch{Name: "SB"}
+	for _, d := range []Device{a, b, c, sa, sb} {
+		n.AddDevice(d)
+	}
+	n.AddBidirectionalLink(a, sa, time.Millisecond)
+	n.AddBidirectionalLink(sa, sb, time.Millisecond)
+	n.AddBidirectionalLink(b, sb, time.Millisecond)
+	n.AddBidirectionalLink(c, sb, time.Millisecond)
+
+	b.SendPacket(lanPacket(b, a, "from b"))
+	c.SendPacket(lanPacket(c, a, "from c"))
+	n.Bus.Run()
+	uplink := sa.PortTo(sb)
+	for _, h := range []*Host{b, c} {
+		if entry, ok := sa.MACTable[h.dataLinkLayer().MAC]; !ok || entry.Port != uplink {
+			t.Errorf("SAが %s を上流のポート %d で学習していない: %+v", h.Name, uplink.Number, entry)
+		}
+	}
+
+	gotB, gotC := record(b), record(c)
+	a.SendPacket(lanPacket(a, b, "to b"))
+	n.Bus.Run()
+	if len(gotB.in) != 1 {
+		t.Fatalf("Bに届いたパケット = %d, 期待値 1", len(gotB.in))
+	}
+	if len(gotC.in) != 0 {
+		t.Error("学習済みの宛先なのにCへフラッディングした")
+	}
+}
+
+func TestSwitchPortNumbersNotReused(t *testing.T) {
+	n, a, b, s := newTestLAN(t)
+	n.RemoveDevice(a)
+	c := newTestHost("C", "AA:AA:AA:AA:AA:03", "10.0.0.3")
+	n.AddDevice(c)
+	n.AddBidirectionalLink(c, s, time.Millisecond)
+	if got := s.PortTo(b).Number; got != 2 {
+		t.Errorf("Bのポート番号 = %d, 期待値 2", got)
+	}
+	if port := s.PortTo(c); port.Number != 3 || port.Name != "eth2" {
+		t.Errorf("Cのポート = %d %s, 期待値 3 eth2", port.Number, port.Name)
+	}
+}
+
+func TestSwitchLearnedPortWithoutLink(t *testing.T) {
+	n, a, b, c, s := newTestLAN3(t)
+	skipAnnounce(a, b, c)
+	b.SendPacket(lanPacket(b, a, "learn"))
+	n.Bus.Run()
+	s.PortTo(b).Link = nil // 学習した後にポートのリンクが外れた
+	received := c.Stats.Received
+	a.SendPacket(lanPacket(a, b, "hello"))
+	n.Bus.Run()
+	if _, ok := s.MACTable[b.dataLinkLayer().MAC]; ok {
+		t.Error("リンクのないポートのエントリを忘れていない")
+	}
+	if c.Stats.Received != received+1 {
+		t.Error("エントリを忘れた後にフラッディングしていない")
+	}
+	if s.Stats.Dropped[DropNoLink] != 1 {
+		t.Errorf("リンクのないポートへの送出の破棄 = %d, 期待値 1", s.Stats.Dropped[DropNoLink])
+	}
+}
+
+func TestSwitchBroadcastSkipsPortWithoutLink(t *testing.T) {
+	n, a, b, c, s := newTestLAN3(t)
+	skipAnnounce(a, b, c)
+	s.PortTo(b).Link = nil
+	broadcast(a)
+	n.Bus.Run()
+	if b.Stats.Received != 0 || c.Stats.Received != 1 {
+		t.Errorf("ブロードキャストを受信 B = %d, C = %d, 期待値 0, 1", b.Stats.Received, c.Stats.Received)
+	}
+	if s.Stats.Dropped[DropNoLink] != 1 {
+		t.Errorf("リンクのないポートへの送出の破棄 = %d, 期待値 1", s.Stats.Dropped[DropNoLink])
+	}
+}
+
+func TestSwitchLearnsOnIngressPortAdded(t *testing.T) {
+	n := newTestNetwork(t)
+	a := newTestHost("A", "AA:AA:AA:AA:AA:01", "10.0.0.1")
+	b := newTestHost("B", "AA:AA:AA:AA:AA:02", "10.0.0.2")
+	s := &Switch{Name: "S"}
+	for _, d := range []Device{a, b, s} {
+		n.AddDevice(d)
+	}
+	for _, h := range []*Host{a, b} { // AddLinkだけではスイッチのポートに登録されない
+		n.AddLink(h, s, time.Millisecond)
+		n.AddLink(s, h, time.Millisecond)
+		h.ConnectedDev = s
+	}
+	gotA, gotB := record(a), record(b)
+
+	a.SendPacket(lanPacket(a, b, "first"))
+	n.Bus.Run()
+	if entry, ok := s.MACTable[a.dataLinkLayer().MAC]; !ok || entry.Port.Peer != a || entry.Port.Link != n.GetLink(s, a) {
+		t.Fatalf("Aのエントリ = %+v, 期待値はAからの受信で追加したポート", entry)
+	}
+	b.SendPacket(lanPacket(b, a, "reply"))
+	n.Bus.Run()
+	if len(gotA.in) != 1 {
+		t.Errorf("Aに届いたパケット = %d, 期待値 1（受信で学習したポートへ転送）", len(gotA.in))
+	}
+	if entry, ok := s.MACTable[b.dataLinkLayer().MAC]; !ok || entry.Port.Peer != b {
+		t.Errorf("Bのエントリ = %+v, 期待値はBからの受信で追加したポート", entry)
+	}
+	a.SendPacket(lanPacket(a, b, "second"))
+	n.Bus.Run()
+	if len(gotB.in) != 1 || string(gotB.in[0].Data) != "second" {
+		t.Errorf("Bに届いたパケット = %v, 期待値は2回目の送信だけ", gotB.in)
+	}
+	if len(s.Ports) != 2 {
+		t.Errorf("ポート数 = %d, 期待値 2", len(s.Ports))
+	}
+}
+
+func TestSwitchMulticastGroup(t *testing.T) {
+	const group = "01:00:5E:00:00:01"
+	n, a, b, c, s := newTestLAN3(t)
+	d := newTestHost("D", "AA:AA:AA:AA:AA:04", "10.0.0.4")
+	n.AddDevice(d)
+	n.AddBidirectionalLink(d, s, time.Millisecond)
+	skipAnnounce(a, b, c, d)
+	s.JoinMulticast(group, b)
+	s.JoinMulticast(group, c)
+	s.JoinMulticast(group, c) // 二重に参加しても1回だけ届く
+
+	p := lanPacket(a, b, "multicast")
+	p.DstMAC = group
+	a.SendPacket(p)
+	n.Bus.Run()
+	if b.Stats.Received != 1 || c.Stats.Received != 1 || d.Stats.Received != 0 {
+		t.Errorf("マルチキャストを受信 B = %d, C = %d, D = %d, 期待値 1, 1, 0", b.Stats.Received, c.Stats.Received, d.Stats.Received)
+	}
+
+	broadcast(a) // ブロードキャストはグループに関係なく全ポートへ
+	n.Bus.Run()
+	if b.Stats.Received != 2 || c.Stats.Received != 2 || d.Stats.Received != 1 {
+		t.Errorf("ブロードキャストを受信 B = %d, C = %d, D = %d, 期待値 2, 2, 1", b.Stats.Received, c.Stats.Received, d.Stats.Received)
+	}
+
+	s.LeaveMulticast(group, b)
+	s.LeaveMulticast(group, c)
+	a.SendPacket(p) // 参加ポートがなくなったグループ宛てはフラッディングする
+	n.Bus.Run()
+	if b.Stats.Received != 3 || c.Stats.Received != 3 || d.Stats.Received != 2 {
+		t.Errorf("グループ解散後に受信 B = %d, C = %d, D = %d, 期待値 3, 3, 2", b.Stats.Received, c.Stats.Received, d.Stats.Received)
+	}
+}
+
+func TestSwitchJoinMulticastRejectsUnicast(t *testing.T) {
+	_, _, b, s := newTestLAN(t)
+	s.JoinMulticast("AA:AA:AA:AA:AA:02", b)
+	s.JoinMulticast(BroadcastMAC, b)
+	if len(s.MulticastGroups) != 0 {
+		t.Errorf("マルチキャストでないアドレスのグループ = %v, 期待値なし", s.MulticastGroups)
+	}
+}
+
+func TestSwitchProcessingDelay(t *testing.T) {
+	n, a, b, s := newTestLAN(t)
+	skipAnnounce(a, b)
+	s.ProcessingDelay = 5 * time.Millisecond
+	got := record(b)
+	a.SendPacket(lanPacket(a, b, "hello"))
+	runBus(t, n)
+	if len(got.in) != 1 {
+		t.Fatalf("届いたパケット = %d, 期待値 1", len(got.in))
+	}
+	// A->Sの1ms、スイッチの処理の5ms、S->Bの1ms
+	if at := got.in[0].ReceivedAt.Sub(SimulationEpoch); at != 7*time.Millisecond {
+		t.Errorf("到着時刻 = %v, 期待値 7ms", at)
+	}
+}
+
+func TestSwitchMirrorPort(t *testing.T) {
+	n, a, b, c, s := newTestLAN3(t)
+	skipAnnounce(a, b, c)
+	a.SendPacket(lanPacket(a, b, "learn a"))
+	b.SendPacket(lanPacket(b, a, "learn b"))
+	runBus(t, n)
+	c.Stats = Stats{}
+
+	s.MirrorPort(a, c)
+	a.SendPacket(lanPacket(a, b, "ingress")) // Aのポートで受信したフレーム
+	b.SendPacket(lanPacket(b, a, "egress"))  // Aのポートから送出したフレーム
+	runBus(t, n)
+	// 複製は宛先MACがCではないため、Cのデータリンク層で破棄される
+	if c.Stats.Received != 2 || c.Stats.Dropped[DropMACMismatch] != 2 || c.Stats.BytesReceived != int64(len("ingress")+len("egress")) {
+		t.Errorf("Cが受信した複製 = %+v, 期待値 ingressとegressの2つ", c.Stats)
+	}
+
+	c.Stats = Stats{}
+	gotB := record(b)
+	c.SendPacket(lanPacket(c, b, "other port"))
+	runBus(t, n)
+	if len(gotB.in) != 1 || c.Stats.Received != 0 {
+		t.Errorf("Bに届いたパケット = %d, Cが受信したフレーム = %d, 期待値 1, 0（ミラー対象外のポート）", len(gotB.in), c.Stats.Received)
+	}
+
+	s.MirrorPort(a, nil)
+	a.SendPacket(lanPacket(a, b, "stopped"))
+	runBus(t, n)
+	if c.Stats.Received != 0 {
+		t.Errorf("ミラーを止めた後にCが受信したフレーム = %d, 期待値 0", c.Stats.Received)
+	}
+	if len(gotB.in) != 2 {
+		t.Errorf("Bに届いたパケット = %d, 期待値 2", len(gotB.in))
+	}
+}
+
+// mutateLayerは受信したパケットのデータを別のゴルーチンで書き換える受信側。
+// 同じデバイスの中ではパケットを共有するため、書き換えるパケットは上位層へ渡さない。
+type mutateLayer struct {
+	wg   *sync.WaitGroup
+	mu   sync.Mutex
+	seen []string // 書き換える前に読んだデータ
+}
+
+func (l *mutateLayer) HandleOutgoing(p Packet) Packet { return p }
+func (l *mutateLayer) HandleIncoming(p Packet) (Packet, bool) {
+	l.mu.Lock()
+	l.seen = append(l.seen, string(p.Data))
+	l.mu.Unlock()
+	l.wg.Add(1)
+	go func(data []byte) {
+		defer l.wg.Done()
+		for i := range data {
+			data[i] = 'x'
+		}
+	}(p.Data)
+	return p, false
+}
+func (l *mutateLayer) GetName() string { return "Mutate" }
+
+// TestBroadcastCopiesAreIndependentは、ブロードキャストを受け取った各ホストがデータを別のゴルーチンで
+// 書き換えても互いに干渉しないことを確かめる。データ競合はgo test -raceで検出する。
+func TestBroadcastCopiesAreIndependent(t *testing.T) {
+	n, a, b, c, s := newTestLAN3(t)
+	d := newTestHost("D", "AA:AA:AA:AA:AA:04", "10.0.0.4")
+	n.AddDevice(d)
+	n.AddBidirectionalLink(d, s, time.Millisecond)
+	skipAnnounce(a, b, c, d)
+	var wg sync.WaitGroup
+	receivers := []*Host{b, c, d}
+	layers := make([]*mutateLayer, len(receivers))
+	for i, h := range receivers {
+		layers[i] = &mutateLayer{wg: &wg}
+		h.Layers = []Layer{h.Layers[0], layers[i]}
+	}
+	data := []byte("broadcast")
+	for i := 0; i < 3; i++ {
+		a.SendPacket(Packet{SrcIP: "10.0.0.1", SrcMAC: "AA:AA:AA:AA:AA:01", DstMAC: BroadcastMAC, Data: data})
+	}
+	// 送信した後に送信元がデータを書き換えても伝送中のパケットは変わらない
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		copy(data, "overwrite")
+	}()
+	runBus(t, n)
+	wg.Wait()
+	for i, l := range layers {
+		if len(l.seen) != 3 {
+			t.Fatalf("%s が受信したパケット = %d, 期待値 3", receivers[i].Name, len(l.seen))
+		}
+		for _, got := range l.seen {
+			if got != "broadcast" {
+				t.Errorf("%s が受信したデータ = %q, 期待値 %q", receivers[i].Name, got, "broadcast")
+			}
+		}
+	}
+	if string(data) != "overwrite" {
+		t.Errorf("受信側の書き換えが送信元のデータに影響した: %q", data)
+	}
+}
+
+func TestSwitchUnknownUnicast(t *testing.T) {
+	tests := []struct {
+		name     string
+		drop     bool
+		received int // BとCのそれぞれに届くフレーム数
+		dropped  int
+	}{
+		{"既定では未学習のMAC宛てをフラッディング", false, 1, 0},
+		{"DropUnknownUnicastなら破棄", true, 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, a, b, c, s := newTestLAN3(t)
+			skipAnnounce(a, b, c)
+			s.DropUnknownUnicast = tt.drop
+			a.SendPacket(lanPacket(a, b, "unknown")) // BもCもまだ送信していないため未学習
+			runBus(t, n)
+			if b.Stats.Received != tt.received || c.Stats.Received != tt.received {
+				t.Errorf("BとCに届いたフレーム = %d, %d, 期待値 %d", b.Stats.Received, c.Stats.Received, tt.received)
+			}
+			if got := s.Stats.Dropped[DropUnknownUnicast]; got != tt.dropped {
+				t.Errorf("%s = %d, 期待値 %d", DropUnknownUnicast, got, tt.dropped)
+			}
+
+			// 学習済みの宛先とブロードキャストは設定によらず届く
+			b.SendPacket(lanPacket(b, a, "learn"))
+			runBus(t, n)
+			received := b.Stats.Received
+			a.SendPacket(lanPacket(a, b, "known"))
+			a.SendPacket(Packet{SrcIP: "10.0.0.1", SrcMAC: "AA:AA:AA:AA:AA:01", DstMAC: BroadcastMAC, Data: []byte("all")})
+			runBus(t, n)
+			if got := b.Stats.Received - received; got != 2 {
+				t.Errorf("学習後にBに届いたフレーム = %d, 期待値 2", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+)
+
+const (
+	DefaultMSS        = 536   // セグメントの既定の最大データ長（バイト）
+	tcpInitialSeq     = 1000  // コネクションの初期シーケンス番号
+	tcpEphemeralStart = 49152 // Dialで割り当てる送信元ポートの開始番号
+)
+
+// TCPStateはTCPのコネクションの状態を表す。
+type TCPState int
+
+const (
+	TCPClosed      TCPState = iota // 未接続
+	TCPSynSent                     // SYNを送ってSYN-ACKを待っている
+	TCPSynReceived                 // SYNを受けてSYN-ACKを送り、ACKを待っている
+	TCPEstablished                 // 確立済み（データを送受信できる）
+)
+
+func (s TCPState) String() string {
+	switch s {
+	case TCPSynSent:
+		return "SYN_SENT"
+	case TCPSynReceived:
+		return "SYN_RECEIVED"
+	case TCPEstablished:
+		return "ESTABLISHED"
+	default:
+		return "CLOSED"
+	}
+}
+
+// tcpKeyはコネクションを自分のポートと相手のIPアドレス、ポートで識別する。
+type tcpKey struct {
+	LocalPort  int
+	RemoteIP   string
+	RemotePort int
+}
+
+// TCPConnはTCPLayerが管理する1つのコネクションを表す。
+// 受け取ったデータはシーケンス番号の順に並べ直してからOnDataに渡す。
+type TCPConn struct {
+	LocalPort  int      // 自分のポート
+	RemoteIP   string   // 相手のIPアドレス
+	RemotePort int      // 相手のポート
+	State      TCPState // コネクションの状態
+
+	OnEstablished func()            // 確立した時に呼ばれるコールバック（nilなら呼ばない）
+	OnData        func(data []byte) // 順番通りにそろったデータを受け取るコールバック
+
+	BytesSent     int // 送信したデータのバイト数
+	BytesReceived int // OnDataへ渡したデータのバイト数
+	BytesAcked    int // 相手が確認応答したデータのバイト数
+
+	layer      *TCPLayer
+	sndNxt     int            // 次に送るデータのシーケンス番号
+	sndUna     int            // 確認応答されていない最初のシーケンス番号
+	rcvNxt     int            // 次に受け取るはずのシーケンス番号
+	unsent     []byte         // 確立前に書き込まれたデータ
+	outOfOrder map[int][]byte // 先に届いた、順番の飛んだセグメント
+}
+
+// TCPLayerはSYN、SYN-ACK、ACKの3ウェイハンドシェイクでコネクションを確立し、
+// シーケンス番号でバイト列を順番通りにアプリケーションへ届けるTCPの層を表す。
+// 再送は行わないため、ロスのあるリンクではデータが届かないことがある。
+type TCPLayer struct {
+	TransportLayer
+	MSS int // セグメントの最大データ長（バイト、0なら既定値）
+
+	conns     map[tcpKey]*TCPConn      // 確立中と確立済みのコネクション
+	listeners map[int]func(c *TCPConn) // 待ち受けポートごとの受け入れコールバック
+	nextPort  int                      // 最後に割り当てた送信元ポート
+}
+
+// Listenはportで接続を待ち受け、コネクションが確立するたびにacceptを呼ぶ。
+func (tl *TCPLayer) Listen(port int, accept func(c *TCPConn)) {
+	if tl.listeners == nil {
+		tl.listeners = make(map[int]func(c *TCPConn))
+	}
+	tl.listeners[port] = accept
+}
+
+// DialはdstIPのdstPortへSYNを送って接続を始め、確立中のコネクションを返す。
+// 確立前にWriteしたデータは確立後に送る。
+func (tl *TCPLayer) Dial(dstIP string, dstPort int) *TCPConn {
+	if tl.nextPort == 0 {
+		tl.nextPort = tcpEphemeralStart - 1
+	}
+	tl.nextPort++
+	c := tl.newConn(tcpKey{LocalPort: tl.nextPort, RemoteIP: dstIP, RemotePort: dstPort})
+	c.State = TCPSynSent
+	tl.log().Debugf("[TCP] %s: %s:%d へ接続開始 (ポート %d)", tl.Name, dstIP, dstPort, c.LocalPort)
+	c.send(FlagSYN, tcpInitialSeq, nil)
+	return c
+}
+
+// Connsは確立中と確立済みのコネクションの数を返す。
+func (tl *TCPLayer) Conns() int {
+	return len(tl.conns)
+}
+
+// newConnはkeyのコネクションを作成して登録する。
+func (tl *TCPLayer) newConn(key tcpKey) *TCPConn {
+	c := &TCPConn{
+		LocalPort:  key.LocalPort,
+		RemoteIP:   key.RemoteIP,
+		RemotePort: key.RemotePort,
+		layer:      tl,
+		sndNxt:     tcpInitialSeq + 1, // SYNがシーケンス番号を1つ使う
+		sndUna:     tcpInitialSeq + 1,
+	}
+	if tl.conns == nil {
+		tl.conns = make(map[tcpKey]*TCPConn)
+	}
+	tl.conns[key] = c
+	return c
+}
+
+// HandleOutgoingはTCPのセグメントに未設定のポートを補完する。TCP以外のパケットはそのまま通す。
+func (tl *TCPLayer) HandleOutgoing(p Packet) Packet {
+	if p.Proto() != ProtocolTCP {
+		return p
+	}
+	return tl.TransportLayer.HandleOutgoing(p)
+}
+
+// HandleIncomingは自分宛のTCPのセグメントを対応するコネクションで処理する。
+// 待ち受けていないポートへのSYNや、コネクションのないセグメントは破棄する。
+func (tl *TCPLayer) HandleIncoming(p Packet) (Packet, bool) {
+	if p.Proto() != ProtocolTCP || (tl.host != nil && !tl.host.addressedToMe(p)) {
+		return p, true
+	}
+	key := tcpKey{LocalPort: p.DstPort, RemoteIP: p.SrcIP, RemotePort: p.SrcPort}
+	if c, ok := tl.conns[key]; ok {
+		c.receive(p)
+		return p, true
+	}
+	accept, listening := tl.listeners[p.DstPort]
+	if !listening || p.Flags&FlagSYN == 0 || p.Flags&FlagACK != 0 {
+		tl.countDrop(DropPortUnreachable)
+		tl.log().Warnf("[TCP] %s: ポート %d に対応するコネクションがないためセグメントを破棄: %s", tl.Name, p.DstPort, p)
+		return p, false
+	}
+	c := tl.newConn(key)
+	c.State = TCPSynReceived
+	c.rcvNxt = p.Seq + 1
+	c.OnEstablished = func() { accept(c) }
+	tl.log().Debugf("[TCP] %s: %s:%d からの接続要求を受信", tl.Name, p.SrcIP, p.SrcPort)
+	c.send(FlagSYN|FlagACK, tcpInitialSeq, nil)
+	return p, true
+}
+
+// Writeはdataをコネクションで送る。MSSを超えるデータは複数のセグメントに分ける。
+// 確立前なら確立するまで保留する。
+func (c *TCPConn) Write(data []byte) {
+	if c.State != TCPEstablished {
+		c.unsent = append(c.unsent, data...)
+		return
+	}
+	mss := c.layer.MSS
+	if mss <= 0 {
+		mss = DefaultMSS
+	}
+	for len(data) > 0 {
+		n := min(len(data), mss)
+		c.send(FlagACK, c.sndNxt, data[:n])
+		c.sndNxt += n
+		c.BytesSent += n
+		data = data[n:]
+	}
+}
+
+// sendはフラグとシーケンス番号、データを持つセグメントを相手へ送る。
+func (c *TCPConn) send(flags Flag, seq int, data []byte) {
+	tl := c.layer
+	if tl.host == nil {
+		return
+	}
+	tl.host.SendPacket(Packet{
+		Data:     append([]byte(nil), data...),
+		DstIP:    c.RemoteIP,
+		SrcPort:  c.LocalPort,
+		DstPort:  c.RemotePort,
+		Protocol: ProtocolTCP,
+		Flags:    flags,
+		Seq:      seq,
+		Ack:      c.rcvNxt,
+	})
+}
+
+// receiveはコネクションに届いたセグメントを状態に応じて処理する。
+func (c *TCPConn) receive(p Packet) {
+	tl := c.layer
+	switch {
+	case c.State == TCPSynSent && p.Flags&(FlagSYN|FlagACK) == FlagSYN|FlagACK && p.Ack == c.sndNxt:
+		c.rcvNxt = p.Seq + 1
+		c.send(FlagACK, c.sndNxt, nil)
+		c.establish()
+		return
+	case c.State == TCPSynReceived && p.Flags&FlagACK != 0 && p.Ack >= c.sndNxt && p.Seq == c.rcvNxt:
+		c.establish()
+	case c.State != TCPEstablished:
+		tl.log().Debugf("[TCP] %s: %s のコネクションで想定外のセグメントを無視%s", tl.Name, c, p.traceTag())
+		return
+	}
+	if p.Flags&FlagACK != 0 && p.Ack > c.sndUna && p.Ack <= c.sndNxt {
+		c.BytesAcked += p.Ack - c.sndUna
+		c.sndUna = p.Ack
+	}
+	if len(p.Data) == 0 {
+		return
+	}
+	if p.Seq >= c.rcvNxt {
+		if c.outOfOrder == nil {
+			c.outOfOrder = make(map[int][]byte)
+		}
+		c.outOfOrder[p.Seq] = p.Data
+	}
+	for {
+		data, ok := c.outOfOrder[c.rcvNxt]
+		if !ok {
+			break
+		}
+		delete(c.outOfOrder, c.rcvNxt)
+		c.rcvNxt += len(data)
+		c.BytesReceived += len(data)
+		if c.OnData != nil {
+			c.OnData(data)
+		}
+	}
+	c.send(FlagACK, c.sndNxt, nil) // 受け取った所までを確認応答する
+}
+
+// establishはコネクションを確立済みにし、保留していたデータを送る。
+func (c *TCPConn) establish() {
+	c.State = TCPEstablished
+	c.layer.log().Debugf("[TCP] %s: %s のコネクションを確立", c.layer.Name, c)
+	if c.OnEstablished != nil {
+		c.OnEstablished()
+	}
+	if unsent := c.unsent; len(unsent) > 0 {
+		c.unsent = nil
+		c.Write(unsent)
+	}
+}
+
+// Stringはコネクションを「ポート->IP:ポート」の形式で返す。
+func (c *TCPConn) String() string {
+	return fmt.Sprintf("%d->%s:%d", c.LocalPort, c.RemoteIP, c.RemotePort)
+}
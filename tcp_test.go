@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+)
+
+// newTestTCPはnewTestLANのAとBにTCP層を積み、その下に受信したセグメントを記録する層を置く。
+func newTestTCP(t *testing.T) (*Network, *Host, *Host, *TCPLayer, *TCPLayer, *recordLayer, *recordLayer) {
+	n, a, b, _ := newTestLAN(t)
+	var layers [2]*TCPLayer
+	var segments [2]*recordLayer
+	for i, h := range []*Host{a, b} {
+		segments[i] = record(h)
+		layers[i] = &TCPLayer{TransportLayer: TransportLayer{Name: "TCP"}}
+		h.Layers = append(h.Layers, layers[i])
+		layers[i].bindHost(h)
+	}
+	return n, a, b, layers[0], layers[1], segments[0], segments[1]
+}
+
+// tcpFlagsは記録したTCPのセグメントのフラグを順に返す。
+func tcpFlags(rec *recordLayer) []Flag {
+	var flags []Flag
+	for _, p := range rec.in {
+		if p.Proto() == ProtocolTCP {
+			flags = append(flags, p.Flags)
+		}
+	}
+	return flags
+}
+
+func TestTCPHandshake(t *testing.T) {
+	n, _, _, client, server, toA, toB := newTestTCP(t)
+	var accepted []*TCPConn
+	server.Listen(80, func(c *TCPConn) { accepted = append(accepted, c) })
+	c := client.Dial("10.0.0.2", 80)
+	if c.State != TCPSynSent {
+		t.Fatalf("Dial直後の状態 = %v, 期待値 %v", c.State, TCPSynSent)
+	}
+	runBus(t, n)
+	if c.State != TCPEstablished || len(accepted) != 1 || accepted[0].State != TCPEstablished {
+		t.Fatalf("クライアント %v, 受け入れたコネクション %d, 期待値 確立済みが1つずつ", c.State, len(accepted))
+	}
+	if s := accepted[0]; s.RemoteIP != "10.0.0.1" || s.RemotePort != c.LocalPort || s.LocalPort != 80 {
+		t.Errorf("受け入れたコネクション = %v, 期待値 80->10.0.0.1:%d", s, c.LocalPort)
+	}
+	if got := tcpFlags(toB); !slices.Equal(got, []Flag{FlagSYN, FlagACK}) {
+		t.Errorf("Bが受信したセグメントのフラグ = %v, 期待値 [SYN ACK]", got)
+	}
+	if got := tcpFlags(toA); !slices.Equal(got, []Flag{FlagSYN | FlagACK}) {
+		t.Errorf("Aが受信したセグメントのフラグ = %v, 期待値 [SYN|ACK]", got)
+	}
+	if client.Conns() != 1 || server.Conns() != 1 {
+		t.Errorf("コネクション数 = %d, %d, 期待値 1, 1", client.Conns(), server.Conns())
+	}
+}
+
+func TestTCPSegmentsByMSS(t *testing.T) {
+	n, _, _, client, server, _, toB := newTestTCP(t)
+	client.MSS = 100
+	var chunks [][]byte
+	server.Listen(80, func(c *TCPConn) {
+		c.OnData = func(data []byte) { chunks = append(chunks, data) }
+	})
+	data := bytes.Repeat([]byte("0123456789"), 25)
+	c := client.Dial("10.0.0.2", 80)
+	c.Write(data) // 確立するまで保留される
+	runBus(t, n)
+
+	var sizes []int
+	for _, p := range toB.in {
+		if p.Proto() == ProtocolTCP && len(p.Data) > 0 {
+			sizes = append(sizes, len(p.Data))
+		}
+	}
+	if !slices.Equal(sizes, []int{100, 100, 50}) {
+		t.Errorf("セグメントのデータ長 = %v, 期待値 [100 100 50]", sizes)
+	}
+	if got := bytes.Join(chunks, nil); !bytes.Equal(got, data) {
+		t.Errorf("受け取ったデータ = %q, 期待値 %q", got, data)
+	}
+	if c.BytesSent != 250 || c.BytesAcked != 250 {
+		t.Errorf("送信 %d, 確認応答 %d バイト, 期待値 250, 250", c.BytesSent, c.BytesAcked)
+	}
+}
+
+func TestTCPReassemblesOutOfOrder(t *testing.T) {
+	n, a, b, client, server, _, _ := newTestTCP(t)
+	var conn *TCPConn
+	var got []string
+	server.Listen(80, func(c *TCPConn) {
+		conn = c
+		c.OnData = func(data []byte) { got = append(got, string(data)) }
+	})
+	c := client.Dial("10.0.0.2", 80)
+	runBus(t, n)
+	if conn == nil {
+		t.Fatal("コネクションが確立していない")
+	}
+	segment := func(seq int, data string) Packet {
+		p := lanPacket(a, b, data)
+		p.Protocol, p.Flags = ProtocolTCP, FlagACK
+		p.SrcPort, p.DstPort, p.Seq = c.LocalPort, 80, seq
+		return p
+	}
+	seq := c.sndNxt
+	b.ReceivePacket(segment(seq+len("hello "), "world"))
+	if len(got) != 0 {
+		t.Fatalf("順番の飛んだセグメントを先に渡した: %v", got)
+	}
+	b.ReceivePacket(segment(seq, "hello "))
+	if !slices.Equal(got, []string{"hello ", "world"}) {
+		t.Errorf("受け取ったデータ = %q, 期待値 [hello  world]", got)
+	}
+	b.ReceivePacket(segment(seq, "hello ")) // 受け取り済みの再送は渡さない
+	if len(got) != 2 || conn.BytesReceived != len("hello world") {
+		t.Errorf("重複したセグメントの後: %q, %d バイト", got, conn.BytesReceived)
+	}
+}
+
+func TestTCPSynReceivedChecksSeq(t *testing.T) {
+	n, a, b, _, server, _, _ := newTestTCP(t)
+	established := 0
+	server.Listen(80, func(*TCPConn) { established++ })
+	segment := func(flags Flag, seq, ack int) Packet {
+		p := lanPacket(a, b, "")
+		p.Protocol, p.Flags = ProtocolTCP, flags
+		p.SrcPort, p.DstPort, p.Seq, p.Ack = 5555, 80, seq, ack
+		return p
+	}
+	b.ReceivePacket(segment(FlagSYN, 500, 0))
+	b.ReceivePacket(segment(FlagACK, 999, tcpInitialSeq+1)) // SYNの次ではないシーケンス番号
+	if established != 0 {
+		t.Fatal("シーケンス番号の合わないACKで確立した")
+	}
+	b.ReceivePacket(segment(FlagACK, 501, tcpInitialSeq+1))
+	if established != 1 {
+		t.Errorf("正しいACKで確立した回数 = %d, 期待値 1", established)
+	}
+	runBus(t, n)
+}
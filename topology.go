@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// TopologyConfigはJSONまたはYAMLで記述されたネットワーク構成を表す。
+type TopologyConfig struct {
+	Devices []DeviceConfig `json:"devices"` // デバイスの一覧
+	Links   []LinkConfig   `json:"links"`   // リンクの一覧
+}
+
+// DeviceConfigはデバイス1台分の設定を表す。
+type DeviceConfig struct {
+	Type string `json:"type"` // デバイスの種類（host, switch, router, hub）
+	Name string `json:"name"` // デバイスの名前
+	IP   string `json:"ip"`   // ホストのIPアドレス
+	MAC  string `json:"mac"`  // ホストのMACアドレス
+
+	SubnetMask string `json:"subnet_mask,omitempty"` // ホストのサブネットマスク
+	Gateway    string `json:"gateway,omitempty"`     // ホストのデフォルトゲートウェイ
+}
+
+// LinkConfigはリンク1本分の設定を表す。
+type LinkConfig struct {
+	From      string `json:"from"`      // 送信元デバイスの名前
+	To        string `json:"to"`        // 宛先デバイスの名前
+	Delay     string `json:"delay"`     // 伝送遅延（例："50ms"）
+	Bandwidth int64  `json:"bandwidth"` // 帯域幅（bps、省略時は無制限）
+
+	LossRate float64 `json:"loss_rate,omitempty"` // パケットロス率（0.0〜1.0）
+	Jitter   string  `json:"jitter,omitempty"`    // 遅延の揺らぎの幅（例："5ms"）
+	MTU      int     `json:"mtu,omitempty"`       // 1パケットで運べる最大データ長（バイト、省略時は無制限）
+	Duplex   string  `json:"duplex,omitempty"`    // 通信方式（full または half、省略時は full）
+}
+
+// LoadTopologyはJSONファイルからネットワーク構成を読み込み、ネットワークを構築。
+// 知らないキーがあればエラーにする。
+func LoadTopology(path string) (*Network, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("トポロジーファイルを読み込めません: %w", err)
+	}
+	cfg, err := decodeTopology(data)
+	if err != nil {
+		return nil, fmt.Errorf("トポロジーファイル %s の解析に失敗: %w", path, err)
+	}
+	return cfg.Build()
+}
+
+// decodeTopologyはJSONのネットワーク構成を読み込む。設定の書き間違いに気づけるよう知らないキーはエラーにする。
+func decodeTopology(data []byte) (TopologyConfig, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var cfg TopologyConfig
+	err := dec.Decode(&cfg)
+	return cfg, err
+}
+
+// newDeviceは設定の種類に応じたデバイスを作成する。
+func (dc DeviceConfig) newDevice() (Device, error) {
+	switch dc.Type {
+	case "host":
+		return &Host{
+			Name: dc.Name,
+			Layers: []Layer{
+				&DataLinkLayer{Name: "DataLink", MAC: dc.MAC},
+				&NetworkLayer{Name: "Network", IP: dc.IP, SubnetMask: dc.SubnetMask, Gateway: dc.Gateway},
+			},
+		}, nil
+	case "switch":
+		return &Switch{Name: dc.Name}, nil
+	case "router":
+		return &Router{Name: dc.Name}, nil
+	case "hub":
+		return &Hub{Name: dc.Name}, nil
+	}
+	return nil, fmt.Errorf("デバイス %q の種類 %q は不明です", dc.Name, dc.Type)
+}
+
+// Buildは設定に従ってデバイスとリンクを作成し、ネットワークを構築。
+func (c TopologyConfig) Build() (*Network, error) {
+	n := NewNetwork()
+	devices := make(map[string]Device)
+	for _, dc := range c.Devices {
+		if dc.Name == "" {
+			return nil, fmt.Errorf("デバイスの名前が指定されていません (種類 %q)", dc.Type)
+		}
+		if _, dup := devices[dc.Name]; dup {
+			return nil, fmt.Errorf("デバイス名 %q が重複しています", dc.Name)
+		}
+		d, err := dc.newDevice()
+		if err != nil {
+			return nil, err
+		}
+		devices[dc.Name] = d
+		n.AddDevice(d)
+	}
+
+	for i, lc := range c.Links {
+		from, ok := devices[lc.From]
+		if !ok {
+			return nil, fmt.Errorf("リンク %d の送信元 %q が存在しません", i, lc.From)
+		}
+		to, ok := devices[lc.To]
+		if !ok {
+			return nil, fmt.Errorf("リンク %d の宛先 %q が存在しません", i, lc.To)
+		}
+		var delay time.Duration
+		if lc.Delay != "" {
+			var err error
+			if delay, err = time.ParseDuration(lc.Delay); err != nil {
+				return nil, fmt.Errorf("リンク %d (%s -> %s) の遅延 %q が不正です: %w", i, lc.From, lc.To, lc.Delay, err)
+			}
+		}
+		var jitter time.Duration
+		if lc.Jitter != "" {
+			var err error
+			if jitter, err = time.ParseDuration(lc.Jitter); err != nil {
+				return nil, fmt.Errorf("リンク %d (%s -> %s) の揺らぎ %q が不正です: %w", i, lc.From, lc.To, lc.Jitter, err)
+			}
+		}
+		if lc.LossRate < 0 || lc.LossRate > 1 {
+			return nil, fmt.Errorf("リンク %d (%s -> %s) のロス率 %v は0.0〜1.0の範囲外です", i, lc.From, lc.To, lc.LossRate)
+		}
+		duplex := FullDuplex
+		switch lc.Duplex {
+		case "", "full":
+		case "half":
+			duplex = HalfDuplex
+		default:
+			return nil, fmt.Errorf("リンク %d (%s -> %s) の通信方式 %q は不明です", i, lc.From, lc.To, lc.Duplex)
+		}
+		link := n.AddLink(from, to, delay)
+		link.Bandwidth = lc.Bandwidth
+		link.LossRate = lc.LossRate
+		link.Jitter = jitter
+		link.MTU = lc.MTU
+		link.Duplex = duplex
+		wireLink(from, to, link)
+	}
+	return n, nil
+}
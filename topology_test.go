@@ -0,0 +1,109 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTopologyFileは一時ディレクトリにトポロジーファイルを書き出し、そのパスを返す。
+func writeTopologyFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// testdata/main.jsonはmainで組み立てるトポロジーと同じ構成。
+func TestLoadTopologyMatchesMain(t *testing.T) {
+	n, err := LoadTopology("testdata/main.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(n.Devices) != 3 {
+		t.Fatalf("デバイス数 = %d, 期待値 3", len(n.Devices))
+	}
+	host1, ok := n.Devices[0].(*Host)
+	if !ok {
+		t.Fatal("Host1 がホストとして作られていない")
+	}
+	host2, ok := n.Devices[1].(*Host)
+	if !ok {
+		t.Fatal("Host2 がホストとして作られていない")
+	}
+	switch1, ok := n.Devices[2].(*Switch)
+	if !ok {
+		t.Fatal("Switch1 がスイッチとして作られていない")
+	}
+	if ip, mac := host1.networkLayer().IP, host1.dataLinkLayer().MAC; ip != "192.168.1.1" || mac != "AA:BB:CC:DD:EE:01" {
+		t.Errorf("Host1 のアドレス = %s %s", ip, mac)
+	}
+	if ip, mac := host2.networkLayer().IP, host2.dataLinkLayer().MAC; ip != "192.168.1.2" || mac != "AA:BB:CC:DD:EE:02" {
+		t.Errorf("Host2 のアドレス = %s %s", ip, mac)
+	}
+	for _, pair := range [][2]Device{{host1, switch1}, {switch1, host1}, {host2, switch1}, {switch1, host2}} {
+		l := n.GetLink(pair[0], pair[1])
+		if l == nil {
+			t.Errorf("%s -> %s のリンクがない", pair[0].GetName(), pair[1].GetName())
+			continue
+		}
+		if l.Delay != 50*time.Millisecond {
+			t.Errorf("%s -> %s の遅延 = %v, 期待値 50ms", pair[0].GetName(), pair[1].GetName(), l.Delay)
+		}
+	}
+	if host1.ConnectedDev != switch1 || host2.ConnectedDev != switch1 || len(switch1.Ports) != 2 {
+		t.Error("ホストとスイッチが接続されていない")
+	}
+
+	got := &recordLayer{}
+	host2.Layers = append(host2.Layers, got)
+	host1.SendPacket(Packet{SrcIP: "192.168.1.1", DstIP: "192.168.1.2", Data: []byte("Hello Network!!")})
+	n.Bus.Run()
+	if len(got.in) != 1 || string(got.in[0].Data) != "Hello Network!!" {
+		t.Fatalf("Host2 に届いたパケット = %v", got.in)
+	}
+	if at := elapsed(n); at != 300*time.Millisecond { // ARPの往復とデータ、それぞれ2ホップ
+		t.Errorf("終了時刻 = %v, 期待値 300ms", at)
+	}
+}
+
+func TestLoadTopologyErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string // エラーメッセージに含まれるべき文字列
+	}{
+		{"不明な種類", `{"devices": [{"type": "modem", "name": "M"}]}`, `"modem"`},
+		{"存在しない送信元", `{"devices": [{"type": "switch", "name": "S"}], "links": [{"from": "X", "to": "S"}]}`, `送信元 "X"`},
+		{"存在しない宛先", `{"devices": [{"type": "switch", "name": "S"}], "links": [{"from": "S", "to": "Y"}]}`, `宛先 "Y"`},
+		{"重複した名前", `{"devices": [{"type": "switch", "name": "S"}, {"type": "router", "name": "S"}]}`, "重複"},
+		{"不正な遅延", `{"devices": [{"type": "switch", "name": "S"}, {"type": "router", "name": "R"}], "links": [{"from": "S", "to": "R", "delay": "fast"}]}`, `"fast"`},
+		{"JSONの構文エラー", `{"devices": [`, "解析に失敗"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadTopology(writeTopologyFile(t, "topology.json", tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("エラー = %v, %q を含むこと", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadTopologyMissingFile(t *testing.T) {
+	if _, err := LoadTopology("testdata/missing.json"); err == nil {
+		t.Error("存在しないファイルでエラーにならない")
+	}
+}
+
+func TestLoadTopologyUnknownKey(t *testing.T) {
+	path := writeTopologyFile(t, "bad.json", `{"devices": [{"type": "host", "name": "A", "adress": "10.0.0.1"}]}`)
+	_, err := LoadTopology(path)
+	if err == nil || !strings.Contains(err.Error(), "adress") {
+		t.Errorf("知らないキーのエラー = %v", err)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strconv"
+	"time"
+)
+
+// TraceActionはトレースに記録するパケットの処理の種類を表す。
+type TraceAction string
+
+const (
+	TraceSend     TraceAction = "send"     // ホストが送信を開始した
+	TraceTransmit TraceAction = "transmit" // リンクへ送出した
+	TraceReceive  TraceAction = "receive"  // デバイスが受信した
+	TraceDrop     TraceAction = "drop"     // リンク上で失われた
+)
+
+// TraceEventはトレースIDを持つパケットが通過したデバイスやリンクの記録を表す。
+type TraceEvent struct {
+	Time   time.Time   // 処理した仮想時刻
+	Name   string      // デバイス名またはリンク名（「送信元->宛先」）
+	Action TraceAction // 処理の種類
+}
+
+// traceTagはログの末尾に付けるトレースIDの表記を返す（IDがなければ空文字列）。
+func (p Packet) traceTag() string {
+	if p.TraceID == "" {
+		return ""
+	}
+	return " [trace " + p.TraceID + "]"
+}
+
+// nextTraceIDはネットワーク内で一意なトレースIDを割り当てる。
+func (n *Network) nextTraceID() string {
+	n.traceSeq++
+	return "t" + strconv.Itoa(n.traceSeq)
+}
+
+// recordTraceはトレースIDを持つパケットの処理を記録する。
+func (n *Network) recordTrace(p Packet, name string, action TraceAction) {
+	if n == nil || p.TraceID == "" {
+		return
+	}
+	if n.traces == nil {
+		n.traces = make(map[string][]TraceEvent)
+	}
+	n.traces[p.TraceID] = append(n.traces[p.TraceID], TraceEvent{Time: n.Bus.Now(), Name: name, Action: action})
+}
+
+// Traceはトレースidのパケットが通過したデバイスとリンクを処理順に返す。
+func (n *Network) Trace(id string) []TraceEvent {
+	return append([]TraceEvent(nil), n.traces[id]...)
+}
+
+// ClearTracesは記録済みのトレースを全て破棄する。
+func (n *Network) ClearTraces() {
+	n.traces = nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// traceStepsはトレースを「名前:処理」の並びにする。
+func traceSteps(events []TraceEvent) string {
+	steps := make([]string, len(events))
+	for i, e := range events {
+		steps[i] = fmt.Sprintf("%s:%s", e.Name, e.Action)
+	}
+	return strings.Join(steps, " ")
+}
+
+func TestTracePerPacket(t *testing.T) {
+	n, a, b, c, _ := newTestLAN3(t)
+	var buf bytes.Buffer
+	n.SetLogger(NewWriterLogger(&buf, LevelDebug))
+	a.SendPacket(lanPacket(a, b, "from a"))
+	c.SendPacket(lanPacket(c, b, "from c"))
+	n.Bus.Run()
+	tests := []struct {
+		id   string
+		want string
+	}{
+		// Bは未学習のためスイッチがフラッディングし、Cにも届く
+		{"t1", "A:send A->S:transmit S:receive S->B:transmit S->C:transmit B:receive C:receive"},
+		// 同時に送るためBは未学習のままで、こちらもフラッディングされる
+		{"t2", "C:send C->S:transmit S:receive S->A:transmit S->B:transmit A:receive B:receive"},
+	}
+	for _, tt := range tests {
+		if got := traceSteps(n.Trace(tt.id)); got != tt.want {
+			t.Errorf("Trace(%s) = %s, 期待値 %s", tt.id, got, tt.want)
+		}
+	}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if strings.HasPrefix(line, "[Switch]") && !strings.Contains(line, "[trace t") && strings.Contains(line, "転送") {
+			t.Errorf("スイッチの転送のログにトレースIDがない: %s", line)
+		}
+	}
+	if !strings.Contains(buf.String(), "[MAC] DataLink: 自分宛のRAWパケットを受信: From 10.0.0.3") {
+		t.Errorf("ログにMAC層の受信がない")
+	}
+	n.ClearTraces()
+	if len(n.Trace("t1")) != 0 {
+		t.Error("ClearTracesの後もトレースが残っている")
+	}
+}
+
+func TestTraceKeepsGivenID(t *testing.T) {
+	n, a, b, _ := newTestLAN(t)
+	p := lanPacket(a, b, "hello")
+	p.TraceID = "mine"
+	got := record(b)
+	a.SendPacket(p)
+	n.Bus.Run()
+	if len(got.in) != 1 || got.in[0].TraceID != "mine" {
+		t.Fatalf("届いたパケットのトレースID = %v", got.in)
+	}
+	if steps := traceSteps(n.Trace("mine")); !strings.HasSuffix(steps, "B:receive") {
+		t.Errorf("Trace(mine) = %s", steps)
+	}
+}
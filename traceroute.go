@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// DefaultTracerouteMaxHopsはTracerouteが調べる最大のホップ数。
+const DefaultTracerouteMaxHops = 30
+
+// TracerouteHopはTracerouteの1ホップ分の結果を表す。
+type TracerouteHop struct {
+	TTL int           // 送信したエコー要求のTTL
+	IP  string        // 応答したデバイスのIPアドレス（応答がなければ空）
+	RTT time.Duration // 応答までの往復時間
+}
+
+// Tracerouteはsrcから宛先へTTLを1から順に増やしたエコー要求を送り、時間超過を返したルータを
+// 経路の順に返す。宛先からエコー応答が届くか、DefaultTracerouteMaxHopsに達すると終了する。
+// 各要求はDefaultPingTimeout以内に応答がなければ応答なしとして次のTTLへ進む。
+func (n *Network) Traceroute(src *Host, dstIP string) ([]TracerouteHop, error) {
+	if src.Network != n {
+		return nil, fmt.Errorf("ホスト %s はこのネットワークに属していません", src.Name)
+	}
+	if net.ParseIP(dstIP) == nil {
+		return nil, fmt.Errorf("不正な宛先IP %q", dstIP)
+	}
+	if src.networkLayer() == nil {
+		return nil, fmt.Errorf("ホスト %s にネットワーク層がありません", src.Name)
+	}
+
+	n.pingID++
+	id := n.pingID
+	ps := &pingSession{bus: n.Bus, sentAt: make(map[int]time.Time)}
+	if src.pings == nil {
+		src.pings = make(map[int]*pingSession)
+	}
+	src.pings[id] = ps
+	defer delete(src.pings, id)
+
+	var hops []TracerouteHop
+	for ttl := 1; ttl <= DefaultTracerouteMaxHops; ttl++ {
+		hop := TracerouteHop{TTL: ttl}
+		ps.onReply = func(seq int, from string, rtt time.Duration) {
+			if seq == ttl {
+				hop.IP, hop.RTT = from, rtt
+			}
+		}
+		ps.sentAt[ttl] = n.Bus.Now()
+		ps.pending = 1
+		src.SendPacket(Packet{
+			Data:     make([]byte, pingPayloadSize),
+			DstIP:    dstIP,
+			TTL:      ttl,
+			Protocol: ProtocolICMP,
+			ICMP:     &ICMPMessage{Type: ICMPEchoRequest, ID: id, Seq: ttl},
+		})
+		n.Bus.AddEvent(DefaultPingTimeout, func() {
+			if _, waiting := ps.sentAt[ttl]; waiting {
+				delete(ps.sentAt, ttl)
+				ps.pending--
+				n.log().Warnf("[Traceroute] %s: TTL %d の応答がタイムアウト", src.Name, ttl)
+			}
+		})
+		for ps.pending > 0 && n.Bus.Step() {
+		}
+		hops = append(hops, hop)
+		n.log().Infof("[Traceroute] %s -> %s: %d %s %v", src.Name, dstIP, ttl, hop.IP, hop.RTT)
+		if sameIP(hop.IP, dstIP) {
+			break
+		}
+	}
+	return hops, nil
+}
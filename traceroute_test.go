@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// newTestTwoRouterNetはホストA（10.0.0.1）からルータR1、R2を経てホストB（203.0.113.1）へ至る
+// ネットワークを1msのリンクで作る。R1とR2は10.0.1.0/24で直結し、互いの先のサブネットへの経路を持つ。
+func newTestTwoRouterNet(t *testing.T) (*Network, *Host, *Host, *Router, *Router) {
+	t.Helper()
+	n := newTestNetwork(t)
+	a := newTestHost("A", "AA:AA:AA:AA:AA:01", "10.0.0.1")
+	b := newTestHost("B", "AA:AA:AA:AA:AA:02", "203.0.113.1")
+	a.networkLayer().SubnetMask, a.networkLayer().Gateway = "255.255.255.0", "10.0.0.254"
+	b.networkLayer().SubnetMask, b.networkLayer().Gateway = "255.255.255.0", "203.0.113.254"
+	r1, r2 := &Router{Name: "R1"}, &Router{Name: "R2"}
+	for _, d := range []Device{a, b, r1, r2} {
+		n.AddDevice(d)
+	}
+	r1a, _ := n.AddBidirectionalLink(r1, a, time.Millisecond)
+	r1r2, r2r1 := n.AddBidirectionalLink(r1, r2, time.Millisecond)
+	r2b, _ := n.AddBidirectionalLink(r2, b, time.Millisecond)
+	for _, c := range []struct {
+		r    *Router
+		cidr string
+		mac  string
+		link *Link
+	}{
+		{r1, "10.0.0.254/24", "R1:R1:R1:R1:R1:01", r1a},
+		{r1, "10.0.1.1/24", "R1:R1:R1:R1:R1:02", r1r2},
+		{r2, "10.0.1.2/24", "R2:R2:R2:R2:R2:01", r2r1},
+		{r2, "203.0.113.254/24", "R2:R2:R2:R2:R2:02", r2b},
+	} {
+		if _, err := c.r.AddInterface(c.cidr, c.mac, c.link); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r1.AddRoute("203.0.113.0/24", r2, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := r2.AddRoute("10.0.0.0/24", r1, 1); err != nil {
+		t.Fatal(err)
+	}
+	return n, a, b, r1, r2
+}
+
+func TestTracerouteTwoRouters(t *testing.T) {
+	n, a, _, _, _ := newTestTwoRouterNet(t)
+	hops, err := n.Traceroute(a, "203.0.113.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"10.0.0.254", "10.0.1.2", "203.0.113.1"}
+	// 1ホップ目はAがゲートウェイを、3ホップ目はR2がBをARPで解決する往復（2ms）を含む
+	wantRTT := []time.Duration{4 * time.Millisecond, 4 * time.Millisecond, 8 * time.Millisecond}
+	if len(hops) != len(want) {
+		t.Fatalf("ホップ = %+v, 期待値 %v", hops, want)
+	}
+	for i, hop := range hops {
+		if hop.TTL != i+1 || hop.IP != want[i] || hop.RTT != wantRTT[i] {
+			t.Errorf("%d番目のホップ = TTL %d %s %v, 期待値 TTL %d %s %v", i+1, hop.TTL, hop.IP, hop.RTT, i+1, want[i], wantRTT[i])
+		}
+	}
+}
+
+func TestTracerouteErrors(t *testing.T) {
+	n, a, _, _, _ := newTestTwoRouterNet(t)
+	if _, err := n.Traceroute(a, "203.0.113"); err == nil {
+		t.Error("不正な宛先IPでエラーにならない")
+	}
+	other := newTestHost("X", "AA:AA:AA:AA:AA:09", "10.0.0.9")
+	if _, err := n.Traceroute(other, "203.0.113.1"); err == nil {
+		t.Error("別のネットワークのホストでエラーにならない")
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"math/rand"
+	"time"
+)
+
+// TrafficGeneratorは送信元ホストから宛先IPへ、到着間隔が指数分布に従う（ポアソン到着の）パケットを送る。
+// 同じSeedなら同じ時刻列になるため、負荷試験を再現できる。
+type TrafficGenerator struct {
+	Src   *Host   // 送信元ホスト
+	DstIP string  // 宛先IPアドレス
+	Rate  float64 // 1秒あたりの平均パケット数
+	Size  int     // 1パケットのデータ長（バイト）
+	Seed  int64   // 到着間隔を決める乱数の種
+
+	scheduled []time.Time // 送信を予約した時刻（昇順）
+	generated int         // 実際に送信したパケット数
+}
+
+// NewTrafficGeneratorはsrcからdstIPへ平均rateパケット/秒、sizeバイトのパケットを送るジェネレータを作成。
+func NewTrafficGenerator(src *Host, dstIP string, rate float64, size int, seed int64) *TrafficGenerator {
+	return &TrafficGenerator{Src: src, DstIP: dstIP, Rate: rate, Size: size, Seed: seed}
+}
+
+// Startは現在時刻からstart後に始まる長さwindowの仮想時間の区間に送信を予約し、予約したパケット数を返す。
+// 到着時刻はSeedから決まる指数分布の間隔で区間の終わりまで並べる。
+func (g *TrafficGenerator) Start(start, window time.Duration) int {
+	n := g.Src.Network
+	if n == nil {
+		return 0
+	}
+	if g.Rate <= 0 || window <= 0 {
+		n.log().Warnf("[Traffic] %s: 送信レート %v または区間 %v が不正なため予約しません", g.Src.Name, g.Rate, window)
+		return 0
+	}
+	rng := rand.New(rand.NewSource(g.Seed))
+	now := n.Bus.Now()
+	count := 0
+	for offset := time.Duration(0); ; {
+		offset += time.Duration(rng.ExpFloat64() / g.Rate * float64(time.Second))
+		if offset >= window {
+			break
+		}
+		seq := len(g.scheduled)
+		g.scheduled = append(g.scheduled, now.Add(start+offset))
+		n.Bus.AddEvent(start+offset, func() { g.send(seq) })
+		count++
+	}
+	n.log().Infof("[Traffic] %s -> %s: %v から %v の区間に %d 個のパケットを予約", g.Src.Name, g.DstIP, start, start+window, count)
+	return count
+}
+
+// sendは予約したseq番目のパケットを送信する。
+func (g *TrafficGenerator) send(seq int) {
+	if err := g.Src.Network.SendByIP(g.Src, g.DstIP, make([]byte, g.Size)); err != nil {
+		g.Src.Network.log().Warnf("[Traffic] %s: パケット %d を送信できません: %v", g.Src.Name, seq, err)
+		return
+	}
+	g.generated++
+}
+
+// Generatedはこれまでに送信したパケット数を返す。
+func (g *TrafficGenerator) Generated() int {
+	return g.generated
+}
+
+// Scheduledは送信を予約した時刻を昇順で返す。
+func (g *TrafficGenerator) Scheduled() []time.Time {
+	return append([]time.Time(nil), g.scheduled...)
+}
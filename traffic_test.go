@@ -0,0 +1,52 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// scheduleTrafficはnewTestLANのAからBへ平均rateパケット/秒のトラフィックを、1s後からwindowの区間に予約する。
+func scheduleTraffic(t *testing.T, rate float64, window time.Duration, seed int64) (*Network, *Host, *TrafficGenerator, int) {
+	n, a, b, _ := newTestLAN(t)
+	g := NewTrafficGenerator(a, b.networkLayer().IP, rate, 10, seed)
+	return n, b, g, g.Start(time.Second, window)
+}
+
+func TestTrafficGeneratorSeedDeterminism(t *testing.T) {
+	_, _, g1, count1 := scheduleTraffic(t, 50, 2*time.Second, 7)
+	_, _, g2, count2 := scheduleTraffic(t, 50, 2*time.Second, 7)
+	if count1 != count2 || !slices.Equal(g1.Scheduled(), g2.Scheduled()) {
+		t.Errorf("同じ種で予約が変わった: %d と %d 個", count1, count2)
+	}
+	if _, _, g3, _ := scheduleTraffic(t, 50, 2*time.Second, 8); slices.Equal(g1.Scheduled(), g3.Scheduled()) {
+		t.Error("種を変えても予約した時刻が同じ")
+	}
+}
+
+func TestTrafficGeneratorRate(t *testing.T) {
+	const rate, window = 100.0, 10 * time.Second
+	n, b, g, count := scheduleTraffic(t, rate, window, 1)
+	// 平均 Rate×window = 1000個、標準偏差は約32個
+	if want := int(rate * window.Seconds()); count < want*9/10 || count > want*11/10 {
+		t.Errorf("予約したパケット = %d, 期待値 %d±10%%", count, want)
+	}
+	start, end := SimulationEpoch.Add(time.Second), SimulationEpoch.Add(time.Second+window)
+	at := g.Scheduled()
+	if len(at) != count || !slices.IsSortedFunc(at, time.Time.Compare) || at[0].Before(start) || !at[len(at)-1].Before(end) {
+		t.Errorf("予約した時刻が区間 [1s, 11s) に昇順で並んでいない: %d 個", len(at))
+	}
+	runBus(t, n)
+	if g.Generated() != count || b.Stats.BytesReceived != int64(10*count) {
+		t.Errorf("送信したパケット = %d, Bが受信したバイト数 = %d, 期待値 %d, %d", g.Generated(), b.Stats.BytesReceived, count, 10*count)
+	}
+}
+
+func TestTrafficGeneratorRejectsInvalidRate(t *testing.T) {
+	if _, _, g, count := scheduleTraffic(t, 0, time.Second, 1); count != 0 || len(g.Scheduled()) != 0 {
+		t.Errorf("レート0で予約したパケット = %d, 期待値 0", count)
+	}
+	if _, _, _, count := scheduleTraffic(t, 10, 0, 1); count != 0 {
+		t.Errorf("区間0で予約したパケット = %d, 期待値 0", count)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+// PortHandlerは宛先ポートに届いたパケットを受け取るコールバック。
+type PortHandler func(p Packet)
+
+// TransportLayerはポート番号でアプリケーションへパケットを振り分けるトランスポート層を表す。
+type TransportLayer struct {
+	Name     string              // 層の名前（デバッグ用）
+	SrcPort  int                 // 送信パケットに既定で設定する送信元ポート
+	DstPort  int                 // 送信パケットに既定で設定する宛先ポート
+	Handlers map[int]PortHandler // 宛先ポートごとの受信ハンドラ
+	hostRef
+}
+
+// Registerは宛先ポートに受信ハンドラを登録。
+func (tl *TransportLayer) Register(port int, handler PortHandler) {
+	if tl.Handlers == nil {
+		tl.Handlers = make(map[int]PortHandler)
+	}
+	tl.Handlers[port] = handler
+}
+
+// HandleOutgoingはポート番号が未設定の送信パケットに既定のポートを設定。
+func (tl *TransportLayer) HandleOutgoing(p Packet) Packet {
+	if p.SrcPort == 0 {
+		p.SrcPort = tl.SrcPort
+	}
+	if p.DstPort == 0 {
+		p.DstPort = tl.DstPort
+	}
+	tl.log().Debugf("[Transport] %s: ポート %d -> %d へ送信中", tl.Name, p.SrcPort, p.DstPort) // トランスポート層の動作をログ
+	return p
+}
+
+// HandleIncomingは宛先ポートに登録されたハンドラへパケットを渡す。ハンドラのないポート宛てのパケットは破棄する。
+func (tl *TransportLayer) HandleIncoming(p Packet) (Packet, bool) {
+	handler, ok := tl.Handlers[p.DstPort]
+	if !ok {
+		tl.countDrop(DropPortUnreachable)
+		tl.log().Warnf("[Transport] %s: ポート %d は到達不能のためパケットを破棄: %s", tl.Name, p.DstPort, p)
+		return p, false
+	}
+	tl.log().Debugf("[Transport] %s: ポート %d のハンドラへ配送", tl.Name, p.DstPort)
+	handler(p)
+	return p, true
+}
+
+func (tl *TransportLayer) GetName() string {
+	return tl.Name
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// addTransportはホストのレイヤースタックの最上位にトランスポート層を追加する。
+func addTransport(h *Host, tl *TransportLayer) {
+	h.Layers = append(h.Layers, tl)
+	tl.bindHost(h)
+}
+
+func TestTransportDispatchesByPort(t *testing.T) {
+	n, a, b, _ := newTestLAN(t)
+	addTransport(a, &TransportLayer{Name: "Transport", SrcPort: 5000, DstPort: 80})
+	tl := &TransportLayer{Name: "Transport"}
+	addTransport(b, tl)
+	var web, dns []Packet
+	tl.Register(80, func(p Packet) { web = append(web, p) })
+	tl.Register(53, func(p Packet) { dns = append(dns, p) })
+
+	a.SendPacket(Packet{DstIP: "10.0.0.2", Data: []byte("GET /")}) // 既定の宛先ポート80
+	a.SendPacket(Packet{DstIP: "10.0.0.2", DstPort: 53, Data: []byte("query")})
+	n.Bus.Run()
+
+	if len(web) != 1 || string(web[0].Data) != "GET /" || web[0].SrcPort != 5000 {
+		t.Errorf("ポート80のハンドラが受け取ったパケット = %v", web)
+	}
+	if len(dns) != 1 || string(dns[0].Data) != "query" {
+		t.Errorf("ポート53のハンドラが受け取ったパケット = %v", dns)
+	}
+}
+
+func TestTransportPortUnreachable(t *testing.T) {
+	n, a, b, _ := newTestLAN(t)
+	var buf bytes.Buffer
+	n.SetLogger(NewWriterLogger(&buf, LevelWarn))
+	tl := &TransportLayer{Name: "Transport"}
+	addTransport(b, tl)
+	called := false
+	tl.Register(80, func(Packet) { called = true })
+	a.SendPacket(Packet{DstIP: "10.0.0.2", DstMAC: "AA:AA:AA:AA:AA:02", DstPort: 8080, Data: []byte("hello")})
+	n.Bus.Run()
+	if called {
+		t.Error("別のポートのハンドラが呼ばれた")
+	}
+	if !strings.Contains(buf.String(), "ポート 8080 は到達不能") {
+		t.Errorf("到達不能ポートの警告がない:\n%s", buf.String())
+	}
+}
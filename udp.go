@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// UDPLayerはポート番号とペイロードのチェックサムを扱うUDPの層を表す。
+// ポートによる振り分けはTransportLayerと同じで、チェックサムが一致しないデータグラムは破棄する。
+type UDPLayer struct {
+	TransportLayer
+}
+
+// udpChecksumはポート番号とペイロードに対するチェックサムを計算する。
+func udpChecksum(p Packet) uint16 {
+	b := make([]byte, 4, 4+len(p.Data))
+	binary.BigEndian.PutUint16(b[0:], uint16(p.SrcPort))
+	binary.BigEndian.PutUint16(b[2:], uint16(p.DstPort))
+	return internetChecksum(append(b, p.Data...))
+}
+
+// HandleOutgoingはRAWの送信パケットをUDPとして扱い、既定のポートとチェックサムを設定。
+func (ul *UDPLayer) HandleOutgoing(p Packet) Packet {
+	if p.Proto() != ProtocolRaw && p.Proto() != ProtocolUDP {
+		return p
+	}
+	p = ul.TransportLayer.HandleOutgoing(p)
+	p.Protocol = ProtocolUDP
+	p.Checksum = udpChecksum(p)
+	return p
+}
+
+// HandleIncomingは自分宛のUDPデータグラムのチェックサムを検証し、宛先ポートのハンドラへ渡す。
+func (ul *UDPLayer) HandleIncoming(p Packet) (Packet, bool) {
+	if p.Proto() != ProtocolUDP || (ul.host != nil && !ul.host.addressedToMe(p)) {
+		return p, true
+	}
+	if sum := udpChecksum(p); sum != p.Checksum {
+		ul.countDrop(DropChecksum)
+		ul.log().Warnf("[UDP] %s: チェックサムが一致しないため破棄 (0x%04x != 0x%04x): %s", ul.Name, p.Checksum, sum, p)
+		return p, false
+	}
+	return ul.TransportLayer.HandleIncoming(p)
+}
+
+// udpLayerはホストのレイヤースタックからUDP層を返す。
+func (h *Host) udpLayer() *UDPLayer {
+	for _, layer := range h.Layers {
+		if ul, ok := layer.(*UDPLayer); ok {
+			return ul
+		}
+	}
+	return nil
+}
+
+// UDPEchoServerは受信したデータグラムを同じペイロードで送信元へ返すアプリケーションを表す。
+type UDPEchoServer struct {
+	Host   *Host // サーバを動かすホスト
+	Port   int   // 待ち受けるポート番号
+	Echoed int   // 返送したデータグラム数
+}
+
+// NewUDPEchoServerはホストのUDP層のportにエコーサーバを登録する。
+func NewUDPEchoServer(h *Host, port int) (*UDPEchoServer, error) {
+	ul := h.udpLayer()
+	if ul == nil {
+		return nil, fmt.Errorf("ホスト %s にUDP層がありません", h.Name)
+	}
+	srv := &UDPEchoServer{Host: h, Port: port}
+	ul.Register(port, srv.handle)
+	return srv, nil
+}
+
+// handleは受信したデータグラムのポートを入れ替えて送信元へ返す。
+func (srv *UDPEchoServer) handle(p Packet) {
+	srv.Echoed++
+	srv.Host.Network.log().Debugf("[UDP] %s: %s:%d へエコー応答", srv.Host.Name, p.SrcIP, p.SrcPort)
+	srv.Host.SendPacket(Packet{
+		Data:     append([]byte(nil), p.Data...),
+		DstIP:    p.SrcIP,
+		DstMAC:   p.SrcMAC,
+		SrcPort:  p.DstPort,
+		DstPort:  p.SrcPort,
+		Protocol: ProtocolUDP,
+	})
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+)
+
+// addUDPはホストのレイヤースタックの最上位にUDP層を追加する。
+func addUDP(h *Host, ul *UDPLayer) {
+	h.Layers = append(h.Layers, ul)
+	ul.bindHost(h)
+}
+
+func TestUDPEchoServerReplies(t *testing.T) {
+	n, a, b, _ := newTestLAN(t)
+	client := &UDPLayer{TransportLayer{Name: "UDP", SrcPort: 5000}}
+	addUDP(a, client)
+	var replies []Packet
+	client.Register(5000, func(p Packet) { replies = append(replies, p) })
+	server := &UDPLayer{TransportLayer{Name: "UDP"}}
+	addUDP(b, server)
+	srv, err := NewUDPEchoServer(b, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := lanPacket(a, b, "echo me")
+	p.DstPort = 7
+	a.SendPacket(p)
+	n.Bus.Run()
+	if srv.Echoed != 1 {
+		t.Errorf("返送したデータグラム = %d, 期待値 1", srv.Echoed)
+	}
+	if len(replies) != 1 {
+		t.Fatalf("応答 = %d, 期待値 1", len(replies))
+	}
+	r := replies[0]
+	if string(r.Data) != "echo me" || r.SrcPort != 7 || r.DstPort != 5000 || r.Proto() != ProtocolUDP {
+		t.Errorf("応答 = %q %d -> %d (%v), 期待値 \"echo me\" 7 -> 5000 (UDP)", r.Data, r.SrcPort, r.DstPort, r.Proto())
+	}
+}
+
+func TestUDPDropsBadChecksum(t *testing.T) {
+	n, a, b, _ := newTestLAN(t)
+	ul := &UDPLayer{TransportLayer{Name: "UDP"}}
+	addUDP(b, ul)
+	srv, err := NewUDPEchoServer(b, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := lanPacket(a, b, "corrupt")
+	p.Protocol, p.SrcPort, p.DstPort = ProtocolUDP, 5000, 7
+	p.Checksum = udpChecksum(p) ^ 0xFFFF // AにはUDP層がないのでそのまま送られる
+	a.SendPacket(p)
+	n.Bus.Run()
+	if srv.Echoed != 0 {
+		t.Error("チェックサムが一致しないデータグラムに応答した")
+	}
+	if b.Stats.Dropped[DropChecksum] != 1 {
+		t.Errorf("チェックサム不一致の破棄 = %d, 期待値 1", b.Stats.Dropped[DropChecksum])
+	}
+}
+
+func TestUDPEchoServerRequiresUDPLayer(t *testing.T) {
+	b := newTestHost("B", "AA:AA:AA:AA:AA:02", "10.0.0.2")
+	if _, err := NewUDPEchoServer(b, 7); err == nil {
+		t.Error("UDP層のないホストでエラーにならない")
+	}
+}
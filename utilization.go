@@ -0,0 +1,77 @@
+package main
+
+import (
+	"time"
+)
+
+// DefaultSampleIntervalはリンクのSampleIntervalが未設定の場合に使う集計の区間。
+const DefaultSampleInterval = time.Millisecond
+
+// linkSampleはリンクがSampleIntervalの1区間に送出したデータの合計を表す。
+type linkSample struct {
+	At    time.Time // 区間の開始時刻
+	Bytes int       // 区間内に送出したデータのバイト数
+}
+
+// sampleIntervalは集計の区間を返す（未設定ならDefaultSampleInterval）。
+func (l *Link) sampleInterval() time.Duration {
+	if l.SampleInterval > 0 {
+		return l.SampleInterval
+	}
+	return DefaultSampleInterval
+}
+
+// recordSampleは時刻atに送出したbytesバイトを、その時刻を含む区間の合計に加える。
+// パケットごとではなく区間ごとに記録するため、長いシミュレーションでも記録は経過時間に比例する量に収まる。
+func (l *Link) recordSample(at time.Time, bytes int) {
+	interval := l.sampleInterval()
+	start := SimulationEpoch.Add(at.Sub(SimulationEpoch) / interval * interval)
+	if last := len(l.samples) - 1; last >= 0 && l.samples[last].At.Equal(start) {
+		l.samples[last].Bytes += bytes
+		return
+	}
+	l.samples = append(l.samples, linkSample{At: start, Bytes: bytes})
+}
+
+// bitsPerWindowは仮想時計の開始時刻から現在までをwindow毎に区切り、各区間に送出したビット数を返す。
+// パケットは送出を始めた時刻を含むSampleIntervalの区間の開始時刻で数えるため、
+// windowがSampleIntervalの倍数でなければ、境界付近のパケットは前の区間に数えることがある。
+func (l *Link) bitsPerWindow(window time.Duration) []int64 {
+	elapsed := l.Network.Bus.Now().Sub(SimulationEpoch)
+	buckets := make([]int64, int(elapsed/window)+1)
+	for _, s := range l.samples {
+		i := int(s.At.Sub(SimulationEpoch) / window)
+		if i >= 0 && i < len(buckets) {
+			buckets[i] += int64(s.Bytes) * 8
+		}
+	}
+	return buckets
+}
+
+// Utilizationはwindow毎の区間に送出したビット数を、帯域幅に対する割合で返す。
+// 帯域幅が無制限（0）の場合やwindowが0以下の場合はnilを返す。
+func (l *Link) Utilization(window time.Duration) []float64 {
+	if l.Bandwidth <= 0 || window <= 0 {
+		return nil
+	}
+	capacity := float64(l.Bandwidth) * window.Seconds()
+	buckets := l.bitsPerWindow(window)
+	util := make([]float64, len(buckets))
+	for i, bits := range buckets {
+		util[i] = float64(bits) / capacity
+	}
+	return util
+}
+
+// Throughputはwindow毎の区間のスループット（bps）を返す。windowが0以下の場合はnilを返す。
+func (l *Link) Throughput(window time.Duration) []float64 {
+	if window <= 0 {
+		return nil
+	}
+	buckets := l.bitsPerWindow(window)
+	bps := make([]float64, len(buckets))
+	for i, bits := range buckets {
+		bps[i] = float64(bits) / window.Seconds()
+	}
+	return bps
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUtilizationAndThroughput(t *testing.T) {
+	n, ab, _ := newTestQueuedLink(t, 1_000_000, 0)
+	for i := 0; i < 5; i++ {
+		ab.Transmit(queuedPacket(125, i+1))
+	}
+	n.Bus.AddEvent(15*time.Millisecond, func() { ab.Transmit(queuedPacket(125, 6)) })
+	n.Bus.Run()
+
+	util := ab.Utilization(10 * time.Millisecond)
+	if len(util) != 2 || util[0] != 0.5 || util[1] != 0.1 {
+		t.Errorf("Utilization(10ms) = %v, 期待値 [0.5 0.1]", util)
+	}
+	if bps := ab.Throughput(10 * time.Millisecond); len(bps) != 2 || bps[0] != 500_000 || bps[1] != 100_000 {
+		t.Errorf("Throughput(10ms) = %v, 期待値 [500000 100000]", bps)
+	}
+	if ab.Utilization(0) != nil || ab.Throughput(-time.Second) != nil {
+		t.Error("不正なwindowでnilを返さない")
+	}
+}
+
+func TestUtilizationUnlimitedBandwidth(t *testing.T) {
+	_, ab, _ := newTestQueuedLink(t, 0, 0)
+	if ab.Utilization(time.Millisecond) != nil {
+		t.Error("帯域幅が無制限のリンクで利用率を返す")
+	}
+}
+
+func TestUtilizationSamplesStayBounded(t *testing.T) {
+	n, ab, _ := newTestQueuedLink(t, 0, 0)
+	ab.SampleInterval = 10 * time.Millisecond
+	for i := 0; i < 1000; i++ {
+		n.Bus.AddEvent(time.Duration(i)*100*time.Microsecond, func() { ab.Transmit(queuedPacket(10, i)) })
+	}
+	runBus(t, n)
+	if len(ab.samples) != 10 {
+		t.Errorf("100msに1000個のパケットを送出した記録 = %d 件, 期待値 10 件（区間ごと）", len(ab.samples))
+	}
+	if bps := ab.Throughput(100 * time.Millisecond); bps[0] != 800_000 {
+		t.Errorf("Throughput(100ms)[0] = %v, 期待値 800000", bps[0])
+	}
+}
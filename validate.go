@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Validateが報告する誤りの種類。errors.Isで判別できる。
+var (
+	ErrDuplicateIP        = errors.New("IPアドレスが重複しています")
+	ErrDuplicateMAC       = errors.New("MACアドレスが重複しています")
+	ErrMissingHostLink    = errors.New("ホストの接続先へのリンクがありません")
+	ErrUnknownPortPeer    = errors.New("スイッチのポートの接続先がネットワークにありません")
+	ErrMissingReverseLink = errors.New("逆方向のリンクがありません")
+)
+
+// Validateはトポロジーの設定ミスを調べ、見つかった問題を全て返す（問題がなければnil）。
+// アドレスの重複、リンクのないホストの接続先、ネットワーク外のデバイスへのスイッチポート、
+// 逆方向のない片方向リンクを検出する。
+func (n *Network) Validate() []error {
+	var errs []error
+	members := make(map[Device]bool)
+	for _, d := range n.Devices {
+		members[d] = true
+	}
+
+	ipOwner := make(map[string]string)
+	macOwner := make(map[string]string)
+	claim := func(owners map[string]string, addr, name string, sentinel error) {
+		if addr == "" {
+			return
+		}
+		if prev, dup := owners[addr]; dup {
+			errs = append(errs, fmt.Errorf("%w: %s (%s と %s)", sentinel, addr, prev, name))
+			return
+		}
+		owners[addr] = name
+	}
+	for _, d := range n.Devices {
+		switch dev := d.(type) {
+		case *Host:
+			for _, nic := range dev.nics() {
+				if nl := nic.Network; nl != nil {
+					claim(ipOwner, nl.IP, dev.Name, ErrDuplicateIP)
+				}
+				if dl := nic.DataLink; dl != nil {
+					claim(macOwner, dl.MAC, dev.Name, ErrDuplicateMAC)
+				}
+				if _, ok := n.linkIndex[[2]Device{dev, nic.ConnectedDev}]; nic.ConnectedDev != nil && !ok {
+					errs = append(errs, fmt.Errorf("%w: %s -> %s", ErrMissingHostLink, dev.Name, nic.ConnectedDev.GetName()))
+				}
+			}
+		case *Router:
+			claim(ipOwner, dev.IP, dev.Name, ErrDuplicateIP)
+			for _, iface := range dev.Interfaces {
+				if iface.IP != dev.IP {
+					claim(ipOwner, iface.IP, dev.Name, ErrDuplicateIP)
+				}
+				claim(macOwner, iface.MAC, dev.Name, ErrDuplicateMAC)
+			}
+		case *DHCPServer:
+			claim(ipOwner, dev.IP, dev.Name, ErrDuplicateIP)
+			claim(macOwner, dev.MAC, dev.Name, ErrDuplicateMAC)
+		case *Switch:
+			for _, port := range dev.Ports {
+				if !members[port.Peer] {
+					errs = append(errs, fmt.Errorf("%w: %s のポート %d -> %s", ErrUnknownPortPeer, dev.Name, port.Number, port.Peer.GetName()))
+				}
+			}
+		}
+	}
+
+	for _, l := range n.Links {
+		if _, ok := n.linkIndex[[2]Device{l.To, l.From}]; !ok {
+			errs = append(errs, fmt.Errorf("%w: %s", ErrMissingReverseLink, l.Name()))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func(n *Network, a, b *Host, s *Switch)
+		want  []error  // 期待する誤りの種類（順番どおり）
+		text  []string // 期待するエラーメッセージ（順番どおり）
+	}{
+		{"問題のないトポロジー", func(*Network, *Host, *Host, *Switch) {}, nil, nil},
+		{
+			"IPアドレスの重複",
+			func(n *Network, a, b *Host, s *Switch) { b.networkLayer().IP = "10.0.0.1" },
+			[]error{ErrDuplicateIP},
+			[]string{"IPアドレスが重複しています: 10.0.0.1 (A と B)"},
+		},
+		{
+			"MACアドレスの重複",
+			func(n *Network, a, b *Host, s *Switch) { b.dataLinkLayer().MAC = "AA:AA:AA:AA:AA:01" },
+			[]error{ErrDuplicateMAC},
+			[]string{"MACアドレスが重複しています: AA:AA:AA:AA:AA:01 (A と B)"},
+		},
+		{
+			"リンクのない接続先",
+			func(n *Network, a, b *Host, s *Switch) {
+				c := newTestHost("C", "AA:AA:AA:AA:AA:03", "10.0.0.3")
+				c.ConnectedDev = s
+				n.AddDevice(c)
+			},
+			[]error{ErrMissingHostLink},
+			[]string{"ホストの接続先へのリンクがありません: C -> S"},
+		},
+		{
+			"ネットワーク外のデバイスへのポート",
+			func(n *Network, a, b *Host, s *Switch) { s.AddPort(&Switch{Name: "X"}, nil) },
+			[]error{ErrUnknownPortPeer},
+			[]string{"スイッチのポートの接続先がネットワークにありません: S のポート 3 -> X"},
+		},
+		{
+			"片方向のリンク",
+			func(n *Network, a, b *Host, s *Switch) { n.RemoveLink(s, b) },
+			[]error{ErrMissingReverseLink},
+			[]string{"逆方向のリンクがありません: B->S"},
+		},
+		{
+			"複数の問題",
+			func(n *Network, a, b *Host, s *Switch) {
+				b.networkLayer().IP = "10.0.0.1"
+				n.AddLink(a, b, time.Millisecond)
+			},
+			[]error{ErrDuplicateIP, ErrMissingReverseLink},
+			[]string{"IPアドレスが重複しています: 10.0.0.1 (A と B)", "逆方向のリンクがありません: A->B"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, a, b, s := newTestLAN(t)
+			tt.build(n, a, b, s)
+			errs := n.Validate()
+			if len(errs) != len(tt.want) {
+				t.Fatalf("Validate = %v, 期待値 %d 個の誤り", errs, len(tt.want))
+			}
+			for i, err := range errs {
+				if !errors.Is(err, tt.want[i]) || err.Error() != tt.text[i] {
+					t.Errorf("誤り %d = %q, 期待値 %q", i, err, tt.text[i])
+				}
+			}
+		})
+	}
+}
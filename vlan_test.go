@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// newTestVLANsはスイッチSのアクセスポートに、VLAN 10のホストA1・A2とVLAN 20のホストB1・B2を接続したネットワークを作る。
+func newTestVLANs(t *testing.T) (*Network, map[string]*Host, *Switch) {
+	n := newTestNetwork(t)
+	s := &Switch{Name: "S"}
+	n.AddDevice(s)
+	hosts := make(map[string]*Host)
+	for i, name := range []string{"A1", "A2", "B1", "B2"} {
+		h := newTestHost(name, fmt.Sprintf("AA:AA:AA:AA:AA:0%d", i+1), fmt.Sprintf("10.0.0.%d", i+1))
+		n.AddDevice(h)
+		n.AddBidirectionalLink(h, s, time.Millisecond)
+		s.PortTo(h).VLAN = 10 + 10*(i/2)
+		hosts[name] = h
+	}
+	return n, hosts, s
+}
+
+func TestVLANIsolation(t *testing.T) {
+	n, hosts, s := newTestVLANs(t)
+	recs := make(map[string]*recordLayer)
+	for name, h := range hosts {
+		recs[name] = record(h)
+	}
+
+	// 学習前のユニキャストと、ブロードキャストはどちらも同じVLAN内にだけフラッディングする
+	hosts["A1"].SendPacket(Packet{DstIP: "10.0.0.2", Data: []byte("same vlan")})
+	hosts["A1"].SendPacket(Packet{DstIP: "10.0.0.3", Data: []byte("other vlan")})
+	n.Bus.Run()
+	if got := recs["A2"].in; len(got) != 1 || string(got[0].Data) != "same vlan" {
+		t.Errorf("A2に届いたパケット = %v, 期待値 same vlan のみ", got)
+	}
+	for _, name := range []string{"B1", "B2"} {
+		if r := len(recs[name].in); r != 0 {
+			t.Errorf("VLAN 20 の %s がVLAN 10 のフレームを %d 個受信した", name, r)
+		}
+	}
+
+	// 学習済みでも別のVLANのポートへは転送しない
+	s.MACTable["AA:AA:AA:AA:AA:03"] = MACEntry{Port: s.PortTo(hosts["B1"]), LearnedAt: n.Bus.Now()}
+	hosts["A1"].SendPacket(lanPacket(hosts["A1"], hosts["B1"], "direct"))
+	n.Bus.Run()
+	if len(recs["B1"].in) != 0 {
+		t.Error("別のVLANのホストへ転送した")
+	}
+	if s.Stats.Dropped[DropVLANMismatch] != 1 {
+		t.Errorf("VLANの不一致による破棄 = %d, 期待値 1", s.Stats.Dropped[DropVLANMismatch])
+	}
+}
+
+func TestVLANAccessPortTagsFrames(t *testing.T) {
+	n, hosts, _ := newTestVLANs(t)
+	got := record(hosts["B2"])
+	hosts["B1"].SendPacket(lanPacket(hosts["B1"], hosts["B2"], "hello"))
+	n.Bus.Run()
+	if len(got.in) != 1 {
+		t.Fatalf("届いたパケット = %d, 期待値 1", len(got.in))
+	}
+	if v := got.in[0].VLAN; v != 20 {
+		t.Errorf("届いたフレームのVLAN = %d, 期待値 20", v)
+	}
+}
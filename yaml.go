@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// LoadTopologyYAMLはYAMLファイルからネットワーク構成を読み込み、ネットワークを構築。
+// キーはJSONのトポロジーファイルと同じで、知らないキーがあればエラーにする。
+// 読めるのはブロック形式のマッピングとシーケンス、スカラー値（引用符付きの文字列を含む）だけで、
+// フロー形式（{...}や[...]）やアンカー、複数行の文字列には対応しない。
+func LoadTopologyYAML(path string) (*Network, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("トポロジーファイルを読み込めません: %w", err)
+	}
+	doc, err := parseYAML(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("トポロジーファイル %s の解析に失敗: %w", path, err)
+	}
+	// 構造体への割り当てはJSONと同じタグで行う
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("トポロジーファイル %s の解析に失敗: %w", path, err)
+	}
+	cfg, err := decodeTopology(raw)
+	if err != nil {
+		return nil, fmt.Errorf("トポロジーファイル %s の解析に失敗: %w", path, err)
+	}
+	return cfg.Build()
+}
+
+// yamlLineはYAMLの空行とコメントを除いた1行を表す。
+type yamlLine struct {
+	no     int    // 行番号（エラー表示用）
+	indent int    // 先頭の空白の数
+	text   string // インデントと行末のコメントを除いた内容
+}
+
+// parseYAMLはYAMLの文書を、マッピングはmap[string]any、シーケンスは[]any、
+// スカラーは文字列、数値（json.Number）、真偽値、nilに変換する。
+func parseYAML(src string) (any, error) {
+	var lines []yamlLine
+	for i, raw := range strings.Split(src, "\n") {
+		text := strings.TrimRight(stripYAMLComment(raw), " \r")
+		trimmed := strings.TrimLeft(text, " ")
+		if trimmed == "" || trimmed == "---" {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("行 %d: インデントにタブは使えません", i+1)
+		}
+		lines = append(lines, yamlLine{no: i + 1, indent: len(text) - len(trimmed), text: trimmed})
+	}
+	if len(lines) == 0 {
+		return nil, nil
+	}
+	v, next, err := parseYAMLBlock(lines, 0, lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if next < len(lines) {
+		return nil, fmt.Errorf("行 %d: インデントが不正です", lines[next].no)
+	}
+	return v, nil
+}
+
+// parseYAMLBlockはlines[i]から始まるインデントindentのブロックを読み、値と次の行の位置を返す。
+func parseYAMLBlock(lines []yamlLine, i, indent int) (any, int, error) {
+	if isYAMLSeqItem(lines[i].text) {
+		return parseYAMLSeq(lines, i, indent)
+	}
+	return parseYAMLMap(lines, i, indent)
+}
+
+// parseYAMLSeqは「- 」で始まる行が並ぶシーケンスを読む。
+func parseYAMLSeq(lines []yamlLine, i, indent int) (any, int, error) {
+	seq := []any{}
+	for i < len(lines) && lines[i].indent == indent && isYAMLSeqItem(lines[i].text) {
+		rest := strings.TrimLeft(strings.TrimPrefix(lines[i].text, "-"), " ")
+		if rest == "" {
+			if i+1 >= len(lines) || lines[i+1].indent <= indent {
+				seq = append(seq, nil)
+				i++
+				continue
+			}
+			v, next, err := parseYAMLBlock(lines, i+1, lines[i+1].indent)
+			if err != nil {
+				return nil, 0, err
+			}
+			seq = append(seq, v)
+			i = next
+			continue
+		}
+		// 「- key: value」は要素の内容を「-」の後ろの位置にインデントした行として読む
+		inner := indent + len(lines[i].text) - len(rest)
+		if _, _, isKey := splitYAMLKey(rest); !isKey && !isYAMLSeqItem(rest) {
+			v, err := parseYAMLScalar(rest, lines[i].no)
+			if err != nil {
+				return nil, 0, err
+			}
+			seq = append(seq, v)
+			i++
+			continue
+		}
+		sub := append([]yamlLine{{no: lines[i].no, indent: inner, text: rest}}, lines[i+1:]...)
+		v, next, err := parseYAMLBlock(sub, 0, inner)
+		if err != nil {
+			return nil, 0, err
+		}
+		seq = append(seq, v)
+		i += next
+	}
+	if i < len(lines) && lines[i].indent > indent {
+		return nil, 0, fmt.Errorf("行 %d: インデントが不正です", lines[i].no)
+	}
+	return seq, i, nil
+}
+
+// parseYAMLMapは「key: value」の行が並ぶマッピングを読む。
+func parseYAMLMap(lines []yamlLine, i, indent int) (any, int, error) {
+	m := make(map[string]any)
+	for i < len(lines) && lines[i].indent == indent && !isYAMLSeqItem(lines[i].text) {
+		line := lines[i]
+		key, value, ok := splitYAMLKey(line.text)
+		if !ok {
+			return nil, 0, fmt.Errorf("行 %d: 「キー: 値」の形式ではありません: %s", line.no, line.text)
+		}
+		if _, dup := m[key]; dup {
+			return nil, 0, fmt.Errorf("行 %d: キー %q が重複しています", line.no, key)
+		}
+		i++
+		switch {
+		case value != "":
+			v, err := parseYAMLScalar(value, line.no)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[key] = v
+		case i < len(lines) && (lines[i].indent > indent || (lines[i].indent == indent && isYAMLSeqItem(lines[i].text))):
+			v, next, err := parseYAMLBlock(lines, i, lines[i].indent)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[key] = v
+			i = next
+		default:
+			m[key] = nil
+		}
+	}
+	if i < len(lines) && lines[i].indent > indent {
+		return nil, 0, fmt.Errorf("行 %d: インデントが不正です", lines[i].no)
+	}
+	return m, i, nil
+}
+
+// isYAMLSeqItemは行がシーケンスの要素（「-」だけか「- 」で始まる）かを返す。
+func isYAMLSeqItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// splitYAMLKeyは「key: value」の行をキーと値に分ける（引用符付きのキーにも対応）。
+// フロー形式の値はキーとして扱わない。
+func splitYAMLKey(text string) (key, value string, ok bool) {
+	if strings.HasPrefix(text, "{") || strings.HasPrefix(text, "[") {
+		return "", "", false
+	}
+	if text != "" && (text[0] == '"' || text[0] == '\'') {
+		end := strings.IndexByte(text[1:], text[0])
+		if end < 0 {
+			return "", "", false
+		}
+		key, text = text[1:end+1], text[end+2:]
+		if !strings.HasPrefix(text, ":") || (len(text) > 1 && text[1] != ' ') {
+			return "", "", false
+		}
+		return key, strings.TrimSpace(text[1:]), true
+	}
+	if k, ok := strings.CutSuffix(text, ":"); ok && !strings.Contains(k, ": ") {
+		return strings.TrimSpace(k), "", true
+	}
+	k, v, ok := strings.Cut(text, ": ")
+	if !ok {
+		return "", "", false
+	}
+	return strings.TrimSpace(k), strings.TrimSpace(v), true
+}
+
+// parseYAMLScalarはスカラー値を変換する。引用符で囲まれた値は常に文字列になる。
+func parseYAMLScalar(s string, no int) (any, error) {
+	switch {
+	case strings.HasPrefix(s, `"`):
+		v, err := strconv.Unquote(s)
+		if err != nil {
+			return nil, fmt.Errorf("行 %d: 不正な文字列 %s", no, s)
+		}
+		return v, nil
+	case strings.HasPrefix(s, "'"):
+		if len(s) < 2 || !strings.HasSuffix(s, "'") {
+			return nil, fmt.Errorf("行 %d: 不正な文字列 %s", no, s)
+		}
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	case strings.HasPrefix(s, "{") || strings.HasPrefix(s, "["):
+		return nil, fmt.Errorf("行 %d: フロー形式には対応していません: %s", no, s)
+	}
+	switch s {
+	case "~", "null":
+		return nil, nil
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	if (s[0] == '-' || (s[0] >= '0' && s[0] <= '9')) && json.Valid([]byte(s)) {
+		return json.Number(s), nil
+	}
+	return s, nil
+}
+
+// stripYAMLCommentは引用符の外にある「#」以降のコメントを取り除く。
+func stripYAMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want any
+	}{
+		{"空の文書", "# コメントだけ\n\n---\n", nil},
+		{"スカラー", "a: 1\nb: -2.5\nc: true\nd: false\ne: ~\nf: null\ng: text\nh:\n", map[string]any{
+			"a": json.Number("1"), "b": json.Number("-2.5"), "c": true, "d": false, "e": nil, "f": nil, "g": "text", "h": nil,
+		}},
+		{"数値に見えない値は文字列", "delay: 50ms\nip: 10.0.0.1\n", map[string]any{"delay": "50ms", "ip": "10.0.0.1"}},
+		{"入れ子のマッピング", "a:\n  b:\n    c: 1\n  d: 2\ne: 3\n", map[string]any{
+			"a": map[string]any{"b": map[string]any{"c": json.Number("1")}, "d": json.Number("2")}, "e": json.Number("3"),
+		}},
+		{"スカラーのシーケンス", "- 1\n- two\n- \"3\"\n", []any{json.Number("1"), "two", "3"}},
+		{"キーと同じインデントのシーケンス", "list:\n- a\n- b\nnext: c\n", map[string]any{"list": []any{"a", "b"}, "next": "c"}},
+		{"マッピングのシーケンス", "devices:\n  - type: host\n    name: A\n  - type: switch\n    name: S\n", map[string]any{
+			"devices": []any{map[string]any{"type": "host", "name": "A"}, map[string]any{"type": "switch", "name": "S"}},
+		}},
+		{"「-」だけの行の後の要素", "-\n  a: 1\n-\n", []any{map[string]any{"a": json.Number("1")}, nil}},
+		{"入れ子のシーケンス", "- - 1\n  - 2\n- 3\n", []any{[]any{json.Number("1"), json.Number("2")}, json.Number("3")}},
+		{"引用符", `a: "x: y # z"` + "\nb: 'it''s'\nc: \"tab\\t\"\n\"d e\": 1\n'f': \"true\"\n", map[string]any{
+			"a": "x: y # z", "b": "it's", "c": "tab\t", "d e": json.Number("1"), "f": "true",
+		}},
+		{"行末のコメント", "a: 1 # 説明\nb: x#y\n  # インデントしたコメント\nc: 2\n", map[string]any{
+			"a": json.Number("1"), "b": "x#y", "c": json.Number("2"),
+		}},
+		{"CRLFの改行", "a: 1\r\nb: 2\r\n", map[string]any{"a": json.Number("1"), "b": json.Number("2")}},
+		{"文書全体のインデント", "  a: 1\n  b: 2\n", map[string]any{"a": json.Number("1"), "b": json.Number("2")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseYAML(tt.src)
+			if err != nil {
+				t.Fatalf("parseYAML: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseYAML =\n %#v\n期待値\n %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string // エラーメッセージに含まれる文字列
+	}{
+		{"タブのインデント", "a:\n\tb: 1\n", "行 2: インデントにタブは使えません"},
+		{"深すぎるインデント", "a: 1\n    b: 2\n", "行 2: インデントが不正です"},
+		{"浅いインデントの後の深いインデント", "a:\n    b: 1\n  c: 2\n", "行 3: インデントが不正です"},
+		{"シーケンスの後の深いインデント", "- 1\n    - 2\n", "行 2: インデントが不正です"},
+		{"キーのない行", "a: 1\njust text\n", "行 2: 「キー: 値」の形式ではありません: just text"},
+		{"重複したキー", "a: 1\nb: 2\na: 3\n", "行 3: キー \"a\" が重複しています"},
+		{"閉じていない二重引用符", "a: \"abc\n", "行 1: 不正な文字列 \"abc"},
+		{"閉じていない一重引用符", "a: 'abc\n", "行 1: 不正な文字列 'abc"},
+		{"フロー形式のマッピング", "a: {b: 1}\n", "行 1: フロー形式には対応していません: {b: 1}"},
+		{"フロー形式のシーケンス", "a: [1, 2]\n", "行 1: フロー形式には対応していません: [1, 2]"},
+		{"シーケンスとマッピングの混在", "- a\nb: 1\n", "行 2: インデントが不正です"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseYAML(tt.src)
+			if err == nil {
+				t.Fatalf("エラーにならない")
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("エラー = %q, %q を含むことを期待", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadTopologyYAML(t *testing.T) {
+	path := writeTopologyFile(t, "lan.yaml", `
+# 2台のホストをスイッチでつなぐ
+devices:
+  - {type: host}
+`)
+	if _, err := LoadTopologyYAML(path); err == nil {
+		t.Error("フロー形式の要素でエラーにならない")
+	}
+
+	path = writeTopologyFile(t, "lan.yaml", `
+devices:
+  - type: host
+    name: A
+    ip: 10.0.0.1
+    mac: "AA:AA:AA:AA:AA:01"
+  - type: host
+    name: B
+    ip: 10.0.0.2
+    mac: "AA:AA:AA:AA:AA:02"
+  - type: switch
+    name: S
+links:
+  - from: A
+    to: S
+    delay: 2ms
+    bandwidth: 1000000
+    loss_rate: 0.25
+    jitter: 1ms
+  - from: S
+    to: B
+    delay: 3ms
+    mtu: 500
+    duplex: half
+`)
+	n, err := LoadTopologyYAML(path)
+	if err != nil {
+		t.Fatalf("LoadTopologyYAML: %v", err)
+	}
+	a, s, b := n.DeviceByName("A"), n.DeviceByName("S"), n.DeviceByName("B")
+	if a == nil || s == nil || b == nil {
+		t.Fatalf("デバイスが作成されていない: %v", n.Devices)
+	}
+	as := n.GetLink(a, s)
+	if as == nil || as.Bandwidth != 1000000 || as.LossRate != 0.25 || as.Delay.String() != "2ms" || as.Jitter.String() != "1ms" {
+		t.Errorf("A->S の設定 = %+v", as)
+	}
+	if sb := n.GetLink(s, b); sb == nil || sb.MTU != 500 || sb.Duplex != HalfDuplex {
+		t.Errorf("S->B の設定 = %+v", sb)
+	}
+}
+
+func TestLoadTopologyYAMLUnknownKey(t *testing.T) {
+	path := writeTopologyFile(t, "bad.yaml", "devices:\n  - type: host\n    name: A\n    adress: 10.0.0.1\n")
+	_, err := LoadTopologyYAML(path)
+	if err == nil || !strings.Contains(err.Error(), "adress") {
+		t.Errorf("知らないキーのエラー = %v", err)
+	}
+}